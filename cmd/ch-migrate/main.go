@@ -0,0 +1,58 @@
+// ch-migrate 执行或查看 ClickHouse 迁移
+//
+// 用法：
+//
+//	APP_ENV=prod go run ./cmd/ch-migrate up
+//	APP_ENV=prod go run ./cmd/ch-migrate status
+//
+// 服务启动时也会执行迁移，设置 CLICKHOUSE_MIGRATE_ON_START=false 时只能通过本命令执行
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"game-fun-be/internal/clickhouse"
+	"game-fun-be/internal/conf"
+	"game-fun-be/internal/pkg/util"
+
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	if len(os.Args) != 2 || (os.Args[1] != "up" && os.Args[1] != "status") {
+		fmt.Fprintln(os.Stderr, "usage: ch-migrate up|status")
+		os.Exit(2)
+	}
+
+	env := os.Getenv("APP_ENV")
+	if env == "" {
+		env = "debug"
+	}
+	if err := godotenv.Load(".env." + env); err != nil {
+		log.Fatalf("Error loading env file: %v", err)
+	}
+	conf.SetEnv(env)
+	util.BuildLogger(os.Getenv("LOG_LEVEL"))
+
+	clickhouse.ClickHouse()
+	defer clickhouse.CloseClickHouse()
+
+	if os.Args[1] == "up" {
+		applied, err := clickhouse.Migrate()
+		if err != nil {
+			log.Fatalf("Migrate failed after %d migrations: %v", applied, err)
+		}
+		fmt.Printf("applied %d migrations\n", applied)
+		return
+	}
+
+	statuses, err := clickhouse.GetMigrationStatuses()
+	if err != nil {
+		log.Fatalf("Get migration status failed: %v", err)
+	}
+	out, _ := json.MarshalIndent(statuses, "", "  ")
+	fmt.Println(string(out))
+}
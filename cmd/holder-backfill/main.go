@@ -0,0 +1,60 @@
+// holder-backfill 将持仓余额物化视图创建前的历史交易累加到钱包持仓余额
+//
+// 用法：
+//
+//	APP_ENV=prod go run ./cmd/holder-backfill -from 2024-01-01
+//
+// 持仓余额表由 ClickHouse 迁移 0003 创建，回填前先执行 go run ./cmd/ch-migrate up
+// 每天的数据使用固定的去重 token 写入，中断后以相同参数重新执行即可
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"game-fun-be/internal/clickhouse"
+	"game-fun-be/internal/conf"
+	"game-fun-be/internal/pkg/util"
+
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	from := flag.String("from", "", "回填开始日期（UTC），格式 2006-01-02")
+	to := flag.String("to", "", "回填结束日期（UTC，不含），为空时回填到物化视图创建时间")
+	flag.Parse()
+
+	start, err := time.Parse("2006-01-02", *from)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "usage: holder-backfill -from 2006-01-02 [-to 2006-01-02]")
+		os.Exit(2)
+	}
+	end := time.Now().UTC()
+	if *to != "" {
+		if end, err = time.Parse("2006-01-02", *to); err != nil {
+			log.Fatalf("invalid -to: %v", err)
+		}
+	}
+
+	env := os.Getenv("APP_ENV")
+	if env == "" {
+		env = "debug"
+	}
+	if err := godotenv.Load(".env." + env); err != nil {
+		log.Fatalf("Error loading env file: %v", err)
+	}
+	conf.SetEnv(env)
+	util.BuildLogger(os.Getenv("LOG_LEVEL"))
+
+	clickhouse.ClickHouse()
+	defer clickhouse.CloseClickHouse()
+
+	done, err := clickhouse.BackfillHolderBalances(start, end)
+	if err != nil {
+		log.Fatalf("Backfill failed, completed up to %s: %v", done.Format(time.RFC3339), err)
+	}
+	fmt.Printf("holder balances: backfilled [%s, %s)\n", start.Format(time.RFC3339), done.Format(time.RFC3339))
+}
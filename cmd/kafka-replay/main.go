@@ -0,0 +1,82 @@
+// kafka-replay 将采集的 Kafka 消息文件交给注册的处理器重新处理，用于复现线上问题
+//
+// 用法：
+//
+//	APP_ENV=test go run ./cmd/kafka-replay -sinks clickhouse,elasticsearch capture/market.raydium.swap.prod/2024101715.jsonl.gz
+//
+// 处理器写入 MySQL、Redis 等存储，运行前确认 .env.<APP_ENV> 指向测试环境
+// 处理器发送的 Kafka 消息写入内存，不会发送到真实 Kafka
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"game-fun-be/internal/clickhouse"
+	"game-fun-be/internal/conf"
+	"game-fun-be/internal/es"
+	"game-fun-be/internal/kafka"
+	"game-fun-be/internal/model"
+	"game-fun-be/internal/pkg/util"
+	"game-fun-be/internal/redis"
+
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	sinks := flag.String("sinks", "", "写入的下游存储，逗号分隔，可选 clickhouse、elasticsearch；为空时不写入")
+	batchSize := flag.Int("batch", 100, "批量处理器每批消息数")
+	flag.Parse()
+	if flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: kafka-replay [-sinks clickhouse,elasticsearch] [-batch 100] capture.jsonl.gz...")
+		os.Exit(2)
+	}
+
+	env := os.Getenv("APP_ENV")
+	if env == "" {
+		env = "debug"
+	}
+	if err := godotenv.Load(".env." + env); err != nil {
+		log.Fatalf("Error loading env file: %v", err)
+	}
+	conf.SetEnv(env)
+	util.BuildLogger(os.Getenv("LOG_LEVEL"))
+
+	model.Database(os.Getenv("MYSQL_DSN"))
+	if err := model.AddPointRecordsTxStatusColumn(); err != nil {
+		log.Fatalf("Failed to add point_records.tx_status column: %v", err)
+	}
+	redis.Redis()
+
+	enabled := []string{}
+	for _, sink := range strings.Split(*sinks, ",") {
+		switch sink = strings.TrimSpace(sink); sink {
+		case "":
+		case kafka.SinkClickHouse:
+			clickhouse.ClickHouse()
+			enabled = append(enabled, sink)
+		case kafka.SinkElasticsearch:
+			es.Elasticsearch()
+			enabled = append(enabled, sink)
+		default:
+			log.Fatalf("unknown sink: %s", sink)
+		}
+	}
+
+	kafka.SetProducer(kafka.NewMemoryBroker())
+
+	result, err := kafka.ReplayCapture(kafka.ReplayOptions{Sinks: enabled, BatchSize: *batchSize}, flag.Args()...)
+	if err != nil {
+		log.Fatalf("Replay failed: %v", err)
+	}
+
+	out, _ := json.MarshalIndent(result, "", "  ")
+	fmt.Println(string(out))
+	if result.Failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,68 @@
+// kline-backfill 将物化视图创建前的历史交易聚合写入预聚合 K 线视图
+//
+// 用法：
+//
+//	APP_ENV=prod go run ./cmd/kline-backfill -from 2024-01-01 -to 2024-10-01 -views 1s,1m,5m,1h,1d
+//
+// 视图由 ClickHouse 迁移 0002 创建，回填前先执行 go run ./cmd/ch-migrate up
+// 每天的数据使用固定的去重 token 写入，中断后以相同参数重新执行即可
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"game-fun-be/internal/clickhouse"
+	"game-fun-be/internal/conf"
+	"game-fun-be/internal/pkg/util"
+
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	from := flag.String("from", "", "回填开始日期（UTC），格式 2006-01-02")
+	to := flag.String("to", "", "回填结束日期（UTC，不含），为空时回填到物化视图创建时间")
+	views := flag.String("views", strings.Join(clickhouse.KlineViewNames(), ","), "回填的视图，逗号分隔")
+	flag.Parse()
+
+	start, err := time.Parse("2006-01-02", *from)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "usage: kline-backfill -from 2006-01-02 [-to 2006-01-02] [-views 1s,1m,5m,1h,1d]")
+		os.Exit(2)
+	}
+	end := time.Now().UTC()
+	if *to != "" {
+		if end, err = time.Parse("2006-01-02", *to); err != nil {
+			log.Fatalf("invalid -to: %v", err)
+		}
+	}
+
+	env := os.Getenv("APP_ENV")
+	if env == "" {
+		env = "debug"
+	}
+	if err := godotenv.Load(".env." + env); err != nil {
+		log.Fatalf("Error loading env file: %v", err)
+	}
+	conf.SetEnv(env)
+	util.BuildLogger(os.Getenv("LOG_LEVEL"))
+
+	clickhouse.ClickHouse()
+	defer clickhouse.CloseClickHouse()
+
+	for _, view := range strings.Split(*views, ",") {
+		view = strings.TrimSpace(view)
+		if view == "" {
+			continue
+		}
+		done, err := clickhouse.BackfillKlineView(view, start, end)
+		if err != nil {
+			log.Fatalf("Backfill failed, completed up to %s: %v", done.Format(time.RFC3339), err)
+		}
+		fmt.Printf("%s: backfilled [%s, %s)\n", view, start.Format(time.RFC3339), done.Format(time.RFC3339))
+	}
+}
@@ -1,12 +1,18 @@
 package api
 
 import (
+	"game-fun-be/internal/clickhouse"
+	"game-fun-be/internal/model"
 	"game-fun-be/internal/response"
 	"game-fun-be/internal/service"
 
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
 )
 
 type TokenHoldingsHandler struct {
@@ -22,7 +28,7 @@ func NewTokenHoldingsHandler(tokenHoldingsService *service.TokenHoldingsServiceI
 //   - Bearer: []
 //
 // @Summary 获取代币持仓数据
-// @Description 根据链类型、用户账户和目标账户获取代币持仓数据。支持的链类型：sol（Solana）、eth（Ethereum）、bsc（Binance Smart Chain）。
+// @Description 根据链类型、用户账户和目标账户获取代币持仓数据，包含按加权平均成本计算的已实现、未实现盈亏和收益率。支持的链类型：sol（Solana）、eth（Ethereum）、bsc（Binance Smart Chain）。
 // @Tags 代币持仓
 // @Accept json
 // @Produce json
@@ -59,7 +65,7 @@ func (h *TokenHoldingsHandler) TokenHoldings(c *gin.Context) {
 //   - Bearer: []
 //
 // @Summary 获取代币持仓历史数据
-// @Description 根据链类型和用户账户获取代币持仓历史数据。支持的链类型：sol（Solana）、eth（Ethereum）、bsc（Binance Smart Chain）。
+// @Description 根据链类型和用户账户获取交易过的代币及盈亏，按钱包动态（含游戏池交易）中的最后成交时间倒序。支持的链类型：sol（Solana）、eth（Ethereum）、bsc（Binance Smart Chain）。
 // @Tags 代币持仓
 // @Accept json
 // @Produce json
@@ -89,3 +95,92 @@ func (h *TokenHoldingsHandler) TokenHoldingsHistories(c *gin.Context) {
 	res := h.tokenHoldingsService.TokenHoldingsHistories(userAccount, page, limit, chainType)
 	c.JSON(res.Code, res)
 }
+
+// WalletActivities 获取钱包动态
+// @Summary 获取钱包在全部代币上的交易
+// @Description 合并链上交易和代理合约（游戏池）交易，按成交时间倒序游标分页，可按买卖方向、交易平台、最小成交金额和时间范围筛选。支持的链类型：sol（Solana）、eth（Ethereum）、bsc（Binance Smart Chain）。
+// @Tags 代币持仓
+// @Accept json
+// @Produce json
+// @Param chain_type path string true "链类型（sol、eth、bsc）"
+// @Param account path string true "钱包地址"
+// @Param side query string false "买卖方向（buy、sell）"
+// @Param platform query string false "交易平台，多个用逗号分隔（pump、raydium、game）"
+// @Param min_usd query string false "最小成交金额（美元）"
+// @Param start_time query int false "开始时间（秒级时间戳，包含）"
+// @Param end_time query int false "结束时间（秒级时间戳，不包含）"
+// @Param cursor query string false "分页游标，取上一页返回的 next_cursor"
+// @Param limit query int false "每页数量，最大 100" default(20)
+// @Success 200 {object} response.Response{data=response.WalletActivitiesResponse} "成功返回钱包动态"
+// @Failure 400 {object} response.Response "参数错误"
+// @Failure 500 {object} response.Response "服务器内部错误"
+// @Router /wallets/{chain_type}/activities/{account} [get]
+func (h *TokenHoldingsHandler) WalletActivities(c *gin.Context) {
+	account := c.Param("account")
+	if account == "" {
+		c.JSON(http.StatusBadRequest, response.Err(http.StatusBadRequest, "Account parameter is required", nil))
+		return
+	}
+	chainType, errResp := ParseChainTypeWithResponse(c)
+	if errResp != nil {
+		c.JSON(errResp.Code, errResp)
+		return
+	}
+
+	var filter clickhouse.WalletActivityFilter
+	switch c.Query("side") {
+	case "":
+	case "buy":
+		filter.TransactionType = uint8(model.TransactionTypeBuy)
+	case "sell":
+		filter.TransactionType = uint8(model.TransactionTypeSell)
+	default:
+		c.JSON(http.StatusBadRequest, response.Err(http.StatusBadRequest, "side must be buy or sell", nil))
+		return
+	}
+	if platforms := c.Query("platform"); platforms != "" {
+		for _, platform := range strings.Split(platforms, ",") {
+			if !clickhouse.IsValidActivityPlatform(platform) {
+				c.JSON(http.StatusBadRequest, response.Err(http.StatusBadRequest, "invalid platform: "+platform, nil))
+				return
+			}
+			filter.Platforms = append(filter.Platforms, platform)
+		}
+	}
+	if minUSD := c.Query("min_usd"); minUSD != "" {
+		value, err := decimal.NewFromString(minUSD)
+		if err != nil || value.IsNegative() {
+			c.JSON(http.StatusBadRequest, response.Err(http.StatusBadRequest, "invalid min_usd", err))
+			return
+		}
+		filter.MinUSD = value
+	}
+	for param, target := range map[string]*time.Time{"start_time": &filter.Start, "end_time": &filter.End} {
+		if value := c.Query(param); value != "" {
+			seconds, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || seconds < 0 {
+				c.JSON(http.StatusBadRequest, response.Err(http.StatusBadRequest, "invalid "+param, err))
+				return
+			}
+			*target = time.Unix(seconds, 0)
+		}
+	}
+
+	var cursor *clickhouse.WalletActivityCursor
+	if value := c.Query("cursor"); value != "" {
+		parsed, err := clickhouse.ParseWalletActivityCursor(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, response.Err(http.StatusBadRequest, "invalid cursor", err))
+			return
+		}
+		cursor = parsed
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit <= 0 || limit > 100 {
+		c.JSON(http.StatusBadRequest, response.Err(http.StatusBadRequest, "limit must be between 1 and 100", err))
+		return
+	}
+
+	res := h.tokenHoldingsService.WalletActivities(account, chainType, filter, cursor, limit)
+	c.JSON(res.Code, res)
+}
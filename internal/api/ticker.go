@@ -1,6 +1,9 @@
 package api
 
 import (
+	"fmt"
+	"game-fun-be/internal/clickhouse"
+	"game-fun-be/internal/model"
 	"game-fun-be/internal/request"
 	"game-fun-be/internal/response"
 	"game-fun-be/internal/service"
@@ -54,6 +57,53 @@ func (t *TickersHandler) Tickers(c *gin.Context) {
 	c.JSON(res.Code, res)
 }
 
+// TickerPointsStatisticSeries 获取平台币统计时间序列
+// @Summary 获取平台币手续费、回购、销毁和积分发放的时间序列
+// @Description 按小时或天聚合平台币的代理合约交易，返回每个周期的手续费、回购 SOL、回购和销毁的代币数量以及积分兑换数量，没有交易的周期补零。支持的链类型：sol（Solana）、eth（Ethereum）、bsc（Binance Smart Chain）。
+// @Tags 市场行情
+// @Accept json
+// @Produce json
+// @Param chain_type path string true "链类型（sol、eth、bsc）"
+// @Param ticker_address path string true "代币地址"
+// @Param interval query string false "周期（1h、1d）" default(1h)
+// @Param start_time query int false "开始时间（秒级时间戳），默认 1h 为 7 天前，1d 为 90 天前"
+// @Param end_time query int false "结束时间（秒级时间戳，不包含），默认当前时间"
+// @Success 200 {object} response.Response{data=response.PlatformTokenStatisticSeriesResponse} "成功返回统计时间序列"
+// @Failure 400 {object} response.Response "参数错误"
+// @Failure 500 {object} response.Response "服务器内部错误"
+// @Router /tickers/{chain_type}/statistic/{ticker_address}/series [get]
+func (t *TickersHandler) TickerPointsStatisticSeries(c *gin.Context) {
+	tickerAddress := c.Param("ticker_address")
+	if tickerAddress == "" {
+		c.JSON(http.StatusBadRequest, response.Err(http.StatusBadRequest, "ticker_address cannot be empty", errors.New("ticker_address is required")))
+		return
+	}
+	chainType, errResp := ParseChainTypeWithResponse(c)
+	if errResp != nil {
+		c.JSON(errResp.Code, errResp)
+		return
+	}
+	interval := c.DefaultQuery("interval", "1h")
+	if !service.IsValidPlatformStatisticInterval(interval) {
+		c.JSON(http.StatusBadRequest, response.Err(http.StatusBadRequest, "invalid interval", nil))
+		return
+	}
+	var start, end time.Time
+	for param, target := range map[string]*time.Time{"start_time": &start, "end_time": &end} {
+		if value := c.Query(param); value != "" {
+			seconds, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || seconds < 0 {
+				c.JSON(http.StatusBadRequest, response.Err(http.StatusBadRequest, "invalid "+param, err))
+				return
+			}
+			*target = time.Unix(seconds, 0)
+		}
+	}
+
+	res := t.platformTokenStatisticService.GetTokenPointsStatisticSeries(tickerAddress, uint8(chainType), interval, start, end)
+	c.JSON(res.Code, res)
+}
+
 // TickerDetail 获取 Ticker 详情
 // @Summary 获取 Ticker 详情
 // @Description 根据链类型和代币地址获取 Ticker 的详细信息。支持的链类型：sol（Solana）、eth（Ethereum）、bsc（Binance Smart Chain）。
@@ -114,7 +164,9 @@ func (t *TickersHandler) TickerPointsStatistic(c *gin.Context) {
 // @Produce json
 // @Param chain_type path string true "链类型（sol、eth、bsc）"
 // @Param ticker_address path string true "代币地址"
+// @Param source query string false "数据来源：chain 为链上交易，game 为游戏池（价格由池子储备计算）" default(chain)
 // @Success 200 {object} response.Response{data=response.GetTickerResponse} "成功返回 Ticker 详情"
+// @Failure 400 {object} response.Response "参数错误"
 // @Failure 500 {object} response.Response "服务器内部错误"
 // @Router /tickers/{chain_type}/market/{ticker_address} [get]
 func (t *TickersHandler) MarketTicker(c *gin.Context) {
@@ -128,7 +180,15 @@ func (t *TickersHandler) MarketTicker(c *gin.Context) {
 		c.JSON(errResp.Code, errResp)
 		return
 	}
-	res := t.tickerService.MarketTicker(tickerAddress, chainType)
+	var res response.Response
+	switch c.DefaultQuery("source", service.KlineSourceChain) {
+	case service.KlineSourceChain:
+		res = t.tickerService.MarketTicker(tickerAddress, chainType)
+	case service.KlineSourceGame:
+		res = t.tickerService.GameMarketTicker(tickerAddress, chainType)
+	default:
+		res = response.Err(http.StatusBadRequest, "invalid source", nil)
+	}
 	c.JSON(res.Code, res)
 }
 
@@ -185,6 +245,52 @@ func (t *TickersHandler) TokenDistribution(c *gin.Context) {
 	c.JSON(res.Code, res)
 }
 
+// TopTraders 获取代币交易者排行
+// @Summary 获取指定 Ticker 的交易者排行
+// @Description 根据时间窗口统计钱包的成交额、净买入、已实现盈亏和交易次数并排序，标记代币创建者（creator）和池子地址（pool）。支持的链类型：sol（Solana）、eth（Ethereum）、bsc（Binance Smart Chain）。
+// @Tags 市场行情
+// @Accept json
+// @Produce json
+// @Param chain_type path string true "链类型（sol、eth、bsc）"
+// @Param ticker_address path string true "代币地址"
+// @Param window query string false "时间窗口（5m、1h、6h、24h、7d、30d、all）" default(24h)
+// @Param sort_by query string false "排序字段（volume、net_buy、realized_pnl、trades）" default(volume)
+// @Param limit query int false "返回数量，最大 100" default(20)
+// @Success 200 {object} response.Response{data=response.TopTradersResponse} "成功返回交易者排行"
+// @Failure 400 {object} response.Response "参数错误"
+// @Failure 500 {object} response.Response "服务器内部错误"
+// @Router /tickers/{chain_type}/top_traders/{ticker_address} [get]
+func (t *TickersHandler) TopTraders(c *gin.Context) {
+	tickerAddress := c.Param("ticker_address")
+	if tickerAddress == "" {
+		c.JSON(http.StatusBadRequest, response.Err(http.StatusBadRequest, "ticker_address cannot be empty", errors.New("ticker_address is required")))
+		return
+	}
+	chainType, errResp := ParseChainTypeWithResponse(c)
+	if errResp != nil {
+		c.JSON(errResp.Code, errResp)
+		return
+	}
+	window := c.DefaultQuery("window", "24h")
+	if !service.IsValidTopTradersWindow(window) {
+		c.JSON(http.StatusBadRequest, response.Err(http.StatusBadRequest, "invalid window", nil))
+		return
+	}
+	sortBy := c.DefaultQuery("sort_by", clickhouse.TopTradersSortVolume)
+	if !clickhouse.IsValidTopTradersSort(sortBy) {
+		c.JSON(http.StatusBadRequest, response.Err(http.StatusBadRequest, "invalid sort_by", nil))
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit <= 0 || limit > 100 {
+		c.JSON(http.StatusBadRequest, response.Err(http.StatusBadRequest, "limit must be between 1 and 100", err))
+		return
+	}
+
+	res := t.tickerService.TopTraders(tickerAddress, chainType, window, sortBy, limit)
+	c.JSON(res.Code, res)
+}
+
 // SearchTickers 根据条件搜索 Tickers
 // @Summary 搜索 Tickers
 // @Description 根据链类型、搜索参数、分页参数等条件搜索 Tickers。支持的链类型：sol（Solana）、eth（Ethereum）、bsc（Binance Smart Chain）。
@@ -221,25 +327,31 @@ func (t *TickersHandler) SearchTickers(c *gin.Context) {
 
 // GetTokenKlines godoc
 // @Summary Get token kline data
-// @Description Get historical kline (candlestick) data for a specific token
+// @Description Get historical kline (candlestick) data for a specific token.
+// @Description The series is continuous: buckets without trades carry the previous close with zero volume.
 // @Tags kline-data
 // @Accept json
 // @Produce json
 // @Param klineType path string true "Kline type (kline for price data, mcapkline for market cap data)" Enums(kline, mcapkline)
 // @Param chainType path string true "Chain type" Enums(sol, eth, bsc)
 // @Param tokenAddress path string true "Token address"
-// @Param resolution query string true "Resolution of kline data" Enums(1S, 1, 5, 15, 60, 240, 720, 1D)
+// @Param resolution query string true "Resolution of kline data" Enums(1S, 1, 5, 15, 30, 60, 240, 720, 1D, 1W)
 // @Param from query integer true "Start timestamp in seconds"
 // @Param till query integer true "End timestamp in seconds"
+// @Param unit query string false "Price unit, defaults to mcap for mcapkline and usd otherwise" Enums(usd, sol, mcap)
+// @Param source query string false "Trade source: chain for on-chain pools, game for the game proxy pool priced from its reserves" Enums(chain, game) default(chain)
 // @Success 200 {object} response.Response{data=[]response.KlineData} "Success"
-// @Failure 400 {object} response.Response "Invalid parameters"
+// @Failure 400 {object} response.Response "Invalid parameters, or unit=mcap for a token without total supply"
 // @Failure 500 {object} response.Response "Server error"
 // @Router /klines/{klineType}/{chainType}/{tokenAddress} [get]
 func (t *TickersHandler) GetTokenKlines(c *gin.Context) {
-	// klineType := c.Param("klineType") TODO: 后续再支持链类型和klineType
-	// chainType := c.Param("chainType")
 	tokenAddress := c.Param("tokenAddress")
-	resolution := c.Query("resolution")
+
+	chainType := model.ChainTypeFromString(c.Param("chainType"))
+	if chainType == model.ChainTypeUnknown {
+		c.JSON(400, response.Err(response.CodeParamErr, "Invalid chain type", nil))
+		return
+	}
 
 	// 解析时间参数
 	startTs, err := strconv.ParseInt(c.Query("from"), 10, 64)
@@ -264,40 +376,52 @@ func (t *TickersHandler) GetTokenKlines(c *gin.Context) {
 	}
 
 	// 验证 resolution 参数
-	validResolutions := map[string]bool{
-		"1S":  true, // 1 second
-		"1":   true, // 1 minute
-		"5":   true, // 5 minutes
-		"15":  true, // 15 minutes
-		"60":  true, // 1 hour
-		"240": true, // 4 hours
-		"720": true, // 12 hours
-		"1D":  true, // 1 day
+	resolution, ok := clickhouse.ParseKlineResolution(c.Query("resolution"))
+	if !ok {
+		c.JSON(400, response.Err(response.CodeParamErr, "Invalid resolution", nil))
+		return
+	}
+	if resolution.BucketCount(start, end) > clickhouse.KlineMaxBuckets {
+		c.JSON(400, response.Err(response.CodeParamErr,
+			fmt.Sprintf("Time range too large for resolution %s, at most %d klines", resolution.Name, clickhouse.KlineMaxBuckets), nil))
+		return
 	}
 
-	resolution = strings.ToUpper(resolution)
-	if !validResolutions[resolution] {
-		c.JSON(400, response.Err(response.CodeParamErr, "Invalid resolution", nil))
+	// 价格单位，mcapkline 默认按市值
+	unit := strings.ToLower(c.Query("unit"))
+	if unit == "" {
+		unit = service.KlinePriceUnitUSD
+		if c.Param("klineType") == "mcapkline" {
+			unit = service.KlinePriceUnitMarketCap
+		}
+	}
+	if !service.IsValidKlinePriceUnit(unit) {
+		c.JSON(400, response.Err(response.CodeParamErr, "Invalid unit", nil))
+		return
+	}
+	source := c.DefaultQuery("source", service.KlineSourceChain)
+	if !service.IsValidKlineSource(source) {
+		c.JSON(400, response.Err(response.CodeParamErr, "Invalid source", nil))
 		return
 	}
 
 	// 调用 service 获取数据
 	klineService := service.NewKlineService()
-	klines, err := klineService.GetTokenKlines(tokenAddress, resolution, start, end)
+	klineDataList, err := klineService.GetTokenKlineData(tokenAddress, chainType.Uint8(), source, resolution, unit, start, end)
+	if errors.Is(err, service.ErrKlineSupplyUnavailable) {
+		c.JSON(400, response.Err(response.CodeParamErr, err.Error(), err))
+		return
+	}
 	if err != nil {
 		c.JSON(500, response.Err(response.CodeServerUnknown, err.Error(), err))
 		return
 	}
 
 	// 空数据处理
-	if len(klines) == 0 {
+	if len(klineDataList) == 0 {
 		c.JSON(200, response.BuildResponse([]response.KlineData{}, 200, "no data found", nil))
 		return
 	}
 
-	decimals := uint8(6) // FIXME: 暂时取 6 ，后续从token_info表中获取
-
-	// 转换为前端需要的格式
-	klineDataList := response.BuildKlineDataList(klines, decimals)
 	c.JSON(200, response.BuildResponse(klineDataList, 200, "success", nil))
 }
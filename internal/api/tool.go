@@ -1,13 +1,19 @@
 package api
 
 import (
+	"game-fun-be/internal/clickhouse"
 	"game-fun-be/internal/cron"
+	"game-fun-be/internal/kafka"
 	"game-fun-be/internal/pkg/util"
+	"game-fun-be/internal/request"
 	"game-fun-be/internal/response"
 	"game-fun-be/internal/service"
 
+	"net/http"
 	"strconv"
+	"time"
 
+	"github.com/IBM/sarama"
 	"github.com/gin-gonic/gin"
 )
 
@@ -61,3 +67,215 @@ func ResetTokenPoolInfo(c *gin.Context) {
 		Data: "任务已开始执行，请查看日志了解进度",
 	})
 }
+
+// ListDeadLetters 列出指定 topic 的死信消息
+// 查询参数: partition 死信分区(默认0)，offset 起始 offset(默认最早)，limit 条数(默认20)
+func ListDeadLetters(c *gin.Context) {
+	topic := c.Param("topic")
+	partition, err := strconv.ParseInt(c.DefaultQuery("partition", "0"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, response.ParamErr("invalid partition", err))
+		return
+	}
+	offset, err := strconv.ParseInt(c.DefaultQuery("offset", strconv.FormatInt(sarama.OffsetOldest, 10)), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, response.ParamErr("invalid offset", err))
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, response.ParamErr("invalid limit", err))
+		return
+	}
+
+	records, err := kafka.ListDeadLetters(topic, int32(partition), offset, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, response.Err(http.StatusInternalServerError, "list dead letters failed", err))
+		return
+	}
+	c.JSON(http.StatusOK, response.Success(records))
+}
+
+// ListQuarantined 列出指定 topic 中未通过 schema 校验而被隔离的消息
+// 查询参数: partition 隔离分区(默认0)，offset 起始 offset(默认最早)，limit 条数(默认20)
+func ListQuarantined(c *gin.Context) {
+	topic := c.Param("topic")
+	partition, err := strconv.ParseInt(c.DefaultQuery("partition", "0"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, response.ParamErr("invalid partition", err))
+		return
+	}
+	offset, err := strconv.ParseInt(c.DefaultQuery("offset", strconv.FormatInt(sarama.OffsetOldest, 10)), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, response.ParamErr("invalid offset", err))
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, response.ParamErr("invalid limit", err))
+		return
+	}
+
+	records, err := kafka.ListQuarantined(topic, int32(partition), offset, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, response.Err(http.StatusInternalServerError, "list quarantined messages failed", err))
+		return
+	}
+	c.JSON(http.StatusOK, response.Success(records))
+}
+
+// GetDeadLetter 查看单条死信消息
+func GetDeadLetter(c *gin.Context) {
+	topic, partition, offset, errResp := parseDeadLetterPosition(c)
+	if errResp != nil {
+		c.JSON(http.StatusBadRequest, errResp)
+		return
+	}
+
+	record, err := kafka.GetDeadLetter(topic, partition, offset)
+	if err != nil {
+		c.JSON(http.StatusNotFound, response.Err(http.StatusNotFound, "dead letter not found", err))
+		return
+	}
+	c.JSON(http.StatusOK, response.Success(record))
+}
+
+// ReplayDeadLetter 将单条死信重新交给原 topic 的处理器处理
+func ReplayDeadLetter(c *gin.Context) {
+	topic, partition, offset, errResp := parseDeadLetterPosition(c)
+	if errResp != nil {
+		c.JSON(http.StatusBadRequest, errResp)
+		return
+	}
+
+	record, err := kafka.ReplayDeadLetter(topic, partition, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, response.BuildResponse(record, http.StatusInternalServerError, "replay dead letter failed", err))
+		return
+	}
+	c.JSON(http.StatusOK, response.Success(record))
+}
+
+// parseDeadLetterPosition 解析死信所在的 topic、分区和 offset
+func parseDeadLetterPosition(c *gin.Context) (string, int32, int64, *response.Response) {
+	partition, err := strconv.ParseInt(c.Param("partition"), 10, 32)
+	if err != nil {
+		errResp := response.ParamErr("invalid partition", err)
+		return "", 0, 0, &errResp
+	}
+	offset, err := strconv.ParseInt(c.Param("offset"), 10, 64)
+	if err != nil {
+		errResp := response.ParamErr("invalid offset", err)
+		return "", 0, 0, &errResp
+	}
+	return c.Param("topic"), int32(partition), offset, nil
+}
+
+// KafkaDuplicateStats 查看各消息类型因幂等检查而跳过的重复消息数
+func KafkaDuplicateStats(c *gin.Context) {
+	stats, err := kafka.GetDuplicateStats()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, response.Err(response.CodeCacheError, "get duplicate stats failed", err))
+		return
+	}
+	c.JSON(http.StatusOK, response.Success(stats))
+}
+
+// KafkaSinkStatuses 查看消费者下游存储（ClickHouse、ES）的健康状态
+func KafkaSinkStatuses(c *gin.Context) {
+	c.JSON(http.StatusOK, response.Success(kafka.GetSinkStatuses()))
+}
+
+// ClickHouseWriterStatuses 查看 ClickHouse 缓冲写入器的缓冲行数和落盘批次
+func ClickHouseWriterStatuses(c *gin.Context) {
+	c.JSON(http.StatusOK, response.Success(clickhouse.GetBufferedWriterStatuses()))
+}
+
+// ClickHouseDuplicates 查询时间范围内重复写入 ClickHouse 的交易，start/end 为秒级时间戳，默认最近 24 小时
+func ClickHouseDuplicates(c *gin.Context) {
+	end := time.Now()
+	if v := c.Query("end"); v != "" {
+		ts, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, response.ParamErr("invalid end", err))
+			return
+		}
+		end = time.Unix(ts, 0)
+	}
+	start := end.Add(-24 * time.Hour)
+	if v := c.Query("start"); v != "" {
+		ts, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, response.ParamErr("invalid start", err))
+			return
+		}
+		start = time.Unix(ts, 0)
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, response.ParamErr("invalid limit", err))
+		return
+	}
+
+	duplicates, err := clickhouse.FindDuplicateTransactions(start, end, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, response.Err(response.CodeDBError, "query duplicate transactions failed", err))
+		return
+	}
+	c.JSON(http.StatusOK, response.Success(duplicates))
+}
+
+// StartBackfill 启动历史回填任务，从 Kafka 指定区间重建 ClickHouse / ES / MySQL 数据
+func StartBackfill(c *gin.Context) {
+	var req request.BackfillRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, response.ParamErr("invalid backfill request", err))
+		return
+	}
+
+	opts := kafka.BackfillOptions{
+		Topics:              req.Topics,
+		Sinks:               req.Sinks,
+		StartOffset:         req.StartOffset,
+		EndOffset:           req.EndOffset,
+		BatchSize:           req.BatchSize,
+		ClickHouseTruncated: req.ClickHouseTruncated,
+	}
+	if req.StartTime > 0 {
+		opts.StartTime = time.Unix(req.StartTime, 0)
+	}
+	if req.EndTime > 0 {
+		opts.EndTime = time.Unix(req.EndTime, 0)
+	}
+
+	job, err := kafka.StartBackfill(opts)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, response.Err(http.StatusBadRequest, "start backfill failed", err))
+		return
+	}
+	c.JSON(http.StatusOK, response.Success(job))
+}
+
+// ListBackfillJobs 列出回填任务及进度
+func ListBackfillJobs(c *gin.Context) {
+	c.JSON(http.StatusOK, response.Success(kafka.ListBackfillJobs()))
+}
+
+// GetBackfillJob 查看单个回填任务进度
+func GetBackfillJob(c *gin.Context) {
+	job, err := kafka.GetBackfillJob(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, response.Err(http.StatusNotFound, "backfill job not found", err))
+		return
+	}
+	c.JSON(http.StatusOK, response.Success(job))
+}
+
+// CancelBackfill 取消运行中的回填任务
+func CancelBackfill(c *gin.Context) {
+	if err := kafka.CancelBackfill(c.Param("id")); err != nil {
+		c.JSON(http.StatusNotFound, response.Err(http.StatusNotFound, "backfill job not found", err))
+		return
+	}
+	c.JSON(http.StatusOK, response.Success("backfill job cancelled"))
+}
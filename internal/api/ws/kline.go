@@ -1,6 +1,7 @@
 package ws
 
 import (
+	"game-fun-be/internal/clickhouse"
 	"game-fun-be/internal/pkg/util"
 	"game-fun-be/internal/response"
 	"game-fun-be/internal/service"
@@ -33,10 +34,16 @@ const (
 // @Accept  json
 // @Produce  json
 // @Param tokenAddress path string true "代币地址" example(8iFREvVdmLKxVeibpC5VLRr1S6X5dm7gYR3VCU1wpump)
-// @Param resolution query string true "K线周期" Enums(1S,1,5,15,60,240,720,1D) example(1S)
+// @Param resolution query string true "K线周期" Enums(1S,1,5,15,30,60,240,720,1D,1W) example(1S)
 // @Success 101 {object} response.KlineData{timestamp=int64,open=string,high=string,low=string,close=string,volume=string} "WebSocket连接成功后的推送数据格式"
 // @Router /api/v1/ws/kline/{tokenAddress} [get]
 func HandleKlineWS(c *gin.Context) {
+	resolution, ok := clickhouse.ParseKlineResolution(c.Query("resolution"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, response.Err(response.CodeParamErr, "Invalid resolution", nil))
+		return
+	}
+
 	ws, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		util.Log().Error("WebSocket upgrade failed: %v", err)
@@ -55,7 +62,7 @@ func HandleKlineWS(c *gin.Context) {
 	defer heartbeatTicker.Stop()
 
 	// 数据推送定时器
-	pushTicker := time.NewTicker(getUpdateInterval(c.Query("resolution")))
+	pushTicker := time.NewTicker(resolution.PushInterval)
 	defer pushTicker.Stop()
 
 	klineService := service.NewKlineService()
@@ -76,7 +83,7 @@ func HandleKlineWS(c *gin.Context) {
 	}
 
 	// 初始推送
-	if klineData, err := getLatestKlineData(klineService, c.Param("tokenAddress"), decimals); err == nil {
+	if klineData, err := getLatestKlineData(klineService, c.Param("tokenAddress"), resolution, decimals); err == nil {
 		lastPrice = klineData.Close.String()
 		if err := ws.WriteJSON(klineData); err != nil {
 			return
@@ -95,7 +102,7 @@ func HandleKlineWS(c *gin.Context) {
 			ws.SetWriteDeadline(time.Now().Add(readWriteTimeout))
 
 		case <-pushTicker.C: // 数据推送
-			klineData, err := getLatestKlineData(klineService, c.Param("tokenAddress"), decimals)
+			klineData, err := getLatestKlineData(klineService, c.Param("tokenAddress"), resolution, decimals)
 			if err != nil {
 				continue
 			}
@@ -115,11 +122,11 @@ func HandleKlineWS(c *gin.Context) {
 	}
 }
 
-// 获取最新K线数据
+// 获取指定周期最新K线数据
 func getLatestKlineData(klineService *service.KlineService, tokenAddress string,
-	decimals uint8) (*response.KlineData, error) {
+	resolution clickhouse.KlineResolution, decimals uint8) (*response.KlineData, error) {
 
-	latestKline, err := klineService.GetLatestKline(tokenAddress)
+	latestKline, err := klineService.GetLatestKline(tokenAddress, resolution)
 	if err != nil {
 		util.Log().Error("获取K线数据失败: %v", err)
 		return nil, err
@@ -128,26 +135,3 @@ func getLatestKlineData(klineService *service.KlineService, tokenAddress string,
 	klineData := response.BuildKlineData(*latestKline, decimals)
 	return &klineData, nil
 }
-
-func getUpdateInterval(resolution string) time.Duration {
-	switch resolution {
-	case "1S":
-		return time.Millisecond * 100
-	case "1":
-		return time.Millisecond * 100
-	case "5":
-		return time.Millisecond * 100
-	case "15":
-		return time.Millisecond * 200
-	case "60":
-		return time.Millisecond * 200
-	case "240":
-		return time.Millisecond * 200
-	case "720":
-		return time.Millisecond * 200
-	case "1D":
-		return time.Minute * 5
-	default:
-		return time.Second * 10
-	}
-}
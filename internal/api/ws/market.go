@@ -1,6 +1,7 @@
 package ws
 
 import (
+	"game-fun-be/internal/clickhouse"
 	"game-fun-be/internal/pkg/util"
 	"game-fun-be/internal/response"
 	"game-fun-be/internal/service"
@@ -57,13 +58,13 @@ func HandleMarketAnalyticsWS(c *gin.Context) {
 func getMarketAnalyticsData(klineService *service.KlineService, tokenAddress string,
 	decimals uint8) (*response.KlineData, error) {
 
-	interval := "60"
+	resolution, _ := clickhouse.ParseKlineResolution("60")
 	// 获取过去1天的数据
 	start := time.Now().AddDate(0, -1, 0)
 	// 获取当前时间
 	end := time.Now()
 
-	latestKlines, err := klineService.GetTokenKlines(tokenAddress, interval, start, end)
+	latestKlines, err := klineService.GetTokenKlines(tokenAddress, resolution, start, end)
 	if err != nil {
 		util.Log().Error("获取K线数据失败: %v", err)
 		return nil, err
@@ -72,7 +72,7 @@ func ClickHouse() {
 		util.Log().Info("ClickHouse版本: %s", version)
 	}
 
-	ClickHouseClient = conn
+	ClickHouseClient = &instrumentedConn{Conn: conn}
 }
 
 // 添加关闭函数
@@ -0,0 +1,100 @@
+package clickhouse
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"game-fun-be/internal/pkg/util"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+)
+
+// 写入去重依赖 insert_deduplication_token：相同 token 的写入在去重窗口内只生效一次
+// 本地表为 Replicated*MergeTree 时默认开启，非复制表需设置 non_replicated_deduplication_window
+// 新表在建表时设置，已有表由迁移 0004_dedup_window 补充
+
+// DuplicateTransaction 重复写入的交易
+type DuplicateTransaction struct {
+	TransactionHash string    `db:"transaction_hash" json:"transaction_hash"`
+	TokenAddress    string    `db:"token_address" json:"token_address"`
+	TransactionType uint8     `db:"transaction_type" json:"transaction_type"`
+	Copies          uint64    `db:"copies" json:"copies"`
+	FirstSeen       time.Time `db:"first_seen" json:"first_seen"`
+}
+
+// DedupToken 由写入来源和各行的唯一标识生成去重 token，同一批数据重试时 token 不变
+func DedupToken(source string, rowKeys []string) string {
+	h := sha1.New()
+	h.Write([]byte(source))
+	for _, key := range rowKeys {
+		h.Write([]byte{0})
+		h.Write([]byte(key))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// transactionRowKey 交易行的唯一标识，不含 MySQL 自增 ID，重试前后保持一致
+func transactionRowKey(tx *TokenTransactionCk) string {
+	return fmt.Sprintf("%s|%s|%s|%s|%d|%d|%d",
+		tx.TransactionHash, tx.TokenAddress, tx.PoolAddress, tx.UserAddress,
+		tx.BaseTokenAmount, tx.QuoteTokenAmount, tx.TransactionType)
+}
+
+// proxyTransactionRowKey 代理交易行的唯一标识
+func proxyTransactionRowKey(tx *ProxyTransaction) string {
+	return fmt.Sprintf("%s|%d|%d|%s", tx.TransactionHash, tx.ProxyType, tx.TransactionType, tx.TokenAddress)
+}
+
+// dedupContext 为写入附加 insert_deduplication_token
+func dedupContext(token string) context.Context {
+	return clickhouse.Context(context.Background(), clickhouse.WithSettings(clickhouse.Settings{
+		"insert_deduplication_token": token,
+	}))
+}
+
+// insertWithRetry 写入失败时按相同 token 重试，已成功写入的块会被 ClickHouse 去重
+func insertWithRetry(operation string, insert func() error) error {
+	attempts := util.GetEnvAsInt("CLICKHOUSE_INSERT_RETRIES", 3)
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if err = insert(); err == nil {
+			return nil
+		}
+		if attempt < attempts {
+			util.Log().Warning("ClickHouse %s failed (attempt %d/%d), retrying: %v", operation, attempt, attempts, err)
+			time.Sleep(time.Duration(attempt) * 500 * time.Millisecond)
+		}
+	}
+	return err
+}
+
+// FindDuplicateTransactions 查询时间范围内写入多次的交易
+func FindDuplicateTransactions(start, end time.Time, limit int) ([]DuplicateTransaction, error) {
+	var duplicates []DuplicateTransaction
+	err := ClickHouseClient.Select(context.Background(), &duplicates, `
+        SELECT
+            transaction_hash,
+            token_address,
+            transaction_type,
+            count() AS copies,
+            min(transaction_time) AS first_seen
+        FROM token_transaction_ck_new_all
+        WHERE transaction_time >= ? AND transaction_time < ?
+        GROUP BY transaction_hash, token_address, pool_address, user_address,
+            base_token_amount, quote_token_amount, transaction_type
+        HAVING copies > 1
+        ORDER BY copies DESC, first_seen
+        LIMIT ?
+    `, start, end, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query duplicate transactions failed: %w", err)
+	}
+	return duplicates, nil
+}
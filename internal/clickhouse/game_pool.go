@@ -0,0 +1,106 @@
+package clickhouse
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// gamePoolTrades 游戏池（代理合约外盘）的买卖及成交后按池子储备计算的代币 SOL 价格
+// 积分购买（gameIn）不记录储备，不参与价格计算
+const gamePoolTrades = `
+            SELECT
+                transaction_hash,
+                transaction_type,
+                base_token_amount,
+                quote_token_amount,
+                transaction_time,
+                toDecimal128(base_token_reserve_amount * exp10(toInt32(decimals) - 9) / quote_token_reserve_amount, 18) AS price_sol
+            FROM proxy_transaction_ck_all
+            WHERE chain_type = ?
+              AND token_address = ?
+              AND transaction_type IN (1, 2)
+              AND base_token_reserve_amount > 0
+              AND quote_token_reserve_amount > 0`
+
+// GetGameKlines 查询游戏池 [start, end) 内的K线，价格为代币的 SOL 价格，返回连续序列
+func GetGameKlines(chainType uint8, tokenAddress string, resolution KlineResolution, start, end time.Time) ([]Kline, error) {
+	bucketStart := resolution.BucketStart(start)
+	var klines []Kline
+	err := ClickHouseClient.Select(context.Background(), &klines, fmt.Sprintf(`
+        SELECT
+            ? AS token_address,
+            %s AS interval_timestamp,
+            argMin(price_sol, (transaction_time, transaction_hash)) AS open_price,
+            max(price_sol) AS high_price,
+            min(price_sol) AS low_price,
+            argMax(price_sol, (transaction_time, transaction_hash)) AS close_price,
+            sum(quote_token_amount) AS volume,
+            count() AS trades_count,
+            countIf(transaction_type = 1) AS buy_count,
+            countIf(transaction_type = 2) AS sell_count,
+            sumIf(quote_token_amount, transaction_type = 1) AS buy_volume,
+            sumIf(quote_token_amount, transaction_type = 2) AS sell_volume,
+            sum(base_token_amount) AS base_volume
+        FROM (%s
+              AND transaction_time >= ?
+              AND transaction_time < ?
+        )
+        GROUP BY interval_timestamp
+        ORDER BY interval_timestamp
+    `, resolution.bucketExpr("transaction_time"), gamePoolTrades), tokenAddress, chainType, tokenAddress, bucketStart, end)
+	if err != nil {
+		return nil, fmt.Errorf("query game klines failed: %w", err)
+	}
+
+	var prevClose decimal.Decimal
+	err = ClickHouseClient.QueryRow(context.Background(), `
+        SELECT argMax(price_sol, (transaction_time, transaction_hash))
+        FROM (`+gamePoolTrades+`
+              AND transaction_time < ?
+        )
+    `, chainType, tokenAddress, bucketStart).Scan(&prevClose)
+	if err != nil {
+		return nil, fmt.Errorf("query game previous close failed: %w", err)
+	}
+	return FillKlineGaps(klines, tokenAddress, resolution, start, end, prevClose), nil
+}
+
+// GameWindowStats 游戏池在最近一个时间窗口内的成交统计，数量为代币最小单位
+type GameWindowStats struct {
+	Seconds       int64           `db:"window_seconds"`
+	StartPriceSOL decimal.Decimal `db:"start_price"` // 窗口开始前最后的 SOL 价格，没有时为零
+	BuyCount      uint64          `db:"buy_count"`
+	SellCount     uint64          `db:"sell_count"`
+	BuyVolume     uint64          `db:"buy_volume"`
+	SellVolume    uint64          `db:"sell_volume"`
+	PriceSOL      decimal.Decimal `db:"last_price"` // 最新 SOL 价格，各窗口相同
+	LastTradeTime time.Time       `db:"last_trade_time"`
+}
+
+// GetGameMarketStats 按 windows（秒）统计游戏池最近的成交，没有成交时返回空
+func GetGameMarketStats(chainType uint8, tokenAddress string, windows []int64) ([]GameWindowStats, error) {
+	var stats []GameWindowStats
+	err := ClickHouseClient.Select(context.Background(), &stats, `
+        SELECT
+            w AS window_seconds,
+            argMaxIf(price_sol, (transaction_time, transaction_hash), transaction_time < now() - toIntervalSecond(w)) AS start_price,
+            countIf(transaction_type = 1 AND transaction_time >= now() - toIntervalSecond(w)) AS buy_count,
+            countIf(transaction_type = 2 AND transaction_time >= now() - toIntervalSecond(w)) AS sell_count,
+            sumIf(quote_token_amount, transaction_type = 1 AND transaction_time >= now() - toIntervalSecond(w)) AS buy_volume,
+            sumIf(quote_token_amount, transaction_type = 2 AND transaction_time >= now() - toIntervalSecond(w)) AS sell_volume,
+            argMax(price_sol, (transaction_time, transaction_hash)) AS last_price,
+            max(transaction_time) AS last_trade_time
+        FROM (`+gamePoolTrades+`
+        )
+        ARRAY JOIN CAST(? AS Array(Int64)) AS w
+        GROUP BY w
+        ORDER BY w
+    `, chainType, tokenAddress, windows)
+	if err != nil {
+		return nil, fmt.Errorf("query game market stats failed: %w", err)
+	}
+	return stats, nil
+}
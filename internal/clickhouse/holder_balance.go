@@ -0,0 +1,120 @@
+package clickhouse
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// HolderBalance 钱包持仓余额（代币最小单位）
+type HolderBalance struct {
+	UserAddress   string
+	Balance       decimal.Decimal
+	LastTradeTime time.Time
+}
+
+// HolderStats 代币持仓统计（代币最小单位）
+type HolderStats struct {
+	Holders     uint64
+	Top10Amount decimal.Decimal
+	DevAmount   decimal.Decimal
+}
+
+// holderBalancesQuery 每个钱包的当前余额，只保留余额为正的钱包
+const holderBalancesQuery = `
+            SELECT user_address, sum(balance) AS balance, max(last_trade_time) AS last_trade_time
+            FROM token_holder_balance_all
+            WHERE chain_type = ?
+              AND token_address = ?
+            GROUP BY user_address
+            HAVING balance > 0`
+
+// GetTopHolders 按余额倒序返回前 limit 个持有者
+func GetTopHolders(chainType uint8, tokenAddress string, limit int) ([]HolderBalance, error) {
+	rows, err := ClickHouseClient.Query(context.Background(), holderBalancesQuery+`
+            ORDER BY balance DESC, user_address
+            LIMIT ?`, chainType, tokenAddress, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query top holders failed: %w", err)
+	}
+	defer rows.Close()
+
+	var holders []HolderBalance
+	for rows.Next() {
+		var h HolderBalance
+		var balance big.Int
+		if err := rows.Scan(&h.UserAddress, &balance, &h.LastTradeTime); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		h.Balance = decimal.NewFromBigInt(&balance, 0)
+		holders = append(holders, h)
+	}
+	return holders, rows.Err()
+}
+
+// GetHolderStats 返回持有者数量、前 10 持有者和开发者的持仓数量，devAddress 为空时开发者持仓为零
+func GetHolderStats(chainType uint8, tokenAddress, devAddress string) (*HolderStats, error) {
+	var holders uint64
+	var top10, dev big.Int
+	err := ClickHouseClient.QueryRow(context.Background(), `
+        SELECT
+            count() AS holders,
+            toInt128(arraySum(arraySlice(arrayReverseSort(groupArray(balance)), 1, 10))) AS top10,
+            toInt128(sumIf(balance, user_address = ?)) AS dev
+        FROM (`+holderBalancesQuery+`
+        )
+    `, devAddress, chainType, tokenAddress).Scan(&holders, &top10, &dev)
+	if err != nil {
+		return nil, fmt.Errorf("query holder stats failed: %w", err)
+	}
+	return &HolderStats{
+		Holders:     holders,
+		Top10Amount: decimal.NewFromBigInt(&top10, 0),
+		DevAmount:   decimal.NewFromBigInt(&dev, 0),
+	}, nil
+}
+
+// GetRecentlyTradedTokens 返回 since 之后有买卖的代币
+func GetRecentlyTradedTokens(chainType uint8, since time.Time) ([]string, error) {
+	var tokens []string
+	rows, err := ClickHouseClient.Query(context.Background(), `
+        SELECT DISTINCT token_address
+        FROM token_transaction_ck_new_all
+        WHERE chain_type = ?
+          AND transaction_type IN (1, 2)
+          AND transaction_time >= ?
+    `, chainType, since)
+	if err != nil {
+		return nil, fmt.Errorf("query recently traded tokens failed: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var token string
+		if err := rows.Scan(&token); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+// BackfillHolderBalances 将 [from, to) 的历史交易累加到持仓余额
+func BackfillHolderBalances(from, to time.Time) (time.Time, error) {
+	query := `
+        INSERT INTO token_holder_balance_all
+        SELECT
+            chain_type,
+            token_address,
+            user_address,
+            sum(if(transaction_type = 1, toInt128(quote_token_amount), -toInt128(quote_token_amount))) AS balance,
+            max(toDateTime(transaction_time)) AS last_trade_time
+        FROM token_transaction_ck_new_all
+        WHERE transaction_type IN (1, 2)
+          AND transaction_time >= ? AND transaction_time < ?
+        GROUP BY chain_type, token_address, user_address`
+	return backfillByDay("holder-backfill", "token_holder_balance_mv", query, from, to)
+}
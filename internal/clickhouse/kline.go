@@ -0,0 +1,160 @@
+package clickhouse
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// KlineMaxBuckets 单次查询最多返回的 K 线数量
+const KlineMaxBuckets = 5000
+
+// KlineResolution K 线周期
+type KlineResolution struct {
+	Name         string        // 接口参数，如 1S、5、1D
+	Seconds      int64         // 周期长度
+	PushInterval time.Duration // WebSocket 推送最新 K 线的间隔
+}
+
+// klineResolutions 支持的 K 线周期，REST 和 WebSocket 接口共用
+var klineResolutions = []KlineResolution{
+	{Name: "1S", Seconds: 1, PushInterval: 100 * time.Millisecond},
+	{Name: "1", Seconds: 60, PushInterval: 100 * time.Millisecond},
+	{Name: "5", Seconds: 300, PushInterval: 100 * time.Millisecond},
+	{Name: "15", Seconds: 900, PushInterval: 200 * time.Millisecond},
+	{Name: "30", Seconds: 1800, PushInterval: 200 * time.Millisecond},
+	{Name: "60", Seconds: 3600, PushInterval: 200 * time.Millisecond},
+	{Name: "240", Seconds: 14400, PushInterval: 200 * time.Millisecond},
+	{Name: "720", Seconds: 43200, PushInterval: 200 * time.Millisecond},
+	{Name: "1D", Seconds: 86400, PushInterval: 5 * time.Minute},
+	{Name: "1W", Seconds: 604800, PushInterval: 5 * time.Minute},
+}
+
+// ParseKlineResolution 解析 K 线周期参数，不区分大小写
+func ParseKlineResolution(name string) (KlineResolution, bool) {
+	name = strings.ToUpper(name)
+	for _, r := range klineResolutions {
+		if r.Name == name {
+			return r, true
+		}
+	}
+	return KlineResolution{}, false
+}
+
+// KlineResolutionNames 返回支持的周期参数列表
+func KlineResolutionNames() []string {
+	names := make([]string, 0, len(klineResolutions))
+	for _, r := range klineResolutions {
+		names = append(names, r.Name)
+	}
+	return names
+}
+
+// bucketExpr 返回 ClickHouse 中的分桶表达式，周线按 UTC 周一对齐，其余按周期秒数对齐
+// 周线显式指定 UTC，避免服务端时区不同时与 BucketStart 补齐的桶错位
+func (r KlineResolution) bucketExpr(column string) string {
+	if r.Name == "1W" {
+		return fmt.Sprintf("toDateTime(toMonday(%s, 'UTC'), 'UTC')", column)
+	}
+	return fmt.Sprintf("toStartOfInterval(%s, INTERVAL %d second)", column, r.Seconds)
+}
+
+// BucketStart 返回 t 所在周期的开始时间（UTC）
+func (r KlineResolution) BucketStart(t time.Time) time.Time {
+	t = t.UTC()
+	if r.Name == "1W" {
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		offset := (int(day.Weekday()) + 6) % 7 // 距离周一的天数
+		return day.AddDate(0, 0, -offset)
+	}
+	unix := t.Unix()
+	return time.Unix(unix-unix%r.Seconds, 0).UTC()
+}
+
+// BucketCount 返回 [start, end) 覆盖的周期数
+func (r KlineResolution) BucketCount(start, end time.Time) int64 {
+	if !end.After(start) {
+		return 0
+	}
+	return (end.Unix() - r.BucketStart(start).Unix() + r.Seconds - 1) / r.Seconds
+}
+
+// FillKlineGaps 补齐 [start, end) 内没有成交的周期，空周期的开高低收均为上一周期的收盘价
+// prevClose 为 start 之前最后的收盘价，为零时代币在 start 前没有成交，首个成交周期之前不补齐
+func FillKlineGaps(klines []Kline, tokenAddress string, r KlineResolution, start, end time.Time, prevClose decimal.Decimal) []Kline {
+	step := time.Duration(r.Seconds) * time.Second
+	filled := make([]Kline, 0, r.BucketCount(start, end))
+
+	next := 0
+	for bucket := r.BucketStart(start); bucket.Before(end); bucket = bucket.Add(step) {
+		if next < len(klines) && !klines[next].IntervalTimestamp.After(bucket) {
+			k := klines[next]
+			next++
+			k.IntervalTimestamp = bucket
+			filled = append(filled, k)
+			prevClose = k.ClosePrice
+			continue
+		}
+		if prevClose.IsZero() {
+			continue
+		}
+		filled = append(filled, Kline{
+			TokenAddress:      tokenAddress,
+			IntervalTimestamp: bucket,
+			OpenPrice:         prevClose,
+			HighPrice:         prevClose,
+			LowPrice:          prevClose,
+			ClosePrice:        prevClose,
+		})
+	}
+	return filled
+}
+
+// hourlySolPriceQuery 每小时最后一笔成交时的 SOL 美元价格（不区分代币），读取 1h 预聚合视图，where 限定 bucket 范围
+func hourlySolPriceQuery(where string) string {
+	return fmt.Sprintf(`
+                SELECT bucket, argMaxMerge(sol_price_state) AS sol_price
+                FROM %s
+                WHERE %s
+                GROUP BY bucket`, KlineResolution{Seconds: 3600}.view().table(), where)
+}
+
+// GetKlineSolPrices 查询各周期最后一笔成交时的 SOL 美元价格，key 为周期开始时间的秒级时间戳
+// tokenAddress 为空时取全部代币中最后一笔成交，用于没有链上交易的代币（如游戏池）
+func GetKlineSolPrices(tokenAddress string, r KlineResolution, start, end time.Time) (map[int64]decimal.Decimal, error) {
+	v := r.view()
+	where := "1 = 1"
+	args := []any{r.BucketStart(start), end}
+	if tokenAddress != "" {
+		where = "token_address = ?"
+		args = append([]any{tokenAddress}, args...)
+	}
+	rows, err := ClickHouseClient.Query(context.Background(), fmt.Sprintf(`
+        SELECT
+            %s AS interval_timestamp,
+            argMaxMerge(sol_price_state) AS sol_price
+        FROM %s
+        WHERE %s
+          AND bucket >= ?
+          AND bucket < ?
+        GROUP BY interval_timestamp
+    `, r.bucketExpr("bucket"), v.table(), where), args...)
+	if err != nil {
+		return nil, fmt.Errorf("query sol prices failed: %w", err)
+	}
+	defer rows.Close()
+
+	prices := make(map[int64]decimal.Decimal)
+	for rows.Next() {
+		var bucket time.Time
+		var price decimal.Decimal
+		if err := rows.Scan(&bucket, &price); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		prices[bucket.Unix()] = price
+	}
+	return prices, rows.Err()
+}
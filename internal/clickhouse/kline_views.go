@@ -0,0 +1,256 @@
+package clickhouse
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"game-fun-be/internal/pkg/util"
+
+	"github.com/shopspring/decimal"
+)
+
+// klineView 预聚合 K 线视图，每个周期一张 AggregatingMergeTree 表和一个写入它的物化视图
+type klineView struct {
+	Name    string // 表名后缀，如 1s、5m
+	Seconds int64  // 聚合周期
+}
+
+// klineViews 预聚合的周期，按周期从小到大排列
+var klineViews = []klineView{
+	{Name: "1s", Seconds: 1},
+	{Name: "1m", Seconds: 60},
+	{Name: "5m", Seconds: 300},
+	{Name: "1h", Seconds: 3600},
+	{Name: "1d", Seconds: 86400},
+}
+
+// 交易表，物化视图监听本地表，回填读取分布式表
+const (
+	klineSourceTable      = "token_transaction_ck_new_all"
+	klineSourceLocalTable = "token_transaction_ck_new"
+)
+
+// klineMergeColumns 从预聚合表读取开高低收和成交量的列，需配合 GROUP BY 使用
+const klineMergeColumns = `
+            argMinMerge(open_state) AS open_price,
+            maxMerge(high_state) AS high_price,
+            minMerge(low_state) AS low_price,
+            argMaxMerge(close_state) AS close_price,
+            sum(volume) AS volume,
+            sum(trades_count) AS trades_count,
+            sum(buy_count) AS buy_count,
+            sum(sell_count) AS sell_count,
+            sum(buy_volume) AS buy_volume,
+            sum(sell_volume) AS sell_volume,
+            sum(base_volume) AS base_volume`
+
+// localTable 存放聚合状态的本地表
+func (v klineView) localTable() string {
+	return "token_kline_agg_" + v.Name
+}
+
+// table 查询和回填使用的分布式表
+func (v klineView) table() string {
+	return v.localTable() + "_all"
+}
+
+// mvName 物化视图名
+func (v klineView) mvName() string {
+	return v.localTable() + "_mv"
+}
+
+// view 返回查询该周期使用的预聚合视图：周期能被整除的最大视图，如 30 分钟使用 5m，周线使用 1d
+func (r KlineResolution) view() klineView {
+	selected := klineViews[0]
+	for _, v := range klineViews {
+		if r.Seconds%v.Seconds == 0 {
+			selected = v
+		}
+	}
+	return selected
+}
+
+// klineViewByName 按名称查找预聚合视图
+func klineViewByName(name string) (klineView, bool) {
+	for _, v := range klineViews {
+		if v.Name == strings.ToLower(name) {
+			return v, true
+		}
+	}
+	return klineView{}, false
+}
+
+// KlineViewNames 返回预聚合视图名称列表
+func KlineViewNames() []string {
+	names := make([]string, 0, len(klineViews))
+	for _, v := range klineViews {
+		names = append(names, v.Name)
+	}
+	return names
+}
+
+// aggregateSelect 返回从交易表聚合出视图行的查询，只统计买卖交易
+// 物化视图和回填共用，where 为附加的过滤条件
+func (v klineView) aggregateSelect(source, where string) string {
+	if where != "" {
+		where = " AND " + where
+	}
+	return fmt.Sprintf(`
+        SELECT
+            token_address,
+            toStartOfInterval(toDateTime(transaction_time), INTERVAL %d second) AS bucket,
+            argMinState(toDecimal128(quote_token_price, 18), (toDateTime(transaction_time), transaction_id)) AS open_state,
+            maxState(toDecimal128(quote_token_price, 18)) AS high_state,
+            minState(toDecimal128(quote_token_price, 18)) AS low_state,
+            argMaxState(toDecimal128(quote_token_price, 18), (toDateTime(transaction_time), transaction_id)) AS close_state,
+            argMaxState(toDecimal128(base_token_price, 18), (toDateTime(transaction_time), transaction_id)) AS sol_price_state,
+            sum(toUInt64(quote_token_amount)) AS volume,
+            count() AS trades_count,
+            countIf(transaction_type = 1) AS buy_count,
+            countIf(transaction_type = 2) AS sell_count,
+            sumIf(toUInt64(quote_token_amount), transaction_type = 1) AS buy_volume,
+            sumIf(toUInt64(quote_token_amount), transaction_type = 2) AS sell_volume,
+            sum(toUInt64(base_token_amount)) AS base_volume
+        FROM %s
+        WHERE transaction_type IN (1, 2)%s
+        GROUP BY token_address, bucket`, v.Seconds, source, where)
+}
+
+// ddl 返回创建视图所需的语句：本地聚合表、分布式表、监听本地交易表的物化视图
+// 语句中的集群占位符由迁移执行时替换
+func (v klineView) ddl() []string {
+	return []string{
+		fmt.Sprintf(`
+        CREATE TABLE IF NOT EXISTS %s${ON_CLUSTER}
+        (
+            token_address String,
+            bucket DateTime,
+            open_state AggregateFunction(argMin, Decimal(38, 18), Tuple(DateTime, UInt64)),
+            high_state AggregateFunction(max, Decimal(38, 18)),
+            low_state AggregateFunction(min, Decimal(38, 18)),
+            close_state AggregateFunction(argMax, Decimal(38, 18), Tuple(DateTime, UInt64)),
+            sol_price_state AggregateFunction(argMax, Decimal(38, 18), Tuple(DateTime, UInt64)),
+            volume SimpleAggregateFunction(sum, UInt64),
+            trades_count SimpleAggregateFunction(sum, UInt64),
+            buy_count SimpleAggregateFunction(sum, UInt64),
+            sell_count SimpleAggregateFunction(sum, UInt64),
+            buy_volume SimpleAggregateFunction(sum, UInt64),
+            sell_volume SimpleAggregateFunction(sum, UInt64),
+            base_volume SimpleAggregateFunction(sum, UInt64)
+        )
+        ENGINE = AggregatingMergeTree
+        PARTITION BY toYYYYMM(bucket)
+        ORDER BY (token_address, bucket)
+        SETTINGS non_replicated_deduplication_window = 1000`, v.localTable()),
+		fmt.Sprintf(`
+        CREATE TABLE IF NOT EXISTS %s${ON_CLUSTER} AS %s
+        ENGINE = Distributed('${CLUSTER}', currentDatabase(), %s, cityHash64(token_address))`,
+			v.table(), v.localTable(), v.localTable()),
+		fmt.Sprintf(`
+        CREATE MATERIALIZED VIEW IF NOT EXISTS %s${ON_CLUSTER} TO %s AS%s`,
+			v.mvName(), v.localTable(), v.aggregateSelect(klineSourceLocalTable, "")),
+	}
+}
+
+// klineViewStatements 返回全部预聚合视图的建表语句，由迁移 0002 执行
+// 物化视图只聚合创建之后写入的交易，历史数据需通过 BackfillKlineView 回填
+func klineViewStatements() []string {
+	var statements []string
+	for _, v := range klineViews {
+		statements = append(statements, v.ddl()...)
+	}
+	return statements
+}
+
+// mvCreatedAt 返回物化视图的创建时间，回填不能超过该时间，否则与物化视图写入的数据重复
+func mvCreatedAt(mvName string) (time.Time, error) {
+	var createdAt time.Time
+	err := ClickHouseClient.QueryRow(context.Background(), `
+        SELECT metadata_modification_time
+        FROM system.tables
+        WHERE database = currentDatabase()
+          AND name = ?
+    `, mvName).Scan(&createdAt)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("query view %s create time failed: %w", mvName, err)
+	}
+	return createdAt, nil
+}
+
+// BackfillKlineView 将 [from, to) 的历史交易聚合写入指定视图
+func BackfillKlineView(name string, from, to time.Time) (time.Time, error) {
+	v, ok := klineViewByName(name)
+	if !ok {
+		return time.Time{}, fmt.Errorf("unknown kline view: %s", name)
+	}
+	query := fmt.Sprintf("INSERT INTO %s%s", v.table(),
+		v.aggregateSelect(klineSourceTable, "transaction_time >= ? AND transaction_time < ?"))
+	return backfillByDay("kline-backfill/"+v.Name, v.mvName(), query, from, to)
+}
+
+// backfillByDay 按天分批执行 query，query 的两个参数为每批的 [开始, 结束) 交易时间
+// to 超过物化视图创建时间时截断到创建时间，每批使用固定的去重 token，中断后可重复执行
+// 返回实际回填的截止时间，失败时返回失败批次的开始时间
+func backfillByDay(name, mvName, query string, from, to time.Time) (time.Time, error) {
+	createdAt, err := mvCreatedAt(mvName)
+	if err != nil {
+		return time.Time{}, err
+	}
+	// 按交易时间划分回填和物化视图的数据，视图创建后才写入的旧交易会被重复统计，创建视图前需追平 Kafka 消费
+	if to.After(createdAt) {
+		to = createdAt
+	}
+
+	for chunkStart := from.UTC(); chunkStart.Before(to); {
+		chunkEnd := chunkStart.Add(24 * time.Hour)
+		if chunkEnd.After(to) {
+			chunkEnd = to
+		}
+
+		token := DedupToken(name, []string{
+			chunkStart.Format(time.RFC3339), chunkEnd.Format(time.RFC3339),
+		})
+		err := insertWithRetry(name, func() error {
+			return ClickHouseClient.Exec(dedupContext(token), query, chunkStart, chunkEnd)
+		})
+		if err != nil {
+			return chunkStart, fmt.Errorf("%s [%s, %s) failed: %w", name,
+				chunkStart.Format(time.RFC3339), chunkEnd.Format(time.RFC3339), err)
+		}
+		util.Log().Info("%s: [%s, %s) done", name,
+			chunkStart.Format(time.RFC3339), chunkEnd.Format(time.RFC3339))
+		chunkStart = chunkEnd
+	}
+	return to, nil
+}
+
+// getCloseBefore 查询 t 之前最后一笔成交的收盘价，没有成交时返回零
+// 当天之前的部分读 1d 视图，当天读 1s 视图，避免扫描代币全部的秒级数据
+func getCloseBefore(tokenAddress string, t time.Time) (decimal.Decimal, error) {
+	day := t.UTC().Truncate(24 * time.Hour)
+	secondView, dayView := klineViews[0], klineViews[len(klineViews)-1]
+
+	closePrice, err := queryLastClose(secondView, tokenAddress, day, t)
+	if err != nil || closePrice.IsPositive() {
+		return closePrice, err
+	}
+	return queryLastClose(dayView, tokenAddress, time.Unix(0, 0), day)
+}
+
+// queryLastClose 查询视图中 [from, to) 内最后的收盘价，没有数据时返回零
+func queryLastClose(v klineView, tokenAddress string, from, to time.Time) (decimal.Decimal, error) {
+	var closePrice decimal.Decimal
+	err := ClickHouseClient.QueryRow(context.Background(), fmt.Sprintf(`
+        SELECT argMaxMerge(close_state)
+        FROM %s
+        WHERE token_address = ?
+          AND bucket >= ?
+          AND bucket < ?
+    `, v.table()), tokenAddress, from, to).Scan(&closePrice)
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("query previous close failed: %w", err)
+	}
+	return closePrice, nil
+}
@@ -0,0 +1,83 @@
+package clickhouse
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"game-fun-be/internal/metrics"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+// instrumentedConn 包装 ClickHouse 连接，记录各类操作的耗时和错误
+type instrumentedConn struct {
+	driver.Conn
+}
+
+// instrumentedBatch 包装批量写入，Send 时记录耗时和错误
+type instrumentedBatch struct {
+	driver.Batch
+	operation string
+}
+
+// queryOperation 取 SQL 的首个关键字作为操作标签，如 select、insert
+func queryOperation(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return "unknown"
+	}
+	return strings.ToLower(fields[0])
+}
+
+func (c *instrumentedConn) Select(ctx context.Context, dest any, query string, args ...any) error {
+	start := time.Now()
+	err := c.Conn.Select(ctx, dest, query, args...)
+	metrics.ObserveClickHouse(queryOperation(query), start, err)
+	return err
+}
+
+func (c *instrumentedConn) Query(ctx context.Context, query string, args ...any) (driver.Rows, error) {
+	start := time.Now()
+	rows, err := c.Conn.Query(ctx, query, args...)
+	metrics.ObserveClickHouse(queryOperation(query), start, err)
+	return rows, err
+}
+
+func (c *instrumentedConn) QueryRow(ctx context.Context, query string, args ...any) driver.Row {
+	start := time.Now()
+	row := c.Conn.QueryRow(ctx, query, args...)
+	metrics.ObserveClickHouse(queryOperation(query), start, row.Err())
+	return row
+}
+
+func (c *instrumentedConn) Exec(ctx context.Context, query string, args ...any) error {
+	start := time.Now()
+	err := c.Conn.Exec(ctx, query, args...)
+	metrics.ObserveClickHouse(queryOperation(query), start, err)
+	return err
+}
+
+func (c *instrumentedConn) AsyncInsert(ctx context.Context, query string, wait bool, args ...any) error {
+	start := time.Now()
+	err := c.Conn.AsyncInsert(ctx, query, wait, args...)
+	metrics.ObserveClickHouse("async_insert", start, err)
+	return err
+}
+
+func (c *instrumentedConn) PrepareBatch(ctx context.Context, query string, opts ...driver.PrepareBatchOption) (driver.Batch, error) {
+	start := time.Now()
+	batch, err := c.Conn.PrepareBatch(ctx, query, opts...)
+	metrics.ObserveClickHouse("prepare_batch", start, err)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedBatch{Batch: batch, operation: "batch_send"}, nil
+}
+
+func (b *instrumentedBatch) Send() error {
+	start := time.Now()
+	err := b.Batch.Send()
+	metrics.ObserveClickHouse(b.operation, start, err)
+	return err
+}
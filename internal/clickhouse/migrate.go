@@ -0,0 +1,262 @@
+package clickhouse
+
+import (
+	"context"
+	"crypto/sha1"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"game-fun-be/internal/pkg/util"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+)
+
+// migrationFiles 按版本号顺序执行的 DDL 文件，文件名格式为 0001_name.sql
+// 多条语句以行尾分号分隔，"--" 开头的行为注释
+// 文件中的 ${ON_CLUSTER} 替换为 " ON CLUSTER '<集群名>'"，${CLUSTER} 替换为集群名
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Migration 一个版本的 DDL 迁移
+// 同一版本的语句不在事务中执行，中途失败时版本不会被记录，下次从头重新执行，因此语句需可重复执行（IF NOT EXISTS 等）
+type Migration struct {
+	Version    int
+	Name       string
+	Statements []string // 未替换占位符的语句
+}
+
+// checksum 语句内容的摘要，已执行的迁移被修改时用于告警
+func (m Migration) checksum() string {
+	sum := sha1.Sum([]byte(strings.Join(m.Statements, ";\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// MigrationStatus 迁移执行状态
+type MigrationStatus struct {
+	Version   int       `json:"version"`
+	Name      string    `json:"name"`
+	Applied   bool      `json:"applied"`
+	AppliedAt time.Time `json:"applied_at,omitempty"`
+	// Modified 迁移执行后内容被修改，修改不会再次执行，需要新增版本
+	Modified bool `json:"modified,omitempty"`
+}
+
+// goMigrations 由代码生成语句的迁移
+func goMigrations() []Migration {
+	return []Migration{
+		{Version: 2, Name: "kline_views", Statements: klineViewStatements()},
+	}
+}
+
+// migrationCluster 返回 ON CLUSTER 使用的集群名
+func migrationCluster() string {
+	if cluster := strings.TrimSpace(os.Getenv("CLICKHOUSE_CLUSTER")); cluster != "" {
+		return cluster
+	}
+	return "default"
+}
+
+// renderStatement 替换语句中的集群占位符
+func renderStatement(stmt string) string {
+	cluster := migrationCluster()
+	return strings.NewReplacer(
+		"${ON_CLUSTER}", fmt.Sprintf(" ON CLUSTER '%s'", cluster),
+		"${CLUSTER}", cluster,
+	).Replace(stmt)
+}
+
+// LoadMigrations 读取内嵌的 DDL 文件和代码中的迁移，按版本号排序
+func LoadMigrations() ([]Migration, error) {
+	migrations := goMigrations()
+
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("read migrations failed: %w", err)
+	}
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".sql")
+		versionPart, label, ok := strings.Cut(name, "_")
+		version, err := strconv.Atoi(versionPart)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("invalid migration file name: %s", entry.Name())
+		}
+
+		content, err := migrationFiles.ReadFile(path.Join("migrations", entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("read migration %s failed: %w", entry.Name(), err)
+		}
+		migrations = append(migrations, Migration{
+			Version:    version,
+			Name:       label,
+			Statements: splitStatements(string(content)),
+		})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version == migrations[i-1].Version {
+			return nil, fmt.Errorf("duplicate migration version %d: %s, %s",
+				migrations[i].Version, migrations[i-1].Name, migrations[i].Name)
+		}
+	}
+	return migrations, nil
+}
+
+// splitStatements 按行尾分号拆分语句，去掉注释行和空语句
+func splitStatements(content string) []string {
+	var statements []string
+	var current strings.Builder
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			if stmt := strings.TrimSuffix(strings.TrimSpace(current.String()), ";"); stmt != "" {
+				statements = append(statements, stmt)
+			}
+			current.Reset()
+		}
+	}
+	if stmt := strings.TrimSpace(current.String()); stmt != "" {
+		statements = append(statements, stmt)
+	}
+	return statements
+}
+
+// ensureMigrationTable 创建记录已执行版本的表，每个节点一张本地表，通过分布式表读写
+func ensureMigrationTable() error {
+	statements := []string{`
+        CREATE TABLE IF NOT EXISTS schema_migrations${ON_CLUSTER}
+        (
+            version UInt32,
+            name String,
+            checksum String,
+            applied_at DateTime
+        )
+        ENGINE = MergeTree
+        ORDER BY version`, `
+        CREATE TABLE IF NOT EXISTS schema_migrations_all${ON_CLUSTER} AS schema_migrations
+        ENGINE = Distributed('${CLUSTER}', currentDatabase(), schema_migrations, rand())`,
+	}
+	for _, stmt := range statements {
+		if err := ClickHouseClient.Exec(context.Background(), renderStatement(stmt)); err != nil {
+			return fmt.Errorf("create schema_migrations failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// appliedMigration 已执行的迁移记录
+type appliedMigration struct {
+	checksum  string
+	appliedAt time.Time
+}
+
+// getAppliedMigrations 查询已执行的迁移，多个实例同时执行时同一版本可能有多条记录，取最早一条
+func getAppliedMigrations() (map[int]appliedMigration, error) {
+	rows, err := ClickHouseClient.Query(context.Background(), `
+        SELECT version, argMin(checksum, applied_at), min(applied_at)
+        FROM schema_migrations_all
+        GROUP BY version
+    `)
+	if err != nil {
+		return nil, fmt.Errorf("query schema_migrations failed: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]appliedMigration)
+	for rows.Next() {
+		var version uint32
+		var record appliedMigration
+		if err := rows.Scan(&version, &record.checksum, &record.appliedAt); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		applied[int(version)] = record
+	}
+	return applied, rows.Err()
+}
+
+// Migrate 按版本号顺序执行尚未执行的迁移，返回本次执行的迁移数
+// 遇到失败的迁移立即停止，后续版本不会执行
+func Migrate() (int, error) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		return 0, err
+	}
+	if err := ensureMigrationTable(); err != nil {
+		return 0, err
+	}
+	applied, err := getAppliedMigrations()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, m := range migrations {
+		if record, ok := applied[m.Version]; ok {
+			if record.checksum != m.checksum() {
+				util.Log().Warning("ClickHouse migration %04d_%s was modified after being applied", m.Version, m.Name)
+			}
+			continue
+		}
+
+		for i, stmt := range m.Statements {
+			if err := ClickHouseClient.Exec(context.Background(), renderStatement(stmt)); err != nil {
+				return count, fmt.Errorf("migration %04d_%s statement %d failed: %w", m.Version, m.Name, i+1, err)
+			}
+		}
+		// 同步写入分布式表，避免下次启动时读不到刚写入的记录
+		ctx := clickhouse.Context(context.Background(), clickhouse.WithSettings(clickhouse.Settings{
+			"insert_distributed_sync": 1,
+		}))
+		err := ClickHouseClient.Exec(ctx, `
+            INSERT INTO schema_migrations_all (version, name, checksum, applied_at)
+            VALUES (?, ?, ?, ?)
+        `, uint32(m.Version), m.Name, m.checksum(), time.Now())
+		if err != nil {
+			return count, fmt.Errorf("record migration %04d_%s failed: %w", m.Version, m.Name, err)
+		}
+		util.Log().Info("ClickHouse migration %04d_%s applied", m.Version, m.Name)
+		count++
+	}
+	return count, nil
+}
+
+// GetMigrationStatuses 返回全部迁移的执行状态
+func GetMigrationStatuses() ([]MigrationStatus, error) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureMigrationTable(); err != nil {
+		return nil, err
+	}
+	applied, err := getAppliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		status := MigrationStatus{Version: m.Version, Name: m.Name}
+		if record, ok := applied[m.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = record.appliedAt
+			status.Modified = record.checksum != m.checksum()
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
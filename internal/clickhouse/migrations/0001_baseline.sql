@@ -0,0 +1,96 @@
+-- 迁移引入前已在线上手工创建的表，已存在时跳过
+-- 本地表不使用 Replicated 引擎，insert_deduplication_token 依赖 non_replicated_deduplication_window
+
+-- 链上交易
+CREATE TABLE IF NOT EXISTS token_transaction_ck_new${ON_CLUSTER}
+(
+    transaction_id UInt64,
+    transaction_hash String,
+    chain_type UInt8,
+    user_address String,
+    token_address String,
+    pool_address String,
+    base_token_amount UInt64,
+    quote_token_amount UInt64,
+    decimals UInt8,
+    base_token_price Decimal(38, 18),
+    quote_token_price Decimal(38, 18),
+    transaction_amount_usd Decimal(38, 18),
+    transaction_type UInt8,
+    platform_type UInt8,
+    is_buyback Bool,
+    transaction_time DateTime,
+    create_time DateTime DEFAULT now()
+)
+ENGINE = MergeTree
+PARTITION BY toYYYYMM(transaction_time)
+ORDER BY (token_address, transaction_time, transaction_id)
+SETTINGS non_replicated_deduplication_window = 10000;
+
+CREATE TABLE IF NOT EXISTS token_transaction_ck_new_all${ON_CLUSTER} AS token_transaction_ck_new
+ENGINE = Distributed('${CLUSTER}', currentDatabase(), token_transaction_ck_new, cityHash64(token_address));
+
+-- 代理合约交易（游戏池）
+CREATE TABLE IF NOT EXISTS proxy_transaction_ck${ON_CLUSTER}
+(
+    transaction_hash String,
+    chain_type UInt8,
+    proxy_type UInt8,
+    user_address String,
+    token_address String,
+    pool_address String,
+    base_token_amount UInt64,
+    quote_token_amount UInt64,
+    base_token_reserve_amount UInt64,
+    quote_token_reserve_amount UInt64,
+    decimals UInt8,
+    base_token_price Decimal(38, 18),
+    quote_token_price Decimal(38, 18),
+    transaction_type UInt8,
+    is_burn UInt8,
+    points_amount UInt64,
+    feeQuote_amount UInt64,
+    feeBase_amount UInt64,
+    buybackFeeBase_amount UInt64,
+    block_time DateTime,
+    transaction_time DateTime,
+    create_time DateTime DEFAULT now()
+)
+ENGINE = MergeTree
+PARTITION BY toYYYYMM(transaction_time)
+ORDER BY (chain_type, token_address, transaction_time, transaction_hash)
+SETTINGS non_replicated_deduplication_window = 10000;
+
+CREATE TABLE IF NOT EXISTS proxy_transaction_ck_all${ON_CLUSTER} AS proxy_transaction_ck
+ENGINE = Distributed('${CLUSTER}', currentDatabase(), proxy_transaction_ck, cityHash64(token_address));
+
+-- 代币近 24 小时交易统计，每分钟刷新一次，GetTokenMarketAnalytics 读取
+CREATE MATERIALIZED VIEW IF NOT EXISTS token_transaction_stats_mv${ON_CLUSTER}
+REFRESH EVERY 1 MINUTE
+ENGINE = MergeTree
+ORDER BY (chain_type, token_address, timestamp)
+AS
+SELECT
+    now() AS timestamp,
+    chain_type,
+    token_address,
+    toInt64(countIf(transaction_time >= now() - INTERVAL 5 MINUTE)) AS TxCount5M,
+    toInt64(countIf(transaction_time >= now() - INTERVAL 1 HOUR)) AS TxCount1H,
+    toInt64(count()) AS TxCount24H,
+    countIf(transaction_type = 1 AND transaction_time >= now() - INTERVAL 5 MINUTE) AS BuyTxCount5M,
+    countIf(transaction_type = 1 AND transaction_time >= now() - INTERVAL 1 HOUR) AS BuyTxCount1H,
+    countIf(transaction_type = 1) AS BuyTxCount24H,
+    sumIf(toFloat64(quote_token_amount), transaction_time >= now() - INTERVAL 5 MINUTE) AS TokenVolume5M,
+    sumIf(toFloat64(quote_token_amount), transaction_time >= now() - INTERVAL 1 HOUR) AS TokenVolume1H,
+    sum(toFloat64(quote_token_amount)) AS TokenVolume24H,
+    sumIf(toFloat64(quote_token_amount), transaction_type = 1 AND transaction_time >= now() - INTERVAL 5 MINUTE) AS BuyTokenVolume5M,
+    sumIf(toFloat64(quote_token_amount), transaction_type = 1 AND transaction_time >= now() - INTERVAL 1 HOUR) AS BuyTokenVolume1H,
+    sumIf(toFloat64(quote_token_amount), transaction_type = 1) AS BuyTokenVolume24H,
+    argMinIf(toFloat64(quote_token_price), transaction_time, transaction_time >= now() - INTERVAL 5 MINUTE) AS Price5M,
+    argMinIf(toFloat64(quote_token_price), transaction_time, transaction_time >= now() - INTERVAL 1 HOUR) AS Price1H,
+    argMin(toFloat64(quote_token_price), transaction_time) AS Price24H,
+    argMax(toFloat64(quote_token_price), transaction_time) AS CurrentPrice
+FROM token_transaction_ck_new_all
+WHERE transaction_time >= now() - INTERVAL 24 HOUR
+  AND transaction_type IN (1, 2)
+GROUP BY chain_type, token_address;
@@ -0,0 +1,28 @@
+-- 钱包持仓余额，由买卖交易累加得到：买入加代币数量，卖出减代币数量
+-- 转账、空投等非交易变动不在交易流中，通过转账获得后卖出的钱包余额可能为负，查询时只统计余额为正的钱包
+-- 物化视图只累加创建之后写入的交易，历史数据通过 go run ./cmd/holder-backfill 回填
+CREATE TABLE IF NOT EXISTS token_holder_balance${ON_CLUSTER}
+(
+    chain_type UInt8,
+    token_address String,
+    user_address String,
+    balance Int128,
+    last_trade_time SimpleAggregateFunction(max, DateTime)
+)
+ENGINE = SummingMergeTree
+ORDER BY (chain_type, token_address, user_address)
+SETTINGS non_replicated_deduplication_window = 1000;
+
+CREATE TABLE IF NOT EXISTS token_holder_balance_all${ON_CLUSTER} AS token_holder_balance
+ENGINE = Distributed('${CLUSTER}', currentDatabase(), token_holder_balance, cityHash64(token_address));
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS token_holder_balance_mv${ON_CLUSTER} TO token_holder_balance AS
+SELECT
+    chain_type,
+    token_address,
+    user_address,
+    sum(if(transaction_type = 1, toInt128(quote_token_amount), -toInt128(quote_token_amount))) AS balance,
+    max(toDateTime(transaction_time)) AS last_trade_time
+FROM token_transaction_ck_new
+WHERE transaction_type IN (1, 2)
+GROUP BY chain_type, token_address, user_address;
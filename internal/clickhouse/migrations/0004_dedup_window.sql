@@ -0,0 +1,5 @@
+-- 0001 只在建表时设置去重窗口，迁移引入前已存在的表不会执行建表语句
+-- 缺少该设置时非复制表忽略 insert_deduplication_token，重试写入会产生重复行
+ALTER TABLE token_transaction_ck_new${ON_CLUSTER} MODIFY SETTING non_replicated_deduplication_window = 10000;
+
+ALTER TABLE proxy_transaction_ck${ON_CLUSTER} MODIFY SETTING non_replicated_deduplication_window = 10000;
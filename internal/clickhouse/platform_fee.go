@@ -0,0 +1,72 @@
+package clickhouse
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// PlatformFeeBucket 平台币在一个周期内的手续费、回购、销毁和积分发放，与 platform_token_statistics 的累计字段口径一致
+type PlatformFeeBucket struct {
+	Bucket        time.Time       `db:"interval_start"`
+	TradesCount   uint64          `db:"trades_count"`
+	FeeAmount     uint64          `db:"fee_amount"`      // 手续费收入（lamports）
+	FeeUSD        decimal.Decimal `db:"fee_usd"`         // 按成交所在小时的 SOL 价格折算
+	BackAmount    uint64          `db:"back_amount"`     // 回购的代币数量（最小单位）
+	BackSolAmount uint64          `db:"back_sol_amount"` // 回购花费的 SOL（lamports）
+	BackSolUSD    decimal.Decimal `db:"back_sol_usd"`
+	BurnAmount    uint64          `db:"burn_amount"`   // 销毁的代币数量（最小单位）
+	PointsAmount  uint64          `db:"points_amount"` // 积分购买（gameIn）发放的积分
+}
+
+// GetPlatformFeeSeries 按 intervalSeconds 聚合 [start, end) 内平台币的代理合约交易，只返回有交易的周期
+// 内盘交易（proxy_type=1 game）计入手续费、回购和销毁，积分购买（proxy_type=2 gameIn）计入手续费和积分
+func GetPlatformFeeSeries(chainType uint8, tokenAddress string, intervalSeconds int64, start, end time.Time) ([]PlatformFeeBucket, error) {
+	var buckets []PlatformFeeBucket
+	err := ClickHouseClient.Select(context.Background(), &buckets, fmt.Sprintf(`
+        SELECT
+            toStartOfInterval(t.transaction_time, INTERVAL %[1]d second) AS interval_start,
+            count() AS trades_count,
+            sum(t.feeBase_amount) AS fee_amount,
+            sum(toDecimal128(p.sol_price * t.feeBase_amount / 1000000000, 18)) AS fee_usd,
+            sumIf(t.feeQuote_amount, t.proxy_type = 1) AS back_amount,
+            sumIf(t.buybackFeeBase_amount, t.proxy_type = 1) AS back_sol_amount,
+            sumIf(toDecimal128(p.sol_price * t.buybackFeeBase_amount / 1000000000, 18), t.proxy_type = 1) AS back_sol_usd,
+            sumIf(t.feeQuote_amount, t.proxy_type = 1 AND t.is_burn = 1) AS burn_amount,
+            sumIf(t.points_amount, t.proxy_type = 2) AS points_amount
+        FROM proxy_transaction_ck_all AS t
+        GLOBAL LEFT JOIN (%[2]s
+        ) AS p ON p.bucket = toStartOfHour(t.transaction_time)
+        WHERE t.chain_type = ?
+          AND t.token_address = ?
+          AND t.transaction_time >= ?
+          AND t.transaction_time < ?
+        GROUP BY interval_start
+        ORDER BY interval_start
+    `, intervalSeconds, hourlySolPriceQuery(`bucket >= toStartOfHour(?) AND bucket < ?`)),
+		start, end, chainType, tokenAddress, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("query platform fee series failed: %w", err)
+	}
+	return buckets, nil
+}
+
+// FillPlatformFeeGaps 按 step 将 [start, end) 对齐为连续的周期，没有交易的周期补零
+// start 按 step 向下对齐到 UTC，查询结果按周期开始时间的秒级时间戳匹配，不在范围内的周期被丢弃
+func FillPlatformFeeGaps(buckets []PlatformFeeBucket, step time.Duration, start, end time.Time) []PlatformFeeBucket {
+	start = start.UTC().Truncate(step)
+	bucketMap := make(map[int64]PlatformFeeBucket, len(buckets))
+	for _, b := range buckets {
+		bucketMap[b.Bucket.Unix()] = b
+	}
+
+	filled := make([]PlatformFeeBucket, 0, len(buckets))
+	for t := start; t.Before(end); t = t.Add(step) {
+		b := bucketMap[t.Unix()]
+		b.Bucket = t
+		filled = append(filled, b)
+	}
+	return filled
+}
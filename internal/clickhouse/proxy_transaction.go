@@ -41,7 +41,7 @@ type QuoteVolumeAll struct {
 	UserQuoteVolume uint64    `db:"user_quote_volume"`
 }
 
-// InsertTransaction 插入单条交易数据
+// InsertProxyTransaction 插入单条代理交易，按交易签名生成去重 token，消息重投递时不会重复写入
 func InsertProxyTransaction(tx *ProxyTransaction) error {
 	query := `
         INSERT INTO proxy_transaction_ck_all (
@@ -55,36 +55,95 @@ func InsertProxyTransaction(tx *ProxyTransaction) error {
         )
     `
 
-	err := ClickHouseClient.Exec(context.Background(), query,
-		tx.TransactionHash,
-		tx.ChainType,
-		tx.ProxyType,
-		tx.UserAddress,
-		tx.TokenAddress,
-		tx.PoolAddress,
-		tx.BaseTokenAmount,
-		tx.QuoteTokenAmount,
-		tx.BaseTokenReserveAmount,
-		tx.QuoteTokenReserveAmount,
-		tx.Decimals,
-		tx.BaseTokenPrice,
-		tx.QuoteTokenPrice,
-		tx.TransactionType,
-		tx.IsBurn,
-		tx.PointsAmount,
-		tx.FeeQuoteAmount,
-		tx.FeeBaseAmount,
-		tx.BuybackFeeBaseAmount,
-		tx.BlockTime,
-		tx.TransactionTime,
-		tx.CreateTime,
-	)
+	token := DedupToken("proxy", []string{proxyTransactionRowKey(tx)})
+	if proxyTransactionWriter != nil {
+		return proxyTransactionWriter.Write(token, tx)
+	}
+
+	err := insertWithRetry("insert proxy transaction", func() error {
+		return ClickHouseClient.Exec(dedupContext(token), query,
+			tx.TransactionHash,
+			tx.ChainType,
+			tx.ProxyType,
+			tx.UserAddress,
+			tx.TokenAddress,
+			tx.PoolAddress,
+			tx.BaseTokenAmount,
+			tx.QuoteTokenAmount,
+			tx.BaseTokenReserveAmount,
+			tx.QuoteTokenReserveAmount,
+			tx.Decimals,
+			tx.BaseTokenPrice,
+			tx.QuoteTokenPrice,
+			tx.TransactionType,
+			tx.IsBurn,
+			tx.PointsAmount,
+			tx.FeeQuoteAmount,
+			tx.FeeBaseAmount,
+			tx.BuybackFeeBaseAmount,
+			tx.BlockTime,
+			tx.TransactionTime,
+			tx.CreateTime,
+		)
+	})
 	if err != nil {
 		return fmt.Errorf("insert transaction failed: %w", err)
 	}
 	return nil
 }
 
+// sendProxyTransactionBatch 批量写入代理交易，供缓冲写入器使用
+func sendProxyTransactionBatch(ctx context.Context, txs []*ProxyTransaction) error {
+	batch, err := ClickHouseClient.PrepareBatch(ctx, `
+        INSERT INTO proxy_transaction_ck_all (
+            transaction_hash, chain_type, proxy_type, user_address, token_address,
+            pool_address, base_token_amount, quote_token_amount, base_token_reserve_amount,
+            quote_token_reserve_amount, decimals, base_token_price, quote_token_price,
+            transaction_type, is_burn, points_amount, feeQuote_amount, feeBase_amount,
+            buybackFeeBase_amount, block_time, transaction_time, create_time
+        )
+    `)
+	if err != nil {
+		return fmt.Errorf("prepare batch failed: %w", err)
+	}
+	defer batch.Abort()
+
+	for _, tx := range txs {
+		err := batch.Append(
+			tx.TransactionHash,
+			tx.ChainType,
+			tx.ProxyType,
+			tx.UserAddress,
+			tx.TokenAddress,
+			tx.PoolAddress,
+			tx.BaseTokenAmount,
+			tx.QuoteTokenAmount,
+			tx.BaseTokenReserveAmount,
+			tx.QuoteTokenReserveAmount,
+			tx.Decimals,
+			tx.BaseTokenPrice,
+			tx.QuoteTokenPrice,
+			tx.TransactionType,
+			tx.IsBurn,
+			tx.PointsAmount,
+			tx.FeeQuoteAmount,
+			tx.FeeBaseAmount,
+			tx.BuybackFeeBaseAmount,
+			tx.BlockTime,
+			tx.TransactionTime,
+			tx.CreateTime,
+		)
+		if err != nil {
+			return fmt.Errorf("append to batch failed: %w", err)
+		}
+	}
+
+	if err := batch.Send(); err != nil {
+		return fmt.Errorf("send batch failed: %w", err)
+	}
+	return nil
+}
+
 // QueryProxyTransactionsByTime 根据时间范围查询交易数据
 func QueryProxyTransactionsByTime(startTime, endTime time.Time, chainType uint8, tokenAddress string) ([]ProxyTransaction, error) {
 	query := `
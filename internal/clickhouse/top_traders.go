@@ -0,0 +1,87 @@
+package clickhouse
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// 交易者排行的排序字段
+const (
+	TopTradersSortVolume      = "volume"
+	TopTradersSortNetBuy      = "net_buy"
+	TopTradersSortRealizedPnL = "realized_pnl"
+	TopTradersSortTrades      = "trades"
+)
+
+// topTradersOrderColumns 排序字段对应的查询列
+var topTradersOrderColumns = map[string]string{
+	TopTradersSortVolume:      "volume_usd",
+	TopTradersSortNetBuy:      "net_buy_usd",
+	TopTradersSortRealizedPnL: "realized_pnl",
+	TopTradersSortTrades:      "trades_count",
+}
+
+// IsValidTopTradersSort 检查排序字段
+func IsValidTopTradersSort(sortBy string) bool {
+	_, ok := topTradersOrderColumns[sortBy]
+	return ok
+}
+
+// TopTrader 钱包在时间窗口内对单个代币的交易汇总
+type TopTrader struct {
+	UserAddress   string          `db:"user_address"`
+	BuyCount      uint64          `db:"buy_count"`
+	SellCount     uint64          `db:"sell_count"`
+	TradesCount   uint64          `db:"trades_count"`
+	BuyAmount     uint64          `db:"buy_amount"`  // 代币数量（最小单位）
+	SellAmount    uint64          `db:"sell_amount"` // 代币数量（最小单位）
+	BuyUSD        decimal.Decimal `db:"buy_usd"`
+	SellUSD       decimal.Decimal `db:"sell_usd"`
+	VolumeUSD     decimal.Decimal `db:"volume_usd"`
+	NetBuyUSD     decimal.Decimal `db:"net_buy_usd"`
+	RealizedPnL   float64         `db:"realized_pnl"`
+	LastTradeTime time.Time       `db:"last_trade_time"`
+}
+
+// GetTopTraders 按排序字段返回 since 之后交易该代币的前 limit 个钱包
+// 已实现盈亏按窗口内的平均买入成本估算：卖出金额 - 平均买入价 × 卖出数量（不超过窗口内买入数量），
+// 窗口内没有买入的卖出按零成本计算，与持仓盈亏接口的全量计算结果可能不同
+func GetTopTraders(chainType uint8, tokenAddress string, since time.Time, sortBy string, limit int) ([]TopTrader, error) {
+	orderColumn, ok := topTradersOrderColumns[sortBy]
+	if !ok {
+		return nil, fmt.Errorf("unknown top traders sort: %s", sortBy)
+	}
+
+	var traders []TopTrader
+	err := ClickHouseClient.Select(context.Background(), &traders, fmt.Sprintf(`
+        SELECT
+            user_address,
+            countIf(transaction_type = 1) AS buy_count,
+            countIf(transaction_type = 2) AS sell_count,
+            count() AS trades_count,
+            sumIf(quote_token_amount, transaction_type = 1) AS buy_amount,
+            sumIf(quote_token_amount, transaction_type = 2) AS sell_amount,
+            sumIf(transaction_amount_usd, transaction_type = 1) AS buy_usd,
+            sumIf(transaction_amount_usd, transaction_type = 2) AS sell_usd,
+            buy_usd + sell_usd AS volume_usd,
+            buy_usd - sell_usd AS net_buy_usd,
+            toFloat64(sell_usd) - if(buy_amount = 0, 0,
+                toFloat64(buy_usd) * least(sell_amount, buy_amount) / buy_amount) AS realized_pnl,
+            max(transaction_time) AS last_trade_time
+        FROM token_transaction_ck_new_all
+        WHERE chain_type = ?
+          AND token_address = ?
+          AND transaction_type IN (1, 2)
+          AND transaction_time >= ?
+        GROUP BY user_address
+        ORDER BY %s DESC, user_address
+        LIMIT ?
+    `, orderColumn), chainType, tokenAddress, since, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query top traders failed: %w", err)
+	}
+	return traders, nil
+}
@@ -83,8 +83,28 @@ func InsertTransaction(tx *TokenTransactionCk) error {
 }
 
 // BatchInsertTransactions 批量插入交易数据
-func BatchInsertTransactions(txs []*TokenTransactionCk) error {
-	batch, err := ClickHouseClient.PrepareBatch(context.Background(), `
+// source 为数据来源（如 Kafka topic/partition/offset 区间），与各行标识一起生成去重 token，重复写入同一批数据不会产生重复行
+func BatchInsertTransactions(source string, txs []*TokenTransactionCk) error {
+	if len(txs) == 0 {
+		return nil
+	}
+	rowKeys := make([]string, 0, len(txs))
+	for _, tx := range txs {
+		rowKeys = append(rowKeys, transactionRowKey(tx))
+	}
+	token := DedupToken(source, rowKeys)
+
+	if transactionWriter != nil {
+		return transactionWriter.Write(token, txs...)
+	}
+
+	return insertWithRetry("batch insert transactions", func() error {
+		return sendTransactionBatch(dedupContext(token), txs)
+	})
+}
+
+func sendTransactionBatch(ctx context.Context, txs []*TokenTransactionCk) error {
+	batch, err := ClickHouseClient.PrepareBatch(ctx, `
         INSERT INTO token_transaction_ck_new_all (
             transaction_id, transaction_hash, chain_type, user_address, token_address,
             pool_address, base_token_amount, quote_token_amount, decimals,
@@ -127,35 +147,20 @@ func BatchInsertTransactions(txs []*TokenTransactionCk) error {
 	return nil
 }
 
-// GetKlines 查询K数据
-func GetKlines(tokenAddress string, interval string, start, end time.Time) ([]Kline, error) {
-
-	rows, err := ClickHouseClient.Query(context.Background(), `
+// GetKlines 查询 [start, end) 内的K线数据，返回连续序列，没有成交的周期沿用上一周期的收盘价
+func GetKlines(tokenAddress string, resolution KlineResolution, start, end time.Time) ([]Kline, error) {
+	bucketStart := resolution.BucketStart(start)
+	rows, err := ClickHouseClient.Query(context.Background(), fmt.Sprintf(`
         SELECT
             token_address,
-            toStartOfInterval(timestamp, INTERVAL ? second) as interval_timestamp,
-            any(open_price) as open_price,
-            max(high_price) as high_price,
-            min(low_price) as low_price,
-            anyLast(open_price) OVER (
-                PARTITION BY token_address 
-                ORDER BY interval_timestamp 
-                ROWS BETWEEN 1 FOLLOWING AND 1 FOLLOWING
-            ) as close_price,
-            sum(volume) as volume,
-            sum(trades_count) as trades_count,
-            sum(buy_count) as buy_count,
-            sum(sell_count) as sell_count,
-            sum(buy_volume) as buy_volume,
-            sum(sell_volume) as sell_volume,
-            sum(base_volume) as base_volume
-        FROM token_kline_1s_all
+            %s AS interval_timestamp,%s
+        FROM %s
         WHERE token_address = ?
-          AND timestamp >= ?
-          AND timestamp < ?
+          AND bucket >= ?
+          AND bucket < ?
         GROUP BY token_address, interval_timestamp
         ORDER BY token_address, interval_timestamp;
-    `, getIntervalSeconds(interval), tokenAddress, start, end)
+    `, resolution.bucketExpr("bucket"), klineMergeColumns, resolution.view().table()), tokenAddress, bucketStart, end)
 
 	if err != nil {
 		return nil, fmt.Errorf("query failed: %w", err)
@@ -188,27 +193,11 @@ func GetKlines(tokenAddress string, interval string, start, end time.Time) ([]Kl
 		klines = append(klines, k)
 	}
 
-	if len(klines) > 0 {
-		lastKline := &klines[len(klines)-1]
-		if lastKline.ClosePrice.IsZero() {
-			lastKline.ClosePrice = lastKline.OpenPrice
-		}
+	prevClose, err := getCloseBefore(tokenAddress, bucketStart)
+	if err != nil {
+		return nil, err
 	}
-
-	return klines, nil
-}
-
-func getIntervalSeconds(interval string) int {
-	return map[string]int{
-		"1S":  1,     // 1 second
-		"1":   60,    // 1 minute
-		"5":   300,   // 5 minutes
-		"15":  900,   // 15 minutes
-		"60":  3600,  // 1 hour
-		"240": 14400, // 4 hours
-		"720": 43200, // 12 hours
-		"1D":  86400, // 1 day
-	}[interval]
+	return FillKlineGaps(klines, tokenAddress, resolution, start, end, prevClose), nil
 }
 
 // GetTokenTransactions retrieves the latest token transactions from ClickHouse
@@ -259,32 +248,35 @@ func GetTokenTransactions(tokenAddress string, limit int) ([]TokenTransactionCk,
 	return transactions, nil
 }
 
-// GetLatestKline 获取最新的K线数据
-func GetLatestKline(tokenAddress string) (*Kline, error) {
-	query := `
+// latestKlineLookback 查找最新 K 线时回看的成交时间范围
+const latestKlineLookback = 12 * time.Hour
+
+// GetLatestKline 获取指定周期最新的K线数据，合并该周期对应预聚合视图中最新周期内的所有行
+func GetLatestKline(tokenAddress string, resolution KlineResolution) (*Kline, error) {
+	table := resolution.view().table()
+	bucketExpr := resolution.bucketExpr("bucket")
+	since := resolution.BucketStart(time.Now().Add(-latestKlineLookback))
+	query := fmt.Sprintf(`
         SELECT
             token_address,
-            timestamp as interval_timestamp,
-            open_price,
-            high_price,
-            low_price,
-            close_price,
-            volume,
-            trades_count,
-            buy_count,
-            sell_count,
-            buy_volume,
-            sell_volume,
-            base_volume
-        FROM token_kline_1s_all
+            %s AS interval_timestamp,%s
+        FROM %s
         WHERE token_address = ?
-            AND timestamp >= now() - INTERVAL 12 HOUR
-        ORDER BY timestamp DESC, max_transaction_id DESC
-        LIMIT 1
-    `
+            AND bucket >= ?
+            AND bucket >= (
+                SELECT %s
+                FROM (
+                    SELECT max(bucket) AS bucket
+                    FROM %s
+                    WHERE token_address = ?
+                        AND bucket >= ?
+                )
+            )
+        GROUP BY token_address, interval_timestamp
+    `, bucketExpr, klineMergeColumns, table, bucketExpr, table)
 
 	var kline Kline
-	row := ClickHouseClient.QueryRow(context.Background(), query, tokenAddress)
+	row := ClickHouseClient.QueryRow(context.Background(), query, tokenAddress, since, tokenAddress, since)
 	err := row.Scan(
 		&kline.TokenAddress,
 		&kline.IntervalTimestamp,
@@ -0,0 +1,251 @@
+package clickhouse
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// 钱包动态的交易平台
+const (
+	ActivityPlatformPump    = "pump"
+	ActivityPlatformRaydium = "raydium"
+	ActivityPlatformGame    = "game"
+)
+
+// IsValidActivityPlatform 检查交易平台
+func IsValidActivityPlatform(platform string) bool {
+	switch platform {
+	case ActivityPlatformPump, ActivityPlatformRaydium, ActivityPlatformGame:
+		return true
+	}
+	return false
+}
+
+// WalletActivity 钱包的一笔买卖
+type WalletActivity struct {
+	TransactionHash  string          `db:"transaction_hash"`
+	TokenAddress     string          `db:"token_address"`
+	PoolAddress      string          `db:"pool_address"`
+	Platform         string          `db:"platform"`
+	TransactionType  uint8           `db:"transaction_type"`
+	IsBuyback        bool            `db:"is_buyback"`
+	BaseTokenAmount  uint64          `db:"base_token_amount"`  // SOL 数量（lamports）
+	QuoteTokenAmount uint64          `db:"quote_token_amount"` // 代币数量（最小单位）
+	Decimals         uint8           `db:"decimals"`
+	QuoteTokenPrice  decimal.Decimal `db:"quote_token_price"` // 代理交易未记录价格时为 0
+	AmountUSD        decimal.Decimal `db:"amount_usd"`
+	TransactionTime  time.Time       `db:"transaction_time"`
+}
+
+// WalletActivityFilter 钱包动态的筛选条件，零值表示不筛选
+type WalletActivityFilter struct {
+	TransactionType uint8    // 1=买，2=卖
+	Platforms       []string // pump、raydium、game
+	MinUSD          decimal.Decimal
+	Start           time.Time // 包含
+	End             time.Time // 不包含
+}
+
+// WalletActivityCursor 钱包动态的分页游标，指向上一页最后一条记录
+// 同一笔交易可能同时买卖多个代币，代币地址作为排序的最后一列保证游标唯一
+type WalletActivityCursor struct {
+	TransactionTime time.Time
+	TransactionHash string
+	TokenAddress    string
+}
+
+// Encode 编码为接口返回的不透明字符串
+func (c WalletActivityCursor) Encode() string {
+	raw := strconv.FormatInt(c.TransactionTime.Unix(), 10) + ":" + c.TransactionHash + ":" + c.TokenAddress
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// ParseWalletActivityCursor 解析 Encode 生成的游标
+func ParseWalletActivityCursor(s string) (*WalletActivityCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %w", err)
+	}
+	parts := strings.Split(string(raw), ":")
+	if len(parts) != 3 || parts[1] == "" || parts[2] == "" {
+		return nil, fmt.Errorf("invalid cursor: %s", s)
+	}
+	seconds, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %w", err)
+	}
+	return &WalletActivityCursor{
+		TransactionTime: time.Unix(seconds, 0),
+		TransactionHash: parts[1],
+		TokenAddress:    parts[2],
+	}, nil
+}
+
+// walletActivitySource 钱包在链上交易表和代理交易表中的买卖
+// 通过代理合约成交的交易两张表都有记录，以链上交易为准并标记为 game；
+// 代理交易表未记录价格，美元金额按成交所在小时的 SOL 价格估算
+func walletActivitySource(chainType uint8, walletAddress string, f WalletActivityFilter) (string, []any) {
+	where := `
+              AND chain_type = ?
+              AND user_address = ?
+              AND transaction_type IN (1, 2)`
+	whereArgs := []any{chainType, walletAddress}
+	if f.TransactionType != 0 {
+		where += `
+              AND transaction_type = ?`
+		whereArgs = append(whereArgs, f.TransactionType)
+	}
+	if !f.Start.IsZero() {
+		where += `
+              AND transaction_time >= ?`
+		whereArgs = append(whereArgs, f.Start)
+	}
+	if !f.End.IsZero() {
+		where += `
+              AND transaction_time < ?`
+		whereArgs = append(whereArgs, f.End)
+	}
+
+	query := fmt.Sprintf(`
+            SELECT
+                transaction_hash,
+                token_address,
+                pool_address,
+                if(transaction_hash GLOBAL IN (
+                    SELECT transaction_hash FROM proxy_transaction_ck_all WHERE chain_type = ? AND user_address = ?
+                ), '%[1]s', multiIf(platform_type = 1, '%[2]s', platform_type = 2, '%[3]s', 'other')) AS platform,
+                transaction_type,
+                is_buyback,
+                base_token_amount,
+                quote_token_amount,
+                decimals,
+                quote_token_price,
+                toDecimal128(transaction_amount_usd, 18) AS amount_usd,
+                transaction_time
+            FROM token_transaction_ck_new_all
+            WHERE 1 = 1%[4]s
+            UNION ALL
+            SELECT
+                t.transaction_hash AS transaction_hash,
+                t.token_address AS token_address,
+                t.pool_address AS pool_address,
+                '%[1]s' AS platform,
+                t.transaction_type AS transaction_type,
+                false AS is_buyback,
+                t.base_token_amount AS base_token_amount,
+                t.quote_token_amount AS quote_token_amount,
+                t.decimals AS decimals,
+                t.quote_token_price AS quote_token_price,
+                toDecimal128(if(t.base_token_price > 0, t.base_token_price, p.sol_price) * t.base_token_amount / 1000000000, 18) AS amount_usd,
+                t.transaction_time AS transaction_time
+            FROM proxy_transaction_ck_all AS t
+            GLOBAL LEFT JOIN (%[5]s
+            ) AS p ON p.bucket = toStartOfHour(t.transaction_time)
+            WHERE t.transaction_hash GLOBAL NOT IN (
+                SELECT transaction_hash FROM token_transaction_ck_new_all WHERE chain_type = ? AND user_address = ?
+            )%[4]s`,
+		ActivityPlatformGame, ActivityPlatformPump, ActivityPlatformRaydium, where,
+		hourlySolPriceQuery(`bucket GLOBAL IN (
+                    SELECT toStartOfHour(transaction_time) FROM proxy_transaction_ck_all WHERE chain_type = ? AND user_address = ?
+                )`))
+
+	args := []any{chainType, walletAddress}
+	args = append(args, whereArgs...)
+	args = append(args, chainType, walletAddress, chainType, walletAddress)
+	args = append(args, whereArgs...)
+
+	// 平台和金额是计算列，在外层筛选
+	outer := ""
+	if len(f.Platforms) > 0 {
+		outer += `
+          AND platform IN ?`
+		args = append(args, f.Platforms)
+	}
+	if f.MinUSD.IsPositive() {
+		outer += `
+          AND amount_usd >= ?`
+		args = append(args, f.MinUSD)
+	}
+	return `
+        SELECT *
+        FROM (` + query + `
+        )
+        WHERE 1 = 1` + outer, args
+}
+
+// GetWalletActivities 按成交时间倒序查询钱包在全部代币上的买卖，cursor 为空时从最新一条开始
+// 返回的记录不超过 limit 条，下一页游标为空表示没有更多数据
+func GetWalletActivities(chainType uint8, walletAddress string, filter WalletActivityFilter, cursor *WalletActivityCursor, limit int) ([]WalletActivity, *WalletActivityCursor, error) {
+	source, args := walletActivitySource(chainType, walletAddress, filter)
+	query := `
+        SELECT *
+        FROM (` + source + `
+        )`
+	if cursor != nil {
+		query += `
+        WHERE (transaction_time, transaction_hash, token_address) < (?, ?, ?)`
+		args = append(args, cursor.TransactionTime, cursor.TransactionHash, cursor.TokenAddress)
+	}
+	query += `
+        ORDER BY transaction_time DESC, transaction_hash DESC, token_address DESC
+        LIMIT ?`
+	args = append(args, limit+1)
+
+	var activities []WalletActivity
+	if err := ClickHouseClient.Select(context.Background(), &activities, query, args...); err != nil {
+		return nil, nil, fmt.Errorf("query wallet activities failed: %w", err)
+	}
+
+	if len(activities) <= limit {
+		return activities, nil, nil
+	}
+	activities = activities[:limit]
+	last := activities[limit-1]
+	return activities, &WalletActivityCursor{
+		TransactionTime: last.TransactionTime,
+		TransactionHash: last.TransactionHash,
+		TokenAddress:    last.TokenAddress,
+	}, nil
+}
+
+// GetWalletActivityTokens 按最后成交时间倒序分页返回钱包交易过的代币，hasMore 表示是否还有下一页
+func GetWalletActivityTokens(chainType uint8, walletAddress string, filter WalletActivityFilter, offset, limit int) ([]string, bool, error) {
+	source, args := walletActivitySource(chainType, walletAddress, filter)
+	args = append(args, limit+1, offset)
+
+	rows, err := ClickHouseClient.Query(context.Background(), `
+        SELECT token_address, max(transaction_time) AS last_trade_time
+        FROM (`+source+`
+        )
+        GROUP BY token_address
+        ORDER BY last_trade_time DESC, token_address
+        LIMIT ? OFFSET ?`, args...)
+	if err != nil {
+		return nil, false, fmt.Errorf("query wallet activity tokens failed: %w", err)
+	}
+	defer rows.Close()
+
+	var tokens []string
+	for rows.Next() {
+		var token string
+		var lastTradeTime time.Time
+		if err := rows.Scan(&token, &lastTradeTime); err != nil {
+			return nil, false, fmt.Errorf("scan failed: %w", err)
+		}
+		tokens = append(tokens, token)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+
+	if len(tokens) <= limit {
+		return tokens, false, nil
+	}
+	return tokens[:limit], true, nil
+}
@@ -0,0 +1,110 @@
+package clickhouse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// WalletTrade 钱包的一笔买卖，用于计算持仓成本和盈亏
+type WalletTrade struct {
+	TokenAddress         string          `db:"token_address"`
+	PoolAddress          string          `db:"pool_address"`
+	TransactionType      uint8           `db:"transaction_type"`
+	BaseTokenAmount      uint64          `db:"base_token_amount"`  // SOL 数量（lamports）
+	QuoteTokenAmount     uint64          `db:"quote_token_amount"` // 代币数量（最小单位）
+	TransactionAmountUSD decimal.Decimal `db:"transaction_amount_usd"`
+	TransactionTime      time.Time       `db:"transaction_time"`
+}
+
+// 钱包盈亏计算的查询上限，盈亏需按成交顺序逐笔计算，避免一次加载交易量过大的钱包的全部历史
+const (
+	WalletTradesMaxRows   = 100000 // 单次加载的最大成交数
+	WalletTradesMaxTokens = 500    // 未指定代币时只计算最近交易的代币数
+)
+
+// ErrTooManyWalletTrades 钱包的成交数超过 WalletTradesMaxRows
+var ErrTooManyWalletTrades = errors.New("too many wallet trades")
+
+// GetWalletTrades 查询钱包的买卖，按代币和成交顺序排列
+// tokenAddresses 为空时查询最近交易的 WalletTradesMaxTokens 个代币，成交数超过 WalletTradesMaxRows 时返回 ErrTooManyWalletTrades
+func GetWalletTrades(chainType uint8, walletAddress string, tokenAddresses []string) ([]WalletTrade, error) {
+	query := `
+        SELECT
+            token_address,
+            pool_address,
+            transaction_type,
+            base_token_amount,
+            quote_token_amount,
+            transaction_amount_usd,
+            transaction_time
+        FROM token_transaction_ck_new_all
+        WHERE chain_type = ?
+          AND user_address = ?
+          AND transaction_type IN (1, 2)`
+	args := []any{chainType, walletAddress}
+	if len(tokenAddresses) > 0 {
+		query += `
+          AND token_address IN ?`
+		args = append(args, tokenAddresses)
+	} else {
+		query += `
+          AND token_address GLOBAL IN (
+              SELECT token_address
+              FROM token_transaction_ck_new_all
+              WHERE chain_type = ?
+                AND user_address = ?
+                AND transaction_type IN (1, 2)
+              GROUP BY token_address
+              ORDER BY max(transaction_time) DESC
+              LIMIT ?
+          )`
+		args = append(args, chainType, walletAddress, WalletTradesMaxTokens)
+	}
+	query += `
+        ORDER BY token_address, transaction_time, transaction_id
+        LIMIT ?`
+	args = append(args, WalletTradesMaxRows+1)
+
+	var trades []WalletTrade
+	if err := ClickHouseClient.Select(context.Background(), &trades, query, args...); err != nil {
+		return nil, fmt.Errorf("query wallet trades failed: %w", err)
+	}
+	if len(trades) > WalletTradesMaxRows {
+		return nil, fmt.Errorf("%w: wallet %s has more than %d trades", ErrTooManyWalletTrades, walletAddress, WalletTradesMaxRows)
+	}
+	return trades, nil
+}
+
+// GetLatestTokenPrices 查询代币最后一笔成交的美元价格，读取 1d 预聚合视图
+func GetLatestTokenPrices(tokenAddresses []string) (map[string]decimal.Decimal, error) {
+	prices := make(map[string]decimal.Decimal, len(tokenAddresses))
+	if len(tokenAddresses) == 0 {
+		return prices, nil
+	}
+
+	dayView := klineViews[len(klineViews)-1]
+	rows, err := ClickHouseClient.Query(context.Background(), fmt.Sprintf(`
+        SELECT token_address, argMaxMerge(close_state) AS close_price
+        FROM %s
+        WHERE token_address IN ?
+        GROUP BY token_address
+    `, dayView.table()), tokenAddresses)
+	if err != nil {
+		return nil, fmt.Errorf("query latest prices failed: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var token string
+		var price decimal.Decimal
+		if err := rows.Scan(&token, &price); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		prices[token] = price
+	}
+	return prices, rows.Err()
+}
@@ -0,0 +1,491 @@
+package clickhouse
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"game-fun-be/internal/metrics"
+	"game-fun-be/internal/pkg/util"
+)
+
+// 缓冲写入器：处理器将行交给后台按顺序写入，写入失败时按退避重试，仍失败则将行写入本地文件，ClickHouse 恢复后按顺序回放
+// 每次写入携带调用方的去重 token（由数据来源和行标识生成），重试、回放和消息重投递使用相同的 token，不会重复写入
+// Write 阻塞到行写入 ClickHouse 或落盘后才返回，调用方随后提交 Kafka offset；
+// 进程在此之前崩溃时 offset 未提交，消息由 Kafka 重新投递，按相同 token 去重
+// 等待写入的行达到上限，或写入失败后仍有待回放的落盘文件时拒绝写入，由调用方暂停消费并重试
+
+// spillFileSuffix 落盘文件后缀，写入过程中使用 .tmp 后缀，完成后重命名
+const spillFileSuffix = ".jsonl"
+
+// replayFilesPerFlush 每次刷写后最多回放的落盘文件数，避免回放占满写入时间
+const replayFilesPerFlush = 10
+
+// ErrWriterUnavailable 缓冲已满或 ClickHouse 不可用，写入被拒绝
+var ErrWriterUnavailable = errors.New("clickhouse buffered writer unavailable")
+
+// BufferedWriter 单张表的缓冲写入器
+type BufferedWriter[T any] struct {
+	table     string
+	send      func(ctx context.Context, rows []T) error
+	maxBuffer int // 等待写入的行数上限
+	interval  time.Duration
+	retries   int
+	spillDir  string
+
+	mu       sync.Mutex
+	pending  []*pendingWrite[T]
+	buffered int // pending 中的行数
+	seq      uint64
+	healthy  bool
+	closed   bool
+	spilled  int
+	lastErr  string
+
+	flushCh chan struct{}
+	stopCh  chan struct{}
+	done    chan struct{}
+}
+
+// pendingWrite 一次 Write 调用的行，按调用方的去重 token 单独写入，结果通过 done 返回
+type pendingWrite[T any] struct {
+	token string
+	rows  []T
+	done  chan error
+}
+
+// spillHeader 落盘文件首行，记录批次的去重 token，回放时使用
+type spillHeader struct {
+	Token string `json:"token"`
+}
+
+// WriterStatus 缓冲写入器状态
+type WriterStatus struct {
+	Table          string `json:"table"`
+	Healthy        bool   `json:"healthy"`
+	BufferedRows   int    `json:"buffered_rows"`
+	SpilledBatches int    `json:"spilled_batches"`
+	LastError      string `json:"last_error,omitempty"`
+}
+
+// NewBufferedWriter 创建缓冲写入器，send 负责将一批行写入 ClickHouse
+// 行需可 JSON 序列化，落盘和回放时使用
+func NewBufferedWriter[T any](table string, send func(ctx context.Context, rows []T) error) *BufferedWriter[T] {
+	spillDir := os.Getenv("CLICKHOUSE_WRITER_SPILL_DIR")
+	if spillDir == "" {
+		spillDir = "data/clickhouse-spill"
+	}
+	return &BufferedWriter[T]{
+		table:     table,
+		send:      send,
+		maxBuffer: util.GetEnvAsInt("CLICKHOUSE_WRITER_MAX_BUFFERED_ROWS", 50000),
+		interval:  util.GetEnvAsDuration("CLICKHOUSE_WRITER_FLUSH_INTERVAL", time.Second),
+		retries:   util.GetEnvAsInt("CLICKHOUSE_WRITER_RETRIES", 5),
+		spillDir:  filepath.Join(spillDir, table),
+		healthy:   true,
+		flushCh:   make(chan struct{}, 1),
+		stopCh:    make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// Start 启动后台刷写，启动时回放上次运行遗留的落盘文件
+func (w *BufferedWriter[T]) Start() error {
+	if err := os.MkdirAll(w.spillDir, 0o755); err != nil {
+		return fmt.Errorf("create spill dir failed: %w", err)
+	}
+	files, err := w.spillFiles()
+	if err != nil {
+		return err
+	}
+	w.setSpilled(len(files))
+
+	go w.run()
+	util.Log().Info("ClickHouse buffered writer started: table=%s interval=%v pending_spills=%d",
+		w.table, w.interval, len(files))
+	return nil
+}
+
+// Write 将行交给后台写入，阻塞到行写入 ClickHouse 或落盘后返回，token 为调用方的去重 token
+// 等待写入的行超过上限、上次写入失败且落盘批次尚未回放完成，或写入器已关闭时返回 ErrWriterUnavailable，不写入任何行；
+// 写入和落盘都失败时返回错误，调用方不应提交 offset
+func (w *BufferedWriter[T]) Write(token string, rows ...T) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return fmt.Errorf("%w: table=%s closed", ErrWriterUnavailable, w.table)
+	}
+	if !w.healthy && w.spilled > 0 {
+		w.mu.Unlock()
+		return fmt.Errorf("%w: table=%s spilled_batches=%d last_error=%s", ErrWriterUnavailable, w.table, w.spilled, w.lastErr)
+	}
+	if w.buffered+len(rows) > w.maxBuffer {
+		buffered := w.buffered
+		w.mu.Unlock()
+		return fmt.Errorf("%w: table=%s buffer full (%d/%d rows)", ErrWriterUnavailable, w.table, buffered, w.maxBuffer)
+	}
+	write := &pendingWrite[T]{token: token, rows: rows, done: make(chan error, 1)}
+	w.pending = append(w.pending, write)
+	w.buffered += len(rows)
+	buffered := w.buffered
+	w.mu.Unlock()
+
+	metrics.SetClickHouseWriterBufferedRows(w.table, buffered)
+	select {
+	case w.flushCh <- struct{}{}:
+	default:
+	}
+	return <-write.done
+}
+
+// Close 停止后台刷写并写出剩余的行，写入失败时落盘
+func (w *BufferedWriter[T]) Close() {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return
+	}
+	w.closed = true
+	w.mu.Unlock()
+
+	close(w.stopCh)
+	<-w.done
+}
+
+// Status 返回写入器状态
+func (w *BufferedWriter[T]) Status() WriterStatus {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return WriterStatus{
+		Table:          w.table,
+		Healthy:        w.healthy,
+		BufferedRows:   w.buffered,
+		SpilledBatches: w.spilled,
+		LastError:      w.lastErr,
+	}
+}
+
+func (w *BufferedWriter[T]) run() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.flush(w.retries)
+		case <-w.flushCh:
+			w.flush(w.retries)
+		case <-w.stopCh:
+			// 停机时只尝试一次，失败直接落盘，避免退避重试超出停机期限
+			w.flush(1)
+			return
+		}
+	}
+}
+
+// flush 按顺序写出等待中的行，每次写入最多尝试 attempts 次，全部成功后回放落盘文件
+func (w *BufferedWriter[T]) flush(attempts int) {
+	w.mu.Lock()
+	writes := w.pending
+	w.pending = nil
+	healthy := w.healthy
+	w.mu.Unlock()
+
+	failed := false
+	for _, write := range writes {
+		// 已知不可用时只尝试一次，避免退避期间等待写入的调用方持续堆积
+		tries := attempts
+		if !healthy || failed {
+			tries = 1
+		}
+		err := w.sendBatch(write.token, write.rows, tries)
+		if err == nil {
+			metrics.IncClickHouseWriterFlush(w.table, "ok")
+		} else {
+			failed = true
+			err = w.spill(write, err)
+		}
+		w.release(len(write.rows))
+		write.done <- err
+	}
+
+	if !failed && w.Status().SpilledBatches > 0 {
+		w.replaySpills()
+	}
+}
+
+// sendBatch 按调用方的去重 token 写入，失败时指数退避重试
+func (w *BufferedWriter[T]) sendBatch(token string, rows []T, attempts int) error {
+	delay := 500 * time.Millisecond
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if err = w.send(dedupContext(token), rows); err == nil {
+			w.setHealthy(nil)
+			return nil
+		}
+		if attempt < attempts {
+			util.Log().Warning("ClickHouse writer %s batch %s failed (attempt %d/%d), retrying in %v: %v",
+				w.table, token, attempt, attempts, delay, err)
+			time.Sleep(delay)
+			if delay < 10*time.Second {
+				delay *= 2
+			}
+		}
+	}
+	w.setHealthy(err)
+	return err
+}
+
+// spill 将写入失败的行写入本地文件，落盘也失败时返回错误，由调用方不提交 offset 等待重投递
+func (w *BufferedWriter[T]) spill(write *pendingWrite[T], sendErr error) error {
+	w.mu.Lock()
+	w.seq++
+	batchID := fmt.Sprintf("%d-%06d", time.Now().UnixNano(), w.seq)
+	w.mu.Unlock()
+
+	path := filepath.Join(w.spillDir, batchID+spillFileSuffix)
+	if err := writeSpillFile(path, write.token, write.rows); err != nil {
+		metrics.IncClickHouseWriterFlush(w.table, "error")
+		util.Log().Error("ClickHouse writer %s failed to write %d rows: send failed: %v, spill failed: %v",
+			w.table, len(write.rows), sendErr, err)
+		return fmt.Errorf("clickhouse writer %s: send failed: %v, spill failed: %w", w.table, sendErr, err)
+	}
+
+	w.mu.Lock()
+	w.spilled++
+	spilled := w.spilled
+	w.mu.Unlock()
+	metrics.SetClickHouseWriterSpilledBatches(w.table, spilled)
+	metrics.IncClickHouseWriterFlush(w.table, "spilled")
+	util.Log().Warning("ClickHouse writer %s spilled %d rows to %s: %v", w.table, len(write.rows), path, sendErr)
+	return nil
+}
+
+// release 写入完成后扣减等待写入的行数
+func (w *BufferedWriter[T]) release(rows int) {
+	w.mu.Lock()
+	w.buffered -= rows
+	buffered := w.buffered
+	w.mu.Unlock()
+	metrics.SetClickHouseWriterBufferedRows(w.table, buffered)
+}
+
+// replaySpills 按批次号顺序回放落盘文件，失败时停止，下次刷写后继续
+func (w *BufferedWriter[T]) replaySpills() {
+	files, err := w.spillFiles()
+	if err != nil {
+		util.Log().Error("ClickHouse writer %s list spill files failed: %v", w.table, err)
+		return
+	}
+	defer func() {
+		remaining, err := w.spillFiles()
+		if err == nil {
+			w.setSpilled(len(remaining))
+		}
+	}()
+
+	if len(files) > replayFilesPerFlush {
+		files = files[:replayFilesPerFlush]
+	}
+	for _, path := range files {
+		var rows []T
+		token, err := readSpillFile(path, &rows)
+		if err != nil {
+			// 损坏的文件改名保留，不再阻塞后续回放
+			util.Log().Error("ClickHouse writer %s skip unreadable spill file %s: %v", w.table, path, err)
+			if err := os.Rename(path, path+".bad"); err != nil {
+				util.Log().Error("ClickHouse writer %s rename spill file %s failed: %v", w.table, path, err)
+			}
+			continue
+		}
+
+		if err := w.sendBatch(token, rows, 1); err != nil {
+			util.Log().Warning("ClickHouse writer %s replay %s failed, will retry: %v", w.table, path, err)
+			return
+		}
+		if err := os.Remove(path); err != nil {
+			util.Log().Error("ClickHouse writer %s remove spill file %s failed: %v", w.table, path, err)
+			return
+		}
+		metrics.IncClickHouseWriterFlush(w.table, "replayed")
+		util.Log().Info("ClickHouse writer %s replayed %d rows from %s", w.table, len(rows), path)
+	}
+}
+
+// spillFiles 返回落盘文件，按文件名（批次号）排序
+func (w *BufferedWriter[T]) spillFiles() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(w.spillDir, "*"+spillFileSuffix))
+	if err != nil {
+		return nil, fmt.Errorf("list spill files failed: %w", err)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func (w *BufferedWriter[T]) setHealthy(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err == nil {
+		if !w.healthy {
+			util.Log().Info("ClickHouse writer %s recovered", w.table)
+		}
+		w.healthy = true
+		return
+	}
+	w.healthy = false
+	w.lastErr = err.Error()
+}
+
+func (w *BufferedWriter[T]) setSpilled(count int) {
+	w.mu.Lock()
+	w.spilled = count
+	w.mu.Unlock()
+	metrics.SetClickHouseWriterSpilledBatches(w.table, count)
+}
+
+// writeSpillFile 首行写入去重 token，之后每行一条 JSON 写入临时文件，同步到磁盘后重命名，回放不会读到写了一半的文件
+func writeSpillFile[T any](path string, token string, rows []T) error {
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	if err := encoder.Encode(spillHeader{Token: token}); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+	for _, row := range rows {
+		if err := encoder.Encode(row); err != nil {
+			file.Close()
+			os.Remove(tmp)
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// readSpillFile 读取落盘文件中的去重 token 和行
+func readSpillFile[T any](path string, rows *[]T) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(bufio.NewReader(file))
+	var header spillHeader
+	if err := decoder.Decode(&header); err != nil {
+		return "", err
+	}
+	if header.Token == "" {
+		return "", fmt.Errorf("spill file %s has no dedup token", path)
+	}
+	for decoder.More() {
+		var row T
+		if err := decoder.Decode(&row); err != nil {
+			return "", err
+		}
+		*rows = append(*rows, row)
+	}
+	return header.Token, nil
+}
+
+var (
+	transactionWriter      *BufferedWriter[*TokenTransactionCk]
+	proxyTransactionWriter *BufferedWriter[*ProxyTransaction]
+)
+
+// StartBufferedWriters 开启交易表的缓冲写入，CLICKHOUSE_ASYNC_WRITES=true 时生效
+// 开启后 BatchInsertTransactions、InsertProxyTransaction 经由缓冲写入器写入，ClickHouse 不可用时行落盘后返回成功，
+// Kafka offset 只在行写入 ClickHouse 或落盘后提交
+func StartBufferedWriters() error {
+	if os.Getenv("CLICKHOUSE_ASYNC_WRITES") != "true" {
+		return nil
+	}
+
+	txWriter := NewBufferedWriter("token_transaction_ck_new_all", sendTransactionBatch)
+	if err := txWriter.Start(); err != nil {
+		return err
+	}
+	proxyWriter := NewBufferedWriter("proxy_transaction_ck_all", sendProxyTransactionBatch)
+	if err := proxyWriter.Start(); err != nil {
+		txWriter.Close()
+		return err
+	}
+	transactionWriter, proxyTransactionWriter = txWriter, proxyWriter
+	return nil
+}
+
+// CloseBufferedWriters 写出剩余的行，需在关闭 ClickHouse 连接之前调用
+// ctx 到期时不再等待，返回错误，尚未写入或落盘的行对应的 offset 未提交，重启后重新消费
+func CloseBufferedWriters(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var wg sync.WaitGroup
+		if transactionWriter != nil {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				transactionWriter.Close()
+			}()
+		}
+		if proxyTransactionWriter != nil {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				proxyTransactionWriter.Close()
+			}()
+		}
+		wg.Wait()
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("close buffered writers: %w", ctx.Err())
+	}
+}
+
+// GetBufferedWriterStatuses 返回缓冲写入器状态，未开启时为空
+func GetBufferedWriterStatuses() []WriterStatus {
+	statuses := []WriterStatus{}
+	if transactionWriter != nil {
+		statuses = append(statuses, transactionWriter.Status())
+	}
+	if proxyTransactionWriter != nil {
+		statuses = append(statuses, proxyTransactionWriter.Status())
+	}
+	return statuses
+}
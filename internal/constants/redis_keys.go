@@ -38,6 +38,15 @@ const (
 	// RedisKeyTokenTransactionID 代币交易记录的分布式ID生成器的Redis键
 	RedisKeyTokenTransactionID = "token:transaction:id"
 
+	// RedisKeyPrefixKafkaProcessed Kafka 消息幂等处理记录的 Redis key 前缀
+	RedisKeyPrefixKafkaProcessed = "kafka:processed"
+	// RedisKeyKafkaDuplicateStats Kafka 重复消息跳过次数统计的 Redis 键
+	RedisKeyKafkaDuplicateStats = "kafka:duplicate:stats"
+	// RedisKeyPumpCurveParams 最新 pump.fun 联合曲线参数缓存
+	RedisKeyPumpCurveParams = "pump:curve:params"
+	// RedisKeyPointTxStatusSchedule 积分交易状态延迟检测队列（ZSET，score 为下次检测时间毫秒）
+	RedisKeyPointTxStatusSchedule = "point:tx:status:schedule"
+
 	RedisKeyVaultAmount          = "vault_amount"
 	RedisKeyQuotaAmountLast10Min = "quota_amount_last_10_min"
 )
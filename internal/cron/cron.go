@@ -8,6 +8,7 @@ import (
 	"strings"
 	"time"
 
+	"game-fun-be/internal/metrics"
 	"game-fun-be/internal/model"
 	"game-fun-be/internal/pkg/util"
 	"game-fun-be/internal/service"
@@ -32,8 +33,7 @@ func InitCronJobs() {
 
 	// 遍历打印每个任务
 	for i, entry := range entries {
-		fullName := runtime.FuncForPC(reflect.ValueOf(entry.Job).Pointer()).Name()
-		funcName := fullName[strings.LastIndex(fullName, ".")+1:]
+		funcName := jobName(entry.Job)
 		nextRun := entry.Next.In(time.Local).Format("2006-01-02 15:04:05")
 
 		// 使用字符串拼接方式，使源码更整齐
@@ -54,22 +54,44 @@ func InitCronJobs() {
 	util.Log().Info("====================================\n")
 }
 
+// metricsJob 带名称的定时任务，执行结果和耗时会记录到监控指标
+type metricsJob struct {
+	name string
+	run  func() error
+}
+
+// Run 实现 cron.Job
+func (j metricsJob) Run() {
+	start := time.Now()
+	err := j.run()
+	metrics.ObserveCronJob(j.name, start, err)
+}
+
+// jobName 获取定时任务名称，用于启动时打印
+func jobName(job cron.Job) string {
+	if mj, ok := job.(metricsJob); ok {
+		return mj.name
+	}
+	fullName := runtime.FuncForPC(reflect.ValueOf(job).Pointer()).Name()
+	return fullName[strings.LastIndex(fullName, ".")+1:]
+}
+
 // addJobs 添加所有定时任务
 func addJobs() {
 	// 每小时执行一次的任务
-	_, err := cronJob.AddFunc("0 0 * * * *", hourlyTask)
+	_, err := cronJob.AddJob("0 0 * * * *", metricsJob{name: "hourlyTask", run: hourlyTask})
 	if err != nil {
 		util.Log().Error("Failed to add hourly task: %v", err)
 	}
 
 	// 每天凌晨执行的任务
-	_, err = cronJob.AddFunc("0 0 0 * * *", dailyTask)
+	_, err = cronJob.AddJob("0 0 0 * * *", metricsJob{name: "dailyTask", run: dailyTask})
 	if err != nil {
 		util.Log().Error("Failed to add daily task: %v", err)
 	}
 
 	// 每5分执行一次的钟定时任务
-	_, err = cronJob.AddFunc("0 */5 * * * *", every5MinuteTask)
+	_, err = cronJob.AddJob("0 */5 * * * *", metricsJob{name: "every5MinuteTask", run: every5MinuteTask})
 	if err != nil {
 		util.Log().Error("Failed to add searchDocumentsJob: %v", err)
 	}
@@ -81,43 +103,56 @@ func addJobs() {
 	// }
 
 	// 添加每分钟获取 SOL 价格的任务
-	_, err = cronJob.AddFunc("0 * * * * *", fetchSolPrice)
+	_, err = cronJob.AddJob("0 * * * * *", metricsJob{name: "fetchSolPrice", run: fetchSolPrice})
 	if err != nil {
 		util.Log().Error("Failed to add SOL price fetching task: %v", err)
 	}
 
+	// 每分钟按自有持仓余额刷新最近有交易的代币的持有者统计
+	_, err = cronJob.AddJob("30 * * * * *", metricsJob{name: "refreshHolderStats", run: refreshHolderStats})
+	if err != nil {
+		util.Log().Error("Failed to add holder stats refreshing task: %v", err)
+	}
+
 	// 添加每天早上7点执行重新索引的任务
-	_, err = cronJob.AddFunc("0 0 7 * * *", func() {
-		if err := ExecuteReindexJob(); err != nil {
+	_, err = cronJob.AddJob("0 0 7 * * *", metricsJob{name: "executeReindexJob", run: func() error {
+		err := ExecuteReindexJob()
+		if err != nil {
 			util.Log().Error("Reindex job failed: %v", err)
 		}
-	})
+		return err
+	}})
 	if err != nil {
 		util.Log().Error("Failed to add reindex task: %v", err)
 	}
 }
 
 // hourlyTask 每小时执行的任务
-func hourlyTask() {
+func hourlyTask() error {
 	const task = "[hourlyTask]"
 	util.Log().Info("%s Starting task\n", task)
 	// 在这里添加每小时需要执行的逻辑
-	createNextDayTable()
+	if err := createNextDayTable(); err != nil {
+		return err
+	}
 	util.Log().Info("%s Task completed\n", task)
+	return nil
 }
 
 // dailyTask 每天执的任务
-func dailyTask() {
+func dailyTask() error {
 	// 在这里添加每天需要执行的逻辑
 	// RefreshHotTokensJob()
+	return nil
 }
 
 // every5MinuteTask 每5分钟执行的任务
-func every5MinuteTask() {
+func every5MinuteTask() error {
 	// 在这里添加每5分钟需要执行的逻辑
+	return nil
 }
 
-func createNextDayTable() {
+func createNextDayTable() error {
 	const task = "[createNextDayTable]"
 	util.Log().Info("%s Starting at: %v\n", task, time.Now())
 	util.Log().Info("%s Current timezone: %v\n", task, time.Now().Location())
@@ -128,27 +163,51 @@ func createNextDayTable() {
 	err := model.CreateTableForDate(tomorrow.Format("20060102"))
 	if err != nil {
 		util.Log().Error("%s Failed to create table: %v\n", task, err)
-		return
+		return err
 	}
 
 	util.Log().Info("%s Table creation completed successfully\n", task)
 	fmt.Println("Table creation completed successfully")
+	return nil
 }
 
 // fetchSolPrice 每分钟获取 SOL 价格的任务
-func fetchSolPrice() {
+func fetchSolPrice() error {
 	const task = "[fetchSolPrice]"
 	ctx := context.Background()
 	err := service.FetchAndStoreSolPrice(ctx)
 	if err != nil {
 		util.Log().Error("%s Failed to fetch and store SOL price: %v\n", task, err)
 	}
+	return err
+}
+
+// refreshHolderStats 刷新最近 2 分钟有交易的代币的持有者数量、前 10 占比和开发者占比
+func refreshHolderStats() error {
+	const task = "[refreshHolderStats]"
+	updated, err := service.RefreshTokenHolderStats(uint8(model.ChainTypeSolana), time.Now().Add(-2*time.Minute))
+	if err != nil {
+		util.Log().Error("%s Failed to refresh holder stats: %v\n", task, err)
+		return err
+	}
+	util.Log().Info("%s Refreshed %d tokens\n", task, updated)
+	return nil
 }
 
-// StopCronJobs 停止所有定时任务
-func StopCronJobs() {
-	if cronJob != nil {
-		cronJob.Stop()
+// StopCronJobs 停止调度新的定时任务，并等待正在运行的任务完成
+// ctx 超时后不再等待，返回 ctx 的错误
+func StopCronJobs(ctx context.Context) error {
+	if cronJob == nil {
+		return nil
+	}
+
+	jobsDone := cronJob.Stop()
+	select {
+	case <-jobsDone.Done():
 		util.Log().Info("Cron jobs stopped\n")
+		return nil
+	case <-ctx.Done():
+		util.Log().Error("Timed out waiting for running cron jobs: %v\n", ctx.Err())
+		return ctx.Err()
 	}
 }
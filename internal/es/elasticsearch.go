@@ -8,6 +8,7 @@ import (
 	"game-fun-be/internal/pkg/util"
 	"io"
 	"log"
+	"net/http"
 	"os"
 	"strings"
 	"time"
@@ -23,6 +24,7 @@ func Elasticsearch() {
 		elastic.SetURL(os.Getenv("ES_URL")),
 		elastic.SetSniff(false),
 		elastic.SetHealthcheck(false),
+		elastic.SetHttpClient(&http.Client{Transport: &metricsTransport{next: http.DefaultTransport}}),
 		elastic.SetBasicAuth(
 			os.Getenv("ES_USERNAME"),
 			os.Getenv("ES_PASSWORD"),
@@ -766,3 +768,10 @@ func AliasExists(aliasName string) (bool, error) {
 
 	return false, nil
 }
+
+// CloseElasticsearch 停止 Elasticsearch 客户端的后台任务
+func CloseElasticsearch() {
+	if ESClient != nil {
+		ESClient.Stop()
+	}
+}
@@ -0,0 +1,36 @@
+package es
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"game-fun-be/internal/metrics"
+)
+
+// metricsTransport 记录每个 Elasticsearch 请求的耗时和错误
+type metricsTransport struct {
+	next http.RoundTripper
+}
+
+func (t *metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	failed := err != nil || resp.StatusCode >= http.StatusInternalServerError
+	metrics.ObserveES(esOperation(req), start, failed)
+	return resp, err
+}
+
+// esOperation 取路径中最后一个以下划线开头的段作为操作标签，如 _search、_bulk，避免索引名和文档 ID 进入标签
+func esOperation(req *http.Request) string {
+	segments := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	for i := len(segments) - 1; i >= 0; i-- {
+		if strings.HasPrefix(segments[i], "_") {
+			return req.Method + " " + segments[i]
+		}
+	}
+	if len(segments) == 1 && segments[0] == "" {
+		return req.Method + " /"
+	}
+	return req.Method + " index"
+}
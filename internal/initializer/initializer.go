@@ -1,6 +1,7 @@
 package initializer
 
 import (
+	"context"
 	"game-fun-be/internal/clickhouse"
 	"game-fun-be/internal/conf"
 	"game-fun-be/internal/cron"
@@ -26,9 +27,20 @@ func Setup(env string) sarama.SyncProducer {
 
 	// 初始化数据库、redis、elasticsearch
 	model.Database(os.Getenv("MYSQL_DSN"))
+	if err := model.AddPointRecordsTxStatusColumn(); err != nil {
+		util.Log().Error("Failed to add point_records.tx_status column: %v", err)
+	}
 	redis.Redis()
 	es.Elasticsearch()
 	clickhouse.ClickHouse()
+	if os.Getenv("CLICKHOUSE_MIGRATE_ON_START") != "false" {
+		if _, err := clickhouse.Migrate(); err != nil {
+			util.Log().Error("Failed to apply ClickHouse migrations: %v", err)
+		}
+	}
+	if err := clickhouse.StartBufferedWriters(); err != nil {
+		util.Log().Error("Failed to start ClickHouse buffered writers: %v", err)
+	}
 
 	endpoint := os.Getenv("BLOCKCHAIN_API_ENDPOINT")
 	httpUtil.InitAPI(&endpoint)
@@ -37,6 +49,9 @@ func Setup(env string) sarama.SyncProducer {
 	// 初始化 Kafka 生产者
 	producer := kafka.Kafka()
 
+	// 启动发件箱投递，接口写入的 Kafka 消息由此异步发送
+	kafka.StartOutboxRelay()
+
 	// 如果不是 debug 环境
 	if !conf.IsDebug() {
 		// 通过环境变量控制:
@@ -55,3 +70,45 @@ func Setup(env string) sarama.SyncProducer {
 	}
 	return producer
 }
+
+// Shutdown 按顺序关闭各组件：先排空 Kafka 消费和定时任务，再关闭存储连接，最后关闭 Kafka 生产者
+// ctx 为整体停机的截止时间，超时后剩余组件仍会被关闭，但不再等待正在进行的处理
+func Shutdown(ctx context.Context) {
+	util.Log().Info("Shutting down components...")
+
+	// 1. 停止消费，处理并提交内存中的批次
+	if err := kafka.ShutdownConsumer(ctx); err != nil {
+		util.Log().Error("Failed to shutdown Kafka consumer: %v", err)
+	}
+
+	// 停止发件箱投递，未投递的消息保留在表中，下次启动后继续发送
+	if err := kafka.StopOutboxRelay(ctx); err != nil {
+		util.Log().Error("Failed to stop Kafka outbox relay: %v", err)
+	}
+
+	// 2. 等待正在运行的定时任务
+	if err := cron.StopCronJobs(ctx); err != nil {
+		util.Log().Error("Failed to stop cron jobs: %v", err)
+	}
+
+	// 3. 写出 ClickHouse 缓冲中的数据，再关闭存储连接
+	if err := clickhouse.CloseBufferedWriters(ctx); err != nil {
+		util.Log().Error("Failed to flush ClickHouse buffered writers: %v", err)
+	}
+	if err := clickhouse.CloseClickHouse(); err != nil {
+		util.Log().Error("Failed to close ClickHouse: %v", err)
+	}
+	es.CloseElasticsearch()
+	if err := redis.CloseRedis(); err != nil {
+		util.Log().Error("Failed to close Redis: %v", err)
+	}
+	if err := model.CloseDatabase(); err != nil {
+		util.Log().Error("Failed to close MySQL: %v", err)
+	}
+
+	// 4. 最后关闭 Kafka 生产者，保证前面的处理过程中仍可发送消息
+	kafka.Close()
+	kafka.CloseCapture()
+
+	util.Log().Info("All components shut down")
+}
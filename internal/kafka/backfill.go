@@ -0,0 +1,606 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"game-fun-be/internal/clickhouse"
+	"game-fun-be/internal/model"
+	"game-fun-be/internal/pkg/util"
+	"game-fun-be/internal/service"
+
+	"github.com/IBM/sarama"
+)
+
+// 回填任务状态
+const (
+	BackfillStatusRunning   = "running"
+	BackfillStatusCompleted = "completed"
+	BackfillStatusFailed    = "failed"
+	BackfillStatusCancelled = "cancelled"
+)
+
+// backfillSinksByHandler 各处理器在重建模式下支持写入的存储，取值见 Sink* 常量
+// 重建模式只写入交易明细，不更新代币、池子、积分等聚合状态，避免重复累加
+var backfillSinksByHandler = map[string][]string{
+	MessageTypeRaySwap:      {SinkMySQL, SinkElasticsearch, SinkClickHouse},
+	MessageTypeGameOutTrade: {SinkClickHouse},
+	MessageTypeGameInTrade:  {SinkClickHouse},
+}
+
+// backfillIdleTimeout 分区在该时间内没有新消息时视为已读到末尾
+// 区间末尾的 offset 可能是事务控制记录或已被压缩，不会投递，环境变量 KAFKA_BACKFILL_IDLE_TIMEOUT 以秒为单位
+func backfillIdleTimeout() time.Duration {
+	return util.GetEnvAsDuration("KAFKA_BACKFILL_IDLE_TIMEOUT", 30*time.Second)
+}
+
+// BackfillOptions 回填任务参数
+// 起点优先使用 StartOffset，未设置时使用 StartTime；终点同理，均未设置时读到任务开始时的最新 offset
+// 只支持 Raydium swap 和游戏代理交易 topic（见 backfillSinksByHandler），pump 系列 topic 会更新代币状态，不支持回填
+// Raydium swap 写入 ClickHouse 时按回填批次的 offset 区间生成去重 token，与线上消费的批次边界不同，
+// 区间内已有的行无法去重，需先清理 ClickHouse 中对应区间的交易并设置 ClickHouseTruncated
+type BackfillOptions struct {
+	Topics              []string  `json:"topics"`
+	Sinks               []string  `json:"sinks"`
+	StartTime           time.Time `json:"start_time"`
+	EndTime             time.Time `json:"end_time"`
+	StartOffset         *int64    `json:"start_offset,omitempty"` // 对所有分区生效
+	EndOffset           *int64    `json:"end_offset,omitempty"`   // 不包含该 offset
+	BatchSize           int       `json:"batch_size"`
+	ClickHouseTruncated bool      `json:"clickhouse_truncated"` // 调用方确认 ClickHouse 中回填区间的 swap 交易已清理
+}
+
+// BackfillPartitionProgress 单个分区的回填进度
+type BackfillPartitionProgress struct {
+	Topic         string `json:"topic"`
+	Partition     int32  `json:"partition"`
+	StartOffset   int64  `json:"start_offset"`
+	EndOffset     int64  `json:"end_offset"`
+	CurrentOffset int64  `json:"current_offset"`
+	Processed     int64  `json:"processed"`
+	Failed        int64  `json:"failed"`
+	Done          bool   `json:"done"`
+}
+
+// BackfillJob 回填任务
+type BackfillJob struct {
+	ID         string                       `json:"id"`
+	Options    BackfillOptions              `json:"options"`
+	Status     string                       `json:"status"`
+	Error      string                       `json:"error,omitempty"`
+	StartedAt  time.Time                    `json:"started_at"`
+	FinishedAt *time.Time                   `json:"finished_at,omitempty"`
+	Total      int64                        `json:"total"`
+	Processed  int64                        `json:"processed"`
+	Failed     int64                        `json:"failed"`
+	Partitions []*BackfillPartitionProgress `json:"partitions"`
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+}
+
+var (
+	backfillJobsMu sync.Mutex
+	backfillJobs   = make(map[string]*BackfillJob)
+)
+
+// StartBackfill 校验参数并在后台启动回填任务
+// 回填直接按分区读取，不加入线上消费组，也不提交 offset，不影响线上消费进度
+func StartBackfill(opts BackfillOptions) (*BackfillJob, error) {
+	handlers, err := resolveBackfillHandlers(opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = util.GetEnvAsInt("KAFKA_BACKFILL_BATCH_SIZE", 500)
+	}
+
+	client, err := sarama.NewClient(strings.Split(os.Getenv("KAFKA_BROKERS"), ","), KafkaConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kafka client: %w", err)
+	}
+
+	partitions, err := resolveBackfillRanges(client, opts)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &BackfillJob{
+		ID:         fmt.Sprintf("backfill-%d", time.Now().UnixNano()),
+		Options:    opts,
+		Status:     BackfillStatusRunning,
+		StartedAt:  time.Now(),
+		Partitions: partitions,
+		cancel:     cancel,
+	}
+	for _, p := range partitions {
+		job.Total += p.EndOffset - p.StartOffset
+	}
+
+	backfillJobsMu.Lock()
+	backfillJobs[job.ID] = job
+	backfillJobsMu.Unlock()
+
+	util.Log().Info("Backfill job %s started: topics=%v sinks=%v partitions=%d total=%d",
+		job.ID, opts.Topics, opts.Sinks, len(partitions), job.Total)
+
+	go job.run(ctx, client, handlers)
+	return job.Snapshot(), nil
+}
+
+// GetBackfillJob 获取回填任务进度
+func GetBackfillJob(id string) (*BackfillJob, error) {
+	backfillJobsMu.Lock()
+	job, ok := backfillJobs[id]
+	backfillJobsMu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("backfill job not found: %s", id)
+	}
+	return job.Snapshot(), nil
+}
+
+// ListBackfillJobs 列出所有回填任务，按开始时间倒序
+func ListBackfillJobs() []*BackfillJob {
+	backfillJobsMu.Lock()
+	jobs := make([]*BackfillJob, 0, len(backfillJobs))
+	for _, job := range backfillJobs {
+		jobs = append(jobs, job.Snapshot())
+	}
+	backfillJobsMu.Unlock()
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].StartedAt.After(jobs[j].StartedAt)
+	})
+	return jobs
+}
+
+// CancelBackfill 取消运行中的回填任务，已写入的数据不会回滚
+func CancelBackfill(id string) error {
+	backfillJobsMu.Lock()
+	job, ok := backfillJobs[id]
+	backfillJobsMu.Unlock()
+	if !ok {
+		return fmt.Errorf("backfill job not found: %s", id)
+	}
+	job.cancel()
+	return nil
+}
+
+// Snapshot 返回任务当前状态的副本
+func (job *BackfillJob) Snapshot() *BackfillJob {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+
+	snapshot := &BackfillJob{
+		ID:         job.ID,
+		Options:    job.Options,
+		Status:     job.Status,
+		Error:      job.Error,
+		StartedAt:  job.StartedAt,
+		FinishedAt: job.FinishedAt,
+		Total:      job.Total,
+		Processed:  job.Processed,
+		Failed:     job.Failed,
+		Partitions: make([]*BackfillPartitionProgress, 0, len(job.Partitions)),
+	}
+	for _, p := range job.Partitions {
+		progress := *p
+		snapshot.Partitions = append(snapshot.Partitions, &progress)
+	}
+	return snapshot
+}
+
+// resolveBackfillHandlers 校验 topic 与存储，返回各 topic 对应的处理器名称
+func resolveBackfillHandlers(opts BackfillOptions) (map[string]string, error) {
+	if len(opts.Topics) == 0 {
+		return nil, fmt.Errorf("at least one topic is required")
+	}
+	if len(opts.Sinks) == 0 {
+		return nil, fmt.Errorf("at least one sink is required")
+	}
+	if opts.StartOffset == nil && opts.StartTime.IsZero() {
+		return nil, fmt.Errorf("start_time or start_offset is required")
+	}
+
+	entries, err := LoadTopicRegistry()
+	if err != nil {
+		return nil, err
+	}
+	handlerByTopic := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		handlerByTopic[entry.TopicName()] = entry.Handler
+	}
+
+	handlers := make(map[string]string, len(opts.Topics))
+	for _, topic := range opts.Topics {
+		handler, ok := handlerByTopic[topic]
+		if !ok {
+			return nil, fmt.Errorf("topic %s is not in the topic registry", topic)
+		}
+		supported, ok := backfillSinksByHandler[handler]
+		if !ok {
+			return nil, fmt.Errorf("topic %s (handler %s) does not support backfill", topic, handler)
+		}
+		for _, sink := range opts.Sinks {
+			if !containsString(supported, sink) {
+				return nil, fmt.Errorf("topic %s (handler %s) does not support sink %s, supported: %v", topic, handler, sink, supported)
+			}
+		}
+		// 游戏代理交易按交易签名去重，可以覆盖已有数据；swap 的去重 token 与线上批次不同，重复写入会产生重复行
+		if handler == MessageTypeRaySwap && containsString(opts.Sinks, SinkClickHouse) && !opts.ClickHouseTruncated {
+			return nil, fmt.Errorf("topic %s: rebuilding ClickHouse would duplicate existing rows, truncate the target range first and set clickhouse_truncated", topic)
+		}
+		handlers[topic] = handler
+	}
+	return handlers, nil
+}
+
+// resolveBackfillRanges 计算每个分区需要回填的 offset 区间 [start, end)
+func resolveBackfillRanges(client sarama.Client, opts BackfillOptions) ([]*BackfillPartitionProgress, error) {
+	var ranges []*BackfillPartitionProgress
+	for _, topic := range opts.Topics {
+		partitions, err := client.Partitions(topic)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get partitions of %s: %w", topic, err)
+		}
+
+		for _, partition := range partitions {
+			oldest, err := client.GetOffset(topic, partition, sarama.OffsetOldest)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get oldest offset of %s/%d: %w", topic, partition, err)
+			}
+			newest, err := client.GetOffset(topic, partition, sarama.OffsetNewest)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get newest offset of %s/%d: %w", topic, partition, err)
+			}
+
+			start, err := backfillBoundary(client, topic, partition, opts.StartOffset, opts.StartTime, oldest, newest)
+			if err != nil {
+				return nil, err
+			}
+			end, err := backfillBoundary(client, topic, partition, opts.EndOffset, opts.EndTime, newest, newest)
+			if err != nil {
+				return nil, err
+			}
+			if start < oldest {
+				start = oldest
+			}
+			if end > newest {
+				end = newest
+			}
+			if end < start {
+				end = start
+			}
+
+			ranges = append(ranges, &BackfillPartitionProgress{
+				Topic:         topic,
+				Partition:     partition,
+				StartOffset:   start,
+				EndOffset:     end,
+				CurrentOffset: start,
+				Done:          start == end,
+			})
+		}
+	}
+	return ranges, nil
+}
+
+// backfillBoundary 根据 offset 或时间戳计算分区边界，均未设置时返回 fallback
+// 按时间戳查询时返回第一条时间戳不早于该时间的消息 offset，不存在时返回最新 offset
+func backfillBoundary(client sarama.Client, topic string, partition int32, offset *int64, t time.Time, fallback, newest int64) (int64, error) {
+	if offset != nil {
+		return *offset, nil
+	}
+	if t.IsZero() {
+		return fallback, nil
+	}
+
+	result, err := client.GetOffset(topic, partition, t.UnixMilli())
+	if err != nil {
+		return 0, fmt.Errorf("failed to get offset of %s/%d at %s: %w", topic, partition, t.Format(time.RFC3339), err)
+	}
+	if result < 0 {
+		return newest, nil
+	}
+	return result, nil
+}
+
+// run 并发回填所有分区，全部结束后更新任务状态
+func (job *BackfillJob) run(ctx context.Context, client sarama.Client, handlers map[string]string) {
+	defer client.Close()
+	defer job.cancel()
+
+	consumer, err := sarama.NewConsumerFromClient(client)
+	if err != nil {
+		job.finish(ctx, fmt.Errorf("failed to create kafka consumer: %w", err))
+		return
+	}
+	defer consumer.Close()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	for _, progress := range job.Partitions {
+		if progress.Done {
+			continue
+		}
+		wg.Add(1)
+		go func(progress *BackfillPartitionProgress) {
+			defer wg.Done()
+			if err := job.runPartition(ctx, consumer, progress, handlers[progress.Topic]); err != nil {
+				errOnce.Do(func() { firstErr = err })
+			}
+		}(progress)
+	}
+	wg.Wait()
+
+	job.finish(ctx, firstErr)
+}
+
+// runPartition 读取单个分区的 offset 区间，按批交给重建处理器
+func (job *BackfillJob) runPartition(ctx context.Context, consumer sarama.Consumer, progress *BackfillPartitionProgress, handler string) error {
+	pc, err := consumer.ConsumePartition(progress.Topic, progress.Partition, progress.StartOffset)
+	if err != nil {
+		return fmt.Errorf("failed to consume %s/%d: %w", progress.Topic, progress.Partition, err)
+	}
+	defer pc.Close()
+
+	batch := make([]Message, 0, job.Options.BatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		failed := rebuildBatch(handler, batch, job.Options.Sinks)
+		job.recordProgress(progress, batch[len(batch)-1].Offset+1, int64(len(batch)), int64(failed))
+		batch = batch[:0]
+	}
+
+	finish := func() {
+		flush()
+		job.markPartitionDone(progress)
+	}
+
+	idleTimeout := backfillIdleTimeout()
+	idle := time.NewTimer(idleTimeout)
+	defer idle.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			flush()
+			return nil
+		case msg := <-pc.Messages():
+			// 区间内剩余的 offset 未投递（如事务控制记录），已越过终点
+			if msg.Offset >= progress.EndOffset {
+				finish()
+				return nil
+			}
+			batch = append(batch, fromSaramaMessage(msg))
+			if next := msg.Offset + 1; next >= progress.EndOffset || next >= pc.HighWaterMarkOffset() {
+				finish()
+				return nil
+			}
+			if len(batch) >= job.Options.BatchSize {
+				flush()
+			}
+			idle.Reset(idleTimeout)
+		case <-idle.C:
+			flush()
+			util.Log().Warning("Backfill %s/%d idle for %v at offset %d, end offset %d, high water mark %d, treat as done",
+				progress.Topic, progress.Partition, idleTimeout, job.currentOffset(progress), progress.EndOffset, pc.HighWaterMarkOffset())
+			job.markPartitionDone(progress)
+			return nil
+		case err := <-pc.Errors():
+			flush()
+			return fmt.Errorf("failed to read %s/%d: %w", progress.Topic, progress.Partition, err)
+		}
+	}
+}
+
+func (job *BackfillJob) recordProgress(progress *BackfillPartitionProgress, nextOffset int64, processed int64, failed int64) {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	progress.CurrentOffset = nextOffset
+	progress.Processed += processed
+	progress.Failed += failed
+	job.Processed += processed
+	job.Failed += failed
+}
+
+func (job *BackfillJob) currentOffset(progress *BackfillPartitionProgress) int64 {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	return progress.CurrentOffset
+}
+
+func (job *BackfillJob) markPartitionDone(progress *BackfillPartitionProgress) {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	progress.Done = true
+}
+
+func (job *BackfillJob) finish(ctx context.Context, err error) {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+
+	now := time.Now()
+	job.FinishedAt = &now
+	switch {
+	case err != nil:
+		job.Status = BackfillStatusFailed
+		job.Error = err.Error()
+	case ctx.Err() != nil && !job.allPartitionsDone():
+		job.Status = BackfillStatusCancelled
+	default:
+		job.Status = BackfillStatusCompleted
+	}
+
+	util.Log().Info("Backfill job %s finished: status=%s processed=%d/%d failed=%d error=%s",
+		job.ID, job.Status, job.Processed, job.Total, job.Failed, job.Error)
+}
+
+func (job *BackfillJob) allPartitionsDone() bool {
+	for _, p := range job.Partitions {
+		if !p.Done {
+			return false
+		}
+	}
+	return true
+}
+
+// rebuildBatch 以重建模式处理一批消息，返回处理失败及未通过 schema 校验的消息数
+// 失败只记录在进度中，不进入死信，修复后可对相同区间重新回填
+func rebuildBatch(handler string, messages []Message, sinks []string) int {
+	invalid := 0
+	valid := make([]Message, 0, len(messages))
+	for i := range messages {
+		if err := ValidateMessage(handler, messages[i].Value); err != nil {
+			util.Log().Warning("Backfill skipped invalid message %s/%d/%d: %v",
+				messages[i].Topic, messages[i].Partition, messages[i].Offset, err)
+			invalid++
+			continue
+		}
+		valid = append(valid, messages[i])
+	}
+	if len(valid) == 0 {
+		return invalid
+	}
+	return invalid + rebuildValidBatch(handler, valid, sinks)
+}
+
+// rebuildValidBatch 按处理器类型重建已通过校验的消息，返回处理失败的消息数
+func rebuildValidBatch(handler string, messages []Message, sinks []string) int {
+	switch handler {
+	case MessageTypeRaySwap:
+		if err := rebuildRaydiumSwaps(messages, sinks); err != nil {
+			util.Log().Error("Backfill Raydium swaps failed: offsets %d-%d: %v",
+				messages[0].Offset, messages[len(messages)-1].Offset, err)
+			return len(messages)
+		}
+		return 0
+	case MessageTypeGameOutTrade, MessageTypeGameInTrade:
+		failed := 0
+		for i := range messages {
+			if err := rebuildGameTrade(handler, messages[i].Value); err != nil {
+				util.Log().Error("Backfill game trade failed: %s/%d/%d: %v",
+					messages[i].Topic, messages[i].Partition, messages[i].Offset, err)
+				failed++
+			}
+		}
+		return failed
+	default:
+		return len(messages)
+	}
+}
+
+// rebuildRaydiumSwaps 将 Raydium swap 消息只写入指定存储
+// 不更新代币和池子信息，ES 文档使用当前库中的代币和池子信息补全
+func rebuildRaydiumSwaps(messages []Message, sinks []string) error {
+	swapMessages := make([]*model.RaydiumSwapMessage, 0, len(messages))
+	for _, msg := range messages {
+		var swapMsg model.RaydiumSwapMessage
+		if err := json.Unmarshal(msg.Value, &swapMsg); err != nil {
+			util.Log().Error("Failed to unmarshal Raydium swap message: %v", err)
+			continue
+		}
+		swapMessages = append(swapMessages, &swapMsg)
+	}
+	if len(swapMessages) == 0 {
+		return nil
+	}
+
+	tokenTxService := &service.TokenTransactionService{}
+	transactions := tokenTxService.ConvertRaydiumSwapMessagesToTransactions(swapMessages)
+
+	if containsString(sinks, SinkMySQL) {
+		if err := rebuildMySQLTransactions(transactions); err != nil {
+			return err
+		}
+	}
+
+	// 直接写入存储，不经过 reportSinkResult，回填失败不影响线上消费的存储健康状态
+	if containsString(sinks, SinkElasticsearch) {
+		tokenAddresses := make([]string, 0, len(transactions))
+		poolAddresses := make([]string, 0, len(transactions))
+		for _, tx := range transactions {
+			tokenAddresses = append(tokenAddresses, tx.TokenAddress)
+			poolAddresses = append(poolAddresses, tx.PoolAddress)
+		}
+		tokenInfoMap := (&service.TokenInfoService{}).GetExistingTokenInfos(tokenAddresses, uint8(model.ChainTypeSolana))
+		poolInfoMap := (&service.TokenLiquidityPoolService{}).GetExistingPools(poolAddresses)
+		if err := tradeStore.IndexTransactions(transactions, tokenInfoMap, poolInfoMap); err != nil {
+			return fmt.Errorf("failed to index transactions to ES: %w", err)
+		}
+	}
+
+	// 去重 token 只对同一回填批次的重试生效，StartBackfill 要求调用方确认目标区间已清理
+	if containsString(sinks, SinkClickHouse) {
+		if err := tradeStore.InsertTransactions(transactions, batchSource(messages)); err != nil {
+			return fmt.Errorf("failed to insert transactions to ClickHouse: %w", err)
+		}
+	}
+	return nil
+}
+
+// rebuildMySQLTransactions 按交易日期写入分表及交易索引，写入使用 INSERT IGNORE，可重复执行
+func rebuildMySQLTransactions(transactions []*model.TokenTransaction) error {
+	tokenTxService := &service.TokenTransactionService{}
+	tokenTxIndexService := &service.TokenTxIndexService{}
+
+	txsByDate := make(map[string][]*model.TokenTransaction)
+	for _, tx := range transactions {
+		date := tx.TransactionTime.Format("20060102")
+		txsByDate[date] = append(txsByDate[date], tx)
+	}
+
+	for date, txs := range txsByDate {
+		if err := model.CreateTableForDate(date); err != nil {
+			return fmt.Errorf("failed to ensure table for %s: %w", date, err)
+		}
+		if resp := tokenTxService.ProcessBatchTokenTransactionCreation(txs, date); resp.Code != 0 {
+			return fmt.Errorf("failed to create transactions for %s: %v", date, resp.Error)
+		}
+		if resp := tokenTxIndexService.BatchCreateIndexFromTransactions(txs); resp.Code != 0 {
+			return fmt.Errorf("failed to create indices for %s: %v", date, resp.Error)
+		}
+	}
+	return nil
+}
+
+// rebuildGameTrade 将游戏代理交易重新写入 ClickHouse，不重复累加积分和平台统计
+func rebuildGameTrade(handler string, message []byte) error {
+	var proxyTx *clickhouse.ProxyTransaction
+	if handler == MessageTypeGameOutTrade {
+		var tradeMsg model.GameOutTradeMessage
+		if err := json.Unmarshal(message, &tradeMsg); err != nil {
+			return fmt.Errorf("failed to unmarshal game-out-trade message: %w", err)
+		}
+		proxyTx = buildGameOutProxyTransaction(&tradeMsg)
+	} else {
+		var tradeMsg model.GameInTradeMessage
+		if err := json.Unmarshal(message, &tradeMsg); err != nil {
+			return fmt.Errorf("failed to unmarshal game-in-trade message: %w", err)
+		}
+		proxyTx = buildGameInProxyTransaction(&tradeMsg)
+	}
+	return gameTradeStore.InsertProxyTransaction(proxyTx)
+}
+
+func containsString(list []string, target string) bool {
+	for _, item := range list {
+		if item == target {
+			return true
+		}
+	}
+	return false
+}
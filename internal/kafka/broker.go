@@ -0,0 +1,66 @@
+package kafka
+
+import (
+	"context"
+	"time"
+)
+
+// Message 消费到的一条消息，与具体的 Kafka 客户端实现无关
+type Message struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+	Key       []byte
+	Value     []byte
+	Timestamp time.Time
+}
+
+// ProducerMessage 待发送的一条消息
+type ProducerMessage struct {
+	Topic string
+	Key   []byte // 为空时由分区器随机选择分区
+	Value []byte
+}
+
+// Producer 同步消息生产者
+type Producer interface {
+	SendMessage(msg ProducerMessage) error
+	SendMessages(msgs []ProducerMessage) error
+	Close() error
+}
+
+// ConsumerSession 一次消费组会话，会话在 rebalance 或停机时结束
+type ConsumerSession interface {
+	// Context 会话结束时取消
+	Context() context.Context
+	// MarkMessage 标记消息已处理，下次提交时生效
+	MarkMessage(msg *Message)
+	// Commit 同步提交已标记的 offset
+	Commit()
+}
+
+// ConsumerClaim 会话中分配给当前消费者的一个分区
+type ConsumerClaim interface {
+	Topic() string
+	Partition() int32
+	InitialOffset() int64
+	HighWaterMarkOffset() int64
+	// Messages 分区消息通道，会话结束后关闭
+	Messages() <-chan *Message
+}
+
+// ClaimHandler 处理分配到的分区，TopicConsumer 实现该接口
+type ClaimHandler interface {
+	ConsumeClaim(session ConsumerSession, claim ConsumerClaim) error
+}
+
+// ConsumerGroup 消费组
+type ConsumerGroup interface {
+	// Consume 加入消费组并阻塞到会话结束，调用方需要循环调用以在 rebalance 后重新加入
+	Consume(ctx context.Context, topics []string, handler ClaimHandler) error
+	// Pause 暂停拉取指定分区的消息，已拉取的消息仍会投递，rebalance 后保持暂停
+	Pause(partitions map[string][]int32)
+	// Resume 恢复拉取指定分区的消息
+	Resume(partitions map[string][]int32)
+	Close() error
+}
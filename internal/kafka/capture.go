@@ -0,0 +1,256 @@
+package kafka
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"game-fun-be/internal/pkg/util"
+)
+
+// 消息采集：设置 KAFKA_CAPTURE_DIR 后按 topic 抽样保存原始消息，用于复现线上问题
+// 文件按小时切分，路径为 <dir>/<topic>/<yyyyMMddHH>.jsonl.gz，每行一条 CapturedMessage
+// KAFKA_CAPTURE_TOPICS 为逗号分隔的 topic 前缀，为空时采集全部；KAFKA_CAPTURE_SAMPLE_RATE 为 0~1 的采样率，默认 1
+
+// captureFlushEvery 每写入多少条消息刷新一次压缩缓冲
+const captureFlushEvery = 100
+
+// CapturedMessage 采集文件中的一条消息
+type CapturedMessage struct {
+	Topic     string    `json:"topic"`
+	Partition int32     `json:"partition"`
+	Offset    int64     `json:"offset"`
+	Key       string    `json:"key,omitempty"`
+	Value     string    `json:"value"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// toMessage 转换为消费消息
+func (m CapturedMessage) toMessage() Message {
+	msg := Message{
+		Topic:     m.Topic,
+		Partition: m.Partition,
+		Offset:    m.Offset,
+		Value:     []byte(m.Value),
+		Timestamp: m.Timestamp,
+	}
+	if m.Key != "" {
+		msg.Key = []byte(m.Key)
+	}
+	return msg
+}
+
+// captureFile 一个 topic 当前小时的采集文件
+type captureFile struct {
+	hour    string
+	file    *os.File
+	gz      *gzip.Writer
+	pending int
+}
+
+func (f *captureFile) close() error {
+	return errors.Join(f.gz.Close(), f.file.Close())
+}
+
+// messageCapture 消息采集器
+type messageCapture struct {
+	mu         sync.Mutex
+	dir        string
+	sampleRate float64
+	prefixes   []string
+	files      map[string]*captureFile
+}
+
+var (
+	captureOnce sync.Once
+	capture     *messageCapture
+)
+
+// getCapture 按环境变量初始化采集器，未设置 KAFKA_CAPTURE_DIR 时返回 nil
+func getCapture() *messageCapture {
+	captureOnce.Do(func() {
+		dir := os.Getenv("KAFKA_CAPTURE_DIR")
+		if dir == "" {
+			return
+		}
+
+		c := &messageCapture{
+			dir:        dir,
+			sampleRate: util.GetEnvAsFloat("KAFKA_CAPTURE_SAMPLE_RATE", 1),
+			files:      make(map[string]*captureFile),
+		}
+		for _, prefix := range strings.Split(os.Getenv("KAFKA_CAPTURE_TOPICS"), ",") {
+			if prefix = strings.TrimSpace(prefix); prefix != "" {
+				c.prefixes = append(c.prefixes, prefix)
+			}
+		}
+		capture = c
+		util.Log().Info("Kafka message capture enabled: dir=%s sample_rate=%.3f topics=%v", dir, c.sampleRate, c.prefixes)
+	})
+	return capture
+}
+
+// captureMessage 抽样保存一条消费到的消息，采集失败只记录日志，不影响消费
+func captureMessage(msg *Message) {
+	c := getCapture()
+	if c == nil || !c.matches(msg.Topic) {
+		return
+	}
+	if c.sampleRate < 1 && rand.Float64() >= c.sampleRate {
+		return
+	}
+	if err := c.write(msg); err != nil {
+		util.Log().Error("Failed to capture message %s/%d/%d: %v", msg.Topic, msg.Partition, msg.Offset, err)
+	}
+}
+
+func (c *messageCapture) matches(topic string) bool {
+	if len(c.prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range c.prefixes {
+		if strings.HasPrefix(topic, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *messageCapture) write(msg *Message) error {
+	line, err := json.Marshal(CapturedMessage{
+		Topic:     msg.Topic,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+		Key:       string(msg.Key),
+		Value:     string(msg.Value),
+		Timestamp: msg.Timestamp,
+	})
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	f, err := c.fileFor(msg.Topic)
+	if err != nil {
+		return err
+	}
+	if _, err := f.gz.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	f.pending++
+	if f.pending >= captureFlushEvery {
+		f.pending = 0
+		return f.gz.Flush()
+	}
+	return nil
+}
+
+// fileFor 返回 topic 当前小时的采集文件，跨小时时关闭旧文件
+// 重启后追加写入同一文件会产生多个 gzip 分段，读取时按多段流处理
+func (c *messageCapture) fileFor(topic string) (*captureFile, error) {
+	hour := time.Now().Format("2006010215")
+	if f := c.files[topic]; f != nil {
+		if f.hour == hour {
+			return f, nil
+		}
+		if err := f.close(); err != nil {
+			util.Log().Error("Failed to close capture file for %s: %v", topic, err)
+		}
+		delete(c.files, topic)
+	}
+
+	dir := filepath.Join(c.dir, topic)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(filepath.Join(dir, hour+".jsonl.gz"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	f := &captureFile{hour: hour, file: file, gz: gzip.NewWriter(file)}
+	c.files[topic] = f
+	return f, nil
+}
+
+// CloseCapture 关闭所有采集文件，写入 gzip 结尾
+func CloseCapture() {
+	c := capture
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for topic, f := range c.files {
+		if err := f.close(); err != nil {
+			util.Log().Error("Failed to close capture file for %s: %v", topic, err)
+		}
+		delete(c.files, topic)
+	}
+}
+
+// WriteCaptureFile 将消息写入采集文件，用于手工构造回放用例
+func WriteCaptureFile(path string, messages []CapturedMessage) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(file)
+	enc := json.NewEncoder(gz)
+	for _, msg := range messages {
+		if err := enc.Encode(msg); err != nil {
+			gz.Close()
+			file.Close()
+			return err
+		}
+	}
+	return errors.Join(gz.Close(), file.Close())
+}
+
+// ReadCaptureFile 读取采集文件，文件末尾不完整（进程未正常退出）时返回已完整读取的消息
+func ReadCaptureFile(path string) ([]CapturedMessage, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("open gzip stream %s: %w", path, err)
+	}
+	defer gz.Close()
+
+	var messages []CapturedMessage
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var msg CapturedMessage
+		if err := json.Unmarshal(line, &msg); err != nil {
+			// 最后一行可能被截断
+			util.Log().Warning("Skip malformed capture line in %s: %v", path, err)
+			continue
+		}
+		messages = append(messages, msg)
+	}
+	if err := scanner.Err(); err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return messages, fmt.Errorf("read capture file %s: %w", path, err)
+	}
+	return messages, nil
+}
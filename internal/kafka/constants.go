@@ -55,20 +55,4 @@ var (
 
 	// 积分交易状态检测
 	TopicPointTxStatus = PointTxStatusPrefix + envSuffix // 积分交易链上状态检测
-
-	// 所有需要监听的 topics
-	AllTopics = []string{
-		TopicRayCreate,
-		TopicRaySwap,
-		TopicRayAddLiquidity,
-		TopicRayRemoveLiquidity,
-		// TopicPumpCreate,
-		// TopicPumpTrade,
-		// TopicPumpComplete,
-		// TopicPumpSetParams,
-		TopicUnknownToken,
-		TopicGameOutTrade,
-		TopicGameInTrade,
-		TopicPointTxStatus,
-	}
 )
@@ -2,11 +2,14 @@ package kafka
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"os"
 	"strings"
 	"sync"
 	"time"
 
+	"game-fun-be/internal/metrics"
 	"game-fun-be/internal/pkg/util"
 
 	"github.com/IBM/sarama"
@@ -16,14 +19,15 @@ import (
 type MessageHandler func([]byte, string) error
 
 // BatchMessageHandler 是批量处理消息的函数类型，增加 topic、partition 和 goroutineID 参数
-type BatchMessageHandler func(topic string, messages []sarama.ConsumerMessage, partition int32, goroutineID uint64) error
+type BatchMessageHandler func(topic string, messages []Message, partition int32, goroutineID uint64) error
 
 // TopicConsumer 管理多个 topic 的消费
 type TopicConsumer struct {
-	consumerGroup       sarama.ConsumerGroup
+	consumerGroup       ConsumerGroup
 	stopChan            chan struct{}
-	session             sarama.ConsumerGroupSession
-	sessionMutex        sync.RWMutex
+	doneChan            chan struct{} // ConsumeTopics 退出时关闭
+	ctx                 context.Context
+	cancel              context.CancelFunc
 	batchSizes          map[string]int
 	defaultBatchSize    int
 	handlers            map[string]MessageHandler
@@ -33,6 +37,7 @@ type TopicConsumer struct {
 	groupID             string
 	processedOffsets    map[string]map[int32]int64 // topic -> partition -> last processed offset
 	processMutex        sync.RWMutex
+	closeOnce           sync.Once
 	minBatchSizes       map[string]int // 新增：每个topic的最小批量
 	defaultMinBatchSize int            // 新增：默认最小批量
 }
@@ -43,11 +48,37 @@ func NewTopicConsumer(groupID string) (*TopicConsumer, error) {
 	if err != nil {
 		return nil, err
 	}
+	return newTopicConsumer(NewSaramaConsumerGroup(consumerGroup), groupID), nil
+}
+
+// NewTopicConsumerWithGroup 使用指定的消费组实现创建 TopicConsumer，如 MemoryBroker.ConsumerGroup
+func NewTopicConsumerWithGroup(consumerGroup ConsumerGroup, groupID string) *TopicConsumer {
+	return newTopicConsumer(consumerGroup, groupID)
+}
+
+// newHandlerRegistry 创建只包含处理器注册信息、不连接 Kafka 的 TopicConsumer，用于死信重放
+// 注册表中未启用的 topic 也会注册处理器，以便重放其历史死信
+func newHandlerRegistry() *TopicConsumer {
+	tc := newTopicConsumer(nil, "")
+	entries, err := LoadTopicRegistry()
+	if err != nil {
+		util.Log().Error("Failed to load topic registry, fallback to default: %v", err)
+		entries = defaultTopicRegistry()
+	}
+	RegisterHandlers(tc, entries, false)
+	return tc
+}
+
+func newTopicConsumer(consumerGroup ConsumerGroup, groupID string) *TopicConsumer {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &TopicConsumer{
 		consumerGroup:       consumerGroup,
 		groupID:             groupID,
 		batchHandlers:       make(map[string]BatchMessageHandler),
 		stopChan:            make(chan struct{}),
+		doneChan:            make(chan struct{}),
+		ctx:                 ctx,
+		cancel:              cancel,
 		handlers:            make(map[string]MessageHandler),
 		batchTimeouts:       make(map[string]time.Duration),
 		batchSizes:          make(map[string]int),
@@ -56,15 +87,7 @@ func NewTopicConsumer(groupID string) (*TopicConsumer, error) {
 		processedOffsets:    make(map[string]map[int32]int64),
 		minBatchSizes:       make(map[string]int),
 		defaultMinBatchSize: 50,
-	}, nil
-}
-
-// Setup 在新会话开始时运行
-func (tc *TopicConsumer) Setup(session sarama.ConsumerGroupSession) error {
-	tc.sessionMutex.Lock()
-	tc.session = session
-	tc.sessionMutex.Unlock()
-	return nil
+	}
 }
 
 // AddHandler 为指定的 topic 添加处理函数
@@ -97,29 +120,43 @@ func (tc *TopicConsumer) AddBatchHandler(topic string, batchHandler BatchMessage
 }
 
 // ConsumeTopics 开始消费指定的 topics
+// 调用 Shutdown 后，当前会话中未处理的批次会被处理并提交，随后返回 nil
 func (tc *TopicConsumer) ConsumeTopics(topics []string) error {
-
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	defer close(tc.doneChan)
 
 	for {
 		select {
 		case <-tc.stopChan:
 			return nil
 		default:
-			err := tc.consumerGroup.Consume(ctx, topics, tc)
+			err := tc.consumerGroup.Consume(tc.ctx, topics, tc)
 			if err != nil {
 				util.Log().Error("Error from consumer: %v", err)
 			}
-			if ctx.Err() != nil {
-				return ctx.Err()
+			if tc.ctx.Err() != nil {
+				util.Log().Info("Consumer context cancelled, stop consuming: group=%s", tc.groupID)
+				return nil
 			}
 		}
 	}
 }
 
+// Shutdown 停止拉取新消息，等待当前批次处理并提交 offset 后关闭消费组
+// ctx 超时后不再等待，直接关闭消费组
+func (tc *TopicConsumer) Shutdown(ctx context.Context) error {
+	tc.cancel()
+
+	select {
+	case <-tc.doneChan:
+		util.Log().Info("Consumer drained: group=%s", tc.groupID)
+	case <-ctx.Done():
+		util.Log().Error("Consumer drain timed out: group=%s err=%v", tc.groupID, ctx.Err())
+	}
+	return tc.Close()
+}
+
 // ConsumeClaim 消费消息的主循环
-func (tc *TopicConsumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+func (tc *TopicConsumer) ConsumeClaim(session ConsumerSession, claim ConsumerClaim) error {
 	// 修改初始日志格式
 	util.Log().Info("=== Consumer Started ===\n"+
 		"Topic:          %s\n"+
@@ -128,7 +165,7 @@ func (tc *TopicConsumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim
 		"Goroutine:      %d",
 		claim.Topic(), claim.Partition(), claim.InitialOffset(), util.GetGoroutineID())
 
-	batchMessages := make(map[string][]sarama.ConsumerMessage)
+	batchMessages := make(map[string][]Message)
 	timers := make(map[string]*time.Timer)
 	messageCounter := 0 // 添加消息计数器
 
@@ -146,10 +183,14 @@ func (tc *TopicConsumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim
 					"TotalProcessed: %d\n"+
 					"Goroutine:      %d",
 					claim.Topic(), claim.Partition(), messageCounter, util.GetGoroutineID())
+				// 会话结束时通道可能先于 Context().Done() 被选中，同样需要处理剩余批次
+				tc.flushRemaining(batchMessages, session, claim.Partition())
 				return nil
 			}
 
 			messageCounter++
+			captureMessage(msg)
+			metrics.SetKafkaConsumerLag(msg.Topic, msg.Partition, claim.HighWaterMarkOffset()-msg.Offset-1)
 
 			handler, handlerExists := tc.handlers[msg.Topic]
 			batchHandler, batchHandlerExists := tc.batchHandlers[msg.Topic]
@@ -161,21 +202,45 @@ func (tc *TopicConsumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim
 					"Offset:    %d\n"+
 					"Goroutine: %d",
 					msg.Topic, msg.Partition, msg.Offset, util.GetGoroutineID())
-				if err := handler(msg.Value, msg.Topic); err != nil {
+				err := tc.retryWhileSinkUnavailable(session, msg.Topic, msg.Partition, func() error {
+					return handler(msg.Value, msg.Topic)
+				})
+				if errors.Is(err, ErrSinkUnavailable) {
+					// 会话结束时下游仍不可用，不提交 offset，由下一次会话重新消费
+					util.Log().Error("Sink still unavailable at session end: topic=%s partition=%d offset=%d err=%v",
+						msg.Topic, msg.Partition, msg.Offset, err)
+					return nil
+				}
+				if err != nil {
 					util.Log().Error("=== Message Handling Error ===\n"+
 						"Topic:     %s\n"+
 						"Partition: %d\n"+
 						"Error:     %v",
 						msg.Topic, msg.Partition, err)
+					// 失败消息写入死信 topic（schema 校验失败写入隔离 topic），写入成功后才提交 offset
+					// 写入失败时阻塞重试，不继续消费后面的消息，避免之后的提交越过这条消息
+					dlqErr := tc.retryWhilePublishFails(session, msg.Topic, msg.Partition, func() error {
+						return publishFailedMessage(msg, err, 1)
+					})
+					if dlqErr != nil {
+						util.Log().Error("Dead letter still not published at session end: topic=%s partition=%d offset=%d err=%v",
+							msg.Topic, msg.Partition, msg.Offset, dlqErr)
+						metrics.AddKafkaMessages(msg.Topic, metrics.ResultError, 1)
+						return nil
+					}
+					if !IsSchemaError(err) {
+						metrics.AddKafkaMessages(msg.Topic, metrics.ResultDeadLetter, 1)
+					}
 				} else {
-					session.MarkMessage(msg, "")
-					session.Commit()
+					metrics.AddKafkaMessages(msg.Topic, metrics.ResultSuccess, 1)
 				}
+				session.MarkMessage(msg)
+				session.Commit()
 			} else if batchHandlerExists && batchHandler != nil {
 				// 批处理模式
 				if _, exists := batchMessages[msg.Topic]; !exists {
 					batchSize := tc.batchSizes[msg.Topic]
-					batchMessages[msg.Topic] = make([]sarama.ConsumerMessage, 0, batchSize)
+					batchMessages[msg.Topic] = make([]Message, 0, batchSize)
 					timers[msg.Topic] = time.NewTimer(tc.batchTimeouts[msg.Topic])
 				}
 
@@ -267,15 +332,7 @@ func (tc *TopicConsumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim
 			}
 
 		case <-session.Context().Done():
-			// 处理剩余的批次消息
-			for topic, messages := range batchMessages {
-				if len(messages) > 0 {
-					// 尝试处理剩余消息，但不重试
-					if err := tc.processBatchForTopic(topic, messages, session, claim.Partition(), util.GetGoroutineID()); err != nil {
-						util.Log().Error("Failed to process remaining messages before shutdown: %v", err)
-					}
-				}
-			}
+			tc.flushRemaining(batchMessages, session, claim.Partition())
 			util.Log().Info("=== Session Completed ===\n"+
 				"Topic:          %s\n"+
 				"Partition:      %d\n"+
@@ -286,8 +343,20 @@ func (tc *TopicConsumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim
 	}
 }
 
+// flushRemaining 处理剩余的批次消息，不受最小批量限制，保证停机或 rebalance 前提交 offset
+func (tc *TopicConsumer) flushRemaining(batchMessages map[string][]Message, session ConsumerSession, partition int32) {
+	for topic, messages := range batchMessages {
+		if len(messages) > 0 {
+			if err := tc.handleBatch(topic, messages, session, partition, util.GetGoroutineID()); err != nil {
+				util.Log().Error("Failed to process remaining messages before shutdown: %v", err)
+			}
+			batchMessages[topic] = messages[:0]
+		}
+	}
+}
+
 // 处理单个主题的批次消息
-func (tc *TopicConsumer) processBatchForTopic(topic string, messages []sarama.ConsumerMessage, session sarama.ConsumerGroupSession, partition int32, goroutineID uint64) error {
+func (tc *TopicConsumer) processBatchForTopic(topic string, messages []Message, session ConsumerSession, partition int32, goroutineID uint64) error {
 	// 检查最小批量
 	minSize := tc.minBatchSizes[topic]
 	if len(messages) < minSize {
@@ -295,7 +364,11 @@ func (tc *TopicConsumer) processBatchForTopic(topic string, messages []sarama.Co
 			topic, len(messages), minSize)
 		return nil
 	}
+	return tc.handleBatch(topic, messages, session, partition, goroutineID)
+}
 
+// handleBatch 调用批处理器处理消息，成功后标记并提交 offset
+func (tc *TopicConsumer) handleBatch(topic string, messages []Message, session ConsumerSession, partition int32, goroutineID uint64) error {
 	startTime := time.Now()
 	firstOffset := messages[0].Offset
 	lastOffset := messages[len(messages)-1].Offset
@@ -305,9 +378,21 @@ func (tc *TopicConsumer) processBatchForTopic(topic string, messages []sarama.Co
 
 	batchHandler := tc.batchHandlers[topic]
 	if batchHandler != nil {
+		defer metrics.ObserveKafkaBatch(topic, partition, len(messages), startTime)
 		maxRetries := 3
+		// pending 为仍需处理的消息，批处理器返回 partialBatchError 时只重试其中失败的消息
+		pending := messages
 		for retry := 0; retry < maxRetries; retry++ {
-			err := batchHandler(topic, messages, partition, goroutineID)
+			// 下游存储不可用时暂停分区并一直退避重试，不计入重试次数，也不写入死信
+			err := tc.retryWhileSinkUnavailable(session, topic, partition, func() error {
+				err := batchHandler(topic, pending, partition, goroutineID)
+				pending = remainingMessages(pending, err)
+				return err
+			})
+			if errors.Is(err, ErrSinkUnavailable) {
+				metrics.AddKafkaMessages(topic, metrics.ResultError, len(messages))
+				return err
+			}
 			if err != nil {
 				util.Log().Error("=== Batch Processing Error (Attempt %d/%d) ===\n"+
 					"Topic:     %s\n"+
@@ -318,7 +403,18 @@ func (tc *TopicConsumer) processBatchForTopic(topic string, messages []sarama.Co
 
 				if retry == maxRetries-1 {
 					util.Log().Error("=== Max Retries Reached ===")
-					return err // 不提交消息，让消费者重试
+					// 仍失败的消息写入死信 topic，写入失败时阻塞重试，会话结束仍未写入则不提交，由下一次会话重新消费
+					dlqErr := tc.retryWhilePublishFails(session, topic, partition, func() error {
+						return tc.deadLetterBatch(pending, err, maxRetries)
+					})
+					if dlqErr != nil {
+						util.Log().Error("Failed to publish batch to dead letter topic: %v", dlqErr)
+						metrics.AddKafkaMessages(topic, metrics.ResultError, len(messages))
+						return err
+					}
+					metrics.AddKafkaMessages(topic, metrics.ResultDeadLetter, len(pending))
+					tc.markBatch(topic, partition, messages, session)
+					return nil
 				}
 
 				time.Sleep(time.Second * time.Duration(retry+1))
@@ -326,11 +422,8 @@ func (tc *TopicConsumer) processBatchForTopic(topic string, messages []sarama.Co
 			}
 
 			// 处理成功后，逐条更新进度并标记
-			for _, msg := range messages {
-				session.MarkMessage(&msg, "")
-				tc.recordProgress(topic, partition, msg.Offset)
-			}
-			session.Commit()
+			tc.markBatch(topic, partition, messages, session)
+			metrics.AddKafkaMessages(topic, metrics.ResultSuccess, len(messages))
 
 			util.Log().Info("Completed batch process: topic=%s partition=%d duration=%v messages=%d",
 				topic, partition, time.Since(startTime), len(messages))
@@ -340,17 +433,90 @@ func (tc *TopicConsumer) processBatchForTopic(topic string, messages []sarama.Co
 	return nil
 }
 
-// Cleanup 在会话结束时运行
-func (tc *TopicConsumer) Cleanup(session sarama.ConsumerGroupSession) error {
-	tc.sessionMutex.Lock()
-	tc.session = nil
-	tc.sessionMutex.Unlock()
+// partialBatchError 批次中只有部分消息处理失败，其余消息已处理完成，重试时只需处理 failed
+type partialBatchError struct {
+	failed []Message
+	err    error
+}
+
+func (e *partialBatchError) Error() string { return e.err.Error() }
+
+func (e *partialBatchError) Unwrap() error { return e.err }
+
+// remainingMessages 返回批处理器失败后仍需重试的消息
+func remainingMessages(messages []Message, err error) []Message {
+	var partial *partialBatchError
+	if errors.As(err, &partial) && len(partial.failed) > 0 {
+		return partial.failed
+	}
+	return messages
+}
+
+// markBatch 逐条标记批次消息并提交 offset
+func (tc *TopicConsumer) markBatch(topic string, partition int32, messages []Message, session ConsumerSession) {
+	for i := range messages {
+		session.MarkMessage(&messages[i])
+		tc.recordProgress(topic, partition, messages[i].Offset)
+	}
+	session.Commit()
+}
+
+// deadLetterBatch 将批次中的每条消息写入死信 topic
+func (tc *TopicConsumer) deadLetterBatch(messages []Message, handleErr error, attempts int) error {
+	for i := range messages {
+		if err := publishDeadLetter(&messages[i], handleErr, attempts); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// retryWhilePublishFails 执行 publish 写入死信，失败时暂停分区并退避重试，直到写入成功或会话结束
+// 会话结束时返回最后一次错误，调用方不能标记消息
+func (tc *TopicConsumer) retryWhilePublishFails(session ConsumerSession, topic string, partition int32, publish func() error) error {
+	err := publish()
+	if err == nil {
+		return nil
+	}
+
+	tc.pausePartition(topic, partition)
+	defer tc.resumePartition(topic, partition)
+
+	for attempt := 1; err != nil; attempt++ {
+		delay := sinkRetryDelay(attempt)
+		util.Log().Error("Failed to publish dead letter, partition paused: topic=%s partition=%d attempt=%d retry_in=%v err=%v",
+			topic, partition, attempt, delay, err)
+
+		select {
+		case <-time.After(delay):
+		case <-session.Context().Done():
+			return err
+		}
+		err = publish()
+	}
+	return nil
+}
+
+// dispatch 将单条消息交给对应 topic 注册的处理器
+func (tc *TopicConsumer) dispatch(msg *Message) error {
+	if handler := tc.handlers[msg.Topic]; handler != nil {
+		return handler(msg.Value, msg.Topic)
+	}
+	if batchHandler := tc.batchHandlers[msg.Topic]; batchHandler != nil {
+		return batchHandler(msg.Topic, []Message{*msg}, msg.Partition, util.GetGoroutineID())
+	}
+	return fmt.Errorf("no handler registered for topic %s", msg.Topic)
+}
+
 // 关闭消费者
 func (tc *TopicConsumer) Close() error {
-	close(tc.stopChan) // 停止 goroutine
+	tc.closeOnce.Do(func() {
+		close(tc.stopChan) // 停止 goroutine
+	})
+	tc.cancel()
+	if tc.consumerGroup == nil {
+		return nil
+	}
 	return tc.consumerGroup.Close()
 }
 
@@ -0,0 +1,226 @@
+package kafka
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"game-fun-be/internal/pkg/util"
+
+	"github.com/IBM/sarama"
+)
+
+// DeadLetterSuffix 死信 topic 后缀，每个业务 topic 对应一个死信 topic
+const DeadLetterSuffix = ".dlq"
+
+// DeadLetterMessage 死信消息结构体，保存原始消息及失败上下文
+type DeadLetterMessage struct {
+	Topic     string    `json:"topic"`     // 原始 topic
+	Partition int32     `json:"partition"` // 原始分区
+	Offset    int64     `json:"offset"`    // 原始 offset
+	Key       []byte    `json:"key,omitempty"`
+	Value     []byte    `json:"value"`    // 原始消息体
+	Error     string    `json:"error"`    // 最后一次处理失败的错误信息
+	Attempts  int       `json:"attempts"` // 累计处理次数
+	FailedAt  time.Time `json:"failedAt"` // 最后一次失败时间
+}
+
+// DeadLetterRecord 死信 topic 中的一条记录
+type DeadLetterRecord struct {
+	DeadLetterTopic string            `json:"dead_letter_topic"`
+	Partition       int32             `json:"partition"`
+	Offset          int64             `json:"offset"`
+	Message         DeadLetterMessage `json:"message"`
+}
+
+// DeadLetterTopic 返回业务 topic 对应的死信 topic
+func DeadLetterTopic(topic string) string {
+	return topic + DeadLetterSuffix
+}
+
+// publishDeadLetter 将处理失败的消息发送到死信 topic
+func publishDeadLetter(msg *Message, handleErr error, attempts int) error {
+	dlqMsg := DeadLetterMessage{
+		Topic:     msg.Topic,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+		Key:       msg.Key,
+		Value:     msg.Value,
+		Attempts:  attempts,
+		FailedAt:  time.Now(),
+	}
+	if handleErr != nil {
+		dlqMsg.Error = handleErr.Error()
+	}
+	return sendDeadLetter(&dlqMsg)
+}
+
+// sendDeadLetter 序列化并发送死信消息
+func sendDeadLetter(dlqMsg *DeadLetterMessage) error {
+	if DefaultProducer() == nil {
+		return fmt.Errorf("kafka producer is not initialized")
+	}
+
+	payload, err := json.Marshal(dlqMsg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal dead letter message: %w", err)
+	}
+
+	producerMsg := ProducerMessage{
+		Topic: DeadLetterTopic(dlqMsg.Topic),
+		Key:   []byte(fmt.Sprintf("%s:%d:%d", dlqMsg.Topic, dlqMsg.Partition, dlqMsg.Offset)),
+		Value: payload,
+	}
+	if err := DefaultProducer().SendMessage(producerMsg); err != nil {
+		return fmt.Errorf("failed to send dead letter message: %w", err)
+	}
+
+	util.Log().Warning("=== Message Sent To Dead Letter Topic ===\n"+
+		"Topic:     %s\n"+
+		"Partition: %d\n"+
+		"Offset:    %d\n"+
+		"Attempts:  %d\n"+
+		"Error:     %s",
+		dlqMsg.Topic, dlqMsg.Partition, dlqMsg.Offset, dlqMsg.Attempts, dlqMsg.Error)
+	return nil
+}
+
+// ListDeadLetters 从指定死信分区的 offset 开始读取最多 limit 条死信
+// offset 小于 0 时从最早的消息开始读取
+func ListDeadLetters(topic string, partition int32, offset int64, limit int) ([]DeadLetterRecord, error) {
+	messages, err := readPartition(DeadLetterTopic(topic), partition, offset, limit)
+	records := make([]DeadLetterRecord, 0, len(messages))
+	for _, msg := range messages {
+		record := DeadLetterRecord{
+			DeadLetterTopic: msg.Topic,
+			Partition:       msg.Partition,
+			Offset:          msg.Offset,
+		}
+		if jsonErr := json.Unmarshal(msg.Value, &record.Message); jsonErr != nil {
+			util.Log().Error("Failed to unmarshal dead letter message at %s/%d/%d: %v",
+				msg.Topic, msg.Partition, msg.Offset, jsonErr)
+			record.Message.Error = fmt.Sprintf("invalid dead letter payload: %v", jsonErr)
+		}
+		records = append(records, record)
+	}
+	return records, err
+}
+
+// readPartition 从指定分区的 offset 开始读取最多 limit 条消息，读到分区末尾或超时后返回
+// offset 小于 0 时从最早的消息开始读取
+func readPartition(topic string, partition int32, offset int64, limit int) ([]*sarama.ConsumerMessage, error) {
+	if limit <= 0 {
+		limit = 20
+	}
+
+	client, err := sarama.NewClient(strings.Split(os.Getenv("KAFKA_BROKERS"), ","), KafkaConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kafka client: %w", err)
+	}
+	defer client.Close()
+
+	oldest, err := client.GetOffset(topic, partition, sarama.OffsetOldest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get oldest offset: %w", err)
+	}
+	newest, err := client.GetOffset(topic, partition, sarama.OffsetNewest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get newest offset: %w", err)
+	}
+
+	if offset < oldest {
+		offset = oldest
+	}
+	if offset >= newest {
+		return nil, nil
+	}
+
+	consumer, err := sarama.NewConsumerFromClient(client)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kafka consumer: %w", err)
+	}
+	defer consumer.Close()
+
+	pc, err := consumer.ConsumePartition(topic, partition, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume partition: %w", err)
+	}
+	defer pc.Close()
+
+	messages := make([]*sarama.ConsumerMessage, 0, limit)
+	timeout := time.NewTimer(10 * time.Second)
+	defer timeout.Stop()
+
+	for len(messages) < limit {
+		select {
+		case msg := <-pc.Messages():
+			messages = append(messages, msg)
+			if msg.Offset >= newest-1 {
+				return messages, nil
+			}
+		case err := <-pc.Errors():
+			return messages, fmt.Errorf("failed to read partition: %w", err)
+		case <-timeout.C:
+			return messages, nil
+		}
+	}
+	return messages, nil
+}
+
+// GetDeadLetter 读取死信 topic 中指定位置的一条死信
+func GetDeadLetter(topic string, partition int32, offset int64) (*DeadLetterRecord, error) {
+	records, err := ListDeadLetters(topic, partition, offset, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 || records[0].Offset != offset {
+		return nil, fmt.Errorf("dead letter not found: topic=%s partition=%d offset=%d", topic, partition, offset)
+	}
+	return &records[0], nil
+}
+
+// ReplayDeadLetter 将指定死信重新交给原 topic 注册的处理器处理
+// 再次失败时会以累加后的处理次数重新写入死信 topic
+func ReplayDeadLetter(topic string, partition int32, offset int64) (*DeadLetterRecord, error) {
+	record, err := GetDeadLetter(topic, partition, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	dlqMsg := record.Message
+	msg := &Message{
+		Topic:     dlqMsg.Topic,
+		Partition: dlqMsg.Partition,
+		Offset:    dlqMsg.Offset,
+		Key:       dlqMsg.Key,
+		Value:     dlqMsg.Value,
+		Timestamp: time.Now(),
+	}
+
+	util.Log().Info("Replaying dead letter: dlq=%s/%d/%d origin=%s/%d/%d attempts=%d",
+		record.DeadLetterTopic, record.Partition, record.Offset,
+		dlqMsg.Topic, dlqMsg.Partition, dlqMsg.Offset, dlqMsg.Attempts)
+
+	if handleErr := newHandlerRegistry().dispatch(msg); handleErr != nil {
+		// schema 校验失败的消息重试无意义，转入隔离 topic
+		if IsSchemaError(handleErr) {
+			if err := publishQuarantine(msg, handleErr); err != nil {
+				util.Log().Error("Failed to quarantine dead letter after replay failure: %v", err)
+			}
+			return record, fmt.Errorf("replay failed: %w", handleErr)
+		}
+		dlqMsg.Attempts++
+		dlqMsg.Error = handleErr.Error()
+		dlqMsg.FailedAt = time.Now()
+		if err := sendDeadLetter(&dlqMsg); err != nil {
+			util.Log().Error("Failed to republish dead letter after replay failure: %v", err)
+		}
+		return record, fmt.Errorf("replay failed: %w", handleErr)
+	}
+
+	util.Log().Info("Dead letter replayed successfully: origin=%s/%d/%d",
+		dlqMsg.Topic, dlqMsg.Partition, dlqMsg.Offset)
+	return record, nil
+}
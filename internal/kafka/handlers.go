@@ -3,8 +3,10 @@ package kafka
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -14,7 +16,6 @@ import (
 	"game-fun-be/internal/clickhouse"
 	"game-fun-be/internal/conf"
 	"game-fun-be/internal/constants"
-	"game-fun-be/internal/es"
 	"game-fun-be/internal/model"
 	"game-fun-be/internal/pkg/httpRespone"
 	"game-fun-be/internal/pkg/httpUtil"
@@ -22,13 +23,15 @@ import (
 	"game-fun-be/internal/redis"
 	"game-fun-be/internal/service"
 
-	"github.com/IBM/sarama"
 	"github.com/shopspring/decimal"
 )
 
 var (
 	solPriceReady    atomic.Bool
 	solPriceInitOnce sync.Once
+
+	// activeConsumer 当前进程中运行的消费者，用于优雅停机
+	activeConsumer atomic.Pointer[TopicConsumer]
 )
 
 func ConsumePumpfunTopics() error {
@@ -37,6 +40,11 @@ func ConsumePumpfunTopics() error {
 		return fmt.Errorf("failed to initialize SOL price: %v", err)
 	}
 
+	// 曲线参数表，set-params 消息写入
+	if err := model.CreatePumpCurveParamsTable(); err != nil {
+		util.Log().Error("Failed to create pump_curve_params table: %v", err)
+	}
+
 	// 初始化 TopicConsumer
 
 	topicConsumer, err := NewTopicConsumer(KafkaGroupDexProcessor)
@@ -47,60 +55,52 @@ func ConsumePumpfunTopics() error {
 
 	util.Log().Info("Kafka consumer initialized successfully")
 
-	// 从环境变量获取批处理参数
-	batchSize, _ := strconv.Atoi(os.Getenv("KAFKA_BATCH_SIZE"))
-	if batchSize == 0 {
-		batchSize = 100 // 默认值
-	}
-
-	// 从环境变量获取批处理参数
-	minSize, _ := strconv.Atoi(os.Getenv("KAFKA_MIN_SIZE"))
-	if minSize == 0 {
-		minSize = 10 // 默认值
+	entries, err := LoadTopicRegistry()
+	if err != nil {
+		topicConsumer.Close()
+		return err
 	}
-
-	batchTimeout, _ := time.ParseDuration(os.Getenv("KAFKA_BATCH_TIMEOUT"))
-	if batchTimeout == 0 {
-		batchTimeout = 100 * time.Millisecond // 默认值
+	topics := EnabledTopics(entries)
+	if len(topics) == 0 {
+		topicConsumer.Close()
+		return fmt.Errorf("no enabled topics in kafka topic registry")
 	}
 
 	// Log current configuration values
 	util.Log().Info("Kafka Configuration:"+
-		"Batch Size:      %d"+
-		"Batch Timeout:   %v"+
+		"Topics:         %s"+
 		"Brokers:        %s"+
 		"Client ID:      %s"+
 		"Group ID:       %s",
-		batchSize,
-		batchTimeout,
+		strings.Join(topics, ","),
 		os.Getenv("KAFKA_BROKERS"),
 		os.Getenv("KAFKA_CLIENT_ID"),
 		KafkaGroupDexProcessor)
 
-	// 添加 Pumpfun 相关的处理器
-	topicConsumer.AddHandler(TopicPumpCreate, PumpfunImmediateHandler)
-	topicConsumer.AddHandler(TopicPumpComplete, PumpfunImmediateHandler)
-	topicConsumer.AddHandler(TopicPumpSetParams, PumpfunImmediateHandler)
-	topicConsumer.AddBatchHandler(TopicPumpTrade, PumpfunBatchHandler, batchSize, minSize, batchTimeout)
-
-	// 添加 Raydium 相关的处理器
-	topicConsumer.AddHandler(TopicRayCreate, RaydiumImmediateHandler)
-	topicConsumer.AddHandler(TopicRayAddLiquidity, RaydiumImmediateHandler)
-	topicConsumer.AddHandler(TopicRayRemoveLiquidity, RaydiumImmediateHandler)
-	topicConsumer.AddBatchHandler(TopicRaySwap, RaydiumBatchHandler, batchSize, minSize, batchTimeout)
+	RegisterHandlers(topicConsumer, entries, true)
 
-	// 添加未知代币处理器
-	topicConsumer.AddHandler(TopicUnknownToken, UnknownTokenHandler)
+	activeConsumer.Store(topicConsumer)
+	defer activeConsumer.CompareAndSwap(topicConsumer, nil)
 
-	// 添加game相关处理器
-	topicConsumer.AddHandler(TopicGameOutTrade, gameOutTradeHandler)
-	topicConsumer.AddHandler(TopicGameInTrade, gameInTradeHandler)
-
-	// 添加积分交易状态检测处理器
-	topicConsumer.AddHandler(TopicPointTxStatus, pointTxStatusHandler)
+	// 积分交易状态的延迟检测随消费者一同启停
+	startPointTxScheduler(topicConsumer.ctx)
 
 	// 开始消费主题
-	return topicConsumer.ConsumeTopics(AllTopics)
+	return topicConsumer.ConsumeTopics(topics)
+}
+
+// ShutdownConsumer 优雅停止当前运行的消费者，处理完内存中的批次并提交 offset，
+// 并等待积分交易状态调度器完成正在进行的检测
+func ShutdownConsumer(ctx context.Context) error {
+	topicConsumer := activeConsumer.Load()
+	if topicConsumer == nil {
+		return nil
+	}
+	err := topicConsumer.Shutdown(ctx)
+	if waitErr := waitPointTxScheduler(ctx); waitErr != nil && err == nil {
+		err = waitErr
+	}
+	return err
 }
 
 func initSolPrice() error {
@@ -149,11 +149,9 @@ func handlePumpfunCreate(message []byte) error {
 
 	util.Log().Info("成功创建代币信息: %s", createMsg.Mint)
 
-	// 创建代币流动性池
+	// 创建代币流动性池，储备量按创建时生效的曲线参数初始化
 	liquidityPoolService := &service.TokenLiquidityPoolService{}
 	liquidityPool := liquidityPoolService.CreatePumpFunInitialPool(&createMsg)
-	liquidityPool.RealNativeReserves, _ = strconv.ParseUint(model.PUMP_INITIAL_REALSOL_TOKEN_RESERVES, 10, 64)
-	liquidityPool.RealTokenReserves, _ = strconv.ParseUint(model.PUMP_INITIAL_REAL_TOKEN_RESERVES, 10, 64)
 	resp = liquidityPoolService.ProcessTokenLiquidityPoolCreation(liquidityPool)
 	if resp.Code != 0 {
 		util.Log().Error("创建流动性池失败: %v", resp.Error)
@@ -191,6 +189,15 @@ func handlePumpfunComplete(message []byte) error {
 		return fmt.Errorf("failed to update token complete status: code=%d, error=%s", resp.Code, errMsg)
 	}
 
+	// Raydium 建池消息先于完成消息到达时，在此关联迁移后的池子
+	liquidityPoolService := &service.TokenLiquidityPoolService{}
+	raydiumPools, err := liquidityPoolService.GetTokenLiquidityPoolsByTokenAddresses([]string{completeMsg.Mint}, uint8(model.PlatformTypeRaydium))
+	if err != nil {
+		util.Log().Error("Failed to query raydium pool for completed token %s: %v", completeMsg.Mint, err)
+	} else if len(raydiumPools) > 0 {
+		linkMigratedPool(completeMsg.Mint, raydiumPools[0].PoolAddress)
+	}
+
 	// 清除缓存
 	if err := redis.Del(fmt.Sprintf("%s:%s", constants.RedisKeyPrefixTokenInfo, completeMsg.Mint)); err != nil {
 		util.Log().Error("Failed to delete Redis cache: %v", err)
@@ -201,21 +208,43 @@ func handlePumpfunComplete(message []byte) error {
 	return nil
 }
 
-func handlePumpfunSetParams(message []byte) error {
-	// TODO: 实现 pumpfun-set-params 的处理逻辑
-	var setParamsMsg struct {
-		// 定义 pumpfun-set-params 消息的结构
+// linkMigratedPool 将已完成的 pump 代币关联到 Raydium 池子，非 pump 代币不做处理
+func linkMigratedPool(tokenAddress string, poolAddress string) {
+	rows, err := model.LinkMigratedTokenPool(tokenAddress, uint8(model.ChainTypeSolana), poolAddress)
+	if err != nil {
+		util.Log().Error("Failed to link token %s to raydium pool %s: %v", tokenAddress, poolAddress, err)
+		return
+	}
+	if rows == 0 {
+		return
 	}
+
+	if err := redis.Del(fmt.Sprintf("%s:%s", constants.RedisKeyPrefixTokenInfo, tokenAddress)); err != nil {
+		util.Log().Error("Failed to delete Redis cache: %v", err)
+	}
+	util.Log().Info("Linked migrated token %s to raydium pool %s", tokenAddress, poolAddress)
+}
+
+// handlePumpfunSetParams 记录 pump.fun 全局曲线参数，之后创建的代币及进度计算使用新参数
+func handlePumpfunSetParams(message []byte) error {
+	var setParamsMsg model.PumpSetParamsMessage
 	if err := json.Unmarshal(message, &setParamsMsg); err != nil {
 		return fmt.Errorf("failed to unmarshal pumpfun-set-params message: %v", err)
 	}
 
-	// 处理 setParamsMsg
-	util.Log().Info("Handling pumpfun-set-params message")
+	params, err := service.SavePumpCurveParamsFromMessage(&setParamsMsg)
+	if err != nil {
+		util.Log().Error("Failed to save pump curve params from %s: %v", setParamsMsg.Signature, err)
+		return err
+	}
+
+	util.Log().Info("Updated pump curve params at block %d: virtualToken=%d virtualSol=%d realToken=%d supply=%d feeBps=%d",
+		params.Block, params.InitialVirtualTokenReserves, params.InitialVirtualSolReserves,
+		params.InitialRealTokenReserves, params.TokenTotalSupply, params.FeeBasisPoints)
 	return nil
 }
 
-func PumpfunBatchHandler(topic string, messages []sarama.ConsumerMessage, partition int32, goroutineID uint64) error {
+func PumpfunBatchHandler(topic string, messages []Message, partition int32, goroutineID uint64) error {
 	util.Log().Info("Processing batch messages for topic %s: %d messages", topic, len(messages))
 
 	switch topic {
@@ -227,7 +256,7 @@ func PumpfunBatchHandler(topic string, messages []sarama.ConsumerMessage, partit
 	}
 }
 
-func handlePumpTradeMessages(messages []sarama.ConsumerMessage) error {
+func handlePumpTradeMessages(messages []Message) error {
 	var tokenTradeMessages []*model.TokenTradeMessage
 	for _, msg := range messages {
 		var tokenTradeMsg model.TokenTradeMessage
@@ -246,16 +275,16 @@ func handlePumpTradeMessages(messages []sarama.ConsumerMessage) error {
 	}
 
 	// 处理交易消息
-	if err := handlePumpfunTokenTransactions(tokenTradeMessages); err != nil {
+	if err := handlePumpfunTokenTransactions(tokenTradeMessages, batchSource(messages)); err != nil {
 		util.Log().Error("处理交易消息失败: %v", err)
-		return fmt.Errorf("处理交易消息失败: %v", err)
+		return fmt.Errorf("处理交易消息失败: %w", err)
 	}
 
 	return nil
 }
 
-// 处理交易消息
-func handlePumpfunTokenTransactions(tokenTradeMessages []*model.TokenTradeMessage) error {
+// 处理交易消息，source 为消息来源的 offset 区间，用于 ClickHouse 写入去重
+func handlePumpfunTokenTransactions(tokenTradeMessages []*model.TokenTradeMessage, source string) error {
 	tokenTxService := &service.TokenTransactionService{}
 
 	// 转换消息到交易
@@ -276,15 +305,15 @@ func handlePumpfunTokenTransactions(tokenTradeMessages []*model.TokenTradeMessag
 
 	// 处理今的数据
 	if len(todayTxs) > 0 {
-		if err := processCurrentDayPumpfunTransactions(todayTxs); err != nil {
-			return fmt.Errorf("处理当天交易失败: %v", err)
+		if err := processCurrentDayPumpfunTransactions(todayTxs, source); err != nil {
+			return fmt.Errorf("处理当天交易失败: %w", err)
 		}
 	}
 
 	// 处理历史数据
 	if len(oldTxs) > 0 {
 		if err := processHistoricalPumpfunTransactions(oldTxs); err != nil {
-			return fmt.Errorf("处理历史交易失败: %v", err)
+			return fmt.Errorf("处理历史交易失败: %w", err)
 		}
 	}
 
@@ -292,32 +321,27 @@ func handlePumpfunTokenTransactions(tokenTradeMessages []*model.TokenTradeMessag
 }
 
 // 处理当天交易数据
-func processCurrentDayPumpfunTransactions(transactions []*model.TokenTransaction) error {
-	tokenTxService := &service.TokenTransactionService{}
-	tokenTxIndexService := &service.TokenTxIndexService{}
-
+func processCurrentDayPumpfunTransactions(transactions []*model.TokenTransaction, source string) error {
 	// 批量创建交易记录
 	start := time.Now()
 	currentDate := time.Now().Format("20060102")
-	resp := tokenTxService.ProcessBatchTokenTransactionCreation(transactions, currentDate)
-	if resp.Code != 0 {
-		util.Log().Error("批量创建代币交易失败: %v", resp.Error)
-		return fmt.Errorf("failed to create transactions: %v", resp.Error)
+	if err := tradeStore.CreateTransactions(transactions, currentDate); err != nil {
+		util.Log().Error("批量创建代币交易失败: %v", err)
+		return fmt.Errorf("failed to create transactions: %v", err)
 	}
 	util.Log().Info("批量创建交易记录耗时: %v", time.Since(start))
 
 	// 批量创建交易索引
 	start = time.Now()
-	indexResp := tokenTxIndexService.BatchCreateIndexFromTransactions(transactions)
-	if indexResp.Code != 0 {
-		util.Log().Error("批量创建代币交易索引失败: %v", indexResp.Error)
-		return fmt.Errorf("failed to create indices: %v", indexResp.Error)
+	if err := tradeStore.CreateTransactionIndices(transactions); err != nil {
+		util.Log().Error("批量创建代币交易索引失败: %v", err)
+		return fmt.Errorf("failed to create indices: %v", err)
 	}
 	util.Log().Info("批量创建交易索引耗时: %v", time.Since(start))
 
 	// 更新代币信息
 	start = time.Now()
-	tokenInfoMap, err := updateTokensInfo(transactions)
+	tokenInfoMap, err := tradeStore.UpdateTokens(transactions)
 	if err != nil {
 		util.Log().Error("更新代币信息失败: %v", err)
 		// 不返回错误，继续处理其他逻辑
@@ -326,7 +350,7 @@ func processCurrentDayPumpfunTransactions(transactions []*model.TokenTransaction
 
 	// 更新池子信息
 	start = time.Now()
-	poolInfoMap, err := updatePoolsInfo(transactions)
+	poolInfoMap, err := tradeStore.UpdatePools(transactions)
 	if err != nil {
 		util.Log().Error("更新池子信息失败: %v", err)
 		// 不返回错误，继续处理其他逻辑
@@ -342,7 +366,9 @@ func processCurrentDayPumpfunTransactions(transactions []*model.TokenTransaction
 
 	// 处理 ClickHouse 数据
 	start = time.Now()
-	processClickHouseData(transactions)
+	if err := processClickHouseData(transactions, source); err != nil {
+		return err
+	}
 	util.Log().Info("处理 ClickHouse 数据耗时: %v", time.Since(start))
 
 	return nil
@@ -381,19 +407,18 @@ func updateTokensInfo(transactions []*model.TokenTransaction) (map[string]*model
 		util.Log().Info("Found missing tokens: %v", missingTokens)
 
 		// 准备批量消息
-		messages := make([]*sarama.ProducerMessage, 0, len(missingTokens))
+		messages := make([]ProducerMessage, 0, len(missingTokens))
 
 		for _, addr := range missingTokens {
-			msg := &sarama.ProducerMessage{
+			messages = append(messages, ProducerMessage{
 				Topic: TopicUnknownToken,
-				Value: sarama.StringEncoder(addr),
-			}
-			messages = append(messages, msg)
+				Value: []byte(addr),
+			})
 		}
 
 		// 批量发送消息
 		if len(messages) > 0 {
-			err := GetProducer().SendMessages(messages)
+			err := DefaultProducer().SendMessages(messages)
 			if err != nil {
 				util.Log().Error("Failed to send batch unknown token messages: %v", err)
 			} else {
@@ -587,9 +612,6 @@ func processCreatorTransaction(tokenInfo *model.TokenInfo, tx *model.TokenTransa
 
 // 处理历史交易数据
 func processHistoricalPumpfunTransactions(transactions []*model.TokenTransaction) error {
-	tokenTxService := &service.TokenTransactionService{}
-	tokenTxIndexService := &service.TokenTxIndexService{}
-
 	// 按日期分组
 	txsByDate := make(map[string][]*model.TokenTransaction)
 	for _, tx := range transactions {
@@ -608,16 +630,14 @@ func processHistoricalPumpfunTransactions(transactions []*model.TokenTransaction
 		}
 
 		// 批量创建历史交易记录
-		resp := tokenTxService.ProcessBatchTokenTransactionCreation(txs, date)
-		if resp.Code != 0 {
-			util.Log().Error("创建 %s 的历史交易失败: %v", date, resp.Error)
+		if err := tradeStore.CreateTransactions(txs, date); err != nil {
+			util.Log().Error("创建 %s 的历史交易失败: %v", date, err)
 			continue
 		}
 
 		// 批量创建历史交易索引
-		indexResp := tokenTxIndexService.BatchCreateIndexFromTransactions(txs)
-		if indexResp.Code != 0 {
-			util.Log().Error("创建 %s 的历史交易索引失败: %v", date, indexResp.Error)
+		if err := tradeStore.CreateTransactionIndices(txs); err != nil {
+			util.Log().Error("创建 %s 的历史交易索引失败: %v", date, err)
 			continue
 		}
 
@@ -627,7 +647,7 @@ func processHistoricalPumpfunTransactions(transactions []*model.TokenTransaction
 	return nil
 }
 
-func RaydiumBatchHandler(topic string, messages []sarama.ConsumerMessage, partition int32, goroutineID uint64) error {
+func RaydiumBatchHandler(topic string, messages []Message, partition int32, goroutineID uint64) error {
 	util.Log().Info("Processing batch messages for topic %s: %d messages", topic, len(messages))
 
 	switch topic {
@@ -639,8 +659,8 @@ func RaydiumBatchHandler(topic string, messages []sarama.ConsumerMessage, partit
 	}
 }
 
-func handleRaydiumSwapMessages(messages []sarama.ConsumerMessage) error {
-	var raydiumSwapMessages []*model.RaydiumSwapMessage
+func handleRaydiumSwapMessages(messages []Message) error {
+	var swaps []raydiumSwap
 	for _, msg := range messages {
 		var swapMsg model.RaydiumSwapMessage
 		err := json.Unmarshal(msg.Value, &swapMsg)
@@ -648,31 +668,112 @@ func handleRaydiumSwapMessages(messages []sarama.ConsumerMessage) error {
 			util.Log().Error("Failed to unmarshal Raydium swap message: %v", err)
 			continue
 		}
-		raydiumSwapMessages = append(raydiumSwapMessages, &swapMsg)
+		swaps = append(swaps, raydiumSwap{message: msg, swap: &swapMsg})
 	}
 
 	// 如果没有有效的交易消息,直接返回
-	if len(raydiumSwapMessages) == 0 {
+	if len(swaps) == 0 {
 		util.Log().Info("No valid Raydium swap messages to process")
 		return nil
 	}
 
 	// 处理 Raydium 交易消息
-	if err := handleRaydiumSwapTransactions(raydiumSwapMessages); err != nil {
+	failed, err := handleRaydiumSwaps(swaps)
+	if err != nil {
 		util.Log().Error("处理 Raydium 交易消息失败: %v", err)
-		return fmt.Errorf("处理 Raydium 交易消息失败: %v", err)
+		err = fmt.Errorf("处理 Raydium 交易消息失败: %w", err)
+		if len(failed) < len(messages) {
+			return &partialBatchError{failed: failed, err: err}
+		}
+		return err
 	}
 
 	return nil
 }
 
+// raydiumSwap 解析后的 swap 消息及其原始消息
+type raydiumSwap struct {
+	message Message
+	swap    *model.RaydiumSwapMessage
+}
+
 // 处理 Raydium 交易消息
-func handleRaydiumSwapTransactions(swapMessages []*model.RaydiumSwapMessage) error {
-	tokenTxService := &service.TokenTransactionService{}
+// 按代币地址将交易分片到多个 worker 并发处理，同一代币的交易落在同一分片内并保持原有顺序
+// 所有分片都处理完成后才返回，返回失败分片中的消息，由消费者只重试这些消息
+// 每个分片按自身的消息生成 ClickHouse 去重 source，重试时分片内容不变，已写入的行会被过滤
+func handleRaydiumSwaps(swaps []raydiumSwap) ([]Message, error) {
+	shards := shardSwapsByToken(swaps, util.GetEnvAsInt("KAFKA_RAYDIUM_SWAP_WORKERS", 4))
+
+	errs := make([]error, len(shards))
+	if len(shards) == 1 {
+		errs[0] = processRaydiumSwapShard(shards[0])
+	} else {
+		var wg sync.WaitGroup
+		for i, shard := range shards {
+			wg.Add(1)
+			go func(i int, shard []raydiumSwap) {
+				defer wg.Done()
+				errs[i] = processRaydiumSwapShard(shard)
+			}(i, shard)
+		}
+		wg.Wait()
+	}
+
+	var failed []Message
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		for _, s := range shards[i] {
+			failed = append(failed, s.message)
+		}
+	}
+	sort.Slice(failed, func(i, j int) bool {
+		return failed[i].Offset < failed[j].Offset
+	})
+	return failed, errors.Join(errs...)
+}
+
+// shardSwapsByToken 按代币地址哈希将交易分到最多 workers 个分片，忽略空分片
+func shardSwapsByToken(swaps []raydiumSwap, workers int) [][]raydiumSwap {
+	if workers <= 1 {
+		return [][]raydiumSwap{swaps}
+	}
+
+	buckets := make([][]raydiumSwap, workers)
+	for _, s := range swaps {
+		idx := util.HashString(s.swap.QuoteToken) % uint32(workers)
+		buckets[idx] = append(buckets[idx], s)
+	}
+
+	shards := make([][]raydiumSwap, 0, workers)
+	for _, bucket := range buckets {
+		if len(bucket) > 0 {
+			shards = append(shards, bucket)
+		}
+	}
+	if len(shards) == 0 {
+		return [][]raydiumSwap{swaps}
+	}
+	return shards
+}
+
+// processRaydiumSwapShard 转换并处理单个分片的 swap 消息
+func processRaydiumSwapShard(shard []raydiumSwap) error {
+	messages := make([]Message, 0, len(shard))
+	swapMessages := make([]*model.RaydiumSwapMessage, 0, len(shard))
+	for _, s := range shard {
+		messages = append(messages, s.message)
+		swapMessages = append(swapMessages, s.swap)
+	}
 
-	// 换消息到交易
+	tokenTxService := &service.TokenTransactionService{}
 	tokenTransactions := tokenTxService.ConvertRaydiumSwapMessagesToTransactions(swapMessages)
+	return processRaydiumTransactionShard(tokenTransactions, batchSource(messages))
+}
 
+// processRaydiumTransactionShard 处理单个分片内的 Raydium 交易
+func processRaydiumTransactionShard(tokenTransactions []*model.TokenTransaction, source string) error {
 	// 分离新旧数据
 	currentDate := time.Now().Format("2006-01-02")
 	var todayTxs, oldTxs []*model.TokenTransaction
@@ -688,15 +789,15 @@ func handleRaydiumSwapTransactions(swapMessages []*model.RaydiumSwapMessage) err
 
 	// 处理今天的数据
 	if len(todayTxs) > 0 {
-		if err := processCurrentDayRaydiumTransactions(todayTxs); err != nil {
-			return fmt.Errorf("处理当天 Raydium 交易失败: %v", err)
+		if err := processCurrentDayRaydiumTransactions(todayTxs, source); err != nil {
+			return fmt.Errorf("处理当天 Raydium 交易失败: %w", err)
 		}
 	}
 
 	// 处理历史数据
 	if len(oldTxs) > 0 {
 		if err := processHistoricalRaydiumTransactions(oldTxs); err != nil {
-			return fmt.Errorf("处理历史 Raydium 交易失败: %v", err)
+			return fmt.Errorf("处理历史 Raydium 交易失败: %w", err)
 		}
 	}
 
@@ -704,18 +805,15 @@ func handleRaydiumSwapTransactions(swapMessages []*model.RaydiumSwapMessage) err
 }
 
 // 处理当天 Raydium 交易数据
-func processCurrentDayRaydiumTransactions(transactions []*model.TokenTransaction) error {
+func processCurrentDayRaydiumTransactions(transactions []*model.TokenTransaction, source string) error {
 	totalStart := time.Now()
-	tokenTxService := &service.TokenTransactionService{}
-	tokenTxIndexService := &service.TokenTxIndexService{}
 
 	// 1. 批量创建交易记录
 	txCreateStart := time.Now()
 	currentDate := time.Now().Format("20060102")
-	resp := tokenTxService.ProcessBatchTokenTransactionCreation(transactions, currentDate)
-	if resp.Code != 0 {
-		util.Log().Error("批量创建代币交易失败: %v", resp.Error)
-		return fmt.Errorf("failed to create transactions: %v", resp.Error)
+	if err := tradeStore.CreateTransactions(transactions, currentDate); err != nil {
+		util.Log().Error("批量创建代币交易失败: %v", err)
+		return fmt.Errorf("failed to create transactions: %v", err)
 	}
 	util.Log().Info("1. 批量创建交易记录耗时: %v, 交易数量: %d",
 		time.Since(txCreateStart),
@@ -723,16 +821,15 @@ func processCurrentDayRaydiumTransactions(transactions []*model.TokenTransaction
 
 	// 2. 批量创建交易索引
 	indexStart := time.Now()
-	indexResp := tokenTxIndexService.BatchCreateIndexFromTransactions(transactions)
-	if indexResp.Code != 0 {
-		util.Log().Error("批量创建代币交易索引失败: %v", indexResp.Error)
-		return fmt.Errorf("failed to create indices: %v", indexResp.Error)
+	if err := tradeStore.CreateTransactionIndices(transactions); err != nil {
+		util.Log().Error("批量创建代币交易索引失败: %v", err)
+		return fmt.Errorf("failed to create indices: %v", err)
 	}
 	util.Log().Info("2. 批量创建交易索引耗时: %v", time.Since(indexStart))
 
 	// 3. 更新代币信息
 	tokenStart := time.Now()
-	tokenInfoMap, err := updateTokensInfo(transactions)
+	tokenInfoMap, err := tradeStore.UpdateTokens(transactions)
 	if err != nil {
 		util.Log().Error("更新代币信息失败: %v", err)
 		// 不返回错误，继续处理其他逻辑
@@ -743,7 +840,7 @@ func processCurrentDayRaydiumTransactions(transactions []*model.TokenTransaction
 
 	// 4. 更新池子信息
 	poolStart := time.Now()
-	poolInfoMap, err := updatePoolsInfo(transactions)
+	poolInfoMap, err := tradeStore.UpdatePools(transactions)
 	if err != nil {
 		util.Log().Error("更新池子信息失败: %v", err)
 		// 不返回错误，继续处理其他逻辑
@@ -761,7 +858,9 @@ func processCurrentDayRaydiumTransactions(transactions []*model.TokenTransaction
 
 	// 6. 处理 ClickHouse 数据
 	chStart := time.Now()
-	processClickHouseData(transactions)
+	if err := processClickHouseData(transactions, source); err != nil {
+		return err
+	}
 	util.Log().Info("6. 处理 ClickHouse 数据耗时: %v", time.Since(chStart))
 
 	// 总耗时统计
@@ -776,9 +875,6 @@ func processCurrentDayRaydiumTransactions(transactions []*model.TokenTransaction
 
 // 处理历史 Raydium 交易数据
 func processHistoricalRaydiumTransactions(transactions []*model.TokenTransaction) error {
-	tokenTxService := &service.TokenTransactionService{}
-	tokenTxIndexService := &service.TokenTxIndexService{}
-
 	// 按日期分组
 	txsByDate := make(map[string][]*model.TokenTransaction)
 	for _, tx := range transactions {
@@ -797,16 +893,14 @@ func processHistoricalRaydiumTransactions(transactions []*model.TokenTransaction
 		}
 
 		// 批量创建历史交易记录
-		resp := tokenTxService.ProcessBatchTokenTransactionCreation(txs, date)
-		if resp.Code != 0 {
-			util.Log().Error("创建 %s 的历史交易失败: %v", date, resp.Error)
+		if err := tradeStore.CreateTransactions(txs, date); err != nil {
+			util.Log().Error("创建 %s 的历史交易失败: %v", date, err)
 			continue
 		}
 
 		// 批量创建历史交易索引
-		indexResp := tokenTxIndexService.BatchCreateIndexFromTransactions(txs)
-		if indexResp.Code != 0 {
-			util.Log().Error("创建 %s 的历史交易索引失败: %v", date, indexResp.Error)
+		if err := tradeStore.CreateTransactionIndices(txs); err != nil {
+			util.Log().Error("创建 %s 的历史交易索引失败: %v", date, err)
 			continue
 		}
 
@@ -849,6 +943,9 @@ func handleRaydiumCreate(message []byte) error {
 
 	util.Log().Info("成功创建流动性池: %s", createMsg.PoolAddress)
 
+	// pump 代币迁移到 Raydium 后关联新池子
+	linkMigratedPool(createMsg.QuoteToken, createMsg.PoolAddress)
+
 	return nil
 }
 
@@ -904,64 +1001,37 @@ func handleRaydiumRemoveLiquidity(message []byte) error {
 	return nil
 }
 
-// 处理 ClickHouse 数据
-func processClickHouseData(transactions []*model.TokenTransaction) {
-	transactionCkService := &service.TransactionCkServiceImpl{}
-
-	// 转换并处理交易数据
-	transactionCks := transactionCkService.ConvertToTransactionCks(transactions)
-	if err := transactionCkService.BatchProcessTransactions(transactionCks); err != nil {
-		util.Log().Error("Failed to process transactions in ClickHouse: %v", err)
-		// 这里只记录错误但不返回，因为 ClickHouse 的错误不应影响主流
+// insertProxyTransaction 写入代理交易到 ClickHouse，失败时返回 sinkError
+func insertProxyTransaction(proxyTx *clickhouse.ProxyTransaction) error {
+	if !sinkEnabled(SinkClickHouse) {
+		return nil
 	}
+	return reportSinkResult(SinkClickHouse, gameTradeStore.InsertProxyTransaction(proxyTx))
 }
 
-// 处理 Elasticsearch 数据
-func processElasticsearchData(transactions []*model.TokenTransaction, tokenInfoMap map[string]*model.TokenInfo, poolInfoMap map[string]*model.TokenLiquidityPool) error {
-	totalStart := time.Now()
-	tokenTxService := &service.TokenTransactionService{}
-
-	// 1. 获取 ES 文档列表
-	prepareStart := time.Now()
-	esDocList := tokenTxService.GetESDocList(transactions, tokenInfoMap, poolInfoMap)
-	prepareTime := time.Since(prepareStart)
-	util.Log().Info("ES文档准备耗时: %v, 文档数量: %d", prepareTime, len(esDocList))
-
-	// 2. 批量索引文档
-	indexStart := time.Now()
-	resp, err := es.BulkIndexDocuments(conf.ES_INDEX_TOKEN_TRANSACTIONS_ALIAS, esDocList)
-	if err != nil {
-		util.Log().Error("Failed to bulk index documents in Elasticsearch: %v", err)
-		return fmt.Errorf("failed to index to ES: %v", err)
-	}
-	indexTime := time.Since(indexStart)
-
-	// 3. 记录批量索引结果
-	if resp != nil {
-		util.Log().Info("ES批量索引结果 - 成功: %d, 耗时: %v",
-			len(resp.Items),
-			indexTime)
-
-		// 如果有失败的文档，记录详细信息
-		if len(resp.Failed()) > 0 {
-			for _, item := range resp.Failed() {
-				util.Log().Error("ES索引失败 - Index: %s, Type: %s, ID: %s, Error: %v",
-					item.Index,
-					item.Type,
-					item.Id,
-					item.Error)
-			}
-		}
+// batchSource 批量消息的来源标识 topic/partition/起止 offset，同一批消息重试时保持不变
+func batchSource(messages []Message) string {
+	if len(messages) == 0 {
+		return ""
 	}
+	first, last := messages[0], messages[len(messages)-1]
+	return fmt.Sprintf("%s/%d/%d-%d", first.Topic, first.Partition, first.Offset, last.Offset)
+}
 
-	totalTime := time.Since(totalStart)
-	util.Log().Info("ES处理总耗时: %v (准备: %v, 索引: %v), 总文档数: %d",
-		totalTime,
-		prepareTime,
-		indexTime,
-		len(esDocList))
+// 处理 ClickHouse 数据，写入失败时返回 sinkError，由消费者暂停分区后重试
+func processClickHouseData(transactions []*model.TokenTransaction, source string) error {
+	if !sinkEnabled(SinkClickHouse) {
+		return nil
+	}
+	return reportSinkResult(SinkClickHouse, tradeStore.InsertTransactions(transactions, source))
+}
 
-	return nil
+// 处理 Elasticsearch 数据，写入失败时返回 sinkError，由消费者暂停分区后重试
+func processElasticsearchData(transactions []*model.TokenTransaction, tokenInfoMap map[string]*model.TokenInfo, poolInfoMap map[string]*model.TokenLiquidityPool) error {
+	if !sinkEnabled(SinkElasticsearch) {
+		return nil
+	}
+	return reportSinkResult(SinkElasticsearch, tradeStore.IndexTransactions(transactions, tokenInfoMap, poolInfoMap))
 }
 
 // updatePoolsInfo 更新代币池子信息
@@ -1264,9 +1334,9 @@ func saveRaydiumPool(tokenAddress string) error {
 	return nil
 }
 
-// gameOutTradeHandler 处理代理合约外盘买卖事件
-func gameOutTradeHandler(message []byte, topic string) error {
-	util.Log().Info("gameOutTradeHandler: Processing message from topic %s", topic)
+// GameOutTradeHandler 处理代理合约外盘买卖事件
+func GameOutTradeHandler(message []byte, topic string) error {
+	util.Log().Info("GameOutTradeHandler: Processing message from topic %s", topic)
 
 	var tradeMsg model.GameOutTradeMessage
 	if err := json.Unmarshal(message, &tradeMsg); err != nil {
@@ -1274,9 +1344,44 @@ func gameOutTradeHandler(message []byte, topic string) error {
 		return fmt.Errorf("failed to unmarshal game-out-trade message: %v", err)
 	}
 
+	proxyTx := buildGameOutProxyTransaction(&tradeMsg)
+	if err := insertProxyTransaction(proxyTx); err != nil {
+		util.Log().Error("Failed to insert proxy transaction: %v", err)
+		return fmt.Errorf("failed to insert proxy transaction: %w", err)
+	}
+
+	amounts := map[model.StatisticType]uint64{
+		model.FeeAmount:     proxyTx.FeeBaseAmount,
+		model.BackAmount:    proxyTx.FeeQuoteAmount,
+		model.BackSolAmount: proxyTx.BuybackFeeBaseAmount,
+	}
+
+	if tradeMsg.IsBurn {
+		amounts[model.BurnAmount] = proxyTx.FeeQuoteAmount
+	}
+
+	// err := pointsService.PointsSave(tradeMsg.User, uint64(point), tradeMsg.Signature, string(message), quoteAmount, baseAmount, tradeMsg.QuoteToken, amounts)
+	// if err != nil {
+	// 	util.Log().Error("Failed to save points: %v", err)
+	// 	return fmt.Errorf("failed to save points: %v", err)
+	// }
+
+	// platformTokenStatisticRepo := model.NewPlatformTokenStatisticRepo()
+	err := gameTradeStore.IncrementStatistics(tradeMsg.QuoteToken, amounts)
+	if err != nil {
+		util.Log().Error("Failed to save points: %v", err)
+		return fmt.Errorf("failed to save points: %v", err)
+	}
+
+	return nil
+}
+
+// buildGameOutProxyTransaction 根据外盘交易消息计算积分并构建代理交易记录
+func buildGameOutProxyTransaction(tradeMsg *model.GameOutTradeMessage) *clickhouse.ProxyTransaction {
 	discount, _ := strconv.ParseUint(os.Getenv("DISCOUNT"), 10, 64)
 	coefficient, _ := strconv.ParseUint(os.Getenv("COEFFICIENT"), 10, 64)
 
+	// 数值字段已在 schema 校验中确认为合法的无符号整数
 	poolQuoteReserve, _ := strconv.ParseUint(tradeMsg.PoolQuoteReserve, 10, 64)
 	poolBaseReserve, _ := strconv.ParseUint(tradeMsg.PoolBaseReserve, 10, 64)
 	feeBaseAmount, _ := strconv.ParseUint(tradeMsg.FeeBaseAmount, 10, 64)
@@ -1348,64 +1453,50 @@ func gameOutTradeHandler(message []byte, topic string) error {
 		TransactionTime:      time.Unix(tradeMsg.Timestamp, 0),
 		CreateTime:           time.Now(),
 	}
+	return proxyTx
+}
 
-	if err := clickhouse.InsertProxyTransaction(proxyTx); err != nil {
-		util.Log().Error("Failed to insert proxy transaction: %v", err)
-		return fmt.Errorf("failed to insert proxy transaction: %v", err)
+// GameInTradeHandler 处理代理合约内盘买事件（积分兑换买）
+func GameInTradeHandler(message []byte, topic string) error {
+	util.Log().Info("GameInTradeHandler: Processing message from topic %s", topic)
+
+	var tradeMsg model.GameInTradeMessage
+	if err := json.Unmarshal(message, &tradeMsg); err != nil {
+		util.Log().Error("Failed to unmarshal game-in-trade message: %v", err)
+		return fmt.Errorf("failed to unmarshal game-in-trade message: %v", err)
 	}
 
-	pointRecordsRepo := model.NewPointRecordsRepo()
-	userInfoRepo := model.NewUserInfoRepo()
-	platformTokenStatisticRepo := model.NewPlatformTokenStatisticRepo()
-	pointsService := service.NewPointsServiceImpl(userInfoRepo, pointRecordsRepo, platformTokenStatisticRepo)
+	// 将交易数据插入到ClickHouse
+	proxyTx := buildGameInProxyTransaction(&tradeMsg)
 
-	amounts := map[model.StatisticType]uint64{
-		model.FeeAmount:     feeBaseAmount,
-		model.BackAmount:    feeQuoteAmount,
-		model.BackSolAmount: buybackFeeBaseAmount,
+	// 插入到ClickHouse
+	if err := insertProxyTransaction(proxyTx); err != nil {
+		util.Log().Error("Failed to insert game-in trade to ClickHouse: %v", err)
+		return fmt.Errorf("failed to insert game-in trade to ClickHouse: %w", err)
 	}
 
-	if tradeMsg.IsBurn {
-		amounts[model.BurnAmount] = feeQuoteAmount
+	amounts := map[model.StatisticType]uint64{
+		model.FeeAmount:    proxyTx.FeeBaseAmount,
+		model.PointsAmount: proxyTx.PointsAmount,
 	}
 
-	// err := pointsService.PointsSave(tradeMsg.User, uint64(point), tradeMsg.Signature, string(message), quoteAmount, baseAmount, tradeMsg.QuoteToken, amounts)
-	// if err != nil {
-	// 	util.Log().Error("Failed to save points: %v", err)
-	// 	return fmt.Errorf("failed to save points: %v", err)
-	// }
-
-	// platformTokenStatisticRepo := model.NewPlatformTokenStatisticRepo()
-	err := pointsService.IncrementStatisticsAndUpdateTime(tradeMsg.QuoteToken, amounts)
+	err := gameTradeStore.CreatePointRecord(tradeMsg.User, proxyTx.PointsAmount, tradeMsg.Signature, string(message), model.BuyG, proxyTx.QuoteTokenAmount, proxyTx.BaseTokenAmount, true, tradeMsg.QuoteToken, amounts)
 	if err != nil {
-		util.Log().Error("Failed to save points: %v", err)
 		return fmt.Errorf("failed to save points: %v", err)
 	}
 
 	return nil
 }
 
-// gameInTradeHandler 处理代理合约内盘买事件（积分兑换买）
-func gameInTradeHandler(message []byte, topic string) error {
-	util.Log().Info("gameInTradeHandler: Processing message from topic %s", topic)
-
-	var tradeMsg model.GameInTradeMessage
-	if err := json.Unmarshal(message, &tradeMsg); err != nil {
-		util.Log().Error("Failed to unmarshal game-in-trade message: %v", err)
-		return fmt.Errorf("failed to unmarshal game-in-trade message: %v", err)
-	}
-	pointRecordsRepo := model.NewPointRecordsRepo()
-	userInfoRepo := model.NewUserInfoRepo()
-	PlatformTokenStatisticRepo := model.NewPlatformTokenStatisticRepo()
-	pointsService := service.NewPointsServiceImpl(userInfoRepo, pointRecordsRepo, PlatformTokenStatisticRepo)
-
+// buildGameInProxyTransaction 根据内盘交易消息构建代理交易记录
+func buildGameInProxyTransaction(tradeMsg *model.GameInTradeMessage) *clickhouse.ProxyTransaction {
+	// 数值字段已在 schema 校验中确认为合法的无符号整数
 	feeBaseAmount, _ := strconv.ParseUint(tradeMsg.FeeBaseAmount, 10, 64)
 	pointsAmount, _ := strconv.ParseUint(tradeMsg.PointsAmount, 10, 64)
 	quoteAmount, _ := strconv.ParseUint(tradeMsg.QuoteAmount, 10, 64)
 	baseAmount, _ := strconv.ParseUint(tradeMsg.BaseAmount, 10, 64)
 
-	// 将交易数据插入到ClickHouse
-	proxyTx := &clickhouse.ProxyTransaction{
+	return &clickhouse.ProxyTransaction{
 		TransactionHash:  tradeMsg.Signature,
 		ChainType:        uint8(model.ChainTypeSolana), // 假设是Solana链
 		ProxyType:        uint8(model.ProxyTypeGameIn), // 假设GameIn类型
@@ -1420,27 +1511,10 @@ func gameInTradeHandler(message []byte, topic string) error {
 		TransactionTime:  time.Unix(tradeMsg.Timestamp, 0),
 		BlockTime:        time.Now(), // 如果tradeMsg中有区块时间应该使用那个
 	}
-
-	// 插入到ClickHouse
-	if err := clickhouse.InsertProxyTransaction(proxyTx); err != nil {
-		util.Log().Error("Failed to insert game-in trade to ClickHouse: %v", err)
-		return fmt.Errorf("failed to insert game-in trade to ClickHouse: %v", err)
-	}
-
-	amounts := map[model.StatisticType]uint64{
-		model.FeeAmount:    feeBaseAmount,
-		model.PointsAmount: pointsAmount,
-	}
-
-	err := pointsService.CreatePointRecord(tradeMsg.User, pointsAmount, tradeMsg.Signature, string(message), model.BuyG, quoteAmount, baseAmount, true, tradeMsg.QuoteToken, amounts)
-	if err != nil {
-		return fmt.Errorf("failed to save points: %v", err)
-	}
-
-	return nil
 }
 
 // pointTxStatusHandler 处理积分交易状态检测
+// 收到消息后立即检测一次，仍在处理中的交易放入 Redis 延迟队列，由 RunPointTxScheduler 继续检测，不阻塞消费
 func pointTxStatusHandler(message []byte, topic string) error {
 	util.Log().Info("pointTxStatusHandler: Processing message from topic %s", topic)
 
@@ -1450,62 +1524,8 @@ func pointTxStatusHandler(message []byte, topic string) error {
 		return fmt.Errorf("failed to unmarshal point-tx-status message: %v", err)
 	}
 
-	// 设置最大重试次数和重试间隔
-	maxRetries := 3
-	retryInterval := 10 * time.Second
-
-	for attempt := 0; attempt <= maxRetries; attempt++ {
-		resp, err := httpUtil.GetSwapStatusBySignature(statusMsg.Signature)
-		if err != nil || resp == nil || resp.Code != 2000 {
-			util.Log().Error("Failed to get swap request status: %v", err)
-			time.Sleep(retryInterval)
-			continue
-		}
-
-		// 根据状态进行不同处理
-		if resp.Data == "success" {
-			// 成功状态，处理完成
-			util.Log().Info("Transaction %s completed successfully", statusMsg.Signature)
-			return nil
-		} else if resp.Data == "failed" {
-			// 失败状态，恢复用户积分
-			userInfoRepo := model.NewUserInfoRepo()
-			if err := userInfoRepo.IncrementAvailablePointsByUserID(statusMsg.UserId, statusMsg.Points); err != nil {
-				util.Log().Error("Failed to restore points for user %d after transaction %s failed: %v",
-					statusMsg.UserId, statusMsg.Signature, err)
-				return fmt.Errorf("transaction failed but could not restore points: %w", err)
-			}
-			util.Log().Info("Transaction %s failed, restored %d points to user %d",
-				statusMsg.Signature, statusMsg.Points, statusMsg.UserId)
-			return nil
-		} else if resp.Data == "processing" {
-			// 处理中状态，如果已达到最大重试次数则退出
-			if attempt == maxRetries {
-				// 失败状态，恢复用户积分
-				userInfoRepo := model.NewUserInfoRepo()
-				if err := userInfoRepo.IncrementAvailablePointsByUserID(statusMsg.UserId, statusMsg.Points); err != nil {
-					util.Log().Error("Failed to restore points for user %d after transaction %s failed: %v",
-						statusMsg.UserId, statusMsg.Signature, err)
-					return fmt.Errorf("transaction failed but could not restore points: %w", err)
-				}
-				util.Log().Info("Transaction %s failed, restored %d points to user %d",
-					statusMsg.Signature, statusMsg.Points, statusMsg.UserId)
-
-				util.Log().Error("Transaction %s still in processing status after %d retries", statusMsg.Signature, maxRetries)
-				return nil
-			}
-
-			// 等待指定时间后重试
-			util.Log().Info("Transaction %s is processing, retrying in %v (attempt %d/%d)",
-				statusMsg.Signature, retryInterval, attempt+1, maxRetries)
-			time.Sleep(retryInterval)
-			continue
-		} else {
-			// 未知状态，记录日志并返回
-			util.Log().Error("Unknown transaction status %s for signature %s", resp.Data, statusMsg.Signature)
-			return fmt.Errorf("unknown transaction status: %s", resp.Data)
-		}
-	}
-
-	return nil
+	return checkPointTx(&pendingPointTx{
+		Message:        statusMsg,
+		FirstCheckedAt: time.Now().UnixMilli(),
+	})
 }
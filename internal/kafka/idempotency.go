@@ -0,0 +1,266 @@
+package kafka
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"game-fun-be/internal/constants"
+	"game-fun-be/internal/pkg/util"
+	"game-fun-be/internal/redis"
+)
+
+// 幂等处理的消息类型，与交易签名一起组成去重 key
+const (
+	MessageTypePumpCreate         = "pump_create"
+	MessageTypePumpComplete       = "pump_complete"
+	MessageTypePumpSetParams      = "pump_set_params"
+	MessageTypePumpTrade          = "pump_trade"
+	MessageTypeRayCreate          = "ray_create"
+	MessageTypeRayAddLiquidity    = "ray_add_liquidity"
+	MessageTypeRayRemoveLiquidity = "ray_remove_liquidity"
+	MessageTypeRaySwap            = "ray_swap"
+	MessageTypeGameOutTrade       = "game_out_trade"
+	MessageTypeGameInTrade        = "game_in_trade"
+	MessageTypePointTxStatus      = "point_tx_status"
+)
+
+// 去重 key 的取值：处理中为租约，处理成功后改为完成标记
+const (
+	idempotencyProcessing = "processing"
+	idempotencyDone       = "done"
+)
+
+// idempotencyTTL 处理完成标记的保留时间，需覆盖消息可能被重投递的时间窗口
+// 环境变量 KAFKA_IDEMPOTENCY_TTL 以秒为单位
+func idempotencyTTL() time.Duration {
+	return util.GetEnvAsDuration("KAFKA_IDEMPOTENCY_TTL", 72*time.Hour)
+}
+
+// idempotencyLeaseTTL 处理租约的有效期，处理过程中进程崩溃时租约到期后消息可被重新处理
+// 需大于单条消息或单个批次的最长处理时间，环境变量 KAFKA_IDEMPOTENCY_LEASE 以秒为单位
+func idempotencyLeaseTTL() time.Duration {
+	return util.GetEnvAsDuration("KAFKA_IDEMPOTENCY_LEASE", 5*time.Minute)
+}
+
+// replayIdempotencyTTL 回放命名空间中完成标记的保留时间，只需覆盖一次回放
+const replayIdempotencyTTL = 24 * time.Hour
+
+// idempotencyScope 独立的去重命名空间，回放时使用，避免被线上消费或上一次回放留下的完成标记跳过
+type idempotencyScope struct {
+	namespace  string
+	duplicates atomic.Int64 // 命名空间内跳过的重复消息数
+}
+
+// activeScope 当前生效的去重命名空间，为 nil 时使用线上命名空间
+var activeScope atomic.Pointer[idempotencyScope]
+
+// beginIdempotencyScope 切换到独立的去重命名空间，返回的恢复函数切回之前的命名空间
+func beginIdempotencyScope(namespace string) (*idempotencyScope, func()) {
+	scope := &idempotencyScope{namespace: namespace}
+	previous := activeScope.Swap(scope)
+	return scope, func() {
+		activeScope.Store(previous)
+	}
+}
+
+// signatureEnvelope 仅用于从消息中提取交易签名
+type signatureEnvelope struct {
+	Signature string `json:"signature"`
+}
+
+// extractSignature 从消息体中提取交易签名，解析失败时返回空字符串
+func extractSignature(message []byte) string {
+	var envelope signatureEnvelope
+	if err := json.Unmarshal(message, &envelope); err != nil {
+		return ""
+	}
+	return envelope.Signature
+}
+
+func idempotencyKey(messageType, dedupID string) string {
+	if scope := activeScope.Load(); scope != nil {
+		return fmt.Sprintf("%s:%s:%s:%s", constants.RedisKeyPrefixKafkaProcessed, scope.namespace, messageType, dedupID)
+	}
+	return fmt.Sprintf("%s:%s:%s", constants.RedisKeyPrefixKafkaProcessed, messageType, dedupID)
+}
+
+// claimMessage 通过 SETNX 获取消息的处理租约，返回 false 表示该消息已处理完成
+// 租约被其他消费者持有时等待其处理完成或租约到期，避免重投递的消息在前一次处理中断后被当作重复跳过
+func claimMessage(messageType, dedupID string) (bool, error) {
+	key := idempotencyKey(messageType, dedupID)
+	for {
+		claimed, err := redis.SetNX(key, idempotencyProcessing, idempotencyLeaseTTL())
+		if err != nil || claimed {
+			return claimed, err
+		}
+
+		value, err := redis.Get(key)
+		if err != nil {
+			return false, err
+		}
+		switch value {
+		case "":
+			// 租约在两次请求之间到期，重新抢占
+		case idempotencyProcessing:
+			time.Sleep(time.Second)
+		default:
+			// 完成标记（早期版本经 JSON 序列化写入，同样视为已处理）
+			return false, nil
+		}
+	}
+}
+
+// markProcessed 处理成功后将租约替换为保留 idempotencyTTL 的完成标记
+// 与租约一样写入原始字符串，不经过 redis.Set 的 JSON 序列化
+func markProcessed(messageType string, dedupIDs ...string) {
+	if len(dedupIDs) == 0 {
+		return
+	}
+	ttl := idempotencyTTL()
+	if activeScope.Load() != nil {
+		ttl = replayIdempotencyTTL
+	}
+	markers := make(map[string]string, len(dedupIDs))
+	for _, id := range dedupIDs {
+		markers[idempotencyKey(messageType, id)] = idempotencyDone
+	}
+	if err := redis.MSet(markers, ttl); err != nil {
+		util.Log().Error("Failed to mark messages processed: type=%s count=%d err=%v", messageType, len(dedupIDs), err)
+	}
+}
+
+// releaseMessage 处理失败时释放处理权，允许消息重投递后再次处理
+func releaseMessage(messageType string, dedupIDs ...string) {
+	if len(dedupIDs) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(dedupIDs))
+	for _, id := range dedupIDs {
+		keys = append(keys, idempotencyKey(messageType, id))
+	}
+	if err := redis.Del(keys...); err != nil {
+		util.Log().Error("Failed to release idempotency keys for %s: %v", messageType, err)
+	}
+}
+
+// recordDuplicate 累加重复消息的跳过次数，独立命名空间中的重复只计入该命名空间
+func recordDuplicate(messageType string, count int) {
+	if scope := activeScope.Load(); scope != nil {
+		scope.duplicates.Add(int64(count))
+		return
+	}
+	if err := redis.HIncrBy(constants.RedisKeyKafkaDuplicateStats, messageType, int64(count)); err != nil {
+		util.Log().Error("Failed to record duplicate stats for %s: %v", messageType, err)
+	}
+}
+
+// GetDuplicateStats 获取各消息类型累计跳过的重复消息数
+func GetDuplicateStats() (map[string]string, error) {
+	return redis.HGetAll(constants.RedisKeyKafkaDuplicateStats)
+}
+
+// WithIdempotency 为单条消息处理器增加幂等控制，按消息类型 + 交易签名去重
+func WithIdempotency(messageType string, handler MessageHandler) MessageHandler {
+	return func(message []byte, topic string) error {
+		signature := extractSignature(message)
+		if signature == "" {
+			util.Log().Warning("Message without signature, skip idempotency check: type=%s topic=%s", messageType, topic)
+			return handler(message, topic)
+		}
+
+		claimed, err := claimMessage(messageType, signature)
+		if err != nil {
+			return fmt.Errorf("failed to check idempotency for %s %s: %w", messageType, signature, err)
+		}
+		if !claimed {
+			recordDuplicate(messageType, 1)
+			util.Log().Info("Duplicate message skipped: type=%s signature=%s", messageType, signature)
+			return nil
+		}
+
+		if err := handler(message, topic); err != nil {
+			releaseMessage(messageType, signature)
+			return err
+		}
+		markProcessed(messageType, signature)
+		return nil
+	}
+}
+
+// WithBatchIdempotency 为批处理器增加幂等控制，批次中已处理过的消息会被过滤掉
+// 同一笔交易可能包含多次 swap，因此批量消息按 签名 + 消息体哈希 去重
+func WithBatchIdempotency(messageType string, batchHandler BatchMessageHandler) BatchMessageHandler {
+	return func(topic string, messages []Message, partition int32, goroutineID uint64) error {
+		fresh := make([]Message, 0, len(messages))
+		claimedIDs := make([]string, 0, len(messages))
+		claimedOffsets := make([]int64, 0, len(messages))
+		claimedSet := make(map[string]bool, len(messages))
+		duplicates := 0
+
+		for _, msg := range messages {
+			signature := extractSignature(msg.Value)
+			if signature == "" {
+				fresh = append(fresh, msg)
+				continue
+			}
+
+			dedupID := fmt.Sprintf("%s:%d", signature, util.HashString(string(msg.Value)))
+			// 同一批次内的重复消息不再请求租约，否则会等待自己持有的租约
+			if claimedSet[dedupID] {
+				duplicates++
+				continue
+			}
+			claimed, err := claimMessage(messageType, dedupID)
+			if err != nil {
+				releaseMessage(messageType, claimedIDs...)
+				return fmt.Errorf("failed to check idempotency for %s %s: %w", messageType, signature, err)
+			}
+			if !claimed {
+				duplicates++
+				continue
+			}
+			claimedIDs = append(claimedIDs, dedupID)
+			claimedOffsets = append(claimedOffsets, msg.Offset)
+			claimedSet[dedupID] = true
+			fresh = append(fresh, msg)
+		}
+
+		if duplicates > 0 {
+			recordDuplicate(messageType, duplicates)
+			util.Log().Info("Duplicate messages skipped: type=%s topic=%s partition=%d count=%d",
+				messageType, topic, partition, duplicates)
+		}
+		if len(fresh) == 0 {
+			return nil
+		}
+
+		if err := batchHandler(topic, fresh, partition, goroutineID); err != nil {
+			// 部分消息失败时保留已处理完成消息的记录，只释放失败的消息
+			var partial *partialBatchError
+			if !errors.As(err, &partial) {
+				releaseMessage(messageType, claimedIDs...)
+				return err
+			}
+			failedOffsets := make(map[int64]bool, len(partial.failed))
+			for _, msg := range partial.failed {
+				failedOffsets[msg.Offset] = true
+			}
+			var doneIDs, failedIDs []string
+			for i, id := range claimedIDs {
+				if failedOffsets[claimedOffsets[i]] {
+					failedIDs = append(failedIDs, id)
+				} else {
+					doneIDs = append(doneIDs, id)
+				}
+			}
+			markProcessed(messageType, doneIDs...)
+			releaseMessage(messageType, failedIDs...)
+			return err
+		}
+		markProcessed(messageType, claimedIDs...)
+		return nil
+	}
+}
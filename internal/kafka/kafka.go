@@ -1,6 +1,7 @@
 package kafka
 
 import (
+	"fmt"
 	"log"
 	"os"
 	"strings"
@@ -14,6 +15,9 @@ import (
 var (
 	KafkaProducer sarama.SyncProducer
 	KafkaConfig   *sarama.Config
+
+	// producerOverride 通过 SetProducer 设置的生产者，优先于 KafkaProducer
+	producerOverride Producer
 )
 
 func Kafka() sarama.SyncProducer {
@@ -39,13 +43,11 @@ func Kafka() sarama.SyncProducer {
 
 // SendMessage 发送消息到指定的 topic
 func SendMessage(topic string, message []byte) error {
-	msg := &sarama.ProducerMessage{
-		Topic: topic,
-		Value: sarama.ByteEncoder(message),
+	producer := DefaultProducer()
+	if producer == nil {
+		return fmt.Errorf("kafka producer is not initialized")
 	}
-
-	_, _, err := KafkaProducer.SendMessage(msg)
-	return err
+	return producer.SendMessage(ProducerMessage{Topic: topic, Value: message})
 }
 
 // Close 关闭 Kafka 连接
@@ -153,3 +155,19 @@ func optimizeKafkaConfig() *sarama.Config {
 func GetProducer() sarama.SyncProducer {
 	return KafkaProducer
 }
+
+// DefaultProducer 返回当前使用的生产者，优先使用 SetProducer 设置的生产者，未初始化时返回 nil
+func DefaultProducer() Producer {
+	if producerOverride != nil {
+		return producerOverride
+	}
+	if KafkaProducer == nil {
+		return nil
+	}
+	return NewSaramaProducer(KafkaProducer)
+}
+
+// SetProducer 替换全局生产者，如测试中使用 MemoryBroker，传入 nil 恢复使用 KafkaProducer
+func SetProducer(producer Producer) {
+	producerOverride = producer
+}
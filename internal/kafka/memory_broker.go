@@ -0,0 +1,271 @@
+package kafka
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryBroker 进程内的 Kafka 实现，每个 topic 只有分区 0，用于在没有 Kafka 集群时运行完整的处理流程
+// 同时实现 Producer，可通过 SetProducer 替换全局生产者，使死信、隔离等消息也写入内存
+type MemoryBroker struct {
+	mu        sync.Mutex
+	logs      map[string][]*Message       // topic -> 消息
+	committed map[string]map[string]int64 // group -> topic -> 下一条待消费的 offset
+	paused    map[string]map[string]bool  // group -> 暂停拉取的 topic
+	changed   chan struct{}               // 有新消息或新提交时关闭并替换，用于唤醒等待方
+}
+
+// NewMemoryBroker 创建内存 broker
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{
+		logs:      make(map[string][]*Message),
+		committed: make(map[string]map[string]int64),
+		paused:    make(map[string]map[string]bool),
+		changed:   make(chan struct{}),
+	}
+}
+
+// notifyLocked 唤醒所有等待方，调用方需持有锁
+func (b *MemoryBroker) notifyLocked() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// SendMessage 追加一条消息到 topic 末尾
+func (b *MemoryBroker) SendMessage(msg ProducerMessage) error {
+	return b.SendMessages([]ProducerMessage{msg})
+}
+
+// SendMessages 按顺序追加多条消息
+func (b *MemoryBroker) SendMessages(msgs []ProducerMessage) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	for _, msg := range msgs {
+		log := b.logs[msg.Topic]
+		b.logs[msg.Topic] = append(log, &Message{
+			Topic:     msg.Topic,
+			Partition: 0,
+			Offset:    int64(len(log)),
+			Key:       msg.Key,
+			Value:     msg.Value,
+			Timestamp: now,
+		})
+	}
+	b.notifyLocked()
+	return nil
+}
+
+// Close 实现 Producer，内存 broker 无需释放资源
+func (b *MemoryBroker) Close() error {
+	return nil
+}
+
+// Messages 返回 topic 中的全部消息副本
+func (b *MemoryBroker) Messages(topic string) []Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	messages := make([]Message, 0, len(b.logs[topic]))
+	for _, msg := range b.logs[topic] {
+		messages = append(messages, *msg)
+	}
+	return messages
+}
+
+// Committed 返回消费组在 topic 上已提交的 offset，即下一条待消费消息的位置
+func (b *MemoryBroker) Committed(groupID, topic string) int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.committed[groupID][topic]
+}
+
+// Paused 返回消费组当前是否暂停拉取 topic
+func (b *MemoryBroker) Paused(groupID, topic string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.paused[groupID][topic]
+}
+
+// WaitCommitted 等待消费组提交到 topic 末尾，即已写入的消息全部处理完成
+func (b *MemoryBroker) WaitCommitted(ctx context.Context, groupID, topic string) error {
+	for {
+		b.mu.Lock()
+		done := b.committed[groupID][topic] >= int64(len(b.logs[topic]))
+		changed := b.changed
+		b.mu.Unlock()
+		if done {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// ConsumerGroup 返回指定消费组，同一消费组的多次 Consume 从上次提交的位置继续
+func (b *MemoryBroker) ConsumerGroup(groupID string) ConsumerGroup {
+	return &memoryConsumerGroup{broker: b, groupID: groupID}
+}
+
+type memoryConsumerGroup struct {
+	broker  *MemoryBroker
+	groupID string
+}
+
+// Consume 为每个 topic 分配一个分区并阻塞到 ctx 取消
+func (g *memoryConsumerGroup) Consume(ctx context.Context, topics []string, handler ClaimHandler) error {
+	sessionCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	session := &memorySession{ctx: sessionCtx, group: g, marked: make(map[string]int64)}
+
+	var wg sync.WaitGroup
+	for _, topic := range topics {
+		claim := &memoryClaim{
+			broker:   g.broker,
+			groupID:  g.groupID,
+			topic:    topic,
+			offset:   g.broker.Committed(g.groupID, topic),
+			messages: make(chan *Message),
+		}
+		go claim.feed(sessionCtx)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := handler.ConsumeClaim(session, claim); err != nil {
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// Pause 暂停拉取 topic，内存 broker 每个 topic 只有分区 0
+func (g *memoryConsumerGroup) Pause(partitions map[string][]int32) {
+	g.setPaused(partitions, true)
+}
+
+// Resume 恢复拉取 topic
+func (g *memoryConsumerGroup) Resume(partitions map[string][]int32) {
+	g.setPaused(partitions, false)
+}
+
+func (g *memoryConsumerGroup) setPaused(partitions map[string][]int32, paused bool) {
+	b := g.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	topics := b.paused[g.groupID]
+	if topics == nil {
+		topics = make(map[string]bool)
+		b.paused[g.groupID] = topics
+	}
+	for topic := range partitions {
+		if paused {
+			topics[topic] = true
+		} else {
+			delete(topics, topic)
+		}
+	}
+	b.notifyLocked()
+}
+
+func (g *memoryConsumerGroup) Close() error {
+	return nil
+}
+
+type memorySession struct {
+	ctx    context.Context
+	group  *memoryConsumerGroup
+	mu     sync.Mutex
+	marked map[string]int64 // topic -> 已标记的下一条 offset
+}
+
+func (s *memorySession) Context() context.Context { return s.ctx }
+
+func (s *memorySession) MarkMessage(msg *Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if next := msg.Offset + 1; next > s.marked[msg.Topic] {
+		s.marked[msg.Topic] = next
+	}
+}
+
+func (s *memorySession) Commit() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	broker := s.group.broker
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+	offsets := broker.committed[s.group.groupID]
+	if offsets == nil {
+		offsets = make(map[string]int64)
+		broker.committed[s.group.groupID] = offsets
+	}
+	for topic, next := range s.marked {
+		if next > offsets[topic] {
+			offsets[topic] = next
+		}
+	}
+	broker.notifyLocked()
+}
+
+type memoryClaim struct {
+	broker   *MemoryBroker
+	groupID  string
+	topic    string
+	offset   int64 // 初始 offset
+	messages chan *Message
+}
+
+// feed 按顺序投递分区消息，消费到末尾或分区暂停时等待，会话结束时关闭通道
+func (c *memoryClaim) feed(ctx context.Context) {
+	defer close(c.messages)
+
+	next := c.offset
+	for {
+		c.broker.mu.Lock()
+		log := c.broker.logs[c.topic]
+		paused := c.broker.paused[c.groupID][c.topic]
+		changed := c.broker.changed
+		c.broker.mu.Unlock()
+
+		if !paused && next < int64(len(log)) {
+			msg := *log[next]
+			select {
+			case c.messages <- &msg:
+				next++
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (c *memoryClaim) Topic() string        { return c.topic }
+func (c *memoryClaim) Partition() int32     { return 0 }
+func (c *memoryClaim) InitialOffset() int64 { return c.offset }
+
+func (c *memoryClaim) HighWaterMarkOffset() int64 {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+	return int64(len(c.broker.logs[c.topic]))
+}
+
+func (c *memoryClaim) Messages() <-chan *Message { return c.messages }
@@ -0,0 +1,148 @@
+package kafka
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"game-fun-be/internal/model"
+	"game-fun-be/internal/pkg/util"
+)
+
+// outboxRelayInterval 发件箱轮询间隔
+const outboxRelayInterval = time.Second
+
+// outboxRelayBatch 每次轮询最多投递的消息数
+const outboxRelayBatch = 100
+
+// outboxClaimLease 抢占消息后的租约时间，投递进程在此期间退出时由其他实例重新投递
+const outboxClaimLease = 30 * time.Second
+
+var (
+	outboxRelayMu     sync.Mutex
+	outboxRelayCancel context.CancelFunc
+	outboxRelayDone   chan struct{}
+)
+
+// StartOutboxRelay 启动发件箱投递任务，将 kafka_outbox 中到期的消息发送到 Kafka
+func StartOutboxRelay() {
+	outboxRelayMu.Lock()
+	defer outboxRelayMu.Unlock()
+	if outboxRelayCancel != nil {
+		return
+	}
+
+	if err := model.CreateKafkaOutboxTable(); err != nil {
+		util.Log().Error("Failed to create kafka_outbox table: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	outboxRelayCancel = cancel
+	outboxRelayDone = done
+
+	go func() {
+		defer close(done)
+		runOutboxRelay(ctx)
+	}()
+}
+
+// StopOutboxRelay 停止发件箱投递任务，等待当前批次投递完成或 ctx 超时
+func StopOutboxRelay(ctx context.Context) error {
+	outboxRelayMu.Lock()
+	cancel, done := outboxRelayCancel, outboxRelayDone
+	outboxRelayCancel, outboxRelayDone = nil, nil
+	outboxRelayMu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+
+	cancel()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func runOutboxRelay(ctx context.Context) {
+	ticker := time.NewTicker(outboxRelayInterval)
+	defer ticker.Stop()
+
+	util.Log().Info("Kafka outbox relay started")
+	for {
+		select {
+		case <-ctx.Done():
+			util.Log().Info("Kafka outbox relay stopped")
+			return
+		case <-ticker.C:
+			relayDueOutbox(ctx)
+		}
+	}
+}
+
+// relayDueOutbox 投递所有到期的发件箱消息
+func relayDueOutbox(ctx context.Context) {
+	if DefaultProducer() == nil {
+		return
+	}
+
+	repo := model.NewKafkaOutboxRepo()
+	rows, err := repo.ListDue(outboxRelayBatch)
+	if err != nil {
+		util.Log().Error("Failed to list due outbox messages: %v", err)
+		return
+	}
+
+	for _, row := range rows {
+		if ctx.Err() != nil {
+			return
+		}
+
+		claimed, err := repo.Claim(row.ID, outboxClaimLease)
+		if err != nil {
+			util.Log().Error("Failed to claim outbox message %d: %v", row.ID, err)
+			continue
+		}
+		if !claimed {
+			// 已被其他实例取走、被放行时间覆盖或已取消
+			continue
+		}
+
+		msg := ProducerMessage{
+			Topic: row.Topic,
+			Key:   []byte(row.MessageKey),
+			Value: []byte(row.Payload),
+		}
+		if err := DefaultProducer().SendMessage(msg); err != nil {
+			attempts := row.Attempts + 1
+			nextAt := time.Now().Add(outboxRetryDelay(attempts))
+			util.Log().Error("Failed to relay outbox message %d to %s (attempt %d), retry at %s: %v",
+				row.ID, row.Topic, attempts, nextAt.Format(time.RFC3339), err)
+			if markErr := repo.MarkRetry(row.ID, err.Error(), nextAt); markErr != nil {
+				util.Log().Error("Failed to record outbox retry for message %d: %v", row.ID, markErr)
+			}
+			continue
+		}
+
+		if err := repo.MarkSent(row.ID); err != nil {
+			// 标记失败时租约到期后会重复投递，由下游幂等处理
+			util.Log().Error("Failed to mark outbox message %d as sent: %v", row.ID, err)
+			continue
+		}
+		util.Log().Info("Relayed outbox message %d to %s", row.ID, row.Topic)
+	}
+}
+
+// outboxRetryDelay 投递失败后的等待时间，按指数退避，最长 5 分钟
+func outboxRetryDelay(attempts int) time.Duration {
+	delay := time.Second
+	for i := 1; i < attempts && delay < 5*time.Minute; i++ {
+		delay *= 2
+	}
+	if delay > 5*time.Minute {
+		delay = 5 * time.Minute
+	}
+	return delay
+}
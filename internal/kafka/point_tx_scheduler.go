@@ -0,0 +1,247 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"game-fun-be/internal/constants"
+	"game-fun-be/internal/model"
+	"game-fun-be/internal/pkg/httpUtil"
+	"game-fun-be/internal/pkg/util"
+	"game-fun-be/internal/redis"
+	"game-fun-be/internal/service"
+)
+
+// 积分交易链上状态
+const (
+	pointTxStatusSuccess    = "success"
+	pointTxStatusFailed     = "failed"
+	pointTxStatusProcessing = "processing"
+)
+
+// pointTxSchedulerInterval 延迟队列轮询间隔
+const pointTxSchedulerInterval = time.Second
+
+// pointTxSchedulerBatch 每次轮询最多取出的到期任务数
+const pointTxSchedulerBatch = 100
+
+// pendingPointTx 延迟队列中等待再次检测的积分交易
+type pendingPointTx struct {
+	Message        model.PointTxStatusMessage `json:"message"`
+	FirstCheckedAt int64                      `json:"firstCheckedAt"` // 首次检测时间（毫秒）
+	Attempts       int                        `json:"attempts"`       // 已检测次数
+	LastStatus     string                     `json:"lastStatus"`     // 最近一次查询到的状态，查询失败时为空
+	Settle         model.PointTxStatus        `json:"settle"`         // 已确定但尚未写入成功的终态，非零时只重试结算
+}
+
+// pointTxRetryDelay 第 attempts 次检测后的等待时间，按指数退避并受最大间隔限制
+func pointTxRetryDelay(attempts int) time.Duration {
+	base := util.GetEnvAsDuration("POINT_TX_STATUS_RETRY_DELAY", 5*time.Second)
+	maxDelay := util.GetEnvAsDuration("POINT_TX_STATUS_MAX_DELAY", 60*time.Second)
+
+	delay := base
+	for i := 1; i < attempts && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay
+}
+
+// pointTxMaxWait 交易保持 processing 状态的最长等待时间，超过后退还积分
+func pointTxMaxWait() time.Duration {
+	return util.GetEnvAsDuration("POINT_TX_STATUS_MAX_WAIT", 120*time.Second)
+}
+
+// pointTxLeaseTimeout 调度器抢占任务后的租约时长，实例在租约内崩溃或停机时任务到期后被重新检测
+func pointTxLeaseTimeout() time.Duration {
+	return util.GetEnvAsDuration("POINT_TX_STATUS_LEASE_TIMEOUT", 60*time.Second)
+}
+
+// checkPointTx 查询一次交易状态，终态时结算，否则放回延迟队列
+// 返回 nil 表示交易已结算或已放回延迟队列
+func checkPointTx(pending *pendingPointTx) error {
+	msg := pending.Message
+	pending.Attempts++
+
+	if pending.Settle == model.PointTxStatusNone {
+		resp, err := httpUtil.GetSwapStatusBySignature(msg.Signature)
+		if err != nil || resp == nil || resp.Code != 2000 {
+			util.Log().Error("Failed to get swap request status for %s (attempt %d): %v", msg.Signature, pending.Attempts, err)
+			return schedulePointTxCheck(pending)
+		}
+		pending.LastStatus = resp.Data
+
+		switch resp.Data {
+		case pointTxStatusSuccess:
+			pending.Settle = model.PointTxStatusSuccess
+		case pointTxStatusFailed:
+			pending.Settle = model.PointTxStatusFailed
+		case pointTxStatusProcessing:
+			return schedulePointTxCheck(pending)
+		default:
+			// 未知状态按查询失败处理，超过最长等待时间后转人工核对
+			util.Log().Error("Unknown transaction status %s for signature %s", resp.Data, msg.Signature)
+			return schedulePointTxCheck(pending)
+		}
+	}
+	return settlePendingPointTx(pending)
+}
+
+// settlePendingPointTx 将已确定的终态写入积分记录，失败时放回延迟队列继续重试
+func settlePendingPointTx(pending *pendingPointTx) error {
+	msg := pending.Message
+	pointsService := service.NewPointsServiceImpl(model.NewUserInfoRepo(), model.NewPointRecordsRepo(), model.NewPlatformTokenStatisticRepo())
+	if err := pointsService.SettlePointTx(msg.UserId, msg.Points, msg.Signature, pending.Settle); err != nil {
+		util.Log().Error("Failed to settle transaction %s as status %d for user %d (attempt %d): %v",
+			msg.Signature, pending.Settle, msg.UserId, pending.Attempts, err)
+		return schedulePointTxCheck(pending)
+	}
+
+	switch pending.Settle {
+	case model.PointTxStatusSuccess:
+		util.Log().Info("Transaction %s completed successfully", msg.Signature)
+	case model.PointTxStatusFailed:
+		util.Log().Info("Transaction %s failed, restored %d points to user %d",
+			msg.Signature, msg.Points, msg.UserId)
+	case model.PointTxStatusExpired:
+		util.Log().Error("Transaction %s still in processing status after %v, restored %d points to user %d",
+			msg.Signature, pointTxMaxWait(), msg.Points, msg.UserId)
+	case model.PointTxStatusReview:
+		util.Log().Error("Transaction %s status unavailable after %d attempts, marked for manual review",
+			msg.Signature, pending.Attempts)
+	}
+	return nil
+}
+
+// schedulePointTxCheck 将交易放入延迟队列，超过最长等待时间时按最近状态确定终态
+// 已确定终态的交易只重试结算，不受最长等待时间限制
+func schedulePointTxCheck(pending *pendingPointTx) error {
+	msg := pending.Message
+	next := time.Now().Add(pointTxRetryDelay(pending.Attempts))
+
+	if pending.Settle == model.PointTxStatusNone {
+		deadline := time.UnixMilli(pending.FirstCheckedAt).Add(pointTxMaxWait())
+		if next.After(deadline) {
+			if pending.LastStatus == pointTxStatusProcessing {
+				pending.Settle = model.PointTxStatusExpired
+			} else {
+				// 始终未能查询到状态，无法确认交易结果，不退还积分，记录为待人工核对
+				pending.Settle = model.PointTxStatusReview
+			}
+			return settlePendingPointTx(pending)
+		}
+	}
+
+	member, err := json.Marshal(pending)
+	if err != nil {
+		return fmt.Errorf("failed to marshal pending point tx: %w", err)
+	}
+	if err := redis.ZAdd(constants.RedisKeyPointTxStatusSchedule, redis.Z{
+		Score:  float64(next.UnixMilli()),
+		Member: string(member),
+	}); err != nil {
+		return fmt.Errorf("failed to schedule point tx status check: %w", err)
+	}
+
+	util.Log().Info("Transaction %s is %s, next check at %s (attempt %d)",
+		msg.Signature, pending.LastStatus, next.Format(time.RFC3339), pending.Attempts)
+	return nil
+}
+
+// pointTxSchedulerWG 跟踪运行中的调度器，停机时等待当前检测完成
+var pointTxSchedulerWG sync.WaitGroup
+
+// startPointTxScheduler 在后台启动调度器，ctx 取消后退出
+func startPointTxScheduler(ctx context.Context) {
+	pointTxSchedulerWG.Add(1)
+	go func() {
+		defer pointTxSchedulerWG.Done()
+		RunPointTxScheduler(ctx)
+	}()
+}
+
+// waitPointTxScheduler 等待后台调度器退出，ctx 超时后不再等待
+func waitPointTxScheduler(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		pointTxSchedulerWG.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("point tx scheduler did not stop: %w", ctx.Err())
+	}
+}
+
+// RunPointTxScheduler 轮询延迟队列，对到期的交易再次检测状态，ctx 取消后退出
+// 多实例同时运行时通过租约抢占任务，租约期内同一任务只会被一个实例处理
+func RunPointTxScheduler(ctx context.Context) {
+	ticker := time.NewTicker(pointTxSchedulerInterval)
+	defer ticker.Stop()
+
+	util.Log().Info("Point tx status scheduler started")
+	for {
+		select {
+		case <-ctx.Done():
+			util.Log().Info("Point tx status scheduler stopped")
+			return
+		case <-ticker.C:
+			processDuePointTxChecks(ctx)
+		}
+	}
+}
+
+// processDuePointTxChecks 处理所有已到期的检测任务
+// 任务先被租约抢占，检测完成（已结算或已放回队列）后才从队列删除，
+// 检测失败或实例中途退出时任务在租约到期后被重新检测
+func processDuePointTxChecks(ctx context.Context) {
+	now := time.Now()
+	members, err := redis.ZRangeByScore(constants.RedisKeyPointTxStatusSchedule, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(now.UnixMilli(), 10),
+		Count: pointTxSchedulerBatch,
+	})
+	if err != nil {
+		return
+	}
+
+	for _, member := range members {
+		if ctx.Err() != nil {
+			// 停机中，剩余任务留在队列里由下次启动处理
+			return
+		}
+
+		claimed, err := redis.ZClaimDue(constants.RedisKeyPointTxStatusSchedule, member,
+			time.Now().UnixMilli(), time.Now().Add(pointTxLeaseTimeout()).UnixMilli())
+		if err != nil || !claimed {
+			// 已被其他实例取走
+			continue
+		}
+
+		var pending pendingPointTx
+		if err := json.Unmarshal([]byte(member), &pending); err != nil {
+			util.Log().Error("Dropping invalid point tx schedule entry %s: %v", member, err)
+			redis.ZRem(constants.RedisKeyPointTxStatusSchedule, member)
+			continue
+		}
+
+		if err := checkPointTx(&pending); err != nil {
+			// 未能结算也未能放回队列，保留租约，到期后重新检测
+			util.Log().Error("Point tx status check failed for %s, retry after lease expires: %v", pending.Message.Signature, err)
+			continue
+		}
+		if _, err := redis.ZRem(constants.RedisKeyPointTxStatusSchedule, member); err != nil {
+			// 删除失败时租约到期后会再检测一次，结算本身可重复执行
+			util.Log().Error("Failed to remove point tx schedule entry for %s: %v", pending.Message.Signature, err)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package kafka
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"game-fun-be/internal/metrics"
+	"game-fun-be/internal/pkg/util"
+)
+
+// QuarantineSuffix 隔离 topic 后缀，存放未通过 schema 校验的消息
+// 与死信不同，隔离消息需要修复生产方或 schema 后再处理，不支持直接重放
+const QuarantineSuffix = ".quarantine"
+
+// QuarantineMessage 隔离消息结构体，保存原始消息及拒绝原因
+type QuarantineMessage struct {
+	Topic         string    `json:"topic"`     // 原始 topic
+	Partition     int32     `json:"partition"` // 原始分区
+	Offset        int64     `json:"offset"`    // 原始 offset
+	Key           []byte    `json:"key,omitempty"`
+	Value         []byte    `json:"value"`         // 原始消息体
+	MessageType   string    `json:"messageType"`   // 消息类型
+	SchemaVersion int       `json:"schemaVersion"` // 消息声明的 schema 版本
+	Reason        string    `json:"reason"`        // 拒绝原因
+	QuarantinedAt time.Time `json:"quarantinedAt"`
+}
+
+// QuarantineRecord 隔离 topic 中的一条记录
+type QuarantineRecord struct {
+	QuarantineTopic string            `json:"quarantine_topic"`
+	Partition       int32             `json:"partition"`
+	Offset          int64             `json:"offset"`
+	Message         QuarantineMessage `json:"message"`
+}
+
+// QuarantineTopic 返回业务 topic 对应的隔离 topic
+func QuarantineTopic(topic string) string {
+	return topic + QuarantineSuffix
+}
+
+// publishQuarantine 将未通过校验的消息发送到隔离 topic
+func publishQuarantine(msg *Message, validationErr error) error {
+	if DefaultProducer() == nil {
+		return fmt.Errorf("kafka producer is not initialized")
+	}
+
+	qMsg := QuarantineMessage{
+		Topic:         msg.Topic,
+		Partition:     msg.Partition,
+		Offset:        msg.Offset,
+		Key:           msg.Key,
+		Value:         msg.Value,
+		Reason:        validationErr.Error(),
+		QuarantinedAt: time.Now(),
+	}
+	var schemaErr *SchemaError
+	if errors.As(validationErr, &schemaErr) {
+		qMsg.MessageType = schemaErr.MessageType
+		qMsg.SchemaVersion = schemaErr.Version
+		qMsg.Reason = schemaErr.Reason
+	}
+
+	payload, err := json.Marshal(qMsg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal quarantine message: %w", err)
+	}
+
+	producerMsg := ProducerMessage{
+		Topic: QuarantineTopic(msg.Topic),
+		Key:   []byte(fmt.Sprintf("%s:%d:%d", msg.Topic, msg.Partition, msg.Offset)),
+		Value: payload,
+	}
+	if err := DefaultProducer().SendMessage(producerMsg); err != nil {
+		return fmt.Errorf("failed to send quarantine message: %w", err)
+	}
+
+	metrics.AddKafkaMessages(msg.Topic, metrics.ResultQuarantined, 1)
+	util.Log().Warning("=== Message Quarantined ===\n"+
+		"Topic:     %s\n"+
+		"Partition: %d\n"+
+		"Offset:    %d\n"+
+		"Type:      %s\n"+
+		"Version:   %d\n"+
+		"Reason:    %s",
+		qMsg.Topic, qMsg.Partition, qMsg.Offset, qMsg.MessageType, qMsg.SchemaVersion, qMsg.Reason)
+	return nil
+}
+
+// publishFailedMessage 处理失败的消息：schema 校验失败进入隔离 topic，其余进入死信 topic
+func publishFailedMessage(msg *Message, handleErr error, attempts int) error {
+	if IsSchemaError(handleErr) {
+		return publishQuarantine(msg, handleErr)
+	}
+	return publishDeadLetter(msg, handleErr, attempts)
+}
+
+// ListQuarantined 从指定隔离分区的 offset 开始读取最多 limit 条隔离消息
+// offset 小于 0 时从最早的消息开始读取
+func ListQuarantined(topic string, partition int32, offset int64, limit int) ([]QuarantineRecord, error) {
+	messages, err := readPartition(QuarantineTopic(topic), partition, offset, limit)
+	records := make([]QuarantineRecord, 0, len(messages))
+	for _, msg := range messages {
+		record := QuarantineRecord{
+			QuarantineTopic: msg.Topic,
+			Partition:       msg.Partition,
+			Offset:          msg.Offset,
+		}
+		if jsonErr := json.Unmarshal(msg.Value, &record.Message); jsonErr != nil {
+			util.Log().Error("Failed to unmarshal quarantine message at %s/%d/%d: %v",
+				msg.Topic, msg.Partition, msg.Offset, jsonErr)
+			record.Message.Reason = fmt.Sprintf("invalid quarantine payload: %v", jsonErr)
+		}
+		records = append(records, record)
+	}
+	return records, err
+}
@@ -0,0 +1,235 @@
+package kafka
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"game-fun-be/internal/pkg/util"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 处理模式
+const (
+	HandlerModeImmediate = "immediate" // 逐条处理
+	HandlerModeBatch     = "batch"     // 批量处理
+)
+
+// HandlerNameUnknownToken 未知代币处理器名称
+const HandlerNameUnknownToken = "unknown_token"
+
+// TopicRegistryEntry 描述一个 topic 的消费配置
+type TopicRegistryEntry struct {
+	Prefix       string        `yaml:"prefix"`         // topic 前缀，实际 topic 为 prefix + 环境后缀
+	Topic        string        `yaml:"topic"`          // 完整 topic 名称，设置后忽略 prefix
+	Handler      string        `yaml:"handler"`        // 处理器名称，见 handlerCatalog
+	Mode         string        `yaml:"mode"`           // immediate 或 batch
+	Enabled      bool          `yaml:"enabled"`        // 是否在当前部署中消费
+	MaxBatchSize int           `yaml:"max_batch_size"` // 批量模式下的最大批量
+	MinBatchSize int           `yaml:"min_batch_size"` // 批量模式下的最小批量
+	BatchTimeout time.Duration `yaml:"batch_timeout"`  // 批量模式下的超时时间，如 100ms
+}
+
+// TopicName 返回配置项对应的完整 topic 名称
+func (e TopicRegistryEntry) TopicName() string {
+	if e.Topic != "" {
+		return e.Topic
+	}
+	return e.Prefix + envSuffix
+}
+
+// topicRegistryFile 注册表 YAML 文件结构
+type topicRegistryFile struct {
+	Topics []TopicRegistryEntry `yaml:"topics"`
+}
+
+// handlerSpec 处理器名称对应的处理函数，二者只设置其一
+type handlerSpec struct {
+	handler      MessageHandler
+	batchHandler BatchMessageHandler
+}
+
+// handlerCatalog 可在注册表中引用的处理器
+// 带签名的消息处理器先做 schema 校验再做幂等控制，未通过校验的消息不会占用幂等 key
+var handlerCatalog = map[string]handlerSpec{
+	MessageTypePumpCreate:         immediateSpec(MessageTypePumpCreate, PumpfunImmediateHandler),
+	MessageTypePumpComplete:       immediateSpec(MessageTypePumpComplete, PumpfunImmediateHandler),
+	MessageTypePumpSetParams:      immediateSpec(MessageTypePumpSetParams, PumpfunImmediateHandler),
+	MessageTypePumpTrade:          batchSpec(MessageTypePumpTrade, PumpfunBatchHandler),
+	MessageTypeRayCreate:          immediateSpec(MessageTypeRayCreate, RaydiumImmediateHandler),
+	MessageTypeRayAddLiquidity:    immediateSpec(MessageTypeRayAddLiquidity, RaydiumImmediateHandler),
+	MessageTypeRayRemoveLiquidity: immediateSpec(MessageTypeRayRemoveLiquidity, RaydiumImmediateHandler),
+	MessageTypeRaySwap:            batchSpec(MessageTypeRaySwap, RaydiumBatchHandler),
+	// 消息体为代币地址，处理器内部已通过 SETNX 加锁去重
+	HandlerNameUnknownToken:  {handler: UnknownTokenHandler},
+	MessageTypeGameOutTrade:  immediateSpec(MessageTypeGameOutTrade, GameOutTradeHandler),
+	MessageTypeGameInTrade:   immediateSpec(MessageTypeGameInTrade, GameInTradeHandler),
+	MessageTypePointTxStatus: immediateSpec(MessageTypePointTxStatus, pointTxStatusHandler),
+}
+
+func immediateSpec(messageType string, handler MessageHandler) handlerSpec {
+	return handlerSpec{handler: withSchemaValidation(messageType, WithIdempotency(messageType, handler))}
+}
+
+func batchSpec(messageType string, batchHandler BatchMessageHandler) handlerSpec {
+	return handlerSpec{batchHandler: withBatchSchemaValidation(messageType, WithBatchIdempotency(messageType, batchHandler))}
+}
+
+// defaultTopicRegistry 未配置 KAFKA_TOPIC_REGISTRY 时使用的默认注册表
+func defaultTopicRegistry() []TopicRegistryEntry {
+	batchSize, minSize, batchTimeout := loadBatchConfig()
+	batch := func(prefix, handler string, enabled bool) TopicRegistryEntry {
+		return TopicRegistryEntry{
+			Prefix:       prefix,
+			Handler:      handler,
+			Mode:         HandlerModeBatch,
+			Enabled:      enabled,
+			MaxBatchSize: batchSize,
+			MinBatchSize: minSize,
+			BatchTimeout: batchTimeout,
+		}
+	}
+	immediate := func(prefix, handler string, enabled bool) TopicRegistryEntry {
+		return TopicRegistryEntry{Prefix: prefix, Handler: handler, Mode: HandlerModeImmediate, Enabled: enabled}
+	}
+
+	return []TopicRegistryEntry{
+		// Pump topics 默认不消费，需要时通过 KAFKA_TOPIC_REGISTRY 开启
+		immediate(PumpCreatePrefix, MessageTypePumpCreate, false),
+		batch(PumpTradePrefix, MessageTypePumpTrade, false),
+		immediate(PumpCompletePrefix, MessageTypePumpComplete, false),
+		immediate(PumpSetParamsPrefix, MessageTypePumpSetParams, false),
+
+		immediate(RayNewPoolPrefix, MessageTypeRayCreate, true),
+		batch(RaySwapPrefix, MessageTypeRaySwap, true),
+		immediate(RayAddLiquidityPrefix, MessageTypeRayAddLiquidity, true),
+		immediate(RayRemoveLiquidityPrefix, MessageTypeRayRemoveLiquidity, true),
+
+		immediate(UnknownTokenPrefix, HandlerNameUnknownToken, true),
+
+		immediate(GameOutTradePrefix, MessageTypeGameOutTrade, true),
+		immediate(GameInTradePrefix, MessageTypeGameInTrade, true),
+		immediate(PointTxStatusPrefix, MessageTypePointTxStatus, true),
+	}
+}
+
+// LoadTopicRegistry 加载 topic 注册表
+// 设置 KAFKA_TOPIC_REGISTRY 时从对应的 YAML 文件加载，否则使用默认注册表
+func LoadTopicRegistry() ([]TopicRegistryEntry, error) {
+	path := os.Getenv("KAFKA_TOPIC_REGISTRY")
+	if path == "" {
+		return defaultTopicRegistry(), nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read topic registry %s: %w", path, err)
+	}
+
+	var file topicRegistryFile
+	if err := yaml.Unmarshal(content, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse topic registry %s: %w", path, err)
+	}
+
+	// 同一 topic 只能注册一个处理器，prefix 与 topic 解析出相同名称时同样视为重复
+	seen := make(map[string]int, len(file.Topics))
+	for i := range file.Topics {
+		if err := validateRegistryEntry(&file.Topics[i]); err != nil {
+			return nil, fmt.Errorf("invalid topic registry entry %d in %s: %w", i, path, err)
+		}
+		topic := file.Topics[i].TopicName()
+		if first, ok := seen[topic]; ok {
+			return nil, fmt.Errorf("invalid topic registry entry %d in %s: duplicate topic %s (also entry %d)", i, path, topic, first)
+		}
+		seen[topic] = i
+	}
+
+	util.Log().Info("Loaded Kafka topic registry from %s: %d topics", path, len(file.Topics))
+	return file.Topics, nil
+}
+
+// validateRegistryEntry 校验配置项，并为批量参数补充默认值
+func validateRegistryEntry(entry *TopicRegistryEntry) error {
+	if entry.Prefix == "" && entry.Topic == "" {
+		return fmt.Errorf("prefix or topic is required")
+	}
+
+	spec, ok := handlerCatalog[entry.Handler]
+	if !ok {
+		return fmt.Errorf("unknown handler %q", entry.Handler)
+	}
+
+	switch entry.Mode {
+	case HandlerModeImmediate:
+		if spec.handler == nil {
+			return fmt.Errorf("handler %q does not support immediate mode", entry.Handler)
+		}
+	case HandlerModeBatch:
+		if spec.batchHandler == nil {
+			return fmt.Errorf("handler %q does not support batch mode", entry.Handler)
+		}
+		batchSize, minSize, batchTimeout := loadBatchConfig()
+		if entry.MaxBatchSize <= 0 {
+			entry.MaxBatchSize = batchSize
+		}
+		if entry.MinBatchSize <= 0 {
+			entry.MinBatchSize = minSize
+		}
+		if entry.BatchTimeout <= 0 {
+			entry.BatchTimeout = batchTimeout
+		}
+	default:
+		return fmt.Errorf("unknown mode %q", entry.Mode)
+	}
+	return nil
+}
+
+// EnabledTopics 返回注册表中需要消费的 topic
+func EnabledTopics(entries []TopicRegistryEntry) []string {
+	topics := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Enabled {
+			topics = append(topics, entry.TopicName())
+		}
+	}
+	return topics
+}
+
+// RegisterHandlers 按注册表为 topic 注册处理器
+// onlyEnabled 为 false 时同时注册未启用的 topic，用于死信重放等场景
+func RegisterHandlers(topicConsumer *TopicConsumer, entries []TopicRegistryEntry, onlyEnabled bool) {
+	for _, entry := range entries {
+		if onlyEnabled && !entry.Enabled {
+			continue
+		}
+
+		spec := handlerCatalog[entry.Handler]
+		topic := entry.TopicName()
+		if entry.Mode == HandlerModeBatch {
+			topicConsumer.AddBatchHandler(topic, spec.batchHandler, entry.MaxBatchSize, entry.MinBatchSize, entry.BatchTimeout)
+		} else {
+			topicConsumer.AddHandler(topic, spec.handler)
+		}
+	}
+}
+
+// loadBatchConfig 从环境变量获取默认批处理参数
+func loadBatchConfig() (batchSize int, minSize int, batchTimeout time.Duration) {
+	batchSize, _ = strconv.Atoi(os.Getenv("KAFKA_BATCH_SIZE"))
+	if batchSize == 0 {
+		batchSize = 100 // 默认值
+	}
+
+	minSize, _ = strconv.Atoi(os.Getenv("KAFKA_MIN_SIZE"))
+	if minSize == 0 {
+		minSize = 10 // 默认值
+	}
+
+	batchTimeout, _ = time.ParseDuration(os.Getenv("KAFKA_BATCH_TIMEOUT"))
+	if batchTimeout == 0 {
+		batchTimeout = 100 * time.Millisecond // 默认值
+	}
+	return batchSize, minSize, batchTimeout
+}
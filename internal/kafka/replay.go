@@ -0,0 +1,137 @@
+package kafka
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"game-fun-be/internal/pkg/util"
+)
+
+// ReplayOptions 采集文件回放参数
+type ReplayOptions struct {
+	// Sinks 回放时写入的下游存储，可选 clickhouse、elasticsearch；nil 时全部写入，空切片时全部不写入
+	// MySQL、Redis 等处理器依赖的存储始终写入，回放前需指向测试环境
+	Sinks []string
+	// BatchSize 批量处理器每批消息数，默认 100
+	BatchSize int
+	// Consumer 提供处理器注册信息，为空时使用 topic 注册表中的处理器（包括未启用的 topic）
+	Consumer *TopicConsumer
+}
+
+// ReplayResult 回放结果
+type ReplayResult struct {
+	Messages int `json:"messages"`
+	Failed   int `json:"failed"`
+	Skipped  int `json:"skipped"` // 没有对应处理器的消息
+	// Duplicates 采集文件中重复、被幂等控制跳过的消息
+	Duplicates int      `json:"duplicates"`
+	Errors     []string `json:"errors,omitempty"`
+}
+
+// replayMaxErrors 结果中最多保留的错误信息条数
+const replayMaxErrors = 20
+
+func (r *ReplayResult) addError(count int, err error) {
+	r.Failed += count
+	if len(r.Errors) < replayMaxErrors {
+		r.Errors = append(r.Errors, err.Error())
+	}
+}
+
+// ReplayCapture 将采集文件中的消息交给已注册的处理器处理
+// 多个文件的消息按时间合并后依次处理，批量处理器的连续消息按 BatchSize 组批
+// 采集环境的 topic 后缀与当前环境不同时，按 topic 前缀匹配当前环境的处理器
+// 幂等控制使用本次回放独立的去重命名空间，同一文件可重复回放，文件内的重复消息仍只处理一次
+// 回放期间会切换下游存储开关和去重命名空间，不能与线上消费在同一进程中同时运行
+func ReplayCapture(opts ReplayOptions, paths ...string) (*ReplayResult, error) {
+	var captured []CapturedMessage
+	for _, path := range paths {
+		messages, err := ReadCaptureFile(path)
+		if err != nil {
+			return nil, err
+		}
+		captured = append(captured, messages...)
+	}
+	sort.SliceStable(captured, func(i, j int) bool {
+		return captured[i].Timestamp.Before(captured[j].Timestamp)
+	})
+
+	tc := opts.Consumer
+	if tc == nil {
+		tc = newHandlerRegistry()
+	}
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+
+	if opts.Sinks != nil {
+		restore := setEnabledSinks(opts.Sinks)
+		defer restore()
+	}
+
+	scope, restoreScope := beginIdempotencyScope(fmt.Sprintf("replay:%d", time.Now().UnixNano()))
+	defer restoreScope()
+
+	result := &ReplayResult{Messages: len(captured)}
+	var pending []Message
+	pendingTopic := ""
+	flush := func() {
+		if len(pending) == 0 {
+			return
+		}
+		if err := tc.batchHandlers[pendingTopic](pendingTopic, pending, pending[0].Partition, util.GetGoroutineID()); err != nil {
+			result.addError(len(remainingMessages(pending, err)), fmt.Errorf("%s offsets %d-%d: %w",
+				pendingTopic, pending[0].Offset, pending[len(pending)-1].Offset, err))
+		}
+		pending = nil
+	}
+
+	for _, c := range captured {
+		msg := c.toMessage()
+		msg.Topic = tc.replayTopic(c.Topic)
+
+		if tc.batchHandlers[msg.Topic] != nil {
+			if msg.Topic != pendingTopic || len(pending) >= batchSize {
+				flush()
+				pendingTopic = msg.Topic
+			}
+			pending = append(pending, msg)
+			continue
+		}
+
+		flush()
+		handler := tc.handlers[msg.Topic]
+		if handler == nil {
+			result.Skipped++
+			continue
+		}
+		if err := handler(msg.Value, msg.Topic); err != nil {
+			result.addError(1, fmt.Errorf("%s offset %d: %w", c.Topic, c.Offset, err))
+		}
+	}
+	flush()
+	result.Duplicates = int(scope.duplicates.Load())
+
+	util.Log().Info("Replayed capture: files=%d messages=%d failed=%d skipped=%d duplicates=%d",
+		len(paths), result.Messages, result.Failed, result.Skipped, result.Duplicates)
+	return result, nil
+}
+
+// replayTopic 将采集到的 topic 映射为当前注册的 topic，注册表前缀以 "." 结尾，后缀为环境名
+func (tc *TopicConsumer) replayTopic(topic string) string {
+	if tc.handlers[topic] != nil || tc.batchHandlers[topic] != nil {
+		return topic
+	}
+	idx := strings.LastIndex(topic, ".")
+	if idx < 0 {
+		return topic
+	}
+	local := topic[:idx+1] + envSuffix
+	if tc.handlers[local] != nil || tc.batchHandlers[local] != nil {
+		return local
+	}
+	return topic
+}
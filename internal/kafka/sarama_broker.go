@@ -0,0 +1,130 @@
+package kafka
+
+import (
+	"context"
+
+	"github.com/IBM/sarama"
+)
+
+// saramaProducer 基于 sarama.SyncProducer 的 Producer 实现
+type saramaProducer struct {
+	producer sarama.SyncProducer
+}
+
+// NewSaramaProducer 包装 sarama 同步生产者
+func NewSaramaProducer(producer sarama.SyncProducer) Producer {
+	return &saramaProducer{producer: producer}
+}
+
+func (p *saramaProducer) SendMessage(msg ProducerMessage) error {
+	_, _, err := p.producer.SendMessage(toSaramaProducerMessage(msg))
+	return err
+}
+
+func (p *saramaProducer) SendMessages(msgs []ProducerMessage) error {
+	saramaMsgs := make([]*sarama.ProducerMessage, 0, len(msgs))
+	for _, msg := range msgs {
+		saramaMsgs = append(saramaMsgs, toSaramaProducerMessage(msg))
+	}
+	return p.producer.SendMessages(saramaMsgs)
+}
+
+func (p *saramaProducer) Close() error {
+	return p.producer.Close()
+}
+
+func toSaramaProducerMessage(msg ProducerMessage) *sarama.ProducerMessage {
+	saramaMsg := &sarama.ProducerMessage{
+		Topic: msg.Topic,
+		Value: sarama.ByteEncoder(msg.Value),
+	}
+	if len(msg.Key) > 0 {
+		saramaMsg.Key = sarama.ByteEncoder(msg.Key)
+	}
+	return saramaMsg
+}
+
+// fromSaramaMessage 将 sarama 消息转换为 Message
+func fromSaramaMessage(msg *sarama.ConsumerMessage) Message {
+	return Message{
+		Topic:     msg.Topic,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+		Key:       msg.Key,
+		Value:     msg.Value,
+		Timestamp: msg.Timestamp,
+	}
+}
+
+// saramaConsumerGroup 基于 sarama.ConsumerGroup 的 ConsumerGroup 实现
+type saramaConsumerGroup struct {
+	group sarama.ConsumerGroup
+}
+
+// NewSaramaConsumerGroup 包装 sarama 消费组
+func NewSaramaConsumerGroup(group sarama.ConsumerGroup) ConsumerGroup {
+	return &saramaConsumerGroup{group: group}
+}
+
+func (g *saramaConsumerGroup) Consume(ctx context.Context, topics []string, handler ClaimHandler) error {
+	return g.group.Consume(ctx, topics, &saramaGroupHandler{handler: handler})
+}
+
+func (g *saramaConsumerGroup) Pause(partitions map[string][]int32) {
+	g.group.Pause(partitions)
+}
+
+func (g *saramaConsumerGroup) Resume(partitions map[string][]int32) {
+	g.group.Resume(partitions)
+}
+
+func (g *saramaConsumerGroup) Close() error {
+	return g.group.Close()
+}
+
+// saramaGroupHandler 将 sarama 的会话和分区适配为 ConsumerSession、ConsumerClaim
+type saramaGroupHandler struct {
+	handler ClaimHandler
+}
+
+func (h *saramaGroupHandler) Setup(sarama.ConsumerGroupSession) error   { return nil }
+func (h *saramaGroupHandler) Cleanup(sarama.ConsumerGroupSession) error { return nil }
+
+func (h *saramaGroupHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	messages := make(chan *Message)
+	go func() {
+		defer close(messages)
+		for msg := range claim.Messages() {
+			converted := fromSaramaMessage(msg)
+			select {
+			case messages <- &converted:
+			case <-session.Context().Done():
+				return
+			}
+		}
+	}()
+	return h.handler.ConsumeClaim(&saramaSession{session: session}, &saramaClaim{claim: claim, messages: messages})
+}
+
+type saramaSession struct {
+	session sarama.ConsumerGroupSession
+}
+
+func (s *saramaSession) Context() context.Context { return s.session.Context() }
+
+func (s *saramaSession) MarkMessage(msg *Message) {
+	s.session.MarkOffset(msg.Topic, msg.Partition, msg.Offset+1, "")
+}
+
+func (s *saramaSession) Commit() { s.session.Commit() }
+
+type saramaClaim struct {
+	claim    sarama.ConsumerGroupClaim
+	messages chan *Message
+}
+
+func (c *saramaClaim) Topic() string              { return c.claim.Topic() }
+func (c *saramaClaim) Partition() int32           { return c.claim.Partition() }
+func (c *saramaClaim) InitialOffset() int64       { return c.claim.InitialOffset() }
+func (c *saramaClaim) HighWaterMarkOffset() int64 { return c.claim.HighWaterMarkOffset() }
+func (c *saramaClaim) Messages() <-chan *Message  { return c.messages }
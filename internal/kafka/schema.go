@@ -0,0 +1,218 @@
+package kafka
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// SchemaVersionField 消息体中声明 schema 版本的字段，缺省为版本 1
+const SchemaVersionField = "schemaVersion"
+
+// fieldKind 字段校验类型
+type fieldKind int
+
+const (
+	kindString     fieldKind = iota // 非空字符串
+	kindUintString                  // 十进制无符号整数字符串，如链上数量
+	kindInt                         // JSON 整数
+	kindBool                        // JSON 布尔值
+)
+
+// fieldRule 单个必填字段的校验规则
+type fieldRule struct {
+	name string
+	kind fieldKind
+}
+
+// messageSchemas 各消息类型按版本划分的必填字段
+// 新增版本时追加对应版本号的规则，旧版本保留以兼容仍在投递的历史消息
+var messageSchemas = map[string]map[int][]fieldRule{
+	MessageTypePumpCreate: {
+		1: {
+			{"mint", kindString}, {"bondingCurve", kindString},
+			{"signature", kindString}, {"timestamp", kindInt},
+		},
+	},
+	MessageTypePumpComplete: {
+		1: {
+			{"mint", kindString}, {"signature", kindString}, {"timestamp", kindInt},
+		},
+	},
+	MessageTypePumpSetParams: {
+		1: {
+			{"signature", kindString}, {"timestamp", kindInt},
+			{"initialVirtualTokenReserves", kindUintString}, {"initialVirtualSolReserves", kindUintString},
+			{"initialRealTokenReserves", kindUintString}, {"tokenTotalSupply", kindUintString},
+			{"feeBasisPoints", kindUintString},
+		},
+	},
+	MessageTypePumpTrade: {
+		1: {
+			{"mint", kindString}, {"user", kindString}, {"signature", kindString}, {"timestamp", kindInt},
+			{"isBuy", kindBool}, {"solAmount", kindUintString}, {"tokenAmount", kindUintString},
+			{"virtualSolReserves", kindUintString}, {"virtualTokenReserves", kindUintString},
+			{"realSolReserves", kindUintString}, {"realTokenReserves", kindUintString},
+		},
+	},
+	MessageTypeRayCreate:          {1: raydiumPoolRules},
+	MessageTypeRayAddLiquidity:    {1: raydiumPoolRules},
+	MessageTypeRayRemoveLiquidity: {1: raydiumPoolRules},
+	MessageTypeRaySwap: {
+		1: {
+			{"signature", kindString}, {"timestamp", kindInt}, {"user", kindString},
+			{"poolAddress", kindString}, {"quoteToken", kindString}, {"baseToken", kindString},
+			{"isBuy", kindBool}, {"decimals", kindInt},
+			{"quoteAmount", kindUintString}, {"baseAmount", kindUintString},
+			{"poolQuoteReserve", kindUintString}, {"poolBaseReserve", kindUintString},
+		},
+	},
+	MessageTypeGameOutTrade: {
+		1: {
+			{"signature", kindString}, {"timestamp", kindInt}, {"user", kindString},
+			{"poolAddress", kindString}, {"quoteToken", kindString}, {"isBuy", kindBool},
+			{"decimals", kindInt},
+			{"quoteAmount", kindUintString}, {"baseAmount", kindUintString},
+			{"poolQuoteReserve", kindUintString}, {"poolBaseReserve", kindUintString},
+			{"feeQuoteAmount", kindUintString}, {"feeBaseAmount", kindUintString},
+			{"buybackFeeBaseAmount", kindUintString},
+		},
+	},
+	MessageTypeGameInTrade: {
+		1: {
+			{"signature", kindString}, {"timestamp", kindInt}, {"user", kindString},
+			{"quoteToken", kindString}, {"decimals", kindInt},
+			{"quoteAmount", kindUintString}, {"baseAmount", kindUintString},
+			{"pointsAmount", kindUintString}, {"feeBaseAmount", kindUintString},
+		},
+	},
+	MessageTypePointTxStatus: {
+		1: {
+			{"signature", kindString}, {"userId", kindInt}, {"points", kindInt}, {"txType", kindInt},
+		},
+	},
+}
+
+// raydiumPoolRules Raydium 建池、加减流动性消息共用的字段
+var raydiumPoolRules = []fieldRule{
+	{"signature", kindString}, {"timestamp", kindInt}, {"poolAddress", kindString},
+	{"quoteToken", kindString}, {"baseToken", kindString}, {"decimals", kindInt},
+	{"poolQuoteReserve", kindUintString}, {"poolBaseReserve", kindUintString},
+}
+
+// SchemaError 消息未通过 schema 校验，此类消息重试也不会成功，应进入隔离 topic
+type SchemaError struct {
+	MessageType string
+	Version     int
+	Reason      string
+}
+
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("invalid %s message (schema v%d): %s", e.MessageType, e.Version, e.Reason)
+}
+
+// IsSchemaError 判断错误是否由 schema 校验失败引起
+func IsSchemaError(err error) bool {
+	var schemaErr *SchemaError
+	return errors.As(err, &schemaErr)
+}
+
+// ValidateMessage 按消息声明的版本校验必填字段及数值字符串，未通过时返回 *SchemaError
+// 未定义 schema 的消息类型不做校验
+func ValidateMessage(messageType string, payload []byte) error {
+	versions, ok := messageSchemas[messageType]
+	if !ok {
+		return nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return &SchemaError{MessageType: messageType, Reason: fmt.Sprintf("payload is not a JSON object: %v", err)}
+	}
+
+	version := 1
+	if raw, ok := fields[SchemaVersionField]; ok {
+		if err := json.Unmarshal(raw, &version); err != nil {
+			return &SchemaError{MessageType: messageType, Reason: fmt.Sprintf("invalid %s: %s", SchemaVersionField, raw)}
+		}
+	}
+
+	rules, ok := versions[version]
+	if !ok {
+		return &SchemaError{MessageType: messageType, Version: version, Reason: "unsupported schema version"}
+	}
+
+	for _, rule := range rules {
+		raw, ok := fields[rule.name]
+		if !ok || bytes.Equal(raw, []byte("null")) {
+			return &SchemaError{MessageType: messageType, Version: version, Reason: fmt.Sprintf("missing required field %q", rule.name)}
+		}
+		if reason := checkField(rule, raw); reason != "" {
+			return &SchemaError{MessageType: messageType, Version: version, Reason: reason}
+		}
+	}
+	return nil
+}
+
+// checkField 校验单个字段，返回空字符串表示通过
+func checkField(rule fieldRule, raw json.RawMessage) string {
+	switch rule.kind {
+	case kindString:
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil || s == "" {
+			return fmt.Sprintf("field %q must be a non-empty string, got %s", rule.name, raw)
+		}
+	case kindUintString:
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return fmt.Sprintf("field %q must be a numeric string, got %s", rule.name, raw)
+		}
+		if _, err := strconv.ParseUint(s, 10, 64); err != nil {
+			return fmt.Sprintf("field %q is not a valid unsigned integer: %q", rule.name, s)
+		}
+	case kindInt:
+		var n int64
+		if err := json.Unmarshal(raw, &n); err != nil {
+			return fmt.Sprintf("field %q must be an integer, got %s", rule.name, raw)
+		}
+	case kindBool:
+		var b bool
+		if err := json.Unmarshal(raw, &b); err != nil {
+			return fmt.Sprintf("field %q must be a boolean, got %s", rule.name, raw)
+		}
+	}
+	return ""
+}
+
+// withSchemaValidation 在处理前校验消息，校验失败返回 SchemaError，由消费者转入隔离 topic
+func withSchemaValidation(messageType string, handler MessageHandler) MessageHandler {
+	return func(message []byte, topic string) error {
+		if err := ValidateMessage(messageType, message); err != nil {
+			return err
+		}
+		return handler(message, topic)
+	}
+}
+
+// withBatchSchemaValidation 过滤批次中未通过校验的消息并直接转入隔离 topic，其余消息继续处理
+// 隔离失败时返回错误，由批处理重试逻辑兜底
+func withBatchSchemaValidation(messageType string, batchHandler BatchMessageHandler) BatchMessageHandler {
+	return func(topic string, messages []Message, partition int32, goroutineID uint64) error {
+		valid := make([]Message, 0, len(messages))
+		for i := range messages {
+			if err := ValidateMessage(messageType, messages[i].Value); err != nil {
+				if qErr := publishQuarantine(&messages[i], err); qErr != nil {
+					return fmt.Errorf("failed to quarantine invalid message: %w", qErr)
+				}
+				continue
+			}
+			valid = append(valid, messages[i])
+		}
+		if len(valid) == 0 {
+			return nil
+		}
+		return batchHandler(topic, valid, partition, goroutineID)
+	}
+}
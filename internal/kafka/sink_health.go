@@ -0,0 +1,185 @@
+package kafka
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"game-fun-be/internal/metrics"
+	"game-fun-be/internal/pkg/util"
+)
+
+// 下游存储名称
+const (
+	SinkClickHouse    = "clickhouse"
+	SinkElasticsearch = "elasticsearch"
+	SinkMySQL         = "mysql" // 仅用于回填：按日分表的交易记录及交易索引
+)
+
+// ErrSinkUnavailable 下游存储写入失败，消费者暂停对应分区并退避重试，不写入死信
+var ErrSinkUnavailable = errors.New("sink unavailable")
+
+// sinkError 标记某个下游存储的写入错误
+type sinkError struct {
+	sink string
+	err  error
+}
+
+func (e *sinkError) Error() string {
+	return fmt.Sprintf("%s write failed: %v", e.sink, e.err)
+}
+
+func (e *sinkError) Unwrap() error { return e.err }
+
+func (e *sinkError) Is(target error) bool { return target == ErrSinkUnavailable }
+
+// SinkStatus 下游存储的健康状态
+type SinkStatus struct {
+	Sink             string    `json:"sink"`
+	Healthy          bool      `json:"healthy"`
+	ConsecutiveFails int       `json:"consecutive_fails"`
+	LastError        string    `json:"last_error,omitempty"`
+	LastFailure      time.Time `json:"last_failure,omitempty"`
+	LastSuccess      time.Time `json:"last_success,omitempty"`
+}
+
+var (
+	sinkMu     sync.Mutex
+	sinkStates = make(map[string]*SinkStatus)
+	// enabledSinks 回放时只写入的下游存储，为 nil 时全部写入
+	enabledSinks map[string]bool
+)
+
+// sinkEnabled 判断是否写入指定下游存储
+func sinkEnabled(sink string) bool {
+	sinkMu.Lock()
+	defer sinkMu.Unlock()
+	return enabledSinks == nil || enabledSinks[sink]
+}
+
+// setEnabledSinks 只写入指定的下游存储，返回恢复函数
+func setEnabledSinks(sinks []string) func() {
+	enabled := make(map[string]bool, len(sinks))
+	for _, sink := range sinks {
+		enabled[sink] = true
+	}
+
+	sinkMu.Lock()
+	previous := enabledSinks
+	enabledSinks = enabled
+	sinkMu.Unlock()
+
+	return func() {
+		sinkMu.Lock()
+		enabledSinks = previous
+		sinkMu.Unlock()
+	}
+}
+
+// reportSinkResult 记录一次下游写入结果，失败时返回包装后的 sinkError
+func reportSinkResult(sink string, err error) error {
+	sinkMu.Lock()
+	state := sinkStates[sink]
+	if state == nil {
+		state = &SinkStatus{Sink: sink, Healthy: true}
+		sinkStates[sink] = state
+	}
+
+	if err == nil {
+		recovered := !state.Healthy
+		state.Healthy = true
+		state.ConsecutiveFails = 0
+		state.LastSuccess = time.Now()
+		sinkMu.Unlock()
+
+		metrics.SetSinkHealthy(sink, true)
+		if recovered {
+			util.Log().Info("Sink %s recovered", sink)
+		}
+		return nil
+	}
+
+	wasHealthy := state.Healthy
+	state.Healthy = false
+	state.ConsecutiveFails++
+	state.LastError = err.Error()
+	state.LastFailure = time.Now()
+	sinkMu.Unlock()
+
+	metrics.SetSinkHealthy(sink, false)
+	if wasHealthy {
+		util.Log().Error("Sink %s became unhealthy: %v", sink, err)
+	}
+	return &sinkError{sink: sink, err: err}
+}
+
+// GetSinkStatuses 返回所有下游存储的健康状态
+func GetSinkStatuses() []SinkStatus {
+	sinkMu.Lock()
+	defer sinkMu.Unlock()
+
+	statuses := make([]SinkStatus, 0, len(sinkStates))
+	for _, state := range sinkStates {
+		statuses = append(statuses, *state)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Sink < statuses[j].Sink })
+	return statuses
+}
+
+// sinkRetryDelay 下游不可用时的重试间隔，按指数退避，上限 KAFKA_SINK_MAX_BACKOFF 秒
+func sinkRetryDelay(attempt int) time.Duration {
+	maxDelay := util.GetEnvAsDuration("KAFKA_SINK_MAX_BACKOFF", 60*time.Second)
+	delay := time.Second
+	for i := 1; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay
+}
+
+// retryWhileSinkUnavailable 执行 process，下游存储不可用时暂停分区并退避重试，直到写入成功或会话结束
+// 返回非 ErrSinkUnavailable 的错误交由调用方按原有逻辑处理；会话结束时返回最后一次错误，offset 不会提交
+func (tc *TopicConsumer) retryWhileSinkUnavailable(session ConsumerSession, topic string, partition int32, process func() error) error {
+	err := process()
+	if !errors.Is(err, ErrSinkUnavailable) {
+		return err
+	}
+
+	tc.pausePartition(topic, partition)
+	defer tc.resumePartition(topic, partition)
+
+	for attempt := 1; errors.Is(err, ErrSinkUnavailable); attempt++ {
+		delay := sinkRetryDelay(attempt)
+		util.Log().Warning("Sink unavailable, partition paused: topic=%s partition=%d attempt=%d retry_in=%v err=%v",
+			topic, partition, attempt, delay, err)
+
+		select {
+		case <-time.After(delay):
+		case <-session.Context().Done():
+			return err
+		}
+		err = process()
+	}
+	return err
+}
+
+// pausePartition 暂停拉取分区消息，批次重试期间不再堆积新消息
+func (tc *TopicConsumer) pausePartition(topic string, partition int32) {
+	if tc.consumerGroup != nil {
+		tc.consumerGroup.Pause(map[string][]int32{topic: {partition}})
+	}
+	metrics.SetKafkaPartitionPaused(topic, partition, true)
+}
+
+// resumePartition 恢复拉取分区消息
+func (tc *TopicConsumer) resumePartition(topic string, partition int32) {
+	if tc.consumerGroup != nil {
+		tc.consumerGroup.Resume(map[string][]int32{topic: {partition}})
+	}
+	metrics.SetKafkaPartitionPaused(topic, partition, false)
+	util.Log().Info("Partition resumed: topic=%s partition=%d", topic, partition)
+}
@@ -0,0 +1,181 @@
+package kafka
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"game-fun-be/internal/clickhouse"
+	"game-fun-be/internal/conf"
+	"game-fun-be/internal/es"
+	"game-fun-be/internal/model"
+	"game-fun-be/internal/pkg/util"
+	"game-fun-be/internal/service"
+)
+
+// TradeStore 交易消息处理依赖的存储，默认写入 MySQL、Elasticsearch 和 ClickHouse
+// 测试中可通过 SetTradeStore 替换为桩实现，在不依赖外部服务的情况下运行真实的处理器
+type TradeStore interface {
+	// CreateTransactions 写入指定日期分表的交易记录
+	CreateTransactions(transactions []*model.TokenTransaction, date string) error
+	// CreateTransactionIndices 写入交易索引
+	CreateTransactionIndices(transactions []*model.TokenTransaction) error
+	// UpdateTokens 按最新交易更新代币信息，返回更新后的代币
+	UpdateTokens(transactions []*model.TokenTransaction) (map[string]*model.TokenInfo, error)
+	// UpdatePools 按最新交易更新池子信息，返回更新后的池子
+	UpdatePools(transactions []*model.TokenTransaction) (map[string]*model.TokenLiquidityPool, error)
+	// IndexTransactions 写入 Elasticsearch
+	IndexTransactions(transactions []*model.TokenTransaction, tokenInfoMap map[string]*model.TokenInfo, poolInfoMap map[string]*model.TokenLiquidityPool) error
+	// InsertTransactions 写入 ClickHouse，source 用于写入去重
+	InsertTransactions(transactions []*model.TokenTransaction, source string) error
+}
+
+// tradeStore 当前使用的存储
+var tradeStore TradeStore = serviceTradeStore{}
+
+// SetTradeStore 替换交易消息处理使用的存储，返回恢复函数
+func SetTradeStore(store TradeStore) func() {
+	previous := tradeStore
+	tradeStore = store
+	return func() {
+		tradeStore = previous
+	}
+}
+
+// serviceTradeStore 通过 service 层写入各存储
+type serviceTradeStore struct{}
+
+func (serviceTradeStore) CreateTransactions(transactions []*model.TokenTransaction, date string) error {
+	tokenTxService := &service.TokenTransactionService{}
+	resp := tokenTxService.ProcessBatchTokenTransactionCreation(transactions, date)
+	if resp.Code != 0 {
+		return fmt.Errorf("%v", resp.Error)
+	}
+	return nil
+}
+
+func (serviceTradeStore) CreateTransactionIndices(transactions []*model.TokenTransaction) error {
+	tokenTxIndexService := &service.TokenTxIndexService{}
+	resp := tokenTxIndexService.BatchCreateIndexFromTransactions(transactions)
+	if resp.Code != 0 {
+		return fmt.Errorf("%v", resp.Error)
+	}
+	return nil
+}
+
+func (serviceTradeStore) UpdateTokens(transactions []*model.TokenTransaction) (map[string]*model.TokenInfo, error) {
+	return updateTokensInfo(transactions)
+}
+
+func (serviceTradeStore) UpdatePools(transactions []*model.TokenTransaction) (map[string]*model.TokenLiquidityPool, error) {
+	return updatePoolsInfo(transactions)
+}
+
+// IndexTransactions 批量索引交易文档，限流或服务端错误视为 ES 不可用，其余失败（如映射错误）仅记录
+func (serviceTradeStore) IndexTransactions(transactions []*model.TokenTransaction, tokenInfoMap map[string]*model.TokenInfo, poolInfoMap map[string]*model.TokenLiquidityPool) error {
+	totalStart := time.Now()
+	tokenTxService := &service.TokenTransactionService{}
+
+	// 1. 获取 ES 文档列表
+	prepareStart := time.Now()
+	esDocList := tokenTxService.GetESDocList(transactions, tokenInfoMap, poolInfoMap)
+	prepareTime := time.Since(prepareStart)
+	util.Log().Info("ES文档准备耗时: %v, 文档数量: %d", prepareTime, len(esDocList))
+
+	// 2. 批量索引文档
+	indexStart := time.Now()
+	resp, err := es.BulkIndexDocuments(conf.ES_INDEX_TOKEN_TRANSACTIONS_ALIAS, esDocList)
+	if err != nil {
+		util.Log().Error("Failed to bulk index documents in Elasticsearch: %v", err)
+		return fmt.Errorf("failed to index to ES: %w", err)
+	}
+	indexTime := time.Since(indexStart)
+
+	// 3. 记录批量索引结果
+	unavailable := 0
+	if resp != nil {
+		util.Log().Info("ES批量索引结果 - 成功: %d, 耗时: %v",
+			len(resp.Items),
+			indexTime)
+
+		// 如果有失败的文档，记录详细信息
+		if len(resp.Failed()) > 0 {
+			for _, item := range resp.Failed() {
+				util.Log().Error("ES索引失败 - Index: %s, Type: %s, ID: %s, Error: %v",
+					item.Index,
+					item.Type,
+					item.Id,
+					item.Error)
+				if item.Status == http.StatusTooManyRequests || item.Status >= http.StatusInternalServerError {
+					unavailable++
+				}
+			}
+		}
+	}
+	if unavailable > 0 {
+		return fmt.Errorf("%d documents rejected by ES", unavailable)
+	}
+
+	totalTime := time.Since(totalStart)
+	util.Log().Info("ES处理总耗时: %v (准备: %v, 索引: %v), 总文档数: %d",
+		totalTime,
+		prepareTime,
+		indexTime,
+		len(esDocList))
+
+	return nil
+}
+
+func (serviceTradeStore) InsertTransactions(transactions []*model.TokenTransaction, source string) error {
+	transactionCkService := &service.TransactionCkServiceImpl{}
+
+	// 转换并处理交易数据
+	transactionCks := transactionCkService.ConvertToTransactionCks(transactions)
+	err := transactionCkService.BatchProcessTransactions(source, transactionCks)
+	if err != nil {
+		util.Log().Error("Failed to process transactions in ClickHouse: %v", err)
+	}
+	return err
+}
+
+// GameTradeStore 代理合约交易消息处理依赖的存储，默认写入 ClickHouse 和 MySQL
+// 测试中可通过 SetGameTradeStore 替换为桩实现
+type GameTradeStore interface {
+	// InsertProxyTransaction 写入代理交易到 ClickHouse
+	InsertProxyTransaction(proxyTx *clickhouse.ProxyTransaction) error
+	// IncrementStatistics 累加平台代币统计
+	IncrementStatistics(tokenAddress string, amounts map[model.StatisticType]uint64) error
+	// CreatePointRecord 写入积分记录，同时更新用户积分和平台代币统计
+	CreatePointRecord(walletAddress string, point uint64, hash string, transactionDetail string, recordType model.RecordType, tokenAmount uint64, nativeTokenAmount uint64, isAddPoints bool, tokenAddress string, amounts map[model.StatisticType]uint64) error
+}
+
+// gameTradeStore 当前使用的代理交易存储
+var gameTradeStore GameTradeStore = serviceGameTradeStore{}
+
+// SetGameTradeStore 替换代理交易消息处理使用的存储，返回恢复函数
+func SetGameTradeStore(store GameTradeStore) func() {
+	previous := gameTradeStore
+	gameTradeStore = store
+	return func() {
+		gameTradeStore = previous
+	}
+}
+
+// serviceGameTradeStore 通过 clickhouse 包和积分服务写入各存储
+type serviceGameTradeStore struct{}
+
+func (serviceGameTradeStore) InsertProxyTransaction(proxyTx *clickhouse.ProxyTransaction) error {
+	return clickhouse.InsertProxyTransaction(proxyTx)
+}
+
+func (serviceGameTradeStore) IncrementStatistics(tokenAddress string, amounts map[model.StatisticType]uint64) error {
+	return newPointsService().IncrementStatisticsAndUpdateTime(tokenAddress, amounts)
+}
+
+func (serviceGameTradeStore) CreatePointRecord(walletAddress string, point uint64, hash string, transactionDetail string, recordType model.RecordType, tokenAmount uint64, nativeTokenAmount uint64, isAddPoints bool, tokenAddress string, amounts map[model.StatisticType]uint64) error {
+	return newPointsService().CreatePointRecord(walletAddress, point, hash, transactionDetail, recordType, tokenAmount, nativeTokenAmount, isAddPoints, tokenAddress, amounts)
+}
+
+func newPointsService() *service.PointsServiceImpl {
+	return service.NewPointsServiceImpl(model.NewUserInfoRepo(), model.NewPointRecordsRepo(), model.NewPlatformTokenStatisticRepo())
+}
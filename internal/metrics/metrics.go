@@ -0,0 +1,270 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "game_fun"
+
+// 结果标签取值
+const (
+	ResultSuccess     = "success"
+	ResultError       = "error"
+	ResultDeadLetter  = "dead_letter"
+	ResultQuarantined = "quarantined"
+)
+
+var (
+	// HTTP
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency by gin route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// Kafka
+	kafkaConsumerLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "kafka",
+		Name:      "consumer_lag",
+		Help:      "Messages between the partition high water mark and the last consumed offset.",
+	}, []string{"topic", "partition"})
+
+	kafkaBatchSize = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "kafka",
+		Name:      "batch_size",
+		Help:      "Number of messages handed to a batch handler.",
+		Buckets:   []float64{1, 5, 10, 25, 50, 100, 200, 500, 1000},
+	}, []string{"topic", "partition"})
+
+	kafkaBatchDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "kafka",
+		Name:      "batch_duration_seconds",
+		Help:      "Time spent processing a batch including retries.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 12),
+	}, []string{"topic"})
+
+	kafkaMessagesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "kafka",
+		Name:      "messages_total",
+		Help:      "Consumed messages by topic and handling result.",
+	}, []string{"topic", "result"})
+
+	kafkaPartitionPaused = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "kafka",
+		Name:      "partition_paused",
+		Help:      "1 while a partition is paused because a downstream sink is failing.",
+	}, []string{"topic", "partition"})
+
+	sinkHealthy = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "kafka",
+		Name:      "sink_healthy",
+		Help:      "1 when the last write to the downstream sink succeeded.",
+	}, []string{"sink"})
+
+	// ClickHouse
+	clickhouseQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "clickhouse",
+		Name:      "query_duration_seconds",
+		Help:      "ClickHouse query latency by operation.",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 2, 12),
+	}, []string{"operation"})
+
+	clickhouseErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "clickhouse",
+		Name:      "errors_total",
+		Help:      "ClickHouse query errors by operation.",
+	}, []string{"operation"})
+
+	clickhouseWriterBufferedRows = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "clickhouse",
+		Name:      "writer_buffered_rows",
+		Help:      "Rows waiting in the buffered writer by table.",
+	}, []string{"table"})
+
+	clickhouseWriterSpilledBatches = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "clickhouse",
+		Name:      "writer_spilled_batches",
+		Help:      "Batches spilled to disk and not yet replayed by table.",
+	}, []string{"table"})
+
+	clickhouseWriterFlushes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "clickhouse",
+		Name:      "writer_flushes_total",
+		Help:      "Buffered writer flushes by table and result (ok, spilled, replayed, error).",
+	}, []string{"table", "result"})
+
+	// Elasticsearch
+	esRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "es",
+		Name:      "request_duration_seconds",
+		Help:      "Elasticsearch request latency by endpoint.",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 2, 12),
+	}, []string{"operation"})
+
+	esErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "es",
+		Name:      "errors_total",
+		Help:      "Elasticsearch transport errors and 5xx responses by endpoint.",
+	}, []string{"operation"})
+
+	// Redis
+	redisCommandDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "redis",
+		Name:      "command_duration_seconds",
+		Help:      "Redis command latency by command name.",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 12),
+	}, []string{"command"})
+
+	redisErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "redis",
+		Name:      "errors_total",
+		Help:      "Redis command errors by command name, excluding cache misses.",
+	}, []string{"command"})
+
+	// Cron
+	cronJobRuns = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "cron",
+		Name:      "job_runs_total",
+		Help:      "Cron job runs by job name and outcome.",
+	}, []string{"job", "result"})
+
+	cronJobDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "cron",
+		Name:      "job_duration_seconds",
+		Help:      "Cron job run time.",
+		Buckets:   prometheus.ExponentialBuckets(0.1, 2, 14),
+	}, []string{"job"})
+)
+
+// Handler 返回 /metrics 的处理器
+func Handler() gin.HandlerFunc {
+	h := promhttp.Handler()
+	return func(c *gin.Context) {
+		h.ServeHTTP(c.Writer, c.Request)
+	}
+}
+
+// GinMiddleware 按路由模板记录 HTTP 请求耗时，未匹配路由统一记为 unmatched 避免标签膨胀
+func GinMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		httpRequestDuration.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).
+			Observe(time.Since(start).Seconds())
+	}
+}
+
+// SetKafkaConsumerLag 更新分区消费延迟
+func SetKafkaConsumerLag(topic string, partition int32, lag int64) {
+	if lag < 0 {
+		lag = 0
+	}
+	kafkaConsumerLag.WithLabelValues(topic, strconv.Itoa(int(partition))).Set(float64(lag))
+}
+
+// ObserveKafkaBatch 记录批次大小及处理耗时
+func ObserveKafkaBatch(topic string, partition int32, size int, start time.Time) {
+	kafkaBatchSize.WithLabelValues(topic, strconv.Itoa(int(partition))).Observe(float64(size))
+	kafkaBatchDuration.WithLabelValues(topic).Observe(time.Since(start).Seconds())
+}
+
+// AddKafkaMessages 按处理结果累加消息数
+func AddKafkaMessages(topic string, result string, count int) {
+	kafkaMessagesTotal.WithLabelValues(topic, result).Add(float64(count))
+}
+
+// SetKafkaPartitionPaused 更新分区暂停状态
+func SetKafkaPartitionPaused(topic string, partition int32, paused bool) {
+	kafkaPartitionPaused.WithLabelValues(topic, strconv.Itoa(int(partition))).Set(boolGauge(paused))
+}
+
+// SetSinkHealthy 更新下游存储的健康状态
+func SetSinkHealthy(sink string, healthy bool) {
+	sinkHealthy.WithLabelValues(sink).Set(boolGauge(healthy))
+}
+
+// SetClickHouseWriterBufferedRows 更新缓冲写入器中等待写入的行数
+func SetClickHouseWriterBufferedRows(table string, rows int) {
+	clickhouseWriterBufferedRows.WithLabelValues(table).Set(float64(rows))
+}
+
+// SetClickHouseWriterSpilledBatches 更新落盘待回放的批次数
+func SetClickHouseWriterSpilledBatches(table string, batches int) {
+	clickhouseWriterSpilledBatches.WithLabelValues(table).Set(float64(batches))
+}
+
+// IncClickHouseWriterFlush 按结果累加缓冲写入器的刷写次数
+func IncClickHouseWriterFlush(table, result string) {
+	clickhouseWriterFlushes.WithLabelValues(table, result).Inc()
+}
+
+func boolGauge(v bool) float64 {
+	if v {
+		return 1
+	}
+	return 0
+}
+
+// ObserveClickHouse 记录 ClickHouse 操作耗时及错误
+func ObserveClickHouse(operation string, start time.Time, err error) {
+	clickhouseQueryDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	if err != nil {
+		clickhouseErrors.WithLabelValues(operation).Inc()
+	}
+}
+
+// ObserveES 记录 Elasticsearch 请求耗时，failed 表示传输错误或 5xx 响应
+func ObserveES(operation string, start time.Time, failed bool) {
+	esRequestDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	if failed {
+		esErrors.WithLabelValues(operation).Inc()
+	}
+}
+
+// ObserveRedis 记录 Redis 命令耗时及错误，isNil 为 true 表示缓存未命中，不计入错误
+func ObserveRedis(command string, start time.Time, err error, isNil bool) {
+	redisCommandDuration.WithLabelValues(command).Observe(time.Since(start).Seconds())
+	if err != nil && !isNil {
+		redisErrors.WithLabelValues(command).Inc()
+	}
+}
+
+// ObserveCronJob 记录定时任务的执行结果和耗时
+func ObserveCronJob(job string, start time.Time, err error) {
+	result := ResultSuccess
+	if err != nil {
+		result = ResultError
+	}
+	cronJobRuns.WithLabelValues(job, result).Inc()
+	cronJobDuration.WithLabelValues(job).Observe(time.Since(start).Seconds())
+}
@@ -217,6 +217,18 @@ const (
 	Invite   RecordType = 2
 	Activity RecordType = 3
 	BuyG     RecordType = 4
+	RefundG  RecordType = 5 // 积分兑换交易失败或超时未确认，退还积分
+)
+
+// PointTxStatus 积分兑换交易的链上终态
+type PointTxStatus int8
+
+const (
+	PointTxStatusNone    PointTxStatus = 0 // 未记录
+	PointTxStatusSuccess PointTxStatus = 1 // 链上成功
+	PointTxStatusFailed  PointTxStatus = 2 // 链上失败，已退还积分
+	PointTxStatusExpired PointTxStatus = 3 // 超过最长等待时间仍未确认，已退还积分
+	PointTxStatusReview  PointTxStatus = 4 // 超过最长等待时间仍无法查询到交易状态，未退还积分，需人工核对
 )
 
 type StatisticType string
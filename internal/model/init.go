@@ -64,6 +64,18 @@ func Database(connString string) {
 
 }
 
+// CloseDatabase 关闭 MySQL 连接池
+func CloseDatabase() error {
+	if DB == nil {
+		return nil
+	}
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
 // customWriter 实现 logger.Writer 接口
 type customWriter struct{}
 
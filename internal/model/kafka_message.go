@@ -76,6 +76,19 @@ type PumpFuncCompleteMessage struct {
 	Signature    string `json:"signature"`
 }
 
+// PumpSetParamsMessage pump.fun 全局曲线参数变更消息结构体
+type PumpSetParamsMessage struct {
+	FeeRecipient                string `json:"feeRecipient"`                // 手续费接收地址
+	InitialVirtualTokenReserves string `json:"initialVirtualTokenReserves"` // 初始虚拟代币储备
+	InitialVirtualSolReserves   string `json:"initialVirtualSolReserves"`   // 初始虚拟 SOL 储备
+	InitialRealTokenReserves    string `json:"initialRealTokenReserves"`    // 初始实际代币储备
+	TokenTotalSupply            string `json:"tokenTotalSupply"`            // 代币总量
+	FeeBasisPoints              string `json:"feeBasisPoints"`              // 手续费（万分比）
+	Signature                   string `json:"signature"`                   // 签名
+	Timestamp                   int64  `json:"timestamp"`                   // 时间戳
+	Block                       uint64 `json:"block"`                       // 区块高度
+}
+
 // GameOutTradeMessage 代理合约外盘买卖事件消息结构体
 type GameOutTradeMessage struct {
 	Timestamp            int64  `json:"timestamp"`            // 时间戳
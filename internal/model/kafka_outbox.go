@@ -0,0 +1,162 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// OutboxStatus 发件箱消息状态
+type OutboxStatus int8
+
+const (
+	OutboxStatusPending   OutboxStatus = 0 // 待发送
+	OutboxStatusSent      OutboxStatus = 1 // 已发送到 Kafka
+	OutboxStatusCancelled OutboxStatus = 2 // 业务回滚，不再发送
+)
+
+type KafkaOutboxRepo struct {
+	db *gorm.DB
+}
+
+func NewKafkaOutboxRepo() *KafkaOutboxRepo {
+	return &KafkaOutboxRepo{}
+}
+
+// KafkaOutbox Kafka 发件箱表，与业务数据在同一事务中写入，由 relay 异步投递
+type KafkaOutbox struct {
+	ID          uint64     `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	Topic       string     `gorm:"column:topic;type:varchar(255);not null" json:"topic"`
+	MessageKey  string     `gorm:"column:message_key;type:varchar(255)" json:"message_key"`
+	Payload     string     `gorm:"column:payload;type:text;not null" json:"payload"`
+	Status      int8       `gorm:"column:status;type:tinyint;not null;default:0" json:"status"`
+	Attempts    int        `gorm:"column:attempts;not null;default:0" json:"attempts"`
+	LastError   string     `gorm:"column:last_error;type:varchar(1024)" json:"last_error"`
+	AvailableAt time.Time  `gorm:"column:available_at;type:datetime(3);not null" json:"available_at"` // 最早可投递时间
+	SentAt      *time.Time `gorm:"column:sent_at;type:datetime(3)" json:"sent_at"`
+	CreateTime  time.Time  `gorm:"column:create_time;type:datetime" json:"create_time"`
+	UpdateTime  time.Time  `gorm:"column:update_time;type:datetime" json:"update_time"`
+}
+
+// TableName 返回表名
+func (KafkaOutbox) TableName() string {
+	return "kafka_outbox"
+}
+
+// BeforeCreate GORM 的钩子,在创建记录前自动设置时间
+func (o *KafkaOutbox) BeforeCreate(tx *gorm.DB) error {
+	now := time.Now()
+	o.CreateTime = now
+	o.UpdateTime = now
+	return nil
+}
+
+// CreateKafkaOutboxTable 创建发件箱表
+func CreateKafkaOutboxTable() error {
+	return DB.Exec(`
+		CREATE TABLE IF NOT EXISTS kafka_outbox (
+			id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+			topic VARCHAR(255) NOT NULL COMMENT '目标 topic',
+			message_key VARCHAR(255) NULL COMMENT '消息 key',
+			payload TEXT NOT NULL COMMENT '消息体',
+			status TINYINT NOT NULL DEFAULT 0 COMMENT '0-待发送 1-已发送 2-已取消',
+			attempts INT NOT NULL DEFAULT 0 COMMENT '投递次数',
+			last_error VARCHAR(1024) NULL COMMENT '最近一次投递错误',
+			available_at DATETIME(3) NOT NULL COMMENT '最早可投递时间',
+			sent_at DATETIME(3) NULL COMMENT '投递成功时间',
+			create_time DATETIME NOT NULL,
+			update_time DATETIME NOT NULL,
+			PRIMARY KEY (id),
+			KEY idx_status_available (status, available_at)
+		) COMMENT = 'Kafka 发件箱'
+	`).Error
+}
+
+func (r *KafkaOutboxRepo) WithTx(tx *gorm.DB) *KafkaOutboxRepo {
+	return &KafkaOutboxRepo{db: tx}
+}
+
+// conn 返回事务连接，未绑定事务时使用全局连接
+func (r *KafkaOutboxRepo) conn() *gorm.DB {
+	if r.db != nil {
+		return r.db
+	}
+	return DB
+}
+
+// Create 写入一条待发送消息
+func (r *KafkaOutboxRepo) Create(outbox *KafkaOutbox) error {
+	return r.conn().Create(outbox).Error
+}
+
+// ListDue 查询已到投递时间的待发送消息
+func (r *KafkaOutboxRepo) ListDue(limit int) ([]*KafkaOutbox, error) {
+	var rows []*KafkaOutbox
+	err := r.conn().Where("status = ? AND available_at <= ?", int8(OutboxStatusPending), time.Now()).
+		Order("id ASC").
+		Limit(limit).
+		Find(&rows).Error
+	return rows, err
+}
+
+// Claim 将到期消息的投递时间推迟 lease，用于多实例间抢占，返回是否抢占成功
+func (r *KafkaOutboxRepo) Claim(id uint64, lease time.Duration) (bool, error) {
+	now := time.Now()
+	result := r.conn().Model(&KafkaOutbox{}).
+		Where("id = ? AND status = ? AND available_at <= ?", id, int8(OutboxStatusPending), now).
+		Updates(map[string]interface{}{
+			"available_at": now.Add(lease),
+			"attempts":     gorm.Expr("attempts + 1"),
+			"update_time":  now,
+		})
+	return result.RowsAffected == 1, result.Error
+}
+
+// MarkSent 标记消息已投递
+func (r *KafkaOutboxRepo) MarkSent(id uint64) error {
+	now := time.Now()
+	return r.conn().Model(&KafkaOutbox{}).
+		Where("id = ? AND status = ?", id, int8(OutboxStatusPending)).
+		Updates(map[string]interface{}{
+			"status":      int8(OutboxStatusSent),
+			"sent_at":     now,
+			"last_error":  "",
+			"update_time": now,
+		}).Error
+}
+
+// MarkRetry 记录投递失败，并在 nextAt 之后重新投递
+func (r *KafkaOutboxRepo) MarkRetry(id uint64, sendErr string, nextAt time.Time) error {
+	if len(sendErr) > 1024 {
+		sendErr = sendErr[:1024]
+	}
+	return r.conn().Model(&KafkaOutbox{}).
+		Where("id = ? AND status = ?", id, int8(OutboxStatusPending)).
+		Updates(map[string]interface{}{
+			"last_error":   sendErr,
+			"available_at": nextAt,
+			"update_time":  time.Now(),
+		}).Error
+}
+
+// Release 将待发送消息的投递时间提前到当前时间
+func (r *KafkaOutboxRepo) Release(id uint64) error {
+	now := time.Now()
+	return r.conn().Model(&KafkaOutbox{}).
+		Where("id = ? AND status = ?", id, int8(OutboxStatusPending)).
+		Updates(map[string]interface{}{
+			"available_at": now,
+			"update_time":  now,
+		}).Error
+}
+
+// Cancel 取消尚未投递的消息，返回是否取消成功，已投递的消息无法取消
+func (r *KafkaOutboxRepo) Cancel(id uint64) (bool, error) {
+	result := r.conn().Model(&KafkaOutbox{}).
+		Where("id = ? AND status = ?", id, int8(OutboxStatusPending)).
+		Updates(map[string]interface{}{
+			"status":      int8(OutboxStatusCancelled),
+			"update_time": time.Now(),
+		})
+	return result.RowsAffected == 1, result.Error
+}
@@ -1,6 +1,7 @@
 package model
 
 import (
+	"errors"
 	"time"
 
 	"gorm.io/gorm"
@@ -16,18 +17,20 @@ func NewPointRecordsRepo() *PointRecordsRepo {
 
 // PointRecords 积分记录表
 type PointRecords struct {
-	ID                uint      `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
-	UserID            uint      `gorm:"column:user_id;not null" json:"user_id"`
-	PointsChange      uint64    `gorm:"column:points_change;type:bigint unsigned;default:0" json:"points_change"`
-	PointsBalance     uint64    `gorm:"column:points_balance;type:bigint unsigned;default:0" json:"points_balance"`
-	RecordType        int8      `gorm:"column:record_type;type:tinyint;not null" json:"record_type"`
-	InviteeID         uint      `gorm:"column:invitee_id;default null" json:"invitee_id,omitempty"`
-	NativeTokenAmount uint64    `gorm:"column:native_token_amount;type:bigint unsigned;default:0" json:"native_token_amount"`
-	TokenAmount       uint64    `gorm:"column:token_amount;type:bigint unsigned;default:0" json:"token_amount"`
-	TransactionHash   string    `gorm:"column:transaction_hash;type:varchar(88)" json:"transaction_hash,omitempty"`
-	TransactionDetail string    `gorm:"column:transaction_detail;type:text" json:"transaction_detail,omitempty"`
-	CreateTime        time.Time `gorm:"column:create_time;type:datetime" json:"create_time"`
-	UpdateTime        time.Time `gorm:"column:update_time;type:datetime" json:"update_time"`
+	ID                uint   `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	UserID            uint   `gorm:"column:user_id;not null" json:"user_id"`
+	PointsChange      uint64 `gorm:"column:points_change;type:bigint unsigned;default:0" json:"points_change"`
+	PointsBalance     uint64 `gorm:"column:points_balance;type:bigint unsigned;default:0" json:"points_balance"`
+	RecordType        int8   `gorm:"column:record_type;type:tinyint;not null" json:"record_type"`
+	InviteeID         uint   `gorm:"column:invitee_id;default null" json:"invitee_id,omitempty"`
+	NativeTokenAmount uint64 `gorm:"column:native_token_amount;type:bigint unsigned;default:0" json:"native_token_amount"`
+	TokenAmount       uint64 `gorm:"column:token_amount;type:bigint unsigned;default:0" json:"token_amount"`
+	TransactionHash   string `gorm:"column:transaction_hash;type:varchar(88)" json:"transaction_hash,omitempty"`
+	TransactionDetail string `gorm:"column:transaction_detail;type:text" json:"transaction_detail,omitempty"`
+	// 积分兑换交易链上终态，见 PointTxStatus，已有表由 AddPointRecordsTxStatusColumn 补列
+	TxStatus   int8      `gorm:"column:tx_status;type:tinyint;default:0" json:"tx_status"`
+	CreateTime time.Time `gorm:"column:create_time;type:datetime" json:"create_time"`
+	UpdateTime time.Time `gorm:"column:update_time;type:datetime" json:"update_time"`
 }
 
 type InvitedPointsDetail struct {
@@ -40,9 +43,20 @@ func (PointRecords) TableName() string {
 	return "point_records"
 }
 
+// AddPointRecordsTxStatusColumn 为已有的积分记录表补充 tx_status 列，列已存在时跳过
+func AddPointRecordsTxStatusColumn() error {
+	if DB.Migrator().HasColumn(&PointRecords{}, "tx_status") {
+		return nil
+	}
+	return DB.Exec(`
+		ALTER TABLE point_records
+		ADD COLUMN tx_status TINYINT NOT NULL DEFAULT 0 COMMENT '积分兑换交易链上终态'
+	`).Error
+}
+
 // CreatePointRecord 创建积分记录
 func (r *PointRecordsRepo) CreatePointRecord(record *PointRecords) error {
-	return DB.Create(record).Error
+	return r.conn().Create(record).Error
 }
 
 // CreatePointRecords 创建积分记录
@@ -92,6 +106,39 @@ func (r *PointRecordsRepo) WithTx(tx *gorm.DB) *PointRecordsRepo {
 	return &PointRecordsRepo{db: tx}
 }
 
+// conn 返回事务连接，未绑定事务时使用全局连接
+func (r *PointRecordsRepo) conn() *gorm.DB {
+	if r.db != nil {
+		return r.db
+	}
+	return DB
+}
+
+// GetPointRecordByHash 按交易签名和记录类型查询用户的积分记录，不存在时返回 nil
+func (r *PointRecordsRepo) GetPointRecordByHash(userID uint, hash string, recordType RecordType) (*PointRecords, error) {
+	var record PointRecords
+	err := r.conn().Where("user_id = ? AND transaction_hash = ? AND record_type = ?", userID, hash, int8(recordType)).
+		First(&record).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &record, nil
+}
+
+// UpdateTxStatusByHash 更新交易对应积分记录的链上终态，返回受影响的行数
+func (r *PointRecordsRepo) UpdateTxStatusByHash(userID uint, hash string, recordType RecordType, status PointTxStatus) (int64, error) {
+	result := r.conn().Model(&PointRecords{}).
+		Where("user_id = ? AND transaction_hash = ? AND record_type = ?", userID, hash, int8(recordType)).
+		Updates(map[string]interface{}{
+			"tx_status":   int8(status),
+			"update_time": time.Now(),
+		})
+	return result.RowsAffected, result.Error
+}
+
 // BeforeCreate GORM 的钩子,在创建记录前自动设置时间
 func (t *PointRecords) BeforeCreate(tx *gorm.DB) error {
 	now := time.Now()
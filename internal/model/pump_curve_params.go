@@ -0,0 +1,105 @@
+package model
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PUMP_TOKEN_TOTAL_SUPPLY pump.fun 代币默认总量
+const PUMP_TOKEN_TOTAL_SUPPLY = "1000000000000000"
+
+// PUMP_FEE_BASIS_POINTS pump.fun 默认手续费（万分比）
+const PUMP_FEE_BASIS_POINTS = 100
+
+// PumpCurveParams pump.fun 全局联合曲线参数，每个 set-params 事件写入一行
+type PumpCurveParams struct {
+	ID                          uint64    `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	InitialVirtualTokenReserves uint64    `gorm:"column:initial_virtual_token_reserves;type:bigint unsigned;not null" json:"initial_virtual_token_reserves"`
+	InitialVirtualSolReserves   uint64    `gorm:"column:initial_virtual_sol_reserves;type:bigint unsigned;not null" json:"initial_virtual_sol_reserves"`
+	InitialRealTokenReserves    uint64    `gorm:"column:initial_real_token_reserves;type:bigint unsigned;not null" json:"initial_real_token_reserves"`
+	TokenTotalSupply            uint64    `gorm:"column:token_total_supply;type:bigint unsigned;not null" json:"token_total_supply"`
+	FeeBasisPoints              uint64    `gorm:"column:fee_basis_points;type:bigint unsigned;not null" json:"fee_basis_points"`
+	FeeRecipient                string    `gorm:"column:fee_recipient;type:varchar(64)" json:"fee_recipient"`
+	TransactionHash             string    `gorm:"column:transaction_hash;type:varchar(88);not null" json:"transaction_hash"`
+	Block                       uint64    `gorm:"column:block;type:bigint unsigned;not null" json:"block"`
+	TransactionTime             time.Time `gorm:"column:transaction_time;type:datetime" json:"transaction_time"`
+	CreateTime                  time.Time `gorm:"column:create_time;type:datetime" json:"create_time"`
+}
+
+// TableName 返回表名
+func (PumpCurveParams) TableName() string {
+	return "pump_curve_params"
+}
+
+// BeforeCreate GORM 的钩子,在创建记录前自动设置时间
+func (p *PumpCurveParams) BeforeCreate(tx *gorm.DB) error {
+	p.CreateTime = time.Now()
+	return nil
+}
+
+// DefaultPumpCurveParams 未收到 set-params 事件前使用的默认参数
+func DefaultPumpCurveParams() *PumpCurveParams {
+	params := &PumpCurveParams{FeeBasisPoints: PUMP_FEE_BASIS_POINTS}
+	params.InitialVirtualTokenReserves, _ = strconv.ParseUint(PUMP_INITIAL_VIRTUAL_TOKEN_RESERVES, 10, 64)
+	params.InitialVirtualSolReserves, _ = strconv.ParseUint(PUMP_INITIAL_VIRTUAL_SOL_RESERVES, 10, 64)
+	params.InitialRealTokenReserves, _ = strconv.ParseUint(PUMP_INITIAL_REAL_TOKEN_RESERVES, 10, 64)
+	params.TokenTotalSupply, _ = strconv.ParseUint(PUMP_TOKEN_TOTAL_SUPPLY, 10, 64)
+	return params
+}
+
+// CreatePumpCurveParamsTable 创建曲线参数表
+func CreatePumpCurveParamsTable() error {
+	return DB.Exec(`
+		CREATE TABLE IF NOT EXISTS pump_curve_params (
+			id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+			initial_virtual_token_reserves BIGINT UNSIGNED NOT NULL COMMENT '初始虚拟代币储备',
+			initial_virtual_sol_reserves BIGINT UNSIGNED NOT NULL COMMENT '初始虚拟 SOL 储备',
+			initial_real_token_reserves BIGINT UNSIGNED NOT NULL COMMENT '初始实际代币储备',
+			token_total_supply BIGINT UNSIGNED NOT NULL COMMENT '代币总量',
+			fee_basis_points BIGINT UNSIGNED NOT NULL COMMENT '手续费（万分比）',
+			fee_recipient VARCHAR(64) NULL COMMENT '手续费接收地址',
+			transaction_hash VARCHAR(88) NOT NULL COMMENT 'set-params 交易签名',
+			block BIGINT UNSIGNED NOT NULL COMMENT '区块高度',
+			transaction_time DATETIME NULL COMMENT '交易时间',
+			create_time DATETIME NOT NULL,
+			PRIMARY KEY (id),
+			UNIQUE KEY uk_transaction_hash (transaction_hash),
+			KEY idx_block (block)
+		) COMMENT = 'pump.fun 联合曲线参数'
+	`).Error
+}
+
+// SavePumpCurveParams 保存曲线参数，同一交易重复写入时忽略
+func SavePumpCurveParams(params *PumpCurveParams) error {
+	return DB.Clauses(clause.OnConflict{DoNothing: true}).Create(params).Error
+}
+
+// GetPumpCurveParamsAtBlock 查询在指定区块生效的曲线参数，没有记录时返回 nil
+func GetPumpCurveParamsAtBlock(block uint64) (*PumpCurveParams, error) {
+	var params PumpCurveParams
+	err := DB.Where("block <= ?", block).Order("block DESC, id DESC").First(&params).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &params, nil
+}
+
+// GetLatestPumpCurveParams 查询最新的曲线参数，没有记录时返回 nil
+func GetLatestPumpCurveParams() (*PumpCurveParams, error) {
+	var params PumpCurveParams
+	err := DB.Order("block DESC, id DESC").First(&params).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &params, nil
+}
@@ -158,6 +158,17 @@ func UpdateTokenInfo(info *TokenInfo) error {
 	return DB.Save(info).Error
 }
 
+// UpdateTokenHolderStats 更新持有者数量、前 10 持有者占比和开发者持仓占比
+func UpdateTokenHolderStats(tokenAddress string, chainType uint8, holder int, top10Percentage, devPercentage float64) error {
+	return DB.Model(&TokenInfo{}).
+		Where("token_address = ? AND chain_type = ?", tokenAddress, chainType).
+		Updates(map[string]interface{}{
+			"holder":           holder,
+			"top10_percentage": top10Percentage,
+			"dev_percentage":   devPercentage,
+		}).Error
+}
+
 // DeleteTokenInfo 删除币种信息记录
 func DeleteTokenInfo(id int64) error {
 	return DB.Delete(&TokenInfo{}, id).Error
@@ -222,16 +233,32 @@ func SearchToken(name string, chainType uint8) ([]string, error) {
 
 }
 
-// UpdateTokenComplete 只更新代币的完成状态
+// UpdateTokenComplete 只更新代币的完成状态，联合曲线完成时进度为 100
 func UpdateTokenComplete(tokenAddress string, chainType uint8) error {
 	return DB.Model(&TokenInfo{}).
 		Where("token_address = ? AND chain_type = ?", tokenAddress, chainType).
 		Updates(map[string]interface{}{
 			"is_complete": true,
+			"progress":    100,
 			"update_time": time.Now(),
 		}).Error
 }
 
+// LinkMigratedTokenPool 将 pump 代币关联到迁移后的 Raydium 池子，并标记为已完成
+// 返回受影响的行数，非 pump 创建的代币不会被更新
+func LinkMigratedTokenPool(tokenAddress string, chainType uint8, poolAddress string) (int64, error) {
+	result := DB.Model(&TokenInfo{}).
+		Where("token_address = ? AND chain_type = ? AND created_platform_type = ?",
+			tokenAddress, chainType, uint8(CreatedPlatformTypePump)).
+		Updates(map[string]interface{}{
+			"pool_address": poolAddress,
+			"is_complete":  true,
+			"progress":     100,
+			"update_time":  time.Now(),
+		})
+	return result.RowsAffected, result.Error
+}
+
 // ListTokenInfosByCursor 使用游标分页获取代币信息
 func ListTokenInfosByCursor(lastID int64, chainType uint8, createdPlatformType uint8, isComplete bool, limit int) ([]TokenInfo, error) {
 	var infos []TokenInfo
@@ -251,8 +251,12 @@ func (r *UserInfoRepo) DeductPointsWithOptimisticLock(userID uint64, amount uint
 		return false, fmt.Errorf("扣减积分必须为正数")
 	}
 
+	db := DB
+	if r.db != nil {
+		db = r.db
+	}
 	// 使用原子UPDATE操作，确保只有当积分足够时才扣减
-	result := DB.Exec(`
+	result := db.Exec(`
         UPDATE user_info 
         SET available_points = available_points - ?, 
             update_time = ? 
@@ -287,7 +291,11 @@ func (r *UserInfoRepo) IncrementAvailablePointsByUserID(userID uint, points uint
 		"update_time":      time.Now(),
 	}
 
-	result := DB.Model(&UserInfo{}).
+	db := DB
+	if r.db != nil {
+		db = r.db
+	}
+	result := db.Model(&UserInfo{}).
 		Where("id = ?", userID).
 		Updates(updates)
 
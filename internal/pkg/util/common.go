@@ -44,6 +44,16 @@ func GetEnvAsInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+// GetEnvAsFloat 从环境变量中获取 float64 类型的值
+func GetEnvAsFloat(key string, defaultValue float64) float64 {
+	if value, exists := os.LookupEnv(key); exists {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
 func GenerateInviteCode(address string) string {
 
 	// 定义可用字符集（去掉 I、L、O，使用大写字母）
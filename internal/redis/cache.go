@@ -35,5 +35,14 @@ func Redis() {
 		util.Log().Info("Redis connected successfully. Version info: %v", version)
 	}
 
+	client.AddHook(metricsHook{})
 	RedisClient = client
 }
+
+// CloseRedis 关闭 Redis 连接
+func CloseRedis() error {
+	if RedisClient != nil {
+		return RedisClient.Close()
+	}
+	return nil
+}
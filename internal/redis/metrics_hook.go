@@ -0,0 +1,36 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"game-fun-be/internal/metrics"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// metricsHook 记录每条 Redis 命令的耗时和错误
+type metricsHook struct{}
+
+func (metricsHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (metricsHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmd)
+		metrics.ObserveRedis(cmd.Name(), start, err, errors.Is(err, redis.Nil))
+		return err
+	}
+}
+
+func (metricsHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmds)
+		metrics.ObserveRedis("pipeline", start, err, errors.Is(err, redis.Nil))
+		return err
+	}
+}
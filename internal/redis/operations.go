@@ -243,6 +243,17 @@ func ZRemRangeByScore(key, min, max string) error {
 	return nil
 }
 
+// ZRem 移除有序集合中的成员，返回实际移除的数量
+func ZRem(key string, members ...interface{}) (int64, error) {
+	ctx := context.Background()
+	removed, err := RedisClient.ZRem(ctx, key, members...).Result()
+	if err != nil {
+		util.Log().Error("Error removing from sorted set %s: %v", key, err)
+		return 0, err
+	}
+	return removed, nil
+}
+
 // ZRangeByScore 获取有序集合中指定分数范围的成员
 func ZRangeByScore(key string, opt *ZRangeBy) ([]string, error) {
 	ctx := context.Background()
@@ -254,6 +265,25 @@ func ZRangeByScore(key string, opt *ZRangeBy) ([]string, error) {
 	return members, nil
 }
 
+// ZClaimDue 原子地抢占有序集合中已到期（score <= now）的成员，并将其 score 改为 leaseUntil
+// 返回 false 表示成员不存在、未到期或已被其他实例抢占；租约到期前未删除的成员会被再次抢占
+func ZClaimDue(key string, member string, now, leaseUntil int64) (bool, error) {
+	luaScript := `
+    local score = redis.call("ZSCORE", KEYS[1], ARGV[1])
+    if score and tonumber(score) <= tonumber(ARGV[2]) then
+        redis.call("ZADD", KEYS[1], ARGV[3], ARGV[1])
+        return 1
+    end
+    return 0
+    `
+	result, err := RedisClient.Eval(context.Background(), luaScript, []string{key}, member, now, leaseUntil).Int64()
+	if err != nil {
+		util.Log().Error("Error claiming member of sorted set %s: %v", key, err)
+		return false, err
+	}
+	return result == 1, nil
+}
+
 // SAddWithTTL 将成员添加到集合并设置过期时间
 func SAddWithTTL(key string, ttl time.Duration, members ...interface{}) error {
 	ctx := context.Background()
@@ -272,6 +302,18 @@ func SAddWithTTL(key string, ttl time.Duration, members ...interface{}) error {
 	return nil
 }
 
+// HIncrBy 将哈希表中指定字段的值加上增量
+func HIncrBy(key, field string, incr int64) error {
+	ctx := context.Background()
+	return RedisClient.HIncrBy(ctx, key, field, incr).Err()
+}
+
+// HGetAll 获取哈希表中的所有字段和值
+func HGetAll(key string) (map[string]string, error) {
+	ctx := context.Background()
+	return RedisClient.HGetAll(ctx, key).Result()
+}
+
 // Del 批量删除多个键
 func Del(keys ...string) error {
 	ctx := context.Background()
@@ -0,0 +1,14 @@
+package request
+
+// BackfillRequest 历史回填请求
+// start_time/end_time 为秒级时间戳，start_offset/end_offset 对所有分区生效且优先于时间戳
+type BackfillRequest struct {
+	Topics              []string `json:"topics" binding:"required,min=1"`
+	Sinks               []string `json:"sinks" binding:"required,min=1,dive,oneof=mysql elasticsearch clickhouse"`
+	StartTime           int64    `json:"start_time"`
+	EndTime             int64    `json:"end_time"`
+	StartOffset         *int64   `json:"start_offset"`
+	EndOffset           *int64   `json:"end_offset"`
+	BatchSize           int      `json:"batch_size"`
+	ClickHouseTruncated bool     `json:"clickhouse_truncated"` // 回填 swap 到 ClickHouse 时必须为 true，确认目标区间的交易已清理
+}
@@ -9,3 +9,23 @@ type PlatfromTokenStatisticResponse struct {
 	BurnAmount    string `json:"burn_amount"`     // token 销毁数量
 	PointsAmount  string `json:"points_amount"`   // 已兑换的积分数量
 }
+
+// PlatformTokenStatisticPoint 平台币统计时间序列中的一个周期
+type PlatformTokenStatisticPoint struct {
+	Time          int64  `json:"time"`            // 周期开始时间（秒级时间戳）
+	TradesCount   uint64 `json:"trades_count"`    // 代理合约交易笔数
+	FeeAmount     string `json:"fee_amount"`      // 手续费收入（美元，按成交时的 SOL 价格折算）
+	FeeSol        string `json:"fee_sol"`         // 手续费收入 sol
+	BackAmount    string `json:"back_amount"`     // token回购数量
+	BackSolAmount string `json:"back_sol_amount"` // 回购花费（美元，按成交时的 SOL 价格折算）
+	BackSol       string `json:"back_sol"`        // 回购花费的 sol数量
+	BurnAmount    string `json:"burn_amount"`     // token 销毁数量
+	PointsAmount  string `json:"points_amount"`   // 已兑换的积分数量
+}
+
+// PlatformTokenStatisticSeriesResponse 平台币统计时间序列，没有交易的周期补零
+type PlatformTokenStatisticSeriesResponse struct {
+	TokenAddress string                        `json:"token_address"` // 代币地址
+	Interval     string                        `json:"interval"`      // 周期：1h、1d
+	Series       []PlatformTokenStatisticPoint `json:"series"`        // 按时间升序
+}
@@ -2,6 +2,7 @@ package response
 
 // TokenHolding 定义代币持仓数据结构
 type TokenHolding struct {
+	TokenAddress     string `json:"token_address"`      // 代币地址
 	TokenName        string `json:"token_name"`         // 代币名称
 	Symbol           string `json:"symbol"`             // 代币符号
 	Price            string `json:"price"`              // 当前价格
@@ -13,6 +14,8 @@ type TokenHolding struct {
 	HoldersCount     int    `json:"holders_count"`      // 持有者数量
 	FilledPrice      string `json:"filled_price"`       // 成交价格
 	RealizedPNL      string `json:"realized_pnl"`       // 已实现盈亏
+	UnrealizedPNL    string `json:"unrealized_pnl"`     // 未实现盈亏
+	ROI              string `json:"roi"`                // 收益率，(已实现 + 未实现) / 买入总额
 	MarketAddress    string `json:"market_address"`     // 市场地址
 	TotalBuy         string `json:"total_buy"`          // 总买入数量
 	TotalBuyNative   string `json:"total_buy_native"`  // 总买入原生代币数量
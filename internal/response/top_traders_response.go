@@ -0,0 +1,26 @@
+package response
+
+// TopTrader 代币交易者排行中的一个钱包
+type TopTrader struct {
+	Rank          int      `json:"rank"`            // 排名，从 1 开始
+	Account       string   `json:"account"`         // 钱包地址
+	Labels        []string `json:"labels"`          // 标签：creator（代币创建者）、pool（池子地址）
+	BuyCount      uint64   `json:"buy_count"`       // 买入次数
+	SellCount     uint64   `json:"sell_count"`      // 卖出次数
+	TradesCount   uint64   `json:"trades_count"`    // 交易次数
+	BuyAmount     string   `json:"buy_amount"`      // 买入代币数量
+	SellAmount    string   `json:"sell_amount"`     // 卖出代币数量
+	BuyVolumeUSD  string   `json:"buy_volume_usd"`  // 买入金额（美元）
+	SellVolumeUSD string   `json:"sell_volume_usd"` // 卖出金额（美元）
+	VolumeUSD     string   `json:"volume_usd"`      // 成交额（美元）
+	NetBuyUSD     string   `json:"net_buy_usd"`     // 净买入（美元）
+	RealizedPNL   string   `json:"realized_pnl"`    // 窗口内估算的已实现盈亏（美元）
+	LastTradeTime int64    `json:"last_trade_time"` // 最后交易时间（秒级时间戳）
+}
+
+// TopTradersResponse 代币交易者排行
+type TopTradersResponse struct {
+	Window     string      `json:"window"`      // 时间窗口
+	SortBy     string      `json:"sort_by"`     // 排序字段
+	TopTraders []TopTrader `json:"top_traders"` // 排行列表
+}
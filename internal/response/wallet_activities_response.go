@@ -0,0 +1,25 @@
+package response
+
+// WalletActivity 钱包在任意代币上的一笔买卖
+type WalletActivity struct {
+	Signature    string `json:"signature"`     // 交易签名
+	TokenAddress string `json:"token_address"` // 代币地址
+	TokenName    string `json:"token_name"`    // 代币名称
+	Symbol       string `json:"symbol"`        // 代币符号
+	ImageURI     string `json:"image_uri"`     // 代币图片 URI
+	PoolAddress  string `json:"pool_address"`  // 池子地址
+	Platform     string `json:"platform"`      // 交易平台：pump、raydium、game
+	TradeType    uint8  `json:"trade_type"`    // 交易类型：1=买，2=卖，3=回购
+	TokenAmount  string `json:"token_amount"`  // 代币数量
+	NativeAmount string `json:"native_amount"` // 原生代币数量
+	TokenPrice   string `json:"token_price"`   // 成交价格（美元）
+	AmountUSD    string `json:"amount_usd"`    // 成交金额（美元）
+	BlockTime    int64  `json:"block_time"`    // 成交时间（秒级时间戳）
+}
+
+// WalletActivitiesResponse 钱包动态
+type WalletActivitiesResponse struct {
+	Activities []WalletActivity `json:"activities"`  // 按成交时间倒序的交易列表
+	NextCursor string           `json:"next_cursor"` // 下一页游标，为空表示没有更多数据
+	HasMore    bool             `json:"has_more"`    // 是否还有更多数据
+}
@@ -7,18 +7,18 @@ import (
 	"game-fun-be/internal/api/ws"
 	"game-fun-be/internal/clickhouse"
 	"game-fun-be/internal/interceptor"
+	"game-fun-be/internal/metrics"
 	"game-fun-be/internal/model"
 	"game-fun-be/internal/service"
 
-	"github.com/IBM/sarama"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 )
 
-// NewRouter 路由配置
-func NewRouter(producer sarama.SyncProducer) *gin.Engine {
+// NewRouter 路由配置，sendMessage 用于发送 Kafka 消息，如 kafka.SendMessage
+func NewRouter(sendMessage service.MessageSender) *gin.Engine {
 	globalService := service.NewGlobalServiceImpl()
 	globalHandler := api.NewGlobalHandler(globalService)
 
@@ -41,7 +41,7 @@ func NewRouter(producer sarama.SyncProducer) *gin.Engine {
 	pointsService := service.NewPointsServiceImpl(userInfoRepo, pointRecordsRepo, platformTokenStatisticRepo)
 	pointsHandler := api.NewPointsHandler(pointsService, globalService)
 
-	swapService := service.NewSwapService(producer)
+	swapService := service.NewSwapService(sendMessage)
 	swapHandler := api.NewSwapHandler(swapService)
 
 	r := gin.New()
@@ -49,6 +49,7 @@ func NewRouter(producer sarama.SyncProducer) *gin.Engine {
 	// 基础中间件
 	r.Use(gin.Logger())
 	r.Use(gin.Recovery())
+	r.Use(metrics.GinMiddleware())
 
 	// CORS 配置
 	r.Use(cors.New(cors.Config{
@@ -99,10 +100,13 @@ func NewRouter(producer sarama.SyncProducer) *gin.Engine {
 		v1.GET("tickers/:chain_type", tickerHandler.Tickers)
 		v1.GET("tickers/:chain_type/detail/:ticker_address", tickerHandler.TickerDetail)
 		v1.GET("tickers/:chain_type/statistic/:ticker_address", tickerHandler.TickerPointsStatistic)
+		v1.GET("tickers/:chain_type/statistic/:ticker_address/series", tickerHandler.TickerPointsStatisticSeries)
 		v1.GET("tickers/:chain_type/market/:ticker_address", tickerHandler.MarketTicker)
 		v1.GET("tickers/:chain_type/search", tickerHandler.SearchTickers)
 		v1.GET("tickers/:chain_type/swap_histories/:ticker_address", tickerHandler.SwapHistories)
 		v1.GET("tickers/:chain_type/token_distribution/:ticker_address", tickerHandler.TokenDistribution)
+		v1.GET("tickers/:chain_type/top_traders/:ticker_address", tickerHandler.TopTraders)
+		v1.GET("wallets/:chain_type/activities/:account", tokenHoldingsHandler.WalletActivities)
 		v1.GET("klines/:klineType/:chainType/:tokenAddress", tickerHandler.GetTokenKlines)
 		v1.GET("global/:chain_type/native_token_price", globalHandler.NativeTokePrice)
 
@@ -130,9 +134,23 @@ func NewRouter(producer sarama.SyncProducer) *gin.Engine {
 
 	// 健康检查路由
 	r.GET("/health", api.HealthCheck)
+	r.GET("/metrics", metrics.Handler())
 	// 工具路由
 	r.GET("/tools/execute_reindex_job", api.ExecuteReindexJob)
 	r.POST("/tools/reset_pool_info", api.ResetTokenPoolInfo)
+	// 死信消息查看与重放
+	r.GET("/tools/dlq/:topic", api.ListDeadLetters)
+	r.GET("/tools/dlq/:topic/:partition/:offset", api.GetDeadLetter)
+	r.POST("/tools/dlq/:topic/:partition/:offset/replay", api.ReplayDeadLetter)
+	r.GET("/tools/quarantine/:topic", api.ListQuarantined)
+	r.GET("/tools/kafka/duplicate_stats", api.KafkaDuplicateStats)
+	r.GET("/tools/kafka/sinks", api.KafkaSinkStatuses)
+	r.GET("/tools/clickhouse/duplicates", api.ClickHouseDuplicates)
+	r.GET("/tools/clickhouse/writers", api.ClickHouseWriterStatuses)
+	r.POST("/tools/backfill", api.StartBackfill)
+	r.GET("/tools/backfill", api.ListBackfillJobs)
+	r.GET("/tools/backfill/:id", api.GetBackfillJob)
+	r.POST("/tools/backfill/:id/cancel", api.CancelBackfill)
 
 	return r
 }
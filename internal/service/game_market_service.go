@@ -0,0 +1,103 @@
+package service
+
+import (
+	"net/http"
+
+	"game-fun-be/internal/clickhouse"
+	"game-fun-be/internal/model"
+	"game-fun-be/internal/pkg/util"
+	"game-fun-be/internal/response"
+
+	"github.com/shopspring/decimal"
+)
+
+// gameMarketWindows 游戏池行情统计的时间窗口（秒）：1m、5m、1h、24h
+var gameMarketWindows = []int64{60, 300, 3600, 86400}
+
+// GameMarketTicker 返回游戏池的行情统计，价格由池子储备计算并按当前 SOL 价格换算为美元，字段与 MarketTicker 一致
+func (s *TickerServiceImpl) GameMarketTicker(tokenAddress string, chainType model.ChainType) response.Response {
+	var analytics response.TokenMarketAnalyticsResponse
+	analytics.TokenAddress = tokenAddress
+
+	stats, err := clickhouse.GetGameMarketStats(chainType.Uint8(), tokenAddress, gameMarketWindows)
+	if err != nil {
+		return response.Err(http.StatusInternalServerError, "Failed to get game pool market stats", err)
+	}
+	if len(stats) == 0 {
+		return response.Success(populateMarketTicker(analytics))
+	}
+
+	tokenInfo, err := s.tokenInfoRepo.GetTokenInfoByAddress(tokenAddress, chainType.Uint8())
+	if err != nil {
+		return response.Err(http.StatusInternalServerError, "Failed to get token info", err)
+	}
+	decimals := defaultKlineDecimals
+	if tokenInfo != nil {
+		decimals = tokenInfo.Decimals
+	}
+	solPrice, err := getSolPrice()
+	if err != nil {
+		return response.Err(http.StatusInternalServerError, "Failed to get sol price", err)
+	}
+
+	if holderStats, err := clickhouse.GetHolderStats(chainType.Uint8(), tokenAddress, ""); err == nil {
+		analytics.Holders = int(holderStats.Holders)
+	} else {
+		util.Log().Error("Failed to get holder stats: %v", err)
+	}
+
+	price := stats[0].PriceSOL.Mul(solPrice)
+	currentPrice, _ := price.Float64()
+	analytics.Price = price
+	analytics.CurrentPrice = currentPrice
+	analytics.LastSwapAt = stats[0].LastTradeTime.Unix()
+	if tokenInfo != nil && tokenInfo.TotalSupply > 0 {
+		supply := decimal.NewFromInt(int64(tokenInfo.TotalSupply)).Shift(-int32(decimals))
+		analytics.MarketCap = price.Mul(supply).String()
+	} else {
+		analytics.MarketCap = "0"
+	}
+
+	tokenAmount := func(amount uint64) decimal.Decimal {
+		return decimal.NewFromUint64(amount).Shift(-int32(decimals))
+	}
+	priceChange := func(w clickhouse.GameWindowStats) float64 {
+		current, _ := w.PriceSOL.Float64()
+		previous, _ := w.StartPriceSOL.Float64()
+		return calculatePriceChange(current, previous)
+	}
+	for _, w := range stats {
+		buyCount := decimal.NewFromUint64(w.BuyCount)
+		sellCount := decimal.NewFromUint64(w.SellCount)
+		buyVolume := tokenAmount(w.BuyVolume)
+		sellVolume := tokenAmount(w.SellVolume)
+		switch w.Seconds {
+		case 60:
+			analytics.BuyCount1m, analytics.SellCount1m = buyCount, sellCount
+			analytics.BuyVolume1m, analytics.SellVolume1m = buyVolume, sellVolume
+			analytics.PriceChange1m = priceChange(w)
+		case 300:
+			analytics.BuyCount5m, analytics.SellCount5m = buyCount, sellCount
+			analytics.BuyVolume5m, analytics.SellVolume5m = buyVolume, sellVolume
+			analytics.PriceChange5m = priceChange(w)
+		case 3600:
+			analytics.BuyCount1h, analytics.SellCount1h = buyCount, sellCount
+			analytics.BuyVolume1h, analytics.SellVolume1h = buyVolume, sellVolume
+			analytics.PriceChange1h = priceChange(w)
+		case 86400:
+			analytics.BuyCount24h, analytics.SellCount24h = buyCount, sellCount
+			analytics.BuyVolume24h, analytics.SellVolume24h = buyVolume, sellVolume
+			analytics.PriceChange24h = priceChange(w)
+		}
+	}
+	analytics.Volume1m = analytics.BuyVolume1m.Add(analytics.SellVolume1m)
+	analytics.Volume5m = analytics.BuyVolume5m.Add(analytics.SellVolume5m)
+	analytics.Volume1h = analytics.BuyVolume1h.Add(analytics.SellVolume1h)
+	analytics.Volume24h = analytics.BuyVolume24h.Add(analytics.SellVolume24h)
+	analytics.TotalCount1m = analytics.BuyCount1m.Add(analytics.SellCount1m)
+	analytics.TotalCount5m = analytics.BuyCount5m.Add(analytics.SellCount5m)
+	analytics.TotalCount1h = analytics.BuyCount1h.Add(analytics.SellCount1h)
+	analytics.TotalCount24h = analytics.BuyCount24h.Add(analytics.SellCount24h)
+
+	return response.Success(populateMarketTicker(analytics))
+}
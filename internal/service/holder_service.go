@@ -0,0 +1,57 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"game-fun-be/internal/clickhouse"
+	"game-fun-be/internal/model"
+	"game-fun-be/internal/pkg/util"
+
+	"github.com/shopspring/decimal"
+)
+
+// holderPercentage 持仓占总量的百分比，保留两位小数，与 token_info 中的 decimal(5,2) 一致
+func holderPercentage(amount decimal.Decimal, totalSupply uint64) float64 {
+	if totalSupply == 0 {
+		return 0
+	}
+	percentage, _ := amount.Mul(decimal.NewFromInt(100)).
+		Div(decimal.NewFromUint64(totalSupply)).Round(2).Float64()
+	return percentage
+}
+
+// RefreshTokenHolderStats 按自有持仓余额更新 since 之后有交易的代币的持有者数量、前 10 占比和开发者占比
+// 返回更新的代币数
+func RefreshTokenHolderStats(chainType uint8, since time.Time) (int, error) {
+	tokens, err := clickhouse.GetRecentlyTradedTokens(chainType, since)
+	if err != nil {
+		return 0, err
+	}
+	if len(tokens) == 0 {
+		return 0, nil
+	}
+
+	infos, err := model.GetTokenInfoByAddresses(tokens, chainType)
+	if err != nil {
+		return 0, fmt.Errorf("获取代币信息失败: %w", err)
+	}
+
+	updated := 0
+	for _, info := range infos {
+		stats, err := clickhouse.GetHolderStats(chainType, info.TokenAddress, info.Creator)
+		if err != nil {
+			util.Log().Error("Failed to get holder stats for %s: %v", info.TokenAddress, err)
+			continue
+		}
+		err = model.UpdateTokenHolderStats(info.TokenAddress, chainType, int(stats.Holders),
+			holderPercentage(stats.Top10Amount, info.TotalSupply),
+			holderPercentage(stats.DevAmount, info.TotalSupply))
+		if err != nil {
+			util.Log().Error("Failed to update holder stats for %s: %v", info.TokenAddress, err)
+			continue
+		}
+		updated++
+	}
+	return updated, nil
+}
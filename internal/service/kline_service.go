@@ -2,22 +2,159 @@
 package service
 
 import (
+	"errors"
+	"fmt"
 	"game-fun-be/internal/clickhouse"
+	"game-fun-be/internal/model"
+	"game-fun-be/internal/response"
 	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// K线价格单位
+const (
+	KlinePriceUnitUSD       = "usd"  // 代币美元价格
+	KlinePriceUnitSOL       = "sol"  // 代币 SOL 价格
+	KlinePriceUnitMarketCap = "mcap" // 美元市值
 )
 
+// K线和行情的数据来源
+const (
+	KlineSourceChain = "chain" // 链上交易（pump、raydium）
+	KlineSourceGame  = "game"  // 游戏池代理合约交易，价格由池子储备计算
+)
+
+// ErrKlineSupplyUnavailable 代币缺少总量信息，无法按市值计算K线
+var ErrKlineSupplyUnavailable = errors.New("token total supply unavailable")
+
+// defaultKlineDecimals 代币信息缺失时使用的精度
+const defaultKlineDecimals = uint8(6)
+
 type KlineService struct{}
 
 func NewKlineService() *KlineService {
 	return &KlineService{}
 }
 
-// GetTokenKlines 获取K线数据
-func (s *KlineService) GetTokenKlines(tokenAddress string, interval string, start, end time.Time) ([]clickhouse.Kline, error) {
-	return clickhouse.GetKlines(tokenAddress, interval, start, end)
+// IsValidKlinePriceUnit 检查价格单位参数
+func IsValidKlinePriceUnit(unit string) bool {
+	switch unit {
+	case KlinePriceUnitUSD, KlinePriceUnitSOL, KlinePriceUnitMarketCap:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsValidKlineSource 检查数据来源参数
+func IsValidKlineSource(source string) bool {
+	return source == KlineSourceChain || source == KlineSourceGame
+}
+
+// GetTokenKlines 获取连续的K线数据，价格为美元
+func (s *KlineService) GetTokenKlines(tokenAddress string, resolution clickhouse.KlineResolution, start, end time.Time) ([]clickhouse.Kline, error) {
+	return clickhouse.GetKlines(tokenAddress, resolution, start, end)
+}
+
+// GetTokenKlineData 获取连续的K线数据，价格按 unit 换算，成交量按代币精度换算
+// 链上K线的原始价格为美元，游戏池K线的原始价格为 SOL
+func (s *KlineService) GetTokenKlineData(tokenAddress string, chainType uint8, source string, resolution clickhouse.KlineResolution, unit string, start, end time.Time) ([]response.KlineData, error) {
+	var klines []clickhouse.Kline
+	var err error
+	if source == KlineSourceGame {
+		klines, err = clickhouse.GetGameKlines(chainType, tokenAddress, resolution, start, end)
+	} else {
+		klines, err = clickhouse.GetKlines(tokenAddress, resolution, start, end)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(klines) == 0 {
+		return []response.KlineData{}, nil
+	}
+
+	tokenInfo, err := model.GetTokenInfoByAddress(tokenAddress, chainType)
+	if err != nil {
+		return nil, fmt.Errorf("获取代币信息失败: %w", err)
+	}
+	decimals := defaultKlineDecimals
+	if tokenInfo != nil {
+		decimals = tokenInfo.Decimals
+	}
+
+	if source == KlineSourceGame {
+		// 游戏池代币没有链上成交，按全部代币的 SOL 价格换算为美元
+		if unit != KlinePriceUnitSOL {
+			solPrices, err := klineSolPrices(klines, "", resolution, start, end)
+			if err != nil {
+				return nil, err
+			}
+			scaleKlines(klines, func(i int) decimal.Decimal { return solPrices[i] })
+		}
+	} else if unit == KlinePriceUnitSOL {
+		solPrices, err := klineSolPrices(klines, tokenAddress, resolution, start, end)
+		if err != nil {
+			return nil, err
+		}
+		scaleKlines(klines, func(i int) decimal.Decimal { return decimal.NewFromInt(1).Div(solPrices[i]) })
+	}
+
+	if unit == KlinePriceUnitMarketCap {
+		if tokenInfo == nil || tokenInfo.TotalSupply == 0 {
+			return nil, fmt.Errorf("%w: 代币 %s 缺少总量信息，无法计算市值，请使用 unit=usd", ErrKlineSupplyUnavailable, tokenAddress)
+		}
+		supply := decimal.NewFromInt(int64(tokenInfo.TotalSupply)).Shift(-int32(decimals))
+		scaleKlines(klines, func(int) decimal.Decimal { return supply })
+	}
+
+	return response.BuildKlineDataList(klines, decimals), nil
+}
+
+// klineSolPrices 返回每根K线所在周期的 SOL 美元价格，没有成交的周期沿用上一周期的 SOL 价格
+// tokenAddress 为空时使用全部代币的成交
+func klineSolPrices(klines []clickhouse.Kline, tokenAddress string, resolution clickhouse.KlineResolution, start, end time.Time) ([]decimal.Decimal, error) {
+	solPrices, err := clickhouse.GetKlineSolPrices(tokenAddress, resolution, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	// 区间开始前的空周期使用第一个有成交周期的 SOL 价格，仍没有时使用当前价格
+	current := decimal.Zero
+	for _, k := range klines {
+		if price, ok := solPrices[k.IntervalTimestamp.Unix()]; ok && price.IsPositive() {
+			current = price
+			break
+		}
+	}
+	if current.IsZero() {
+		if current, err = getSolPrice(); err != nil {
+			return nil, fmt.Errorf("获取 SOL 价格失败: %w", err)
+		}
+	}
+
+	prices := make([]decimal.Decimal, len(klines))
+	for i, k := range klines {
+		if price, ok := solPrices[k.IntervalTimestamp.Unix()]; ok && price.IsPositive() {
+			current = price
+		}
+		prices[i] = current
+	}
+	return prices, nil
+}
+
+// scaleKlines 将第 i 根K线的开高低收乘以 factor(i)
+func scaleKlines(klines []clickhouse.Kline, factor func(i int) decimal.Decimal) {
+	for i := range klines {
+		f := factor(i)
+		klines[i].OpenPrice = klines[i].OpenPrice.Mul(f)
+		klines[i].HighPrice = klines[i].HighPrice.Mul(f)
+		klines[i].LowPrice = klines[i].LowPrice.Mul(f)
+		klines[i].ClosePrice = klines[i].ClosePrice.Mul(f)
+	}
 }
 
-// GetLatestKline 获取最新的K线数据
-func (s *KlineService) GetLatestKline(tokenAddress string) (*clickhouse.Kline, error) {
-	return clickhouse.GetLatestKline(tokenAddress)
+// GetLatestKline 获取指定周期最新的K线数据
+func (s *KlineService) GetLatestKline(tokenAddress string, resolution clickhouse.KlineResolution) (*clickhouse.Kline, error) {
+	return clickhouse.GetLatestKline(tokenAddress, resolution)
 }
@@ -3,7 +3,9 @@ package service
 import (
 	"fmt"
 	"net/http"
+	"time"
 
+	"game-fun-be/internal/clickhouse"
 	"game-fun-be/internal/model"
 	"game-fun-be/internal/response"
 
@@ -55,3 +57,67 @@ func (s *PlatformTokenStatisticServiceImpl) GetTokenPointsStatistic(tokenAddress
 
 	return response.Success(platfromTokenStatisticResponse)
 }
+
+// platformStatisticIntervals 平台币统计时间序列支持的周期及未指定开始时间时的默认跨度
+var platformStatisticIntervals = map[string]struct {
+	Step, DefaultRange time.Duration
+}{
+	"1h": {Step: time.Hour, DefaultRange: 7 * 24 * time.Hour},
+	"1d": {Step: 24 * time.Hour, DefaultRange: 90 * 24 * time.Hour},
+}
+
+// maxPlatformStatisticPoints 单次查询的最大周期数
+const maxPlatformStatisticPoints = 1000
+
+// IsValidPlatformStatisticInterval 检查平台币统计时间序列的周期
+func IsValidPlatformStatisticInterval(interval string) bool {
+	_, ok := platformStatisticIntervals[interval]
+	return ok
+}
+
+// GetTokenPointsStatisticSeries 按周期返回平台币的手续费、回购、销毁和积分发放，由代理合约交易计算
+// end 为零时取当前时间，start 为零时按周期取默认跨度，周期按 UTC 对齐
+func (s *PlatformTokenStatisticServiceImpl) GetTokenPointsStatisticSeries(tokenAddress string, chainType uint8, interval string, start, end time.Time) response.Response {
+	spec, ok := platformStatisticIntervals[interval]
+	if !ok {
+		return response.Err(http.StatusBadRequest, "invalid interval", fmt.Errorf("unsupported interval: %s", interval))
+	}
+	if end.IsZero() {
+		end = time.Now()
+	}
+	if start.IsZero() {
+		start = end.Add(-spec.DefaultRange)
+	}
+	start = start.UTC().Truncate(spec.Step)
+	if !start.Before(end) {
+		return response.Err(http.StatusBadRequest, "start_time must be before end_time", nil)
+	}
+	if end.Sub(start) > spec.Step*maxPlatformStatisticPoints {
+		return response.Err(http.StatusBadRequest, fmt.Sprintf("time range exceeds %d intervals", maxPlatformStatisticPoints), nil)
+	}
+
+	buckets, err := clickhouse.GetPlatformFeeSeries(chainType, tokenAddress, int64(spec.Step/time.Second), start, end)
+	if err != nil {
+		return response.Err(http.StatusInternalServerError, "failed to get platform token statistic series", err)
+	}
+
+	seriesResponse := response.PlatformTokenStatisticSeriesResponse{
+		TokenAddress: tokenAddress,
+		Interval:     interval,
+		Series:       []response.PlatformTokenStatisticPoint{},
+	}
+	for _, b := range clickhouse.FillPlatformFeeGaps(buckets, spec.Step, start, end) {
+		seriesResponse.Series = append(seriesResponse.Series, response.PlatformTokenStatisticPoint{
+			Time:          b.Bucket.Unix(),
+			TradesCount:   b.TradesCount,
+			FeeAmount:     b.FeeUSD.Round(6).StringFixed(6),
+			FeeSol:        formatSol(b.FeeAmount),
+			BackAmount:    formatPoints(b.BackAmount),
+			BackSolAmount: b.BackSolUSD.Round(6).StringFixed(6),
+			BackSol:       formatSol(b.BackSolAmount),
+			BurnAmount:    formatPoints(b.BurnAmount),
+			PointsAmount:  formatPoints(b.PointsAmount),
+		})
+	}
+	return response.Success(seriesResponse)
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"game-fun-be/internal/clickhouse"
+	"game-fun-be/internal/model"
+
+	"github.com/shopspring/decimal"
+)
+
+// solDecimals SOL 精度，交易表中 base_token_amount 为 lamports
+const solDecimals = 9
+
+// TokenPnL 钱包在单个代币上的持仓成本和盈亏，金额单位为美元，数量已按精度换算
+// 成本按加权平均法计算：买入累加成本，卖出按当时的平均成本结转，差额计入已实现盈亏
+type TokenPnL struct {
+	TokenAddress    string
+	PoolAddress     string // 最后一笔成交的池子
+	Balance         decimal.Decimal
+	TotalBuy        decimal.Decimal
+	TotalSell       decimal.Decimal
+	TotalBuyNative  decimal.Decimal // 买入花费的 SOL
+	TotalSellNative decimal.Decimal // 卖出得到的 SOL
+	TotalBuyUSD     decimal.Decimal
+	TotalSellUSD    decimal.Decimal
+	CostBasis       decimal.Decimal // 剩余持仓的成本
+	AvgCost         decimal.Decimal // 剩余持仓的平均成本价
+	RealizedPnL     decimal.Decimal
+	UnrealizedPnL   decimal.Decimal
+	ROI             decimal.Decimal // (已实现 + 未实现) / 买入总额
+	Price           decimal.Decimal // 最新价格
+	Value           decimal.Decimal // 持仓市值
+	LastTradeTime   time.Time
+}
+
+// CalculateTokenPnL 按成交顺序计算单个代币的盈亏，trades 需为同一代币
+// 卖出数量超过持仓时（代币来自转账等非交易途径），超出部分按零成本计入已实现盈亏
+func CalculateTokenPnL(trades []clickhouse.WalletTrade, decimals uint8, price decimal.Decimal) TokenPnL {
+	pnl := TokenPnL{Price: price}
+	for _, t := range trades {
+		amount := decimal.NewFromUint64(t.QuoteTokenAmount).Shift(-int32(decimals))
+		native := decimal.NewFromUint64(t.BaseTokenAmount).Shift(-solDecimals)
+		pnl.TokenAddress = t.TokenAddress
+		pnl.PoolAddress = t.PoolAddress
+		pnl.LastTradeTime = t.TransactionTime
+
+		switch t.TransactionType {
+		case uint8(model.TransactionTypeBuy):
+			pnl.TotalBuy = pnl.TotalBuy.Add(amount)
+			pnl.TotalBuyNative = pnl.TotalBuyNative.Add(native)
+			pnl.TotalBuyUSD = pnl.TotalBuyUSD.Add(t.TransactionAmountUSD)
+			pnl.CostBasis = pnl.CostBasis.Add(t.TransactionAmountUSD)
+			pnl.Balance = pnl.Balance.Add(amount)
+		case uint8(model.TransactionTypeSell):
+			pnl.TotalSell = pnl.TotalSell.Add(amount)
+			pnl.TotalSellNative = pnl.TotalSellNative.Add(native)
+			pnl.TotalSellUSD = pnl.TotalSellUSD.Add(t.TransactionAmountUSD)
+
+			sold := decimal.Min(amount, pnl.Balance)
+			releasedCost := decimal.Zero
+			if pnl.Balance.IsPositive() {
+				releasedCost = pnl.CostBasis.Mul(sold).Div(pnl.Balance)
+			}
+			pnl.RealizedPnL = pnl.RealizedPnL.Add(t.TransactionAmountUSD.Sub(releasedCost))
+			pnl.CostBasis = pnl.CostBasis.Sub(releasedCost)
+			pnl.Balance = pnl.Balance.Sub(sold)
+		}
+	}
+
+	if pnl.Balance.IsPositive() {
+		pnl.AvgCost = pnl.CostBasis.Div(pnl.Balance)
+		pnl.Value = pnl.Balance.Mul(price)
+		pnl.UnrealizedPnL = pnl.Value.Sub(pnl.CostBasis)
+	}
+	if pnl.TotalBuyUSD.IsPositive() {
+		pnl.ROI = pnl.RealizedPnL.Add(pnl.UnrealizedPnL).Div(pnl.TotalBuyUSD)
+	}
+	return pnl
+}
+
+// GetWalletPnL 计算钱包在代币上的盈亏，tokenAddresses 为空时计算最近交易的 clickhouse.WalletTradesMaxTokens 个代币并按最后成交时间倒序，
+// 否则按 tokenAddresses 的顺序返回，没有链上买卖的代币盈亏为零；成交数超过上限时返回 clickhouse.ErrTooManyWalletTrades
+// 返回代币信息用于填充名称、符号等展示字段，代币信息缺失时按默认精度计算
+func GetWalletPnL(chainType uint8, walletAddress string, tokenAddresses []string) ([]TokenPnL, map[string]model.TokenInfo, error) {
+	trades, err := clickhouse.GetWalletTrades(chainType, walletAddress, tokenAddresses)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 交易已按代币排序，切分为每个代币的成交序列
+	tokens := tokenAddresses
+	groups := make(map[string][]clickhouse.WalletTrade)
+	for i, t := range trades {
+		if len(tokenAddresses) == 0 && (i == 0 || trades[i-1].TokenAddress != t.TokenAddress) {
+			tokens = append(tokens, t.TokenAddress)
+		}
+		groups[t.TokenAddress] = append(groups[t.TokenAddress], t)
+	}
+	if len(tokens) == 0 {
+		return []TokenPnL{}, map[string]model.TokenInfo{}, nil
+	}
+
+	infos, err := model.GetTokenInfoByAddresses(tokens, chainType)
+	if err != nil {
+		return nil, nil, fmt.Errorf("获取代币信息失败: %w", err)
+	}
+	infoMap := make(map[string]model.TokenInfo, len(infos))
+	for _, info := range infos {
+		infoMap[info.TokenAddress] = info
+	}
+
+	prices, err := clickhouse.GetLatestTokenPrices(tokens)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result := make([]TokenPnL, 0, len(tokens))
+	for _, token := range tokens {
+		decimals := defaultKlineDecimals
+		if info, ok := infoMap[token]; ok {
+			decimals = info.Decimals
+		}
+		pnl := CalculateTokenPnL(groups[token], decimals, prices[token])
+		pnl.TokenAddress = token
+		result = append(result, pnl)
+	}
+	if len(tokenAddresses) == 0 {
+		sort.SliceStable(result, func(i, j int) bool {
+			return result[i].LastTradeTime.After(result[j].LastTradeTime)
+		})
+	}
+	return result, infoMap, nil
+}
@@ -14,6 +14,7 @@ import (
 
 	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type PointsServiceImpl struct {
@@ -147,6 +148,57 @@ func (s *PointsServiceImpl) CreatePointRecord(wallet_address string, point uint6
 	})
 }
 
+// SettlePointTx 记录积分兑换交易的链上终态
+// 成功或待人工核对时只更新兑换记录的状态；失败或超时未确认时退还积分并写入退款记录，
+// 同一笔交易已存在退款记录时直接返回，保证重复结算不会重复退款
+func (s *PointsServiceImpl) SettlePointTx(userID uint, points uint64, signature string, status model.PointTxStatus) error {
+	if status == model.PointTxStatusSuccess || status == model.PointTxStatusReview {
+		if _, err := s.pointRecordsRecord.UpdateTxStatusByHash(userID, signature, model.BuyG, status); err != nil {
+			return fmt.Errorf("failed to update tx status for %s: %w", signature, err)
+		}
+		return nil
+	}
+
+	return model.DB.Transaction(func(tx *gorm.DB) error {
+		// 锁定用户行，避免发送失败的回滚与状态检测并发退款
+		var user model.UserInfo
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id", "available_points").Where("id = ?", userID).First(&user).Error; err != nil {
+			return fmt.Errorf("failed to lock user %d: %w", userID, err)
+		}
+
+		recordsRepo := s.pointRecordsRecord.WithTx(tx)
+		refund, err := recordsRepo.GetPointRecordByHash(userID, signature, model.RefundG)
+		if err != nil {
+			return fmt.Errorf("failed to query refund record for %s: %w", signature, err)
+		}
+		if refund != nil {
+			util.Log().Info("Points for transaction %s already refunded to user %d, skip", signature, userID)
+			return nil
+		}
+
+		if err := s.userInfoRepo.WithTx(tx).IncrementAvailablePointsByUserID(userID, points); err != nil {
+			return fmt.Errorf("failed to restore points: %w", err)
+		}
+
+		if err := recordsRepo.CreatePointRecord(&model.PointRecords{
+			UserID:          userID,
+			PointsChange:    points,
+			PointsBalance:   user.AvailablePoints + points,
+			RecordType:      int8(model.RefundG),
+			TransactionHash: signature,
+			TxStatus:        int8(status),
+		}); err != nil {
+			return fmt.Errorf("failed to create refund record: %w", err)
+		}
+
+		if _, err := recordsRepo.UpdateTxStatusByHash(userID, signature, model.BuyG, status); err != nil {
+			return fmt.Errorf("failed to update tx status for %s: %w", signature, err)
+		}
+		return nil
+	})
+}
+
 func (s *PointsServiceImpl) InvitedPointsDetail(userID uint64, cursor *uint, limit int, chainType model.ChainType) response.Response {
 	// 获取用户信息
 	users, new_curs, has_more, err := s.userInfoRepo.GetUsersByInviterId(userID, cursor, limit)
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"game-fun-be/internal/constants"
+	"game-fun-be/internal/model"
+	"game-fun-be/internal/pkg/util"
+	"game-fun-be/internal/redis"
+
+	"github.com/shopspring/decimal"
+)
+
+// GetLatestPumpCurveParams 获取最新的联合曲线参数，优先读取缓存，未记录过 set-params 时使用默认值
+func GetLatestPumpCurveParams() *model.PumpCurveParams {
+	if cached, err := redis.Get(constants.RedisKeyPumpCurveParams); err == nil && cached != "" {
+		var params model.PumpCurveParams
+		if err := json.Unmarshal([]byte(cached), &params); err == nil {
+			return &params
+		}
+	}
+
+	params, err := model.GetLatestPumpCurveParams()
+	if err != nil {
+		util.Log().Error("Failed to get latest pump curve params: %v", err)
+		return model.DefaultPumpCurveParams()
+	}
+	if params == nil {
+		params = model.DefaultPumpCurveParams()
+	}
+
+	if data, err := json.Marshal(params); err == nil {
+		if err := redis.Set(constants.RedisKeyPumpCurveParams, string(data), 10*time.Minute); err != nil {
+			util.Log().Error("Failed to cache pump curve params: %v", err)
+		}
+	}
+	return params
+}
+
+// GetPumpCurveParamsAtBlock 获取在指定区块生效的联合曲线参数，用于处理参数变更前创建的代币
+func GetPumpCurveParamsAtBlock(block uint64) *model.PumpCurveParams {
+	latest := GetLatestPumpCurveParams()
+	if block == 0 || block >= latest.Block {
+		return latest
+	}
+
+	params, err := model.GetPumpCurveParamsAtBlock(block)
+	if err != nil {
+		util.Log().Error("Failed to get pump curve params at block %d: %v", block, err)
+		return latest
+	}
+	if params == nil {
+		return model.DefaultPumpCurveParams()
+	}
+	return params
+}
+
+// SavePumpCurveParamsFromMessage 保存 set-params 消息中的曲线参数并清除缓存
+func SavePumpCurveParamsFromMessage(msg *model.PumpSetParamsMessage) (*model.PumpCurveParams, error) {
+	params := &model.PumpCurveParams{
+		FeeRecipient:    msg.FeeRecipient,
+		TransactionHash: msg.Signature,
+		Block:           msg.Block,
+		TransactionTime: time.Unix(msg.Timestamp, 0),
+	}
+
+	fields := []struct {
+		name  string
+		value string
+		dest  *uint64
+	}{
+		{"initialVirtualTokenReserves", msg.InitialVirtualTokenReserves, &params.InitialVirtualTokenReserves},
+		{"initialVirtualSolReserves", msg.InitialVirtualSolReserves, &params.InitialVirtualSolReserves},
+		{"initialRealTokenReserves", msg.InitialRealTokenReserves, &params.InitialRealTokenReserves},
+		{"tokenTotalSupply", msg.TokenTotalSupply, &params.TokenTotalSupply},
+		{"feeBasisPoints", msg.FeeBasisPoints, &params.FeeBasisPoints},
+	}
+	for _, field := range fields {
+		value, err := strconv.ParseUint(field.value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %w", field.name, field.value, err)
+		}
+		*field.dest = value
+	}
+
+	if err := model.SavePumpCurveParams(params); err != nil {
+		return nil, fmt.Errorf("failed to save pump curve params: %w", err)
+	}
+	if err := redis.Del(constants.RedisKeyPumpCurveParams); err != nil {
+		util.Log().Error("Failed to delete pump curve params cache: %v", err)
+	}
+	return params, nil
+}
+
+// PumpCurveProgress 根据剩余实际代币储备计算联合曲线进度（0-100）
+func PumpCurveProgress(params *model.PumpCurveParams, realTokenReserves uint64) decimal.Decimal {
+	if params.InitialRealTokenReserves == 0 {
+		return decimal.Zero
+	}
+	if realTokenReserves >= params.InitialRealTokenReserves {
+		return decimal.Zero
+	}
+	sold := decimal.NewFromInt(int64(params.InitialRealTokenReserves - realTokenReserves))
+	progress := sold.Mul(decimal.NewFromInt(100)).Div(decimal.NewFromInt(int64(params.InitialRealTokenReserves)))
+	return progress.Round(2)
+}
@@ -22,19 +22,22 @@ import (
 	"strconv"
 	"time"
 
-	"github.com/IBM/sarama"
 	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
 )
 
+// MessageSender 发送消息到指定 topic，由 kafka 包提供，service 不依赖具体的 Kafka 客户端
+type MessageSender func(topic string, message []byte) error
+
 type SwapServiceImpl struct {
 	userInfoRepo      *model.UserInfoRepo
 	pointsServiceImpl *PointsServiceImpl
-	kafka             sarama.SyncProducer
+	sendMessage       MessageSender
 }
 
-func NewSwapService(producer sarama.SyncProducer) *SwapServiceImpl {
+func NewSwapService(sendMessage MessageSender) *SwapServiceImpl {
 	return &SwapServiceImpl{
-		kafka: producer,
+		sendMessage: sendMessage,
 	}
 }
 
@@ -333,6 +336,7 @@ func (s *SwapServiceImpl) buildBuyGWithPointsStruct(req request.SwapRouteRequest
 }
 
 func (s *SwapServiceImpl) buildSwapPumpStruct(req request.SwapRouteRequest, tokenDetail *model.TokenInfo, poolDetail *model.TokenLiquidityPool, mev bool, jitotip string) httpRequest.SwapPumpStruct {
+	params := GetPumpCurveParamsAtBlock(tokenDetail.Block)
 	return httpRequest.SwapPumpStruct{
 		FromAddress:                 req.FromAddress,
 		InAmount:                    req.InAmount,
@@ -343,9 +347,9 @@ func (s *SwapServiceImpl) buildSwapPumpStruct(req request.SwapRouteRequest, toke
 		TokenTotalSupply:            strconv.FormatUint(tokenDetail.CirculatingSupply, 10),
 		VirtualSolReserves:          strconv.FormatUint(poolDetail.PoolPcReserve, 10),
 		VirtualTokenReserves:        strconv.FormatUint(poolDetail.PoolCoinReserve, 10),
-		InitialRealTokenReserves:    model.PUMP_INITIAL_REAL_TOKEN_RESERVES,
-		InitialVirtualSolReserves:   model.PUMP_INITIAL_VIRTUAL_SOL_RESERVES,
-		InitialVirtualTokenReserves: model.PUMP_INITIAL_VIRTUAL_TOKEN_RESERVES,
+		InitialRealTokenReserves:    strconv.FormatUint(params.InitialRealTokenReserves, 10),
+		InitialVirtualSolReserves:   strconv.FormatUint(params.InitialVirtualSolReserves, 10),
+		InitialVirtualTokenReserves: strconv.FormatUint(params.InitialVirtualTokenReserves, 10),
 		Mev:                         mev,
 		Jitotip:                     jitotip,
 	}
@@ -536,7 +540,15 @@ func (s *SwapServiceImpl) SendTransaction(userID string, userAddress string, swa
 		return response.Err(http.StatusInternalServerError, "Invalid user ID", err)
 	}
 	points := uint64(0)
+	var signature string
+	var outbox *model.KafkaOutbox
 	if swapRequest.PlatformType == "g_points" {
+		// 交易签名在发送前即可从已签名交易中得到，用于提前写入状态检测消息
+		signature, err = SignatureFromSignedTransaction(swapRequest.SwapTransaction)
+		if err != nil {
+			util.Log().Error("Failed to decode signed transaction: %v", err)
+			return response.Err(http.StatusBadRequest, "Invalid signed transaction", err)
+		}
 		SwapGPointsKey := GetRedisKey(constants.SwapGPoints, userAddress, swapRequest.StartTime)
 		redisValue, err := redis.Get(SwapGPointsKey)
 		if err != nil {
@@ -559,15 +571,15 @@ func (s *SwapServiceImpl) SendTransaction(userID string, userAddress string, swa
 		if points > userInfo.AvailablePoints {
 			return response.Err(http.StatusInternalServerError, "Your available points are insufficient, transaction failed!", err)
 		}
-		isTrue, err := s.userInfoRepo.DeductPointsWithOptimisticLock(userIDUint64, points)
+		outbox, err = DeductPointsWithOutbox(userIDUint64, points, signature)
+		if errors.Is(err, ErrPointsDeductConflict) {
+			util.Log().Error("Optimistic lock failed, points deduction unsuccessful for user: %d", userIDUint64)
+			return response.Err(http.StatusConflict, "Points deduction failed due to concurrent update, please try again", nil)
+		}
 		if err != nil {
 			util.Log().Error("Failed to deduct points with optimistic lock: %v", err)
 			return response.Err(http.StatusInternalServerError, "Failed to deduct points, please try again later", err)
 		}
-		if !isTrue {
-			util.Log().Error("Optimistic lock failed, points deduction unsuccessful for user: %d", userIDUint64)
-			return response.Err(http.StatusConflict, "Points deduction failed due to concurrent update, please try again", nil)
-		}
 		isUsePoint = true
 	}
 
@@ -575,58 +587,96 @@ func (s *SwapServiceImpl) SendTransaction(userID string, userAddress string, swa
 
 	if err != nil || resp == nil || resp.Code != 2000 {
 		if swapRequest.PlatformType == "g_points" {
-			// 交易发送失败，恢复用户积分
-			userInfoRepo := model.NewUserInfoRepo()
-			if err := userInfoRepo.IncrementAvailablePointsByUserID(uint(userIDUint64), points); err != nil {
+			// 交易发送失败，取消状态检测消息并恢复用户积分
+			if err := RollbackPointsDeduction(userIDUint64, points, signature, outbox.ID); err != nil {
 				util.Log().Error("Failed to restore points for user %d after transaction %s failed: %v",
-					userIDUint64, swapRequest.SwapTransaction, err)
+					userIDUint64, signature, err)
 				return response.Err(http.StatusInternalServerError, "Failed to restore points, please try again later", err)
 			}
 			util.Log().Info("Transaction %s failed, restored %d points to user %d",
-				swapRequest.SwapTransaction, points, userIDUint64)
+				signature, points, userIDUint64)
 		}
 		return response.Err(http.StatusInternalServerError, "Failed to get send transaction", err)
 	}
 	if swapRequest.PlatformType == "g_points" {
-		// 交易发送成功，发送Kafka积分交易检测消息
-		pointTxStatusMsg := model.PointTxStatusMessage{
-			Signature: resp.Data.Signature,
-			UserId:    uint(userIDUint64),
-			Points:    points,
-			TxType:    1,
+		// 交易发送成功，立即投递积分交易检测消息
+		if resp.Data.Signature != signature {
+			util.Log().Warning("Sent transaction signature %s differs from decoded signature %s", resp.Data.Signature, signature)
 		}
-
-		msgBytes, err := json.Marshal(pointTxStatusMsg)
-		if err != nil {
-			util.Log().Error("Failed to marshal point transaction status message: %v", err)
+		if err := model.NewKafkaOutboxRepo().Release(outbox.ID); err != nil {
+			util.Log().Error("Failed to release outbox message %d, it will be sent after the hold period: %v", outbox.ID, err)
 		} else {
-			// 发送消息到Kafka
-			var topic string
-			if conf.IsTest() {
-				topic = "market.point.tx.status.test"
-			} else {
-				topic = "market.point.tx.status.prod"
-			}
-			if err := s.SendMessage(topic, msgBytes); err != nil {
-				util.Log().Error("Failed to send point transaction status message to Kafka: %v", err)
-			} else {
-				util.Log().Info("Sent point transaction status check message for transaction %s, user %d, points %d",
-					swapRequest.SwapTransaction, uint(userIDUint64), points)
-			}
+			util.Log().Info("Released point transaction status check message for transaction %s, user %d, points %d",
+				signature, uint(userIDUint64), points)
 		}
 	}
 	return response.Success(resp.Data)
 }
 
+// ErrPointsDeductConflict 扣减积分时积分不足或被并发修改
+var ErrPointsDeductConflict = errors.New("points deduction conflict")
+
+// DeductPointsWithOutbox 在同一事务中扣减积分并写入积分交易检测消息
+// 消息先按 KAFKA_OUTBOX_HOLD（秒，默认 60）延迟投递，交易发送成功后立即放行、失败则取消；
+// 进程在此期间退出时由 relay 到期投递，状态检测负责最终退款
+func DeductPointsWithOutbox(userID uint64, points uint64, signature string) (*model.KafkaOutbox, error) {
+	msgBytes, err := json.Marshal(model.PointTxStatusMessage{
+		Signature: signature,
+		UserId:    uint(userID),
+		Points:    points,
+		TxType:    1,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal point transaction status message: %w", err)
+	}
+
+	outbox := &model.KafkaOutbox{
+		Topic:       pointTxStatusTopic(),
+		MessageKey:  signature,
+		Payload:     string(msgBytes),
+		Status:      int8(model.OutboxStatusPending),
+		AvailableAt: time.Now().Add(util.GetEnvAsDuration("KAFKA_OUTBOX_HOLD", 60*time.Second)),
+	}
+	err = model.DB.Transaction(func(tx *gorm.DB) error {
+		ok, err := model.NewUserInfoRepo().WithTx(tx).DeductPointsWithOptimisticLock(userID, points)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrPointsDeductConflict
+		}
+		return model.NewKafkaOutboxRepo().WithTx(tx).Create(outbox)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return outbox, nil
+}
+
+// RollbackPointsDeduction 交易发送失败时取消状态检测消息并退还积分
+// 取消失败只记录日志，消息到期投递后由状态检测按已退款处理
+func RollbackPointsDeduction(userID uint64, points uint64, signature string, outboxID uint64) error {
+	if _, err := model.NewKafkaOutboxRepo().Cancel(outboxID); err != nil {
+		util.Log().Error("Failed to cancel outbox message %d for transaction %s: %v", outboxID, signature, err)
+	}
+	pointsService := NewPointsServiceImpl(model.NewUserInfoRepo(), model.NewPointRecordsRepo(), model.NewPlatformTokenStatisticRepo())
+	return pointsService.SettlePointTx(uint(userID), points, signature, model.PointTxStatusFailed)
+}
+
+// pointTxStatusTopic 积分交易状态检测 topic
+func pointTxStatusTopic() string {
+	if conf.IsTest() {
+		return "market.point.tx.status.test"
+	}
+	return "market.point.tx.status.prod"
+}
+
 // SendMessage 发送消息到指定的 topic
 func (s *SwapServiceImpl) SendMessage(topic string, message []byte) error {
-	msg := &sarama.ProducerMessage{
-		Topic: topic,
-		Value: sarama.ByteEncoder(message),
+	if s.sendMessage == nil {
+		return fmt.Errorf("kafka producer is not initialized")
 	}
-
-	_, _, err := s.kafka.SendMessage(msg)
-	return err
+	return s.sendMessage(topic, message)
 }
 
 func (s *SwapServiceImpl) GetSwapStatusBySignature(swapTransaction string) response.Response {
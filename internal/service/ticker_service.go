@@ -16,7 +16,6 @@ import (
 	"game-fun-be/internal/response"
 
 	"log"
-	"math"
 	"net/http"
 	"reflect"
 	"strconv"
@@ -191,9 +190,10 @@ func (s *TickerServiceImpl) MarketTicker(tokenAddress string, chainType model.Ch
 	}
 
 	tokenHolders := 0
-	tradeDataResponse, err := GetMarketData(tokenAddress, chainType.ToString())
-	if err == nil {
-		tokenHolders = tradeDataResponse.Data.Holder
+	if stats, err := clickhouse.GetHolderStats(chainType.Uint8(), tokenAddress, ""); err == nil {
+		tokenHolders = int(stats.Holders)
+	} else {
+		util.Log().Error("Failed to get holder stats: %v", err)
 	}
 
 	buyVolume1m := decimal.NewFromInt(0)
@@ -486,39 +486,29 @@ func (s *TickerServiceImpl) TokenDistribution(tokenAddress string, chainType mod
 		}
 	}
 
-	tokenMarketDataRes, err := GetOrFetchTokenMarketData(tokenAddress, chainType.ToString())
+	tokenInfo, err := s.tokenInfoRepo.GetTokenInfoByAddress(tokenAddress, chainType.Uint8())
 	if err != nil {
-		return response.Err(http.StatusInternalServerError, "Failed to get token market data", err)
+		return response.Err(http.StatusInternalServerError, "Failed to get token info", err)
+	}
+	if tokenInfo == nil {
+		return response.Err(http.StatusNotFound, "Token not found", nil)
 	}
 
-	CirculatingSupply := tokenMarketDataRes.Data.CirculatingSupply
-
-	tokenHoldersRes, err := httpUtil.GetTokenHolders(tokenAddress, 0, 20, chainType.ToString())
+	// 持仓余额由自有交易流累加得到，不再调用 Birdeye
+	holders, err := clickhouse.GetTopHolders(chainType.Uint8(), tokenAddress, 20)
 	if err != nil {
 		return response.Err(http.StatusInternalServerError, "Failed to get token holders", err)
 	}
-	if !tokenHoldersRes.Success {
-		return response.Err(http.StatusInternalServerError, "Failed to fetch token holders data", nil)
-	}
-	if len(tokenHoldersRes.Data.Items) == 0 {
-		return response.Success("No token holders found")
-	}
-	var tokenHolders []response.TokenHolder
-	for _, holder := range tokenHoldersRes.Data.Items {
+	tokenHolders := make([]response.TokenHolder, 0, len(holders))
+	for _, holder := range holders {
 		var tokenHolder response.TokenHolder
-		tokenHolder.Account = holder.Owner
-		amount, err := strconv.ParseFloat(holder.Amount, 64)
-		if err != nil {
-			log.Printf("Failed to parse amount for holder %s: %v\n", holder.Owner, err)
-			continue
-		}
-		percentage := (amount / math.Pow(10, float64(holder.Decimals))) / CirculatingSupply * 100
-
-		tokenHolder.Percentage = strconv.FormatFloat(percentage, 'f', 2, 64)
+		tokenHolder.Account = holder.UserAddress
+		tokenHolder.Percentage = strconv.FormatFloat(holderPercentage(holder.Balance, tokenInfo.TotalSupply), 'f', 2, 64)
+		// 曲线持仓在池子储备中，不会以池子地址出现在交易流持仓里
 		tokenHolder.IsAssociatedBondingCurve = false
 		tokenHolder.UserProfile = nil
-		tokenHolder.Amount = holder.Amount
-		tokenHolder.UIAmount = holder.UIAmount
+		tokenHolder.Amount = holder.Balance.String()
+		tokenHolder.UIAmount, _ = holder.Balance.Shift(-int32(tokenInfo.Decimals)).Float64()
 		var moderator response.Moderator
 		moderator.BannedModID = 0
 		moderator.Status = "NORMAL"
@@ -530,7 +520,7 @@ func (s *TickerServiceImpl) TokenDistribution(tokenAddress string, chainType mod
 	}
 	tokenDistributionResponse.TokenHolders = tokenHolders
 
-	if err := redis.Set(redisKey, tokenDistributionResponse, 10*time.Minute); err != nil {
+	if err := redis.Set(redisKey, tokenDistributionResponse, time.Minute); err != nil {
 		log.Printf("Failed to set data in Redis: %v\n", err)
 	}
 	return response.Success(tokenDistributionResponse)
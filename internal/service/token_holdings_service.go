@@ -1,8 +1,15 @@
 package service
 
 import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"game-fun-be/internal/clickhouse"
 	"game-fun-be/internal/model"
 	"game-fun-be/internal/response"
+
+	"github.com/shopspring/decimal"
 )
 
 type TokenHoldingsServiceImpl struct{}
@@ -11,12 +18,161 @@ func NewTokenHoldingsServiceImpl() *TokenHoldingsServiceImpl {
 	return &TokenHoldingsServiceImpl{}
 }
 
+// TokenHoldings 返回目标账户的持仓及盈亏，allowZeroBalance 为 true 时包含已清仓的代币
 func (s *TokenHoldingsServiceImpl) TokenHoldings(userAccount, targetAccount, allowZeroBalance string, chainType model.ChainType) response.Response {
-	var tokenHoldingsResponse response.TokenHoldingsResponse
+	positions, infos, err := GetWalletPnL(chainType.Uint8(), targetAccount, nil)
+	if errors.Is(err, clickhouse.ErrTooManyWalletTrades) {
+		return response.Err(http.StatusBadRequest, "Too many trades to calculate token holdings", err)
+	}
+	if err != nil {
+		return response.Err(http.StatusInternalServerError, "Failed to calculate token holdings", err)
+	}
+
+	includeZero := allowZeroBalance == "true"
+	tokenHoldingsResponse := response.TokenHoldingsResponse{TokenHoldings: []response.TokenHolding{}}
+	for _, p := range positions {
+		if !includeZero && !p.Balance.IsPositive() {
+			continue
+		}
+		info := infos[p.TokenAddress]
+		tokenHoldingsResponse.TokenHoldings = append(tokenHoldingsResponse.TokenHoldings, response.TokenHolding{
+			TokenAddress:    p.TokenAddress,
+			TokenName:       info.TokenName,
+			Symbol:          info.Symbol,
+			Price:           p.Price.String(),
+			ImageURI:        info.URI,
+			Balance:         p.Balance.String(),
+			TotalValue:      p.Value.String(),
+			ID:              int(info.ID),
+			HoldersCount:    info.Holder,
+			FilledPrice:     p.AvgCost.String(),
+			RealizedPNL:     p.RealizedPnL.String(),
+			UnrealizedPNL:   p.UnrealizedPnL.String(),
+			ROI:             p.ROI.String(),
+			MarketAddress:   p.PoolAddress,
+			TotalBuy:        p.TotalBuy.String(),
+			TotalBuyNative:  p.TotalBuyNative.String(),
+			TotalSell:       p.TotalSell.String(),
+			TotalSellNative: p.TotalSellNative.String(),
+		})
+	}
 	return response.Success(tokenHoldingsResponse)
 }
 
+// TokenHoldingsHistories 返回账户交易过的代币及盈亏，按钱包动态中的最后成交时间倒序分页，page 从 1 开始
 func (s *TokenHoldingsServiceImpl) TokenHoldingsHistories(userAccount, page, limit string, chainType model.ChainType) response.Response {
-	var tokenHoldingHistoriesResponse response.TokenHoldingHistoriesResponse
+	pageNum, err := strconv.Atoi(page)
+	if err != nil || pageNum < 0 {
+		return response.Err(http.StatusBadRequest, "Invalid page parameter", err)
+	}
+	if pageNum == 0 {
+		pageNum = 1
+	}
+	limitNum, err := strconv.Atoi(limit)
+	if err != nil || limitNum <= 0 {
+		return response.Err(http.StatusBadRequest, "Invalid limit parameter", err)
+	}
+
+	tokens, hasMore, err := clickhouse.GetWalletActivityTokens(chainType.Uint8(), userAccount, clickhouse.WalletActivityFilter{}, (pageNum-1)*limitNum, limitNum)
+	if err != nil {
+		return response.Err(http.StatusInternalServerError, "Failed to get wallet activity tokens", err)
+	}
+
+	tokenHoldingHistoriesResponse := response.TokenHoldingHistoriesResponse{TokenHoldingsHistories: []response.TokenHoldingHistory{}, HasMore: hasMore}
+	if len(tokens) == 0 {
+		return response.Success(tokenHoldingHistoriesResponse)
+	}
+
+	positions, infos, err := GetWalletPnL(chainType.Uint8(), userAccount, tokens)
+	if errors.Is(err, clickhouse.ErrTooManyWalletTrades) {
+		return response.Err(http.StatusBadRequest, "Too many trades, use a smaller limit", err)
+	}
+	if err != nil {
+		return response.Err(http.StatusInternalServerError, "Failed to calculate token holding histories", err)
+	}
+
+	for _, p := range positions {
+		info := infos[p.TokenAddress]
+		tokenHoldingHistoriesResponse.TokenHoldingsHistories = append(tokenHoldingHistoriesResponse.TokenHoldingsHistories, response.TokenHoldingHistory{
+			TokenAddress:    p.TokenAddress,
+			TokenName:       info.TokenName,
+			Symbol:          info.Symbol,
+			Price:           p.Price.String(),
+			ImageURI:        info.URI,
+			Balance:         p.Balance.String(),
+			TotalValue:      p.Value.String(),
+			ID:              int(info.ID),
+			HoldersCount:    info.Holder,
+			FilledPrice:     p.AvgCost.String(),
+			RealizedPNL:     p.RealizedPnL.String(),
+			UnrealizedPNL:   p.UnrealizedPnL.String(),
+			ROI:             p.ROI.String(),
+			MarketAddress:   p.PoolAddress,
+			TotalBuy:        p.TotalBuy.String(),
+			TotalBuyNative:  p.TotalBuyNative.String(),
+			TotalSell:       p.TotalSell.String(),
+			TotalSellNative: p.TotalSellNative.String(),
+		})
+	}
 	return response.Success(tokenHoldingHistoriesResponse)
 }
+
+// WalletActivities 返回钱包在全部代币上的买卖，按成交时间倒序游标分页
+func (s *TokenHoldingsServiceImpl) WalletActivities(account string, chainType model.ChainType, filter clickhouse.WalletActivityFilter, cursor *clickhouse.WalletActivityCursor, limit int) response.Response {
+	activities, next, err := clickhouse.GetWalletActivities(chainType.Uint8(), account, filter, cursor, limit)
+	if err != nil {
+		return response.Err(http.StatusInternalServerError, "Failed to get wallet activities", err)
+	}
+
+	walletActivitiesResponse := response.WalletActivitiesResponse{Activities: []response.WalletActivity{}}
+	if next != nil {
+		walletActivitiesResponse.NextCursor = next.Encode()
+		walletActivitiesResponse.HasMore = true
+	}
+	if len(activities) == 0 {
+		return response.Success(walletActivitiesResponse)
+	}
+
+	tokens := make([]string, 0, len(activities))
+	for _, a := range activities {
+		tokens = append(tokens, a.TokenAddress)
+	}
+	infos, err := model.GetTokenInfoByAddresses(tokens, chainType.Uint8())
+	if err != nil {
+		return response.Err(http.StatusInternalServerError, "Failed to get token info", err)
+	}
+	infoMap := make(map[string]model.TokenInfo, len(infos))
+	for _, info := range infos {
+		infoMap[info.TokenAddress] = info
+	}
+
+	for _, a := range activities {
+		info := infoMap[a.TokenAddress]
+		tradeType := a.TransactionType
+		if a.IsBuyback {
+			tradeType = 3
+		}
+		tokenAmount := decimal.NewFromUint64(a.QuoteTokenAmount).Shift(-int32(a.Decimals))
+		// 代理交易未记录成交价，按成交金额和数量折算
+		price := a.QuoteTokenPrice
+		if price.IsZero() && tokenAmount.IsPositive() {
+			price = a.AmountUSD.Div(tokenAmount)
+		}
+		walletActivitiesResponse.Activities = append(walletActivitiesResponse.Activities, response.WalletActivity{
+			Signature:    a.TransactionHash,
+			TokenAddress: a.TokenAddress,
+			TokenName:    info.TokenName,
+			Symbol:       info.Symbol,
+			ImageURI:     info.URI,
+			PoolAddress:  a.PoolAddress,
+			Platform:     a.Platform,
+			TradeType:    tradeType,
+			TokenAmount:  tokenAmount.String(),
+			NativeAmount: decimal.NewFromUint64(a.BaseTokenAmount).Shift(-solDecimals).String(),
+			TokenPrice:   price.String(),
+			AmountUSD:    a.AmountUSD.String(),
+			BlockTime:    a.TransactionTime.Unix(),
+		})
+	}
+	return response.Success(walletActivitiesResponse)
+}
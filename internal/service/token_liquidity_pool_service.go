@@ -207,12 +207,16 @@ func (service *TokenLiquidityPoolService) CreatePumpFunInitialPool(msg *model.To
 	pool.PoolAddress = msg.BondingCurve            // 池子地址
 	pool.UserAddress = msg.Creator                 // 创建者地址
 
-	// 从 bondingCurve 计算初始流动性
+	// 按创建时生效的曲线参数计算初始流动性
+	params := GetPumpCurveParamsAtBlock(msg.Block)
 	initialPcReserve, _ := decimal.NewFromString(model.PUMP_INITIAL_REALSOL_TOKEN_RESERVES)
-	initialCoinReserve, _ := decimal.NewFromString(model.PUMP_INITIAL_VIRTUAL_TOKEN_RESERVES)
 	// 设置代币储备量
 	pool.InitialPcReserve = uint64(initialPcReserve.IntPart())
-	pool.InitialCoinReserve = uint64(initialCoinReserve.IntPart())
+	pool.InitialCoinReserve = params.InitialVirtualTokenReserves
+	pool.PoolPcReserve = params.InitialVirtualSolReserves
+	pool.PoolCoinReserve = params.InitialVirtualTokenReserves
+	pool.RealNativeReserves = pool.InitialPcReserve
+	pool.RealTokenReserves = params.InitialRealTokenReserves
 
 	// 设置区块信息
 	pool.BlockTime = time.Unix(msg.Timestamp, 0)
@@ -167,7 +167,7 @@ func (service *TokenInfoService) ConvertMessageToTokenInfo(msg *model.TokenInfoM
 
 	// 设置代币相关数值
 	tokenInfo.Decimals = model.CreatedPlatformType(tokenInfo.CreatedPlatformType).GetDecimals()
-	tokenInfo.TotalSupply = uint64(decimal.NewFromInt(1000000000000000).IntPart())
+	tokenInfo.TotalSupply = GetPumpCurveParamsAtBlock(msg.Block).TokenTotalSupply
 	tokenInfo.CirculatingSupply = tokenInfo.TotalSupply
 
 	// 设置交易相关信息
@@ -396,10 +396,20 @@ func (service *TokenTransactionService) ProcessBatchTokenTransactionCreation(txs
 }
 
 // ConvertTradeMessagesToTransactions 将 TokenTradeMessage 列表转换为 TokenTransaction 列表
+// 消息未携带进度时按交易所在区块生效的曲线参数由剩余实际代币储备计算
 func (service *TokenTransactionService) ConvertTradeMessagesToTransactions(messages []*model.TokenTradeMessage) []*model.TokenTransaction {
 	transactions := make([]*model.TokenTransaction, 0, len(messages))
+	paramsByBlock := make(map[uint64]*model.PumpCurveParams)
 	for _, msg := range messages {
 		tx := service.ConvertTradeMessageToTransaction(msg)
+		if tx.Progress.IsZero() {
+			params, ok := paramsByBlock[msg.Block]
+			if !ok {
+				params = GetPumpCurveParamsAtBlock(msg.Block)
+				paramsByBlock[msg.Block] = params
+			}
+			tx.Progress = PumpCurveProgress(params, tx.RealTokenReserves)
+		}
 		transactions = append(transactions, tx)
 	}
 	return transactions
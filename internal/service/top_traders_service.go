@@ -0,0 +1,86 @@
+package service
+
+import (
+	"net/http"
+	"time"
+
+	"game-fun-be/internal/clickhouse"
+	"game-fun-be/internal/model"
+	"game-fun-be/internal/response"
+
+	"github.com/shopspring/decimal"
+)
+
+// topTradersWindows 交易者排行支持的时间窗口，0 表示全部历史
+var topTradersWindows = map[string]time.Duration{
+	"5m":  5 * time.Minute,
+	"1h":  time.Hour,
+	"6h":  6 * time.Hour,
+	"24h": 24 * time.Hour,
+	"7d":  7 * 24 * time.Hour,
+	"30d": 30 * 24 * time.Hour,
+	"all": 0,
+}
+
+// 交易者标签
+const (
+	TraderLabelCreator = "creator"
+	TraderLabelPool    = "pool"
+)
+
+// IsValidTopTradersWindow 检查时间窗口参数
+func IsValidTopTradersWindow(window string) bool {
+	_, ok := topTradersWindows[window]
+	return ok
+}
+
+// TopTraders 返回时间窗口内代币的交易者排行，标记代币创建者和池子地址
+func (s *TickerServiceImpl) TopTraders(tokenAddress string, chainType model.ChainType, window, sortBy string, limit int) response.Response {
+	since := time.Unix(0, 0)
+	if d := topTradersWindows[window]; d > 0 {
+		since = time.Now().Add(-d)
+	}
+
+	traders, err := clickhouse.GetTopTraders(chainType.Uint8(), tokenAddress, since, sortBy, limit)
+	if err != nil {
+		return response.Err(http.StatusInternalServerError, "Failed to query top traders", err)
+	}
+
+	tokenInfo, err := s.tokenInfoRepo.GetTokenInfoByAddress(tokenAddress, chainType.Uint8())
+	if err != nil {
+		return response.Err(http.StatusInternalServerError, "Failed to get token info", err)
+	}
+	decimals := defaultKlineDecimals
+	creator, pool := "", ""
+	if tokenInfo != nil {
+		decimals, creator, pool = tokenInfo.Decimals, tokenInfo.Creator, tokenInfo.PoolAddress
+	}
+
+	res := response.TopTradersResponse{Window: window, SortBy: sortBy, TopTraders: make([]response.TopTrader, 0, len(traders))}
+	for i, t := range traders {
+		labels := []string{}
+		if creator != "" && t.UserAddress == creator {
+			labels = append(labels, TraderLabelCreator)
+		}
+		if pool != "" && t.UserAddress == pool {
+			labels = append(labels, TraderLabelPool)
+		}
+		res.TopTraders = append(res.TopTraders, response.TopTrader{
+			Rank:          i + 1,
+			Account:       t.UserAddress,
+			Labels:        labels,
+			BuyCount:      t.BuyCount,
+			SellCount:     t.SellCount,
+			TradesCount:   t.TradesCount,
+			BuyAmount:     decimal.NewFromUint64(t.BuyAmount).Shift(-int32(decimals)).String(),
+			SellAmount:    decimal.NewFromUint64(t.SellAmount).Shift(-int32(decimals)).String(),
+			BuyVolumeUSD:  t.BuyUSD.String(),
+			SellVolumeUSD: t.SellUSD.String(),
+			VolumeUSD:     t.VolumeUSD.String(),
+			NetBuyUSD:     t.NetBuyUSD.String(),
+			RealizedPNL:   decimal.NewFromFloat(t.RealizedPnL).StringFixed(6),
+			LastTradeTime: t.LastTradeTime.Unix(),
+		})
+	}
+	return response.Success(res)
+}
@@ -117,7 +117,7 @@ func (s *TransactionCkServiceImpl) ConvertToTransactionCks(transactions []*model
 	return txCks
 }
 
-// BatchProcessTransactions 批量处理交易数据
-func (s *TransactionCkServiceImpl) BatchProcessTransactions(txs []*clickhouse.TokenTransactionCk) error {
-	return clickhouse.BatchInsertTransactions(txs)
+// BatchProcessTransactions 批量处理交易数据，source 标识数据来源，用于生成写入去重 token
+func (s *TransactionCkServiceImpl) BatchProcessTransactions(source string, txs []*clickhouse.TokenTransactionCk) error {
+	return clickhouse.BatchInsertTransactions(source, txs)
 }
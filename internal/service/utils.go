@@ -31,6 +31,18 @@ func VerifySolanaSignature(address, signature, message string) (bool, error) {
 	return true, nil
 }
 
+// SignatureFromSignedTransaction 从 base64 编码的已签名交易中取出交易签名
+func SignatureFromSignedTransaction(signedTransaction string) (string, error) {
+	tx, err := solana.TransactionFromBase64(signedTransaction)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode transaction: %w", err)
+	}
+	if len(tx.Signatures) == 0 || tx.Signatures[0].IsZero() {
+		return "", errors.New("transaction is not signed")
+	}
+	return tx.Signatures[0].String(), nil
+}
+
 func UintToString(id uint) string {
 	return strconv.FormatUint(uint64(id), 10)
 }
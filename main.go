@@ -1,12 +1,20 @@
 package main
 
 import (
+	"context"
+	"errors"
 	_ "game-fun-be/docs"
 	"game-fun-be/internal/initializer"
+	"game-fun-be/internal/kafka"
+	"game-fun-be/internal/pkg/util"
 	"game-fun-be/internal/server"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
 	// "net/http"
 
@@ -82,12 +90,12 @@ func main() {
 	}
 
 	// 初始化配置
-	producer := initializer.Setup(currentEnv.String())
+	initializer.Setup(currentEnv.String())
 
 	// 装载路由
 	gin.SetMode(os.Getenv("GIN_MODE"))
 
-	r := server.NewRouter(producer)
+	r := server.NewRouter(kafka.SendMessage)
 
 	// 从环境变量获取端口，如果没有设置，则使用默认值 8080
 	port := os.Getenv("PORT")
@@ -103,5 +111,35 @@ func main() {
 	// 	}
 	// }()
 
-	r.Run(":" + port)
+	srv := &http.Server{
+		Addr:    ":" + port,
+		Handler: r,
+	}
+
+	// 监听退出信号
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("HTTP server failed: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+
+	// 停机截止时间（秒），默认 30 秒
+	shutdownTimeout := util.GetEnvAsDuration("SHUTDOWN_TIMEOUT", 30*time.Second)
+	util.Log().Info("Received shutdown signal, draining with timeout %v", shutdownTimeout)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	// 先停止接收新的 HTTP 请求并等待进行中的请求完成
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		util.Log().Error("HTTP server shutdown failed: %v", err)
+	}
+
+	initializer.Shutdown(shutdownCtx)
 }
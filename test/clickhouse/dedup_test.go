@@ -0,0 +1,80 @@
+package clickhouse_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"game-fun-be/internal/clickhouse"
+
+	ch "github.com/ClickHouse/clickhouse-go/v2"
+)
+
+// TestDedupWindowMigrationOnExistingTable 迁移前已存在、未设置去重窗口的表执行 0004 后，相同 token 的重复写入只生效一次
+func TestDedupWindowMigrationOnExistingTable(t *testing.T) {
+	if testing.Short() || os.Getenv("CLICKHOUSE_ADDR") == "" {
+		t.Skip("Skipping ClickHouse integration test")
+	}
+	clickhouse.ClickHouse()
+	defer clickhouse.CloseClickHouse()
+
+	migrations, err := clickhouse.LoadMigrations()
+	if err != nil {
+		t.Fatalf("load migrations: %v", err)
+	}
+	var statements []string
+	for _, m := range migrations {
+		if m.Name == "dedup_window" {
+			statements = m.Statements
+		}
+	}
+	if len(statements) != 2 {
+		t.Fatalf("expected 2 dedup_window statements, got %d", len(statements))
+	}
+
+	ctx := context.Background()
+	for _, table := range []string{"token_transaction_ck_new", "proxy_transaction_ck"} {
+		t.Run(table, func(t *testing.T) {
+			scratch := fmt.Sprintf("%s_dedup_test_%d", table, time.Now().UnixNano())
+			// 模拟迁移引入前手工创建的表：结构相同，但没有去重窗口设置
+			if err := clickhouse.ClickHouseClient.Exec(ctx, fmt.Sprintf(`
+                CREATE TABLE %s (transaction_hash String, transaction_time DateTime)
+                ENGINE = MergeTree ORDER BY transaction_hash`, scratch)); err != nil {
+				t.Fatalf("create table: %v", err)
+			}
+			defer clickhouse.ClickHouseClient.Exec(ctx, "DROP TABLE IF EXISTS "+scratch)
+
+			var stmt string
+			for _, s := range statements {
+				if strings.Contains(s, "ALTER TABLE "+table+"${ON_CLUSTER}") {
+					stmt = strings.Replace(s, "ALTER TABLE "+table+"${ON_CLUSTER}", "ALTER TABLE "+scratch, 1)
+				}
+			}
+			if stmt == "" {
+				t.Fatalf("no dedup_window statement for %s", table)
+			}
+			if err := clickhouse.ClickHouseClient.Exec(ctx, stmt); err != nil {
+				t.Fatalf("apply migration: %v", err)
+			}
+
+			insertCtx := ch.Context(ctx, ch.WithSettings(ch.Settings{"insert_deduplication_token": "dedup-window-test"}))
+			for i := 0; i < 2; i++ {
+				if err := clickhouse.ClickHouseClient.Exec(insertCtx,
+					fmt.Sprintf("INSERT INTO %s VALUES ('hash', now())", scratch)); err != nil {
+					t.Fatalf("insert: %v", err)
+				}
+			}
+
+			var rows uint64
+			if err := clickhouse.ClickHouseClient.QueryRow(ctx, "SELECT count() FROM "+scratch).Scan(&rows); err != nil {
+				t.Fatalf("count: %v", err)
+			}
+			if rows != 1 {
+				t.Fatalf("expected duplicate insert to be dropped, got %d rows", rows)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package clickhouse_test
+
+import (
+	"testing"
+	"time"
+
+	"game-fun-be/internal/clickhouse"
+
+	"github.com/shopspring/decimal"
+)
+
+func mustResolution(t *testing.T, name string) clickhouse.KlineResolution {
+	t.Helper()
+	r, ok := clickhouse.ParseKlineResolution(name)
+	if !ok {
+		t.Fatalf("unknown resolution %s", name)
+	}
+	return r
+}
+
+func utc(s string) time.Time {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestKlineBucketStart(t *testing.T) {
+	tests := []struct {
+		resolution string
+		at         time.Time
+		expected   time.Time
+	}{
+		{"1", utc("2025-01-08T15:04:05Z"), utc("2025-01-08T15:04:00Z")},
+		{"240", utc("2025-01-08T15:04:05Z"), utc("2025-01-08T12:00:00Z")},
+		{"1D", utc("2025-01-08T15:04:05Z"), utc("2025-01-08T00:00:00Z")},
+		// 周线按 UTC 周一对齐
+		{"1W", utc("2025-01-08T15:04:05Z"), utc("2025-01-06T00:00:00Z")},
+		{"1W", utc("2025-01-06T00:00:00Z"), utc("2025-01-06T00:00:00Z")},
+		{"1W", utc("2025-01-12T23:59:59Z"), utc("2025-01-06T00:00:00Z")},
+		{"1W", utc("2025-01-01T08:00:00Z"), utc("2024-12-30T00:00:00Z")},
+		// 本地时间已是周一，UTC 仍是周日
+		{"1W", utc("2025-01-13T02:00:00+08:00"), utc("2025-01-06T00:00:00Z")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.resolution+" "+tt.at.Format(time.RFC3339), func(t *testing.T) {
+			got := mustResolution(t, tt.resolution).BucketStart(tt.at)
+			if !got.Equal(tt.expected) {
+				t.Errorf("expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestKlineBucketCount(t *testing.T) {
+	tests := []struct {
+		name       string
+		resolution string
+		start, end time.Time
+		expected   int64
+	}{
+		{"empty range", "1W", utc("2025-01-08T00:00:00Z"), utc("2025-01-08T00:00:00Z"), 0},
+		{"end before start", "1", utc("2025-01-08T00:05:00Z"), utc("2025-01-08T00:00:00Z"), 0},
+		{"unaligned minutes", "5", utc("2025-01-08T12:01:00Z"), utc("2025-01-08T12:10:00Z"), 2},
+		{"partial week up to next monday", "1W", utc("2025-01-08T15:00:00Z"), utc("2025-01-13T00:00:00Z"), 1},
+		{"one second into next week", "1W", utc("2025-01-08T15:00:00Z"), utc("2025-01-13T00:00:01Z"), 2},
+		{"aligned weeks", "1W", utc("2025-01-06T00:00:00Z"), utc("2025-01-20T00:00:00Z"), 2},
+		{"across year end", "1W", utc("2024-12-31T00:00:00Z"), utc("2025-01-14T00:00:00Z"), 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mustResolution(t, tt.resolution).BucketCount(tt.start, tt.end); got != tt.expected {
+				t.Errorf("expected %d, got %d", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestFillKlineGaps(t *testing.T) {
+	const token = "CUCfqECyNKLe8dzxBQtT8vzHXpDryT72c8NtEeoN7WmS"
+	kline := func(at string, close int64) clickhouse.Kline {
+		price := decimal.NewFromInt(close)
+		return clickhouse.Kline{
+			TokenAddress:      token,
+			IntervalTimestamp: utc(at),
+			OpenPrice:         price,
+			HighPrice:         price,
+			LowPrice:          price,
+			ClosePrice:        price,
+			Volume:            100,
+		}
+	}
+	type bar struct {
+		at     string
+		close  int64
+		traded bool
+	}
+
+	tests := []struct {
+		name       string
+		resolution string
+		start, end string
+		klines     []clickhouse.Kline
+		prevClose  int64
+		expected   []bar
+	}{
+		{
+			name:       "gaps carry the previous close",
+			resolution: "1",
+			start:      "2025-01-08T12:00:00Z",
+			end:        "2025-01-08T12:05:00Z",
+			klines:     []clickhouse.Kline{kline("2025-01-08T12:01:00Z", 2), kline("2025-01-08T12:03:00Z", 3)},
+			prevClose:  1,
+			expected: []bar{
+				{"2025-01-08T12:00:00Z", 1, false},
+				{"2025-01-08T12:01:00Z", 2, true},
+				{"2025-01-08T12:02:00Z", 2, false},
+				{"2025-01-08T12:03:00Z", 3, true},
+				{"2025-01-08T12:04:00Z", 3, false},
+			},
+		},
+		{
+			name:       "leading gaps are dropped without a previous close",
+			resolution: "1",
+			start:      "2025-01-08T12:00:00Z",
+			end:        "2025-01-08T12:05:00Z",
+			klines:     []clickhouse.Kline{kline("2025-01-08T12:02:00Z", 2)},
+			prevClose:  0,
+			expected: []bar{
+				{"2025-01-08T12:02:00Z", 2, true},
+				{"2025-01-08T12:03:00Z", 2, false},
+				{"2025-01-08T12:04:00Z", 2, false},
+			},
+		},
+		{
+			name:       "no trades and no previous close",
+			resolution: "1",
+			start:      "2025-01-08T12:00:00Z",
+			end:        "2025-01-08T12:05:00Z",
+			prevClose:  0,
+			expected:   []bar{},
+		},
+		{
+			name:       "weeks align to monday",
+			resolution: "1W",
+			start:      "2025-01-08T15:00:00Z",
+			end:        "2025-01-22T00:00:00Z",
+			klines:     []clickhouse.Kline{kline("2025-01-13T00:00:00Z", 4)},
+			prevClose:  3,
+			expected: []bar{
+				{"2025-01-06T00:00:00Z", 3, false},
+				{"2025-01-13T00:00:00Z", 4, true},
+				{"2025-01-20T00:00:00Z", 4, false},
+			},
+		},
+		{
+			name:       "weeks without a previous close start at the first trade",
+			resolution: "1W",
+			start:      "2025-01-08T15:00:00Z",
+			end:        "2025-01-22T00:00:00Z",
+			klines:     []clickhouse.Kline{kline("2025-01-13T00:00:00Z", 4)},
+			prevClose:  0,
+			expected: []bar{
+				{"2025-01-13T00:00:00Z", 4, true},
+				{"2025-01-20T00:00:00Z", 4, false},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := clickhouse.FillKlineGaps(tt.klines, token, mustResolution(t, tt.resolution),
+				utc(tt.start), utc(tt.end), decimal.NewFromInt(tt.prevClose))
+			if len(got) != len(tt.expected) {
+				t.Fatalf("expected %d klines, got %d: %+v", len(tt.expected), len(got), got)
+			}
+			for i, want := range tt.expected {
+				k := got[i]
+				if !k.IntervalTimestamp.Equal(utc(want.at)) {
+					t.Errorf("kline %d: expected bucket %s, got %s", i, want.at, k.IntervalTimestamp)
+				}
+				if !k.ClosePrice.Equal(decimal.NewFromInt(want.close)) {
+					t.Errorf("kline %d: expected close %d, got %s", i, want.close, k.ClosePrice)
+				}
+				if k.TokenAddress != token {
+					t.Errorf("kline %d: expected token %s, got %s", i, token, k.TokenAddress)
+				}
+				if traded := k.Volume > 0; traded != want.traded {
+					t.Errorf("kline %d: expected traded=%v, got volume %d", i, want.traded, k.Volume)
+				}
+				if !want.traded && !k.OpenPrice.Equal(k.ClosePrice) {
+					t.Errorf("kline %d: gap should be flat, got open %s close %s", i, k.OpenPrice, k.ClosePrice)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package clickhouse_test
+
+import (
+	"testing"
+	"time"
+
+	"game-fun-be/internal/clickhouse"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestFillPlatformFeeGaps(t *testing.T) {
+	bucket := func(at string, trades uint64) clickhouse.PlatformFeeBucket {
+		return clickhouse.PlatformFeeBucket{
+			Bucket:       utc(at),
+			TradesCount:  trades,
+			FeeAmount:    trades * 1000,
+			FeeUSD:       decimal.NewFromInt(int64(trades)),
+			PointsAmount: trades * 10,
+		}
+	}
+	type point struct {
+		at     string
+		trades uint64
+	}
+
+	tests := []struct {
+		name       string
+		step       time.Duration
+		start, end string
+		buckets    []clickhouse.PlatformFeeBucket
+		expected   []point
+	}{
+		{
+			name:  "hours without trades are zero filled",
+			step:  time.Hour,
+			start: "2025-01-08T12:00:00Z",
+			end:   "2025-01-08T16:00:00Z",
+			buckets: []clickhouse.PlatformFeeBucket{
+				bucket("2025-01-08T13:00:00Z", 2),
+				bucket("2025-01-08T15:00:00Z", 5),
+			},
+			expected: []point{
+				{"2025-01-08T12:00:00Z", 0},
+				{"2025-01-08T13:00:00Z", 2},
+				{"2025-01-08T14:00:00Z", 0},
+				{"2025-01-08T15:00:00Z", 5},
+			},
+		},
+		{
+			name:  "unaligned start truncates to the hour",
+			step:  time.Hour,
+			start: "2025-01-08T12:34:56Z",
+			end:   "2025-01-08T14:00:00Z",
+			buckets: []clickhouse.PlatformFeeBucket{
+				bucket("2025-01-08T12:00:00Z", 1),
+			},
+			expected: []point{
+				{"2025-01-08T12:00:00Z", 1},
+				{"2025-01-08T13:00:00Z", 0},
+			},
+		},
+		{
+			name:  "partial last hour is included",
+			step:  time.Hour,
+			start: "2025-01-08T12:00:00Z",
+			end:   "2025-01-08T13:00:01Z",
+			expected: []point{
+				{"2025-01-08T12:00:00Z", 0},
+				{"2025-01-08T13:00:00Z", 0},
+			},
+		},
+		{
+			name:  "days align to utc midnight regardless of bucket time zone",
+			step:  24 * time.Hour,
+			start: "2025-01-08T15:00:00Z",
+			end:   "2025-01-11T00:00:00Z",
+			buckets: []clickhouse.PlatformFeeBucket{
+				bucket("2025-01-09T08:00:00+08:00", 3),
+			},
+			expected: []point{
+				{"2025-01-08T00:00:00Z", 0},
+				{"2025-01-09T00:00:00Z", 3},
+				{"2025-01-10T00:00:00Z", 0},
+			},
+		},
+		{
+			name:  "buckets outside the range are dropped",
+			step:  time.Hour,
+			start: "2025-01-08T12:00:00Z",
+			end:   "2025-01-08T14:00:00Z",
+			buckets: []clickhouse.PlatformFeeBucket{
+				bucket("2025-01-08T11:00:00Z", 7),
+				bucket("2025-01-08T13:00:00Z", 1),
+				bucket("2025-01-08T14:00:00Z", 9),
+			},
+			expected: []point{
+				{"2025-01-08T12:00:00Z", 0},
+				{"2025-01-08T13:00:00Z", 1},
+			},
+		},
+		{
+			name:     "empty range",
+			step:     time.Hour,
+			start:    "2025-01-08T12:00:00Z",
+			end:      "2025-01-08T12:00:00Z",
+			expected: []point{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := clickhouse.FillPlatformFeeGaps(tt.buckets, tt.step, utc(tt.start), utc(tt.end))
+			if len(got) != len(tt.expected) {
+				t.Fatalf("expected %d buckets, got %d: %+v", len(tt.expected), len(got), got)
+			}
+			for i, want := range tt.expected {
+				b := got[i]
+				if !b.Bucket.Equal(utc(want.at)) {
+					t.Errorf("bucket %d: expected %s, got %s", i, want.at, b.Bucket)
+				}
+				if b.TradesCount != want.trades {
+					t.Errorf("bucket %d: expected %d trades, got %d", i, want.trades, b.TradesCount)
+				}
+				if b.FeeAmount != want.trades*1000 || b.PointsAmount != want.trades*10 {
+					t.Errorf("bucket %d: expected fee %d points %d, got fee %d points %d",
+						i, want.trades*1000, want.trades*10, b.FeeAmount, b.PointsAmount)
+				}
+				if !b.FeeUSD.Equal(decimal.NewFromInt(int64(want.trades))) {
+					t.Errorf("bucket %d: expected fee usd %d, got %s", i, want.trades, b.FeeUSD)
+				}
+			}
+		})
+	}
+}
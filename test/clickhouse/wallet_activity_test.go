@@ -0,0 +1,47 @@
+package clickhouse_test
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"game-fun-be/internal/clickhouse"
+)
+
+func TestWalletActivityCursorRoundTrip(t *testing.T) {
+	cursor := clickhouse.WalletActivityCursor{
+		TransactionTime: time.Unix(1735689600, 0),
+		TransactionHash: "5h6xBEauJ3PK6SWCZ1PGjBvj8vDdWG3KpwATGy1ARAXF",
+		TokenAddress:    "CUCfqECyNKLe8dzxBQtT8vzHXpDryT72c8NtEeoN7WmS",
+	}
+
+	parsed, err := clickhouse.ParseWalletActivityCursor(cursor.Encode())
+	if err != nil {
+		t.Fatalf("parse cursor: %v", err)
+	}
+	if !parsed.TransactionTime.Equal(cursor.TransactionTime) ||
+		parsed.TransactionHash != cursor.TransactionHash ||
+		parsed.TokenAddress != cursor.TokenAddress {
+		t.Errorf("expected %+v, got %+v", cursor, *parsed)
+	}
+}
+
+func TestParseWalletActivityCursorRejectsInvalid(t *testing.T) {
+	encode := func(raw string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(raw))
+	}
+	tests := map[string]string{
+		"not base64":      "%%%",
+		"missing token":   encode("1735689600:hash"),
+		"empty token":     encode("1735689600:hash:"),
+		"empty hash":      encode("1735689600::token"),
+		"invalid seconds": encode("now:hash:token"),
+	}
+	for name, value := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := clickhouse.ParseWalletActivityCursor(value); err == nil {
+				t.Errorf("expected %q to be rejected", value)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package clickhouse_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"game-fun-be/internal/clickhouse"
+)
+
+type writerRow struct {
+	ID   int    `json:"id"`
+	Hash string `json:"hash"`
+}
+
+// TestBufferedWriterSpillReplay ClickHouse 不可用时批次连同去重 token 落盘，恢复后回放并删除落盘文件
+func TestBufferedWriterSpillReplay(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("CLICKHOUSE_WRITER_SPILL_DIR", dir)
+	t.Setenv("CLICKHOUSE_WRITER_RETRIES", "1")
+
+	failing := clickhouse.NewBufferedWriter("test_rows", func(ctx context.Context, rows []writerRow) error {
+		return errors.New("connection refused")
+	})
+	if err := failing.Start(); err != nil {
+		t.Fatalf("start writer: %v", err)
+	}
+	// 落盘成功即视为写入成功，调用方可以提交 offset
+	if err := failing.Write("source-token", writerRow{ID: 1, Hash: "a"}, writerRow{ID: 2, Hash: "b"}); err != nil {
+		t.Fatalf("spilled write should succeed, got %v", err)
+	}
+	failing.Close()
+
+	spilled, _ := filepath.Glob(filepath.Join(dir, "test_rows", "*.jsonl"))
+	if len(spilled) != 1 {
+		t.Fatalf("expected 1 spill file, got %d", len(spilled))
+	}
+	if token := readSpillToken(t, spilled[0]); token != "source-token" {
+		t.Fatalf("spill file should keep the caller's dedup token, got %q", token)
+	}
+	if status := failing.Status(); status.Healthy || status.SpilledBatches != 1 || status.BufferedRows != 0 {
+		t.Fatalf("unexpected status after failure: %+v", status)
+	}
+
+	var (
+		mu       sync.Mutex
+		received []writerRow
+	)
+	recovered := clickhouse.NewBufferedWriter("test_rows", func(ctx context.Context, rows []writerRow) error {
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, rows...)
+		return nil
+	})
+	if err := recovered.Start(); err != nil {
+		t.Fatalf("start writer: %v", err)
+	}
+	if err := recovered.Write("next-token", writerRow{ID: 3, Hash: "c"}); err != nil {
+		t.Fatalf("write after recovery: %v", err)
+	}
+	// Write 返回时行已写入，不依赖 Close 刷写
+	mu.Lock()
+	sent := len(received) > 0 && received[0].ID == 3
+	mu.Unlock()
+	if !sent {
+		t.Fatalf("rows should be sent before Write returns")
+	}
+	recovered.Close()
+
+	if len(received) != 3 {
+		t.Fatalf("expected 3 rows after replay, got %d: %+v", len(received), received)
+	}
+	if _, err := os.Stat(spilled[0]); !os.IsNotExist(err) {
+		t.Fatalf("spill file should be removed after replay, stat err: %v", err)
+	}
+	if status := recovered.Status(); !status.Healthy || status.SpilledBatches != 0 {
+		t.Fatalf("unexpected status after replay: %+v", status)
+	}
+}
+
+// TestBufferedWriterSpillFailure 写入和落盘都失败时 Write 返回错误，调用方不提交 offset
+func TestBufferedWriterSpillFailure(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("CLICKHOUSE_WRITER_SPILL_DIR", dir)
+	t.Setenv("CLICKHOUSE_WRITER_RETRIES", "1")
+
+	writer := clickhouse.NewBufferedWriter("test_rows", func(ctx context.Context, rows []writerRow) error {
+		return errors.New("connection refused")
+	})
+	if err := writer.Start(); err != nil {
+		t.Fatalf("start writer: %v", err)
+	}
+	defer writer.Close()
+
+	// 落盘目录被删除后无法落盘
+	if err := os.RemoveAll(filepath.Join(dir, "test_rows")); err != nil {
+		t.Fatalf("remove spill dir: %v", err)
+	}
+	err := writer.Write("source-token", writerRow{ID: 1, Hash: "a"})
+	if err == nil || errors.Is(err, clickhouse.ErrWriterUnavailable) {
+		t.Fatalf("expected a write error when rows can neither be sent nor spilled, got %v", err)
+	}
+	if status := writer.Status(); status.BufferedRows != 0 || status.SpilledBatches != 0 {
+		t.Fatalf("unexpected status after failed spill: %+v", status)
+	}
+}
+
+// TestBufferedWriterBackpressure 等待写入的行超过上限、落盘批次未回放或写入器已关闭时拒绝写入
+func TestBufferedWriterBackpressure(t *testing.T) {
+	t.Setenv("CLICKHOUSE_WRITER_SPILL_DIR", t.TempDir())
+	t.Setenv("CLICKHOUSE_WRITER_RETRIES", "1")
+	t.Setenv("CLICKHOUSE_WRITER_MAX_BUFFERED_ROWS", "2")
+	t.Setenv("CLICKHOUSE_WRITER_FLUSH_INTERVAL", "3600")
+
+	writer := clickhouse.NewBufferedWriter("test_rows", func(ctx context.Context, rows []writerRow) error {
+		return errors.New("connection refused")
+	})
+	if err := writer.Start(); err != nil {
+		t.Fatalf("start writer: %v", err)
+	}
+
+	if err := writer.Write("too-large", writerRow{ID: 1}, writerRow{ID: 2}, writerRow{ID: 3}); !errors.Is(err, clickhouse.ErrWriterUnavailable) {
+		t.Fatalf("expected ErrWriterUnavailable when rows exceed the buffer limit, got %v", err)
+	}
+	if status := writer.Status(); status.BufferedRows != 0 || status.SpilledBatches != 0 {
+		t.Fatalf("rejected rows should not be buffered or spilled: %+v", status)
+	}
+
+	if err := writer.Write("first", writerRow{ID: 1, Hash: "a"}, writerRow{ID: 2, Hash: "b"}); err != nil {
+		t.Fatalf("write within buffer limit: %v", err)
+	}
+	if err := writer.Write("second", writerRow{ID: 3, Hash: "c"}); !errors.Is(err, clickhouse.ErrWriterUnavailable) {
+		t.Fatalf("expected ErrWriterUnavailable while spilled batches are pending, got %v", err)
+	}
+
+	writer.Close()
+	if err := writer.Write("closed", writerRow{ID: 4, Hash: "d"}); !errors.Is(err, clickhouse.ErrWriterUnavailable) {
+		t.Fatalf("expected ErrWriterUnavailable after close, got %v", err)
+	}
+}
+
+// readSpillToken 读取落盘文件首行记录的去重 token
+func readSpillToken(t *testing.T, path string) string {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open spill file: %v", err)
+	}
+	defer file.Close()
+
+	var header struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(bufio.NewReader(file)).Decode(&header); err != nil {
+		t.Fatalf("decode spill header: %v", err)
+	}
+	return header.Token
+}
@@ -1,19 +1,30 @@
 package kafka_test
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"game-fun-be/internal/clickhouse"
+	"game-fun-be/internal/constants"
 	"game-fun-be/internal/kafka"
 	"game-fun-be/internal/model"
+	"game-fun-be/internal/redis"
 
 	"github.com/IBM/sarama"
 	"github.com/IBM/sarama/mocks"
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
 )
 
 func TestKafkaInitialization(t *testing.T) {
@@ -155,6 +166,511 @@ func TestKafkaIntegration(t *testing.T) {
 	})
 }
 
+func TestMemoryBrokerConsume(t *testing.T) {
+	broker := kafka.NewMemoryBroker()
+	kafka.SetProducer(broker)
+	defer kafka.SetProducer(nil)
+
+	topic := "memory-test-topic"
+	var handled []string
+	consumer := kafka.NewTopicConsumerWithGroup(broker.ConsumerGroup("memory-test-group"), "memory-test-group")
+	consumer.AddHandler(topic, func(message []byte, topic string) error {
+		if string(message) == "bad" {
+			return fmt.Errorf("bad message")
+		}
+		handled = append(handled, string(message))
+		return nil
+	})
+	go consumer.ConsumeTopics([]string{topic})
+
+	for _, value := range []string{"first", "bad", "second"} {
+		if err := kafka.SendMessage(topic, []byte(value)); err != nil {
+			t.Fatalf("Failed to send message: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := broker.WaitCommitted(ctx, "memory-test-group", topic); err != nil {
+		t.Fatalf("Messages were not committed: %v", err)
+	}
+	if err := consumer.Shutdown(ctx); err != nil {
+		t.Fatalf("Failed to shutdown consumer: %v", err)
+	}
+
+	if len(handled) != 2 || handled[0] != "first" || handled[1] != "second" {
+		t.Errorf("Expected [first second] to be handled, got %v", handled)
+	}
+	if dlq := broker.Messages(kafka.DeadLetterTopic(topic)); len(dlq) != 1 {
+		t.Errorf("Expected 1 dead letter, got %d", len(dlq))
+	}
+}
+
+// closingClaimGroup 第一次会话的分区消息改由测试控制的通道投递，测试关闭通道时会话的 Context 仍未结束，
+// 模拟 sarama 适配器在会话取消时先关闭消息通道；之后的会话阻塞到 ctx 取消，不再重复投递
+type closingClaimGroup struct {
+	kafka.ConsumerGroup
+	messages chan *kafka.Message
+	claimed  atomic.Bool
+	done     chan struct{} // 第一次会话的 ConsumeClaim 返回时关闭
+}
+
+func (g *closingClaimGroup) Consume(ctx context.Context, topics []string, handler kafka.ClaimHandler) error {
+	if g.claimed.Swap(true) {
+		<-ctx.Done()
+		return nil
+	}
+	return g.ConsumerGroup.Consume(ctx, topics, &closingClaimHandler{group: g, handler: handler})
+}
+
+type closingClaimHandler struct {
+	group   *closingClaimGroup
+	handler kafka.ClaimHandler
+}
+
+func (h *closingClaimHandler) ConsumeClaim(session kafka.ConsumerSession, claim kafka.ConsumerClaim) error {
+	defer close(h.group.done)
+	return h.handler.ConsumeClaim(session, &closingClaim{ConsumerClaim: claim, messages: h.group.messages})
+}
+
+type closingClaim struct {
+	kafka.ConsumerClaim
+	messages chan *kafka.Message
+}
+
+func (c *closingClaim) Messages() <-chan *kafka.Message { return c.messages }
+
+func TestConsumeClaimFlushesBatchWhenChannelCloses(t *testing.T) {
+	broker := kafka.NewMemoryBroker()
+	group, topic := "drain-test-group", "drain-test-topic"
+	consumerGroup := &closingClaimGroup{
+		ConsumerGroup: broker.ConsumerGroup(group),
+		messages:      make(chan *kafka.Message),
+		done:          make(chan struct{}),
+	}
+
+	var handled atomic.Int64
+	consumer := kafka.NewTopicConsumerWithGroup(consumerGroup, group)
+	consumer.AddBatchHandler(topic, func(topic string, messages []kafka.Message, partition int32, goroutineID uint64) error {
+		handled.Add(int64(len(messages)))
+		return nil
+	}, 100, 100, time.Minute)
+	go consumer.ConsumeTopics([]string{topic})
+
+	// 批次未满也未超时，消息都留在内存批次中
+	for offset := int64(0); offset < 3; offset++ {
+		consumerGroup.messages <- &kafka.Message{Topic: topic, Offset: offset, Value: []byte("pending")}
+	}
+	close(consumerGroup.messages)
+
+	select {
+	case <-consumerGroup.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("ConsumeClaim did not return after the message channel closed")
+	}
+	if got := handled.Load(); got != 3 {
+		t.Errorf("Expected 3 pending messages to be handled, got %d", got)
+	}
+	if committed := broker.Committed(group, topic); committed != 3 {
+		t.Errorf("Expected pending batch committed up to offset 3, got %d", committed)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := consumer.Shutdown(ctx); err != nil {
+		t.Fatalf("Failed to shutdown consumer: %v", err)
+	}
+}
+
+// stubTradeStore 交易存储桩，failing 为 true 时 ClickHouse 写入失败
+type stubTradeStore struct {
+	failing  atomic.Bool
+	inserted atomic.Int64
+}
+
+func (s *stubTradeStore) CreateTransactions(transactions []*model.TokenTransaction, date string) error {
+	return nil
+}
+
+func (s *stubTradeStore) CreateTransactionIndices(transactions []*model.TokenTransaction) error {
+	return nil
+}
+
+func (s *stubTradeStore) UpdateTokens(transactions []*model.TokenTransaction) (map[string]*model.TokenInfo, error) {
+	return map[string]*model.TokenInfo{}, nil
+}
+
+func (s *stubTradeStore) UpdatePools(transactions []*model.TokenTransaction) (map[string]*model.TokenLiquidityPool, error) {
+	return map[string]*model.TokenLiquidityPool{}, nil
+}
+
+func (s *stubTradeStore) IndexTransactions(transactions []*model.TokenTransaction, tokenInfoMap map[string]*model.TokenInfo, poolInfoMap map[string]*model.TokenLiquidityPool) error {
+	return nil
+}
+
+func (s *stubTradeStore) InsertTransactions(transactions []*model.TokenTransaction, source string) error {
+	if s.failing.Load() {
+		return fmt.Errorf("clickhouse: connection refused")
+	}
+	s.inserted.Add(int64(len(transactions)))
+	return nil
+}
+
+// waitFor 轮询等待 cond 成立
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestSwapBatchPausesWhenSinkUnavailable(t *testing.T) {
+	// SOL 价格读取失败时按 0 处理，不依赖真实 Redis
+	redis.RedisClient = goredis.NewClient(&goredis.Options{Addr: "127.0.0.1:1", MaxRetries: -1, DialTimeout: 100 * time.Millisecond})
+	defer func() { redis.RedisClient = nil }()
+
+	store := &stubTradeStore{}
+	store.failing.Store(true)
+	defer kafka.SetTradeStore(store)()
+
+	broker := kafka.NewMemoryBroker()
+	kafka.SetProducer(broker)
+	defer kafka.SetProducer(nil)
+
+	group, topic := "sink-test-group", kafka.TopicRaySwap
+	consumer := kafka.NewTopicConsumerWithGroup(broker.ConsumerGroup(group), group)
+	consumer.AddBatchHandler(topic, kafka.RaydiumBatchHandler, 1, 1, time.Minute)
+	go consumer.ConsumeTopics([]string{topic})
+
+	// 批次上限为 1，第二条消息到达时处理第一条
+	for i := 0; i < 2; i++ {
+		message := fmt.Sprintf(`{
+			"timestamp": %d,
+			"block": 301364918,
+			"signature": "sink-test-signature-%d",
+			"poolAddress": "8nsjiwgZGpqMQ4n3fSWcEdMoQfMaAqxBFTkaGDtzeD4J",
+			"user": "EYANY4XNWRcx3YBhFygQLo3UAzGnXEWBskZMctyuxyFG",
+			"isBuy": true,
+			"quoteToken": "CUCfqECyNKLe8dzxBQtT8vzHXpDryT72c8NtEeoN7WmS",
+			"baseToken": "So11111111111111111111111111111111111111112",
+			"quoteAmount": "54610438",
+			"baseAmount": "1585960",
+			"poolQuoteReserve": "18640745631097",
+			"poolBaseReserve": "539997130105",
+			"decimals": 6
+		}`, time.Now().Unix(), i)
+		if err := kafka.SendMessage(topic, []byte(message)); err != nil {
+			t.Fatalf("Failed to send message: %v", err)
+		}
+	}
+
+	waitFor(t, "partition pause", func() bool { return broker.Paused(group, topic) })
+	if dlq := broker.Messages(kafka.DeadLetterTopic(topic)); len(dlq) != 0 {
+		t.Errorf("Expected no dead letters while sink is unavailable, got %d", len(dlq))
+	}
+	if committed := broker.Committed(group, topic); committed != 0 {
+		t.Errorf("Expected no commit while sink is unavailable, got offset %d", committed)
+	}
+
+	store.failing.Store(false)
+	waitFor(t, "commit after sink recovery", func() bool { return broker.Committed(group, topic) >= 1 })
+	waitFor(t, "partition resume", func() bool { return !broker.Paused(group, topic) })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := consumer.Shutdown(ctx); err != nil {
+		t.Fatalf("Failed to shutdown consumer: %v", err)
+	}
+
+	if committed := broker.Committed(group, topic); committed != 2 {
+		t.Errorf("Expected both messages committed, got offset %d", committed)
+	}
+	if inserted := store.inserted.Load(); inserted != 2 {
+		t.Errorf("Expected 2 transactions inserted, got %d", inserted)
+	}
+	if dlq := broker.Messages(kafka.DeadLetterTopic(topic)); len(dlq) != 0 {
+		t.Errorf("Expected no dead letters, got %d", len(dlq))
+	}
+}
+
+// shardFailingTradeStore 指定代币的第一次 ClickHouse 写入失败，按代币记录写入的交易数
+type shardFailingTradeStore struct {
+	stubTradeStore
+	failToken string
+	mu        sync.Mutex
+	failed    bool
+	byToken   map[string]int
+}
+
+func (s *shardFailingTradeStore) InsertTransactions(transactions []*model.TokenTransaction, source string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, tx := range transactions {
+		if tx.TokenAddress == s.failToken && !s.failed {
+			s.failed = true
+			return fmt.Errorf("clickhouse: connection reset")
+		}
+	}
+	for _, tx := range transactions {
+		s.byToken[tx.TokenAddress]++
+	}
+	return nil
+}
+
+func TestSwapBatchRetriesOnlyFailedShard(t *testing.T) {
+	t.Setenv("KAFKA_RAYDIUM_SWAP_WORKERS", "2")
+	redis.RedisClient = goredis.NewClient(&goredis.Options{Addr: "127.0.0.1:1", MaxRetries: -1, DialTimeout: 100 * time.Millisecond})
+	defer func() { redis.RedisClient = nil }()
+
+	// 两个代币在 2 个 worker 下落在不同分片
+	okToken, failToken := "CUCfqECyNKLe8dzxBQtT8vzHXpDryT72c8NtEeoN7WmS", "Huy4cz1yTxS6GrGMN7Q5acQ7ws3PsHsc886i4iS2pump"
+	store := &shardFailingTradeStore{failToken: failToken, byToken: make(map[string]int)}
+	defer kafka.SetTradeStore(store)()
+
+	broker := kafka.NewMemoryBroker()
+	kafka.SetProducer(broker)
+	defer kafka.SetProducer(nil)
+
+	group, topic := "shard-test-group", kafka.TopicRaySwap
+	consumer := kafka.NewTopicConsumerWithGroup(broker.ConsumerGroup(group), group)
+	consumer.AddBatchHandler(topic, kafka.RaydiumBatchHandler, 2, 2, time.Minute)
+	go consumer.ConsumeTopics([]string{topic})
+
+	// 批次上限为 2，第三条消息到达时处理前两条
+	for i, token := range []string{okToken, failToken, okToken} {
+		message := fmt.Sprintf(`{
+			"timestamp": %d,
+			"signature": "shard-test-signature-%d",
+			"poolAddress": "8nsjiwgZGpqMQ4n3fSWcEdMoQfMaAqxBFTkaGDtzeD4J",
+			"user": "EYANY4XNWRcx3YBhFygQLo3UAzGnXEWBskZMctyuxyFG",
+			"isBuy": true,
+			"quoteToken": "%s",
+			"baseToken": "So11111111111111111111111111111111111111112",
+			"quoteAmount": "54610438",
+			"baseAmount": "1585960",
+			"poolQuoteReserve": "18640745631097",
+			"poolBaseReserve": "539997130105",
+			"decimals": 6
+		}`, time.Now().Unix(), i, token)
+		if err := kafka.SendMessage(topic, []byte(message)); err != nil {
+			t.Fatalf("Failed to send message: %v", err)
+		}
+	}
+
+	waitFor(t, "first batch committed", func() bool { return broker.Committed(group, topic) >= 2 })
+	store.mu.Lock()
+	okWrites, failWrites := store.byToken[okToken], store.byToken[failToken]
+	store.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := consumer.Shutdown(ctx); err != nil {
+		t.Fatalf("Failed to shutdown consumer: %v", err)
+	}
+
+	if okWrites != 1 || failWrites != 1 {
+		t.Errorf("Expected each shard written once, got %s=%d %s=%d", okToken, okWrites, failToken, failWrites)
+	}
+	if dlq := broker.Messages(kafka.DeadLetterTopic(topic)); len(dlq) != 0 {
+		t.Errorf("Expected no dead letters, got %d", len(dlq))
+	}
+}
+
+// pointRecord 桩存储记录的一次积分写入
+type pointRecord struct {
+	user    string
+	points  uint64
+	amounts map[model.StatisticType]uint64
+}
+
+// stubGameTradeStore 代理交易存储桩，用户为 failUser 时积分写入失败
+type stubGameTradeStore struct {
+	failUser   string
+	mu         sync.Mutex
+	proxyTxs   []*clickhouse.ProxyTransaction
+	points     []pointRecord
+	statistics []map[model.StatisticType]uint64
+}
+
+func (s *stubGameTradeStore) InsertProxyTransaction(proxyTx *clickhouse.ProxyTransaction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.proxyTxs = append(s.proxyTxs, proxyTx)
+	return nil
+}
+
+func (s *stubGameTradeStore) IncrementStatistics(tokenAddress string, amounts map[model.StatisticType]uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statistics = append(s.statistics, amounts)
+	return nil
+}
+
+func (s *stubGameTradeStore) CreatePointRecord(walletAddress string, point uint64, hash string, transactionDetail string, recordType model.RecordType, tokenAmount uint64, nativeTokenAmount uint64, isAddPoints bool, tokenAddress string, amounts map[model.StatisticType]uint64) error {
+	if walletAddress == s.failUser {
+		return fmt.Errorf("user %s not found", walletAddress)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.points = append(s.points, pointRecord{user: walletAddress, points: point, amounts: amounts})
+	return nil
+}
+
+func TestGameTradeHandlersWithMemoryBroker(t *testing.T) {
+	t.Setenv("DISCOUNT", "0")
+	t.Setenv("COEFFICIENT", "1")
+
+	store := &stubGameTradeStore{failUser: "missing-user"}
+	defer kafka.SetGameTradeStore(store)()
+
+	broker := kafka.NewMemoryBroker()
+	kafka.SetProducer(broker)
+	defer kafka.SetProducer(nil)
+
+	group, inTopic, outTopic := "game-test-group", "game-in-test", "game-out-test"
+	consumer := kafka.NewTopicConsumerWithGroup(broker.ConsumerGroup(group), group)
+	consumer.AddHandler(inTopic, kafka.GameInTradeHandler)
+	consumer.AddHandler(outTopic, kafka.GameOutTradeHandler)
+	go consumer.ConsumeTopics([]string{inTopic, outTopic})
+
+	gameIn := func(signature, user string) []byte {
+		return []byte(fmt.Sprintf(`{
+			"timestamp": %d,
+			"signature": "%s",
+			"user": "%s",
+			"isBuy": true,
+			"quoteToken": "CUCfqECyNKLe8dzxBQtT8vzHXpDryT72c8NtEeoN7WmS",
+			"baseToken": "So11111111111111111111111111111111111111112",
+			"quoteAmount": "54610438",
+			"baseAmount": "1585960",
+			"decimals": 6,
+			"pointsAmount": "2500000",
+			"feeBaseAmount": "15859"
+		}`, time.Now().Unix(), signature, user))
+	}
+	for _, message := range [][]byte{gameIn("game-in-1", "EYANY4XNWRcx3YBhFygQLo3UAzGnXEWBskZMctyuxyFG"), gameIn("game-in-2", "missing-user")} {
+		if err := kafka.SendMessage(inTopic, message); err != nil {
+			t.Fatalf("Failed to send message: %v", err)
+		}
+	}
+	gameOut := fmt.Sprintf(`{
+		"timestamp": %d,
+		"signature": "game-out-1",
+		"user": "EYANY4XNWRcx3YBhFygQLo3UAzGnXEWBskZMctyuxyFG",
+		"poolAddress": "8nsjiwgZGpqMQ4n3fSWcEdMoQfMaAqxBFTkaGDtzeD4J",
+		"isBuy": false,
+		"isBurn": true,
+		"quoteToken": "CUCfqECyNKLe8dzxBQtT8vzHXpDryT72c8NtEeoN7WmS",
+		"baseToken": "So11111111111111111111111111111111111111112",
+		"quoteAmount": "54610438",
+		"baseAmount": "1585960",
+		"poolQuoteReserve": "18640745631097",
+		"poolBaseReserve": "539997130105",
+		"decimals": 6,
+		"feeQuoteAmount": "1000",
+		"feeBaseAmount": "15859",
+		"buybackFeeBaseAmount": "7000"
+	}`, time.Now().Unix())
+	if err := kafka.SendMessage(outTopic, []byte(gameOut)); err != nil {
+		t.Fatalf("Failed to send message: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, topic := range []string{inTopic, outTopic} {
+		if err := broker.WaitCommitted(ctx, group, topic); err != nil {
+			t.Fatalf("Messages on %s were not committed: %v", topic, err)
+		}
+	}
+	if err := consumer.Shutdown(ctx); err != nil {
+		t.Fatalf("Failed to shutdown consumer: %v", err)
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if len(store.points) != 1 {
+		t.Fatalf("Expected 1 point record, got %d", len(store.points))
+	}
+	record := store.points[0]
+	if record.points != 2500000 || record.amounts[model.PointsAmount] != 2500000 || record.amounts[model.FeeAmount] != 15859 {
+		t.Errorf("Unexpected point record: %+v", record)
+	}
+	if dlq := broker.Messages(kafka.DeadLetterTopic(inTopic)); len(dlq) != 1 {
+		t.Errorf("Expected the game-in trade of an unknown user in the dead letter topic, got %d", len(dlq))
+	}
+
+	if len(store.statistics) != 1 {
+		t.Fatalf("Expected 1 statistics update, got %d", len(store.statistics))
+	}
+	amounts := store.statistics[0]
+	if amounts[model.FeeAmount] != 15859 || amounts[model.BackAmount] != 1000 ||
+		amounts[model.BackSolAmount] != 7000 || amounts[model.BurnAmount] != 1000 {
+		t.Errorf("Unexpected statistics amounts: %v", amounts)
+	}
+	var inTx, outTx *clickhouse.ProxyTransaction
+	for _, tx := range store.proxyTxs {
+		switch tx.TransactionHash {
+		case "game-in-1":
+			inTx = tx
+		case "game-out-1":
+			outTx = tx
+		}
+	}
+	if inTx == nil || inTx.TransactionType != uint8(model.TransactionTypeBuy) || inTx.PointsAmount != 2500000 {
+		t.Errorf("Unexpected game-in proxy transaction: %+v", inTx)
+	}
+	if outTx == nil || outTx.TransactionType != uint8(model.TransactionTypeSell) || outTx.IsBurn != 1 || outTx.PointsAmount == 0 {
+		t.Errorf("Unexpected game-out proxy transaction: %+v", outTx)
+	}
+}
+
+func TestCaptureReplay(t *testing.T) {
+	batchTopic, immediateTopic := "replay-test-batch", "replay-test-immediate"
+	start := time.Now()
+	captured := []kafka.CapturedMessage{
+		{Topic: batchTopic, Offset: 0, Value: "a1", Timestamp: start},
+		{Topic: batchTopic, Offset: 1, Value: "a2", Timestamp: start.Add(time.Second)},
+		{Topic: batchTopic, Offset: 2, Value: "a3", Timestamp: start.Add(3 * time.Second)},
+		{Topic: immediateTopic, Offset: 0, Value: "b1", Timestamp: start.Add(2 * time.Second)},
+		{Topic: "replay-test-unknown", Offset: 0, Value: "c1", Timestamp: start.Add(4 * time.Second)},
+	}
+	path := filepath.Join(t.TempDir(), "capture.jsonl.gz")
+	if err := kafka.WriteCaptureFile(path, captured); err != nil {
+		t.Fatalf("Failed to write capture file: %v", err)
+	}
+
+	var handled []string
+	consumer := kafka.NewTopicConsumerWithGroup(nil, "")
+	consumer.AddBatchHandler(batchTopic, func(topic string, messages []kafka.Message, partition int32, goroutineID uint64) error {
+		batch := ""
+		for _, msg := range messages {
+			batch += string(msg.Value)
+		}
+		handled = append(handled, batch)
+		return nil
+	}, 0, 0, 0)
+	consumer.AddHandler(immediateTopic, func(message []byte, topic string) error {
+		handled = append(handled, string(message))
+		return fmt.Errorf("replay failure")
+	})
+
+	result, err := kafka.ReplayCapture(kafka.ReplayOptions{Consumer: consumer, BatchSize: 2, Sinks: []string{}}, path)
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+
+	if fmt.Sprint(handled) != "[a1a2 b1 a3]" {
+		t.Errorf("Expected [a1a2 b1 a3] in capture time order, got %v", handled)
+	}
+	if result.Messages != 5 || result.Failed != 1 || result.Skipped != 1 {
+		t.Errorf("Unexpected replay result: %+v", result)
+	}
+}
+
 func TestSolBalanceAPI(t *testing.T) {
 	// 定义要请求的 URL
 	url := "http://172.20.8.16:3001/api/v1/sol-balance?address=Huy4cz1yTxS6GrGMN7Q5acQ7ws3PsHsc886i4iS2pump"
@@ -285,3 +801,496 @@ func TestPointTxStatusHandler(t *testing.T) {
 	// 例如，如果模拟交易失败的情况，应该检查用户积分是否被恢复
 	t.Log("Test completed - check logs for processing results")
 }
+
+// swapPayload 返回一条合法的 Raydium swap 消息，mutate 用于构造不合法的变体
+func swapPayload(mutate func(fields map[string]interface{})) []byte {
+	fields := map[string]interface{}{
+		"timestamp":        1735689600,
+		"block":            301364918,
+		"signature":        "schema-test-signature",
+		"poolAddress":      "8nsjiwgZGpqMQ4n3fSWcEdMoQfMaAqxBFTkaGDtzeD4J",
+		"user":             "EYANY4XNWRcx3YBhFygQLo3UAzGnXEWBskZMctyuxyFG",
+		"isBuy":            true,
+		"quoteToken":       "CUCfqECyNKLe8dzxBQtT8vzHXpDryT72c8NtEeoN7WmS",
+		"baseToken":        "So11111111111111111111111111111111111111112",
+		"quoteAmount":      "54610438",
+		"baseAmount":       "1585960",
+		"poolQuoteReserve": "18640745631097",
+		"poolBaseReserve":  "539997130105",
+		"decimals":         6,
+	}
+	if mutate != nil {
+		mutate(fields)
+	}
+	payload, _ := json.Marshal(fields)
+	return payload
+}
+
+func TestValidateMessage(t *testing.T) {
+	tests := []struct {
+		name        string
+		messageType string
+		payload     []byte
+		version     int    // 期望的 SchemaError.Version
+		reason      string // 期望 SchemaError.Reason 包含的内容，为空表示校验通过
+	}{
+		{"valid v1 without version", kafka.MessageTypeRaySwap, swapPayload(nil), 0, ""},
+		{"valid explicit v1", kafka.MessageTypeRaySwap, swapPayload(func(f map[string]interface{}) { f["schemaVersion"] = 1 }), 0, ""},
+		{"unsupported version", kafka.MessageTypeRaySwap, swapPayload(func(f map[string]interface{}) { f["schemaVersion"] = 2 }), 2, "unsupported schema version"},
+		{"invalid version", kafka.MessageTypeRaySwap, swapPayload(func(f map[string]interface{}) { f["schemaVersion"] = "v1" }), 0, "invalid schemaVersion"},
+		{"missing field", kafka.MessageTypeRaySwap, swapPayload(func(f map[string]interface{}) { delete(f, "signature") }), 1, `missing required field "signature"`},
+		{"null field", kafka.MessageTypeRaySwap, swapPayload(func(f map[string]interface{}) { f["poolAddress"] = nil }), 1, `missing required field "poolAddress"`},
+		{"empty string", kafka.MessageTypeRaySwap, swapPayload(func(f map[string]interface{}) { f["user"] = "" }), 1, `field "user" must be a non-empty string`},
+		{"amount as number", kafka.MessageTypeRaySwap, swapPayload(func(f map[string]interface{}) { f["quoteAmount"] = 54610438 }), 1, `field "quoteAmount" must be a numeric string`},
+		{"negative amount", kafka.MessageTypeRaySwap, swapPayload(func(f map[string]interface{}) { f["baseAmount"] = "-1" }), 1, `field "baseAmount" is not a valid unsigned integer`},
+		{"decimal amount", kafka.MessageTypeRaySwap, swapPayload(func(f map[string]interface{}) { f["poolBaseReserve"] = "1.5" }), 1, `field "poolBaseReserve" is not a valid unsigned integer`},
+		{"timestamp as string", kafka.MessageTypeRaySwap, swapPayload(func(f map[string]interface{}) { f["timestamp"] = "1735689600" }), 1, `field "timestamp" must be an integer`},
+		{"bool as string", kafka.MessageTypeRaySwap, swapPayload(func(f map[string]interface{}) { f["isBuy"] = "true" }), 1, `field "isBuy" must be a boolean`},
+		{"not an object", kafka.MessageTypeRaySwap, []byte(`["signature"]`), 0, "payload is not a JSON object"},
+		{"valid point tx status", kafka.MessageTypePointTxStatus, []byte(`{"signature":"sig","userId":1,"points":10,"txType":1}`), 0, ""},
+		{"point tx status missing user", kafka.MessageTypePointTxStatus, []byte(`{"signature":"sig","points":10,"txType":1}`), 1, `missing required field "userId"`},
+		{"message type without schema", kafka.HandlerNameUnknownToken, []byte(`CUCfqECyNKLe8dzxBQtT8vzHXpDryT72c8NtEeoN7WmS`), 0, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := kafka.ValidateMessage(tt.messageType, tt.payload)
+			if tt.reason == "" {
+				if err != nil {
+					t.Fatalf("Expected message to pass validation, got %v", err)
+				}
+				return
+			}
+
+			var schemaErr *kafka.SchemaError
+			if !errors.As(err, &schemaErr) {
+				t.Fatalf("Expected *SchemaError, got %v", err)
+			}
+			if !kafka.IsSchemaError(err) {
+				t.Errorf("IsSchemaError should report %v", err)
+			}
+			if schemaErr.MessageType != tt.messageType || schemaErr.Version != tt.version {
+				t.Errorf("Expected type %s version %d, got %s version %d", tt.messageType, tt.version, schemaErr.MessageType, schemaErr.Version)
+			}
+			if !strings.Contains(schemaErr.Reason, tt.reason) {
+				t.Errorf("Expected reason containing %q, got %q", tt.reason, schemaErr.Reason)
+			}
+		})
+	}
+}
+
+// TestSchemaRejectionQuarantined 未通过校验的消息进入隔离 topic 而不是死信 topic，offset 正常提交
+func TestSchemaRejectionQuarantined(t *testing.T) {
+	broker := kafka.NewMemoryBroker()
+	kafka.SetProducer(broker)
+	defer kafka.SetProducer(nil)
+
+	group, batchTopic, immediateTopic := "schema-test-group", "schema-test-swap", "schema-test-create"
+	consumer := kafka.NewTopicConsumerWithGroup(broker.ConsumerGroup(group), group)
+	kafka.RegisterHandlers(consumer, []kafka.TopicRegistryEntry{
+		{Topic: batchTopic, Handler: kafka.MessageTypeRaySwap, Mode: kafka.HandlerModeBatch, Enabled: true,
+			MaxBatchSize: 1, MinBatchSize: 1, BatchTimeout: time.Minute},
+		{Topic: immediateTopic, Handler: kafka.MessageTypeRayCreate, Mode: kafka.HandlerModeImmediate, Enabled: true},
+	}, true)
+	go consumer.ConsumeTopics([]string{batchTopic, immediateTopic})
+
+	// 批次上限为 1，第二条消息到达时处理第一条，停机时处理第二条
+	invalidSwaps := [][]byte{
+		swapPayload(func(f map[string]interface{}) { f["quoteAmount"] = 1 }),
+		swapPayload(func(f map[string]interface{}) { delete(f, "signature") }),
+	}
+	for _, payload := range invalidSwaps {
+		if err := kafka.SendMessage(batchTopic, payload); err != nil {
+			t.Fatalf("Failed to send message: %v", err)
+		}
+	}
+	if err := kafka.SendMessage(immediateTopic, []byte(`{"signature":"schema-test-create","timestamp":"now"}`)); err != nil {
+		t.Fatalf("Failed to send message: %v", err)
+	}
+
+	waitFor(t, "batch commit", func() bool { return broker.Committed(group, batchTopic) >= 1 })
+	waitFor(t, "immediate commit", func() bool { return broker.Committed(group, immediateTopic) == 1 })
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := consumer.Shutdown(ctx); err != nil {
+		t.Fatalf("Failed to shutdown consumer: %v", err)
+	}
+
+	if committed := broker.Committed(group, batchTopic); committed != 2 {
+		t.Errorf("Expected both swaps committed, got offset %d", committed)
+	}
+	for topic, expected := range map[string]int{batchTopic: 2, immediateTopic: 1} {
+		if dlq := broker.Messages(kafka.DeadLetterTopic(topic)); len(dlq) != 0 {
+			t.Errorf("Expected no dead letters for %s, got %d", topic, len(dlq))
+		}
+		if quarantined := broker.Messages(kafka.QuarantineTopic(topic)); len(quarantined) != expected {
+			t.Errorf("Expected %d quarantined messages for %s, got %d", expected, topic, len(quarantined))
+		}
+	}
+
+	quarantined := broker.Messages(kafka.QuarantineTopic(batchTopic))
+	if len(quarantined) == 0 {
+		return
+	}
+	var record kafka.QuarantineMessage
+	if err := json.Unmarshal(quarantined[0].Value, &record); err != nil {
+		t.Fatalf("Failed to decode quarantine message: %v", err)
+	}
+	if record.Topic != batchTopic || record.Offset != 0 || record.MessageType != kafka.MessageTypeRaySwap ||
+		record.SchemaVersion != 1 || !strings.Contains(record.Reason, "quoteAmount") {
+		t.Errorf("Unexpected quarantine record: %+v", record)
+	}
+	if string(record.Value) != string(invalidSwaps[0]) {
+		t.Errorf("Quarantine record should keep the original payload, got %s", record.Value)
+	}
+}
+
+// writeRegistry 将注册表内容写入临时文件并通过 KAFKA_TOPIC_REGISTRY 指定
+func writeRegistry(t *testing.T, content string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "topic_registry.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write registry: %v", err)
+	}
+	t.Setenv("KAFKA_TOPIC_REGISTRY", path)
+}
+
+func TestLoadTopicRegistry(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		err     string // 期望错误包含的内容，为空表示加载成功
+	}{
+		{
+			name: "valid entries",
+			content: `topics:
+  - topic: registry-test-swap
+    handler: ray_swap
+    mode: batch
+    enabled: true
+    max_batch_size: 200
+    batch_timeout: 200ms
+  - prefix: registry.test.create.
+    handler: ray_create
+    mode: immediate
+    enabled: false`,
+		},
+		{"invalid yaml", "topics: [", "failed to parse topic registry"},
+		{"missing topic", "topics:\n  - handler: ray_create\n    mode: immediate", "prefix or topic is required"},
+		{"unknown handler", "topics:\n  - topic: t\n    handler: ray_swapp\n    mode: batch", `unknown handler "ray_swapp"`},
+		{"unknown mode", "topics:\n  - topic: t\n    handler: ray_create\n    mode: stream", `unknown mode "stream"`},
+		{"immediate handler in batch mode", "topics:\n  - topic: t\n    handler: ray_create\n    mode: batch", `handler "ray_create" does not support batch mode`},
+		{"batch handler in immediate mode", "topics:\n  - topic: t\n    handler: ray_swap\n    mode: immediate", `handler "ray_swap" does not support immediate mode`},
+		{
+			name:    "duplicate topic",
+			content: "topics:\n  - topic: t\n    handler: ray_create\n    mode: immediate\n  - topic: t\n    handler: ray_add_liquidity\n    mode: immediate",
+			err:     "duplicate topic t (also entry 0)",
+		},
+		{
+			name: "prefix and topic resolving to the same name",
+			content: fmt.Sprintf("topics:\n  - prefix: registry.test.create.\n    handler: ray_create\n    mode: immediate\n  - topic: %s\n    handler: ray_create\n    mode: immediate",
+				kafka.TopicRegistryEntry{Prefix: "registry.test.create."}.TopicName()),
+			err: "duplicate topic",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeRegistry(t, tt.content)
+			entries, err := kafka.LoadTopicRegistry()
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Expected error containing %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to load registry: %v", err)
+			}
+			if len(entries) != 2 {
+				t.Fatalf("Expected 2 entries, got %d", len(entries))
+			}
+
+			// 未设置的批量参数使用默认值
+			swap := entries[0]
+			if swap.TopicName() != "registry-test-swap" || swap.MaxBatchSize != 200 || swap.MinBatchSize != 10 || swap.BatchTimeout != 200*time.Millisecond {
+				t.Errorf("Unexpected batch entry: %+v", swap)
+			}
+			if topics := kafka.EnabledTopics(entries); len(topics) != 1 || topics[0] != "registry-test-swap" {
+				t.Errorf("Expected only registry-test-swap enabled, got %v", topics)
+			}
+		})
+	}
+}
+
+// TestDefaultTopicRegistryDisablesPump pump 系列 topic 默认不消费，其余 topic 默认消费
+func TestDefaultTopicRegistryDisablesPump(t *testing.T) {
+	t.Setenv("KAFKA_TOPIC_REGISTRY", "")
+	entries, err := kafka.LoadTopicRegistry()
+	if err != nil {
+		t.Fatalf("Failed to load default registry: %v", err)
+	}
+
+	pumpHandlers := map[string]bool{
+		kafka.MessageTypePumpCreate:    true,
+		kafka.MessageTypePumpTrade:     true,
+		kafka.MessageTypePumpComplete:  true,
+		kafka.MessageTypePumpSetParams: true,
+	}
+	seen := 0
+	for _, entry := range entries {
+		if pumpHandlers[entry.Handler] {
+			seen++
+			if entry.Enabled {
+				t.Errorf("Pump topic %s should be disabled by default", entry.TopicName())
+			}
+		} else if !entry.Enabled {
+			t.Errorf("Topic %s should be enabled by default", entry.TopicName())
+		}
+	}
+	if seen != len(pumpHandlers) {
+		t.Errorf("Expected %d pump topics in the default registry, got %d", len(pumpHandlers), seen)
+	}
+}
+
+// TestTopicRegistryExample 示例注册表可以加载，且与默认注册表的 topic、处理器、模式和开关保持一致
+func TestTopicRegistryExample(t *testing.T) {
+	t.Setenv("KAFKA_TOPIC_REGISTRY", "")
+	defaults, err := kafka.LoadTopicRegistry()
+	if err != nil {
+		t.Fatalf("Failed to load default registry: %v", err)
+	}
+
+	t.Setenv("KAFKA_TOPIC_REGISTRY", filepath.Join("..", "..", "internal", "kafka", "topic_registry.example.yaml"))
+	example, err := kafka.LoadTopicRegistry()
+	if err != nil {
+		t.Fatalf("Failed to load example registry: %v", err)
+	}
+
+	type summary struct {
+		Handler string
+		Mode    string
+		Enabled bool
+	}
+	summarize := func(entries []kafka.TopicRegistryEntry) map[string]summary {
+		result := make(map[string]summary, len(entries))
+		for _, entry := range entries {
+			result[entry.TopicName()] = summary{entry.Handler, entry.Mode, entry.Enabled}
+		}
+		return result
+	}
+
+	expected, got := summarize(defaults), summarize(example)
+	for topic, want := range expected {
+		if got[topic] != want {
+			t.Errorf("Example entry for %s = %+v, default registry has %+v", topic, got[topic], want)
+		}
+	}
+	for topic := range got {
+		if _, ok := expected[topic]; !ok {
+			t.Errorf("Example registers %s, which is not in the default registry", topic)
+		}
+	}
+}
+
+// useMiniredis 将全局 Redis 客户端指向内存 Redis，测试结束后恢复
+func useMiniredis(t *testing.T) *miniredis.Miniredis {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	redis.RedisClient = goredis.NewClient(&goredis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { redis.RedisClient = nil })
+	return mr
+}
+
+// idempotencyTestKey 线上命名空间中测试消息类型的去重 key
+func idempotencyTestKey(dedupID string) string {
+	return constants.RedisKeyPrefixKafkaProcessed + ":idem_test:" + dedupID
+}
+
+func TestIdempotencySkipsDuplicateMessages(t *testing.T) {
+	mr := useMiniredis(t)
+	broker := kafka.NewMemoryBroker()
+	kafka.SetProducer(broker)
+	defer kafka.SetProducer(nil)
+
+	group, topic := "idem-dup-group", "idem-dup-topic"
+	var handled []string
+	consumer := kafka.NewTopicConsumerWithGroup(broker.ConsumerGroup(group), group)
+	consumer.AddHandler(topic, kafka.WithIdempotency("idem_test", func(message []byte, topic string) error {
+		handled = append(handled, string(message))
+		return nil
+	}))
+	go consumer.ConsumeTopics([]string{topic})
+
+	for _, value := range []string{`{"signature":"sig-1","n":1}`, `{"signature":"sig-1","n":2}`, `{"signature":"sig-2"}`} {
+		if err := kafka.SendMessage(topic, []byte(value)); err != nil {
+			t.Fatalf("Failed to send message: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := broker.WaitCommitted(ctx, group, topic); err != nil {
+		t.Fatalf("Messages were not committed: %v", err)
+	}
+	if err := consumer.Shutdown(ctx); err != nil {
+		t.Fatalf("Failed to shutdown consumer: %v", err)
+	}
+
+	if fmt.Sprint(handled) != `[{"signature":"sig-1","n":1} {"signature":"sig-2"}]` {
+		t.Errorf("Expected the redelivered sig-1 to be skipped, handled %v", handled)
+	}
+	// 处理成功后租约替换为保留 KAFKA_IDEMPOTENCY_TTL 的完成标记
+	if value, _ := mr.Get(idempotencyTestKey("sig-1")); value != "done" {
+		t.Errorf("Expected sig-1 marked done, got %q", value)
+	}
+	if ttl := mr.TTL(idempotencyTestKey("sig-1")); ttl != 72*time.Hour {
+		t.Errorf("Expected done marker TTL 72h, got %v", ttl)
+	}
+	stats, err := kafka.GetDuplicateStats()
+	if err != nil || stats["idem_test"] != "1" {
+		t.Errorf("Expected 1 duplicate recorded, got %v (err %v)", stats, err)
+	}
+	if dlq := broker.Messages(kafka.DeadLetterTopic(topic)); len(dlq) != 0 {
+		t.Errorf("Expected no dead letters, got %d", len(dlq))
+	}
+}
+
+func TestIdempotencyReleasesLeaseOnError(t *testing.T) {
+	mr := useMiniredis(t)
+	broker := kafka.NewMemoryBroker()
+	kafka.SetProducer(broker)
+	defer kafka.SetProducer(nil)
+
+	group, topic, batchTopic := "idem-release-group", "idem-release-topic", "idem-release-batch"
+	immediateCalls, batchCalls := 0, 0
+	var batchHandled []string
+	consumer := kafka.NewTopicConsumerWithGroup(broker.ConsumerGroup(group), group)
+	consumer.AddHandler(topic, kafka.WithIdempotency("idem_test", func(message []byte, topic string) error {
+		immediateCalls++
+		if immediateCalls == 1 {
+			return fmt.Errorf("mysql: connection reset")
+		}
+		return nil
+	}))
+	// 批次上限为 1，第一次处理失败，批处理重试时需要能重新获取租约
+	consumer.AddBatchHandler(batchTopic, kafka.WithBatchIdempotency("idem_test", func(topic string, messages []kafka.Message, partition int32, goroutineID uint64) error {
+		batchCalls++
+		if batchCalls == 1 {
+			return fmt.Errorf("mysql: connection reset")
+		}
+		for _, msg := range messages {
+			batchHandled = append(batchHandled, string(msg.Value))
+		}
+		return nil
+	}), 1, 1, time.Minute)
+	go consumer.ConsumeTopics([]string{topic, batchTopic})
+
+	// 失败的消息写入死信并提交，租约释放后同一签名重投递时会再次处理
+	message := []byte(`{"signature":"sig-retry"}`)
+	if err := kafka.SendMessage(topic, message); err != nil {
+		t.Fatalf("Failed to send message: %v", err)
+	}
+	waitFor(t, "dead letter commit", func() bool { return broker.Committed(group, topic) == 1 })
+	if mr.Exists(idempotencyTestKey("sig-retry")) {
+		t.Errorf("Lease should be released after a handler error")
+	}
+	if err := kafka.SendMessage(topic, message); err != nil {
+		t.Fatalf("Failed to send message: %v", err)
+	}
+	waitFor(t, "redelivery commit", func() bool { return broker.Committed(group, topic) == 2 })
+
+	for _, value := range []string{`{"signature":"sig-a"}`, `{"signature":"sig-b"}`} {
+		if err := kafka.SendMessage(batchTopic, []byte(value)); err != nil {
+			t.Fatalf("Failed to send message: %v", err)
+		}
+	}
+	waitFor(t, "batch retry commit", func() bool { return broker.Committed(group, batchTopic) >= 1 })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := consumer.Shutdown(ctx); err != nil {
+		t.Fatalf("Failed to shutdown consumer: %v", err)
+	}
+
+	if immediateCalls != 2 {
+		t.Errorf("Expected the redelivered message to be handled again, got %d calls", immediateCalls)
+	}
+	if value, _ := mr.Get(idempotencyTestKey("sig-retry")); value != "done" {
+		t.Errorf("Expected sig-retry marked done after redelivery, got %q", value)
+	}
+	if dlq := broker.Messages(kafka.DeadLetterTopic(topic)); len(dlq) != 1 {
+		t.Errorf("Expected 1 dead letter for the failed attempt, got %d", len(dlq))
+	}
+
+	if fmt.Sprint(batchHandled) != `[{"signature":"sig-a"} {"signature":"sig-b"}]` {
+		t.Errorf("Expected both batch messages handled after retry, got %v", batchHandled)
+	}
+	if committed := broker.Committed(group, batchTopic); committed != 2 {
+		t.Errorf("Expected batch topic committed to offset 2, got %d", committed)
+	}
+	if dlq := broker.Messages(kafka.DeadLetterTopic(batchTopic)); len(dlq) != 0 {
+		t.Errorf("Expected no batch dead letters, got %d", len(dlq))
+	}
+	stats, _ := kafka.GetDuplicateStats()
+	if len(stats) != 0 {
+		t.Errorf("Retries must not be counted as duplicates, got %v", stats)
+	}
+}
+
+func TestReplayUsesIsolatedIdempotencyScope(t *testing.T) {
+	mr := useMiniredis(t)
+	// 线上消费已处理过 sig-1
+	mr.Set(idempotencyTestKey("sig-1"), "done")
+
+	topic := "idem-replay-topic"
+	start := time.Now()
+	path := filepath.Join(t.TempDir(), "capture.jsonl.gz")
+	if err := kafka.WriteCaptureFile(path, []kafka.CapturedMessage{
+		{Topic: topic, Offset: 0, Value: `{"signature":"sig-1"}`, Timestamp: start},
+		{Topic: topic, Offset: 1, Value: `{"signature":"sig-1"}`, Timestamp: start.Add(time.Second)},
+		{Topic: topic, Offset: 2, Value: `{"signature":"sig-2"}`, Timestamp: start.Add(2 * time.Second)},
+	}); err != nil {
+		t.Fatalf("Failed to write capture file: %v", err)
+	}
+
+	handled := 0
+	consumer := kafka.NewTopicConsumerWithGroup(nil, "")
+	consumer.AddHandler(topic, kafka.WithIdempotency("idem_test", func(message []byte, topic string) error {
+		handled++
+		return nil
+	}))
+
+	// 每次回放使用新的命名空间，同一文件可重复回放，文件内的重复消息只处理一次
+	for run := 1; run <= 2; run++ {
+		result, err := kafka.ReplayCapture(kafka.ReplayOptions{Consumer: consumer, Sinks: []string{}}, path)
+		if err != nil {
+			t.Fatalf("Replay %d failed: %v", run, err)
+		}
+		if result.Duplicates != 1 || result.Failed != 0 {
+			t.Errorf("Replay %d: expected 1 duplicate and no failures, got %+v", run, result)
+		}
+		if handled != 2*run {
+			t.Errorf("Replay %d: expected %d messages handled in total, got %d", run, 2*run, handled)
+		}
+	}
+
+	if mr.Exists(constants.RedisKeyKafkaDuplicateStats) {
+		t.Errorf("Replay duplicates must not be counted in the live duplicate stats")
+	}
+	if ttl := mr.TTL(idempotencyTestKey("sig-1")); ttl != 0 {
+		t.Errorf("Live done marker should be left untouched, got TTL %v", ttl)
+	}
+	replayKeys := 0
+	for _, key := range mr.Keys() {
+		if strings.HasPrefix(key, constants.RedisKeyPrefixKafkaProcessed+":replay:") {
+			replayKeys++
+			if ttl := mr.TTL(key); ttl != 24*time.Hour {
+				t.Errorf("Replay marker %s should expire after 24h, got %v", key, ttl)
+			}
+		}
+	}
+	if replayKeys != 4 {
+		t.Errorf("Expected 4 replay markers (2 signatures x 2 runs), got %d", replayKeys)
+	}
+}
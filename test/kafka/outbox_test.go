@@ -0,0 +1,249 @@
+package kafka_test
+
+import (
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"game-fun-be/internal/model"
+	"game-fun-be/internal/service"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// useSQLMock 将 model.DB 替换为 sqlmock 连接，测试结束后恢复并校验所有预期语句均已执行
+func useSQLMock(t *testing.T) sqlmock.Sqlmock {
+	t.Helper()
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	db, err := gorm.Open(mysql.New(mysql.Config{Conn: sqlDB, SkipInitializeWithVersion: true}),
+		&gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("Failed to open gorm with sqlmock: %v", err)
+	}
+
+	prev := model.DB
+	model.DB = db
+	t.Cleanup(func() {
+		model.DB = prev
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("Unmet SQL expectations: %v", err)
+		}
+		sqlDB.Close()
+	})
+	return mock
+}
+
+func TestKafkaOutboxRepoStateTransitions(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		args     []driver.Value
+		affected int64
+		run      func(repo *model.KafkaOutboxRepo) (bool, error)
+		want     bool
+	}{
+		{
+			name:     "claim due message",
+			query:    "UPDATE `kafka_outbox` SET `attempts`=attempts + 1,`available_at`=?,`update_time`=? WHERE id = ? AND status = ? AND available_at <= ?",
+			args:     []driver.Value{sqlmock.AnyArg(), sqlmock.AnyArg(), uint64(7), int8(model.OutboxStatusPending), sqlmock.AnyArg()},
+			affected: 1,
+			run: func(repo *model.KafkaOutboxRepo) (bool, error) {
+				return repo.Claim(7, 30*time.Second)
+			},
+			want: true,
+		},
+		{
+			name:     "claim already taken",
+			query:    "UPDATE `kafka_outbox` SET `attempts`=attempts + 1,`available_at`=?,`update_time`=? WHERE id = ? AND status = ? AND available_at <= ?",
+			args:     []driver.Value{sqlmock.AnyArg(), sqlmock.AnyArg(), uint64(7), int8(model.OutboxStatusPending), sqlmock.AnyArg()},
+			affected: 0,
+			run: func(repo *model.KafkaOutboxRepo) (bool, error) {
+				return repo.Claim(7, 30*time.Second)
+			},
+			want: false,
+		},
+		{
+			name:     "release pending message",
+			query:    "UPDATE `kafka_outbox` SET `available_at`=?,`update_time`=? WHERE id = ? AND status = ?",
+			args:     []driver.Value{sqlmock.AnyArg(), sqlmock.AnyArg(), uint64(7), int8(model.OutboxStatusPending)},
+			affected: 1,
+			run: func(repo *model.KafkaOutboxRepo) (bool, error) {
+				return true, repo.Release(7)
+			},
+			want: true,
+		},
+		{
+			name:     "cancel pending message",
+			query:    "UPDATE `kafka_outbox` SET `status`=?,`update_time`=? WHERE id = ? AND status = ?",
+			args:     []driver.Value{int8(model.OutboxStatusCancelled), sqlmock.AnyArg(), uint64(7), int8(model.OutboxStatusPending)},
+			affected: 1,
+			run: func(repo *model.KafkaOutboxRepo) (bool, error) {
+				return repo.Cancel(7)
+			},
+			want: true,
+		},
+		{
+			name:     "cancel already sent message",
+			query:    "UPDATE `kafka_outbox` SET `status`=?,`update_time`=? WHERE id = ? AND status = ?",
+			args:     []driver.Value{int8(model.OutboxStatusCancelled), sqlmock.AnyArg(), uint64(7), int8(model.OutboxStatusPending)},
+			affected: 0,
+			run: func(repo *model.KafkaOutboxRepo) (bool, error) {
+				return repo.Cancel(7)
+			},
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sqlDB, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("Failed to create sqlmock: %v", err)
+			}
+			defer sqlDB.Close()
+			db, err := gorm.Open(mysql.New(mysql.Config{Conn: sqlDB, SkipInitializeWithVersion: true}),
+				&gorm.Config{Logger: logger.Default.LogMode(logger.Silent), SkipDefaultTransaction: true})
+			if err != nil {
+				t.Fatalf("Failed to open gorm with sqlmock: %v", err)
+			}
+
+			mock.ExpectExec(tt.query).WithArgs(tt.args...).WillReturnResult(sqlmock.NewResult(0, tt.affected))
+
+			got, err := tt.run(model.NewKafkaOutboxRepo().WithTx(db))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Unmet SQL expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestDeductPointsWithOutboxCommitsTogether(t *testing.T) {
+	mock := useSQLMock(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE user_info").
+		WithArgs(uint64(100), sqlmock.AnyArg(), uint64(1), uint64(100)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO `kafka_outbox`").WillReturnResult(sqlmock.NewResult(42, 1))
+	mock.ExpectCommit()
+
+	outbox, err := service.DeductPointsWithOutbox(1, 100, "sig-commit")
+	if err != nil {
+		t.Fatalf("DeductPointsWithOutbox failed: %v", err)
+	}
+	if outbox.ID != 42 {
+		t.Errorf("Expected outbox id 42, got %d", outbox.ID)
+	}
+	if outbox.MessageKey != "sig-commit" || !strings.Contains(outbox.Payload, `"sig-commit"`) {
+		t.Errorf("Expected outbox message keyed by signature, got key %q payload %s", outbox.MessageKey, outbox.Payload)
+	}
+	if !outbox.AvailableAt.After(time.Now()) {
+		t.Errorf("Expected outbox message to be held until the transaction is sent, available at %s", outbox.AvailableAt)
+	}
+}
+
+func TestDeductPointsWithOutboxRollsBackTogether(t *testing.T) {
+	insertErr := errors.New("insert outbox failed")
+	tests := []struct {
+		name    string
+		expect  func(mock sqlmock.Sqlmock)
+		wantErr error
+	}{
+		{
+			name: "insufficient points writes no outbox row",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("UPDATE user_info").WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			wantErr: service.ErrPointsDeductConflict,
+		},
+		{
+			name: "outbox insert failure restores points",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("UPDATE user_info").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("INSERT INTO `kafka_outbox`").WillReturnError(insertErr)
+			},
+			wantErr: insertErr,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := useSQLMock(t)
+			mock.ExpectBegin()
+			tt.expect(mock)
+			mock.ExpectRollback()
+
+			outbox, err := service.DeductPointsWithOutbox(1, 100, "sig-rollback")
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if outbox != nil {
+				t.Errorf("Expected no outbox message on rollback, got %+v", outbox)
+			}
+		})
+	}
+}
+
+func TestRollbackPointsDeductionCancelsOutboxAndRefunds(t *testing.T) {
+	mock := useSQLMock(t)
+
+	// 取消状态检测消息
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE `kafka_outbox` SET `status`=\\?").
+		WithArgs(int8(model.OutboxStatusCancelled), sqlmock.AnyArg(), uint64(42), int8(model.OutboxStatusPending)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	// SettlePointTx(Failed) 在一个事务中退还积分并记录退款
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT `id`,`available_points` FROM `user_info` .* FOR UPDATE").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "available_points"}).AddRow(1, 900))
+	mock.ExpectQuery("SELECT \\* FROM `point_records`").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectExec("UPDATE `user_info` SET `available_points`=available_points \\+ \\?").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO `point_records`").WillReturnResult(sqlmock.NewResult(5, 1))
+	mock.ExpectExec("UPDATE `point_records` SET").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := service.RollbackPointsDeduction(1, 100, "sig-failed", 42); err != nil {
+		t.Fatalf("RollbackPointsDeduction failed: %v", err)
+	}
+}
+
+func TestRollbackPointsDeductionRefundIsAtomic(t *testing.T) {
+	mock := useSQLMock(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE `kafka_outbox` SET `status`=\\?").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	// 写入退款记录失败时，已执行的积分退还必须一起回滚
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT `id`,`available_points` FROM `user_info` .* FOR UPDATE").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "available_points"}).AddRow(1, 900))
+	mock.ExpectQuery("SELECT \\* FROM `point_records`").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectExec("UPDATE `user_info` SET `available_points`=available_points \\+ \\?").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO `point_records`").WillReturnError(errors.New("insert refund failed"))
+	mock.ExpectRollback()
+
+	if err := service.RollbackPointsDeduction(1, 100, "sig-failed", 42); err == nil {
+		t.Fatal("Expected RollbackPointsDeduction to fail when the refund record cannot be written")
+	}
+}
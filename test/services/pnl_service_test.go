@@ -0,0 +1,98 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"game-fun-be/internal/clickhouse"
+	"game-fun-be/internal/model"
+	"game-fun-be/internal/service"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCalculateTokenPnL(t *testing.T) {
+	const decimals = 6
+	start := time.Unix(1735689600, 0)
+	trade := func(i int, txType model.TransactionType, tokens int64, usd string) clickhouse.WalletTrade {
+		return clickhouse.WalletTrade{
+			TokenAddress:         "CUCfqECyNKLe8dzxBQtT8vzHXpDryT72c8NtEeoN7WmS",
+			TransactionType:      uint8(txType),
+			QuoteTokenAmount:     uint64(tokens * 1000000),
+			TransactionAmountUSD: decimal.RequireFromString(usd),
+			TransactionTime:      start.Add(time.Duration(i) * time.Minute),
+		}
+	}
+	buy := func(i int, tokens int64, usd string) clickhouse.WalletTrade {
+		return trade(i, model.TransactionTypeBuy, tokens, usd)
+	}
+	sell := func(i int, tokens int64, usd string) clickhouse.WalletTrade {
+		return trade(i, model.TransactionTypeSell, tokens, usd)
+	}
+
+	tests := []struct {
+		name       string
+		trades     []clickhouse.WalletTrade
+		price      string
+		balance    string
+		costBasis  string
+		avgCost    string
+		realized   string
+		unrealized string
+		roi        decimal.Decimal
+	}{
+		{
+			name:       "partial sell releases cost at the average price",
+			trades:     []clickhouse.WalletTrade{buy(0, 100, "10"), sell(1, 40, "8")},
+			price:      "0.2",
+			balance:    "60",
+			costBasis:  "6",
+			avgCost:    "0.1",
+			realized:   "4",
+			unrealized: "6",
+			roi:        decimal.NewFromInt(1),
+		},
+		{
+			name:       "sell exceeding balance counts the excess at zero cost",
+			trades:     []clickhouse.WalletTrade{buy(0, 100, "10"), sell(1, 150, "30")},
+			price:      "0.2",
+			balance:    "0",
+			costBasis:  "0",
+			avgCost:    "0",
+			realized:   "20",
+			unrealized: "0",
+			roi:        decimal.NewFromInt(2),
+		},
+		{
+			name:       "full exit then re-entry starts a new cost basis",
+			trades:     []clickhouse.WalletTrade{buy(0, 100, "10"), sell(1, 100, "15"), buy(2, 50, "20")},
+			price:      "0.5",
+			balance:    "50",
+			costBasis:  "20",
+			avgCost:    "0.4",
+			realized:   "5",
+			unrealized: "5",
+			roi:        decimal.NewFromInt(10).Div(decimal.NewFromInt(30)),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pnl := service.CalculateTokenPnL(tt.trades, decimals, decimal.RequireFromString(tt.price))
+
+			assertDecimal(t, "balance", tt.balance, pnl.Balance)
+			assertDecimal(t, "cost basis", tt.costBasis, pnl.CostBasis)
+			assertDecimal(t, "avg cost", tt.avgCost, pnl.AvgCost)
+			assertDecimal(t, "realized", tt.realized, pnl.RealizedPnL)
+			assertDecimal(t, "unrealized", tt.unrealized, pnl.UnrealizedPnL)
+			assert.True(t, tt.roi.Equal(pnl.ROI), "roi: expected %s, got %s", tt.roi, pnl.ROI)
+			assert.Equal(t, tt.trades[len(tt.trades)-1].TransactionTime, pnl.LastTradeTime)
+		})
+	}
+}
+
+func assertDecimal(t *testing.T, field, expected string, actual decimal.Decimal) {
+	t.Helper()
+	assert.True(t, decimal.RequireFromString(expected).Equal(actual), "%s: expected %s, got %s", field, expected, actual)
+}